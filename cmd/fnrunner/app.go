@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+
+	"github.com/fnrun/fnrun/run"
+	"github.com/fnrun/fnrun/run/admin"
+	"github.com/fnrun/fnrun/run/config"
+	"github.com/fnrun/fnrun/run/supervisor"
+	"github.com/fnrun/fnrun/run/tracing"
+)
+
+// The top-level keys of fnrun.yaml that configure the admin server and the
+// tracing provider.
+const (
+	adminKey   = "admin"
+	tracingKey = "tracing"
+)
+
+// app is the root of fnrun.yaml: a supervisor for the pipelines, an optional
+// admin server, and an optional tracing provider.
+type app struct {
+	supervisor *supervisor.Supervisor
+	admin      *admin.Server
+	tracing    *tracing.Provider
+	config     map[string]interface{}
+}
+
+func (a *app) RequiresConfig() bool {
+	return true
+}
+
+// ConfigureMap configures the admin server and tracing provider from their
+// keys, if they are present, and the supervisor from the remaining keys.
+func (a *app) ConfigureMap(configMap map[string]interface{}) error {
+	var errs []error
+
+	if tracingConfig, exists := configMap[tracingKey]; exists {
+		a.tracing = tracing.NewProvider()
+		if err := config.Configure(a.tracing, tracingConfig); err != nil {
+			errs = append(errs, config.WithPath(tracingKey, err))
+		}
+	}
+
+	if adminConfig, exists := configMap[adminKey]; exists {
+		a.admin = admin.New(a.supervisor)
+		if err := config.Configure(a.admin, adminConfig); err != nil {
+			errs = append(errs, config.WithPath(adminKey, err))
+		}
+		a.admin.SetConfig(configMap)
+	}
+
+	if err := config.Configure(a.supervisor, pipelinesConfig(configMap)); err != nil {
+		errs = append(errs, err)
+	}
+
+	a.config = configMap
+	return errors.Join(errs...)
+}
+
+// Describe describes fnrun.yaml.
+func (a *app) Describe() *config.Schema {
+	root := a.supervisor.Describe()
+	root.Properties[adminKey] = admin.New(a.supervisor).Describe()
+	root.Properties[tracingKey] = tracing.NewProvider().Describe()
+	return root
+}
+
+// Start starts the tracing provider and admin server, if they are configured.
+// The returned error names the one that failed to start. If the admin server
+// fails to start, the tracing provider is closed again.
+func (a *app) Start(ctx context.Context) error {
+	if a.tracing != nil {
+		if err := a.tracing.Start(ctx); err != nil {
+			return fmt.Errorf("starting tracing provider: %w", err)
+		}
+	}
+	if a.admin != nil {
+		if err := a.admin.Start(ctx); err != nil {
+			err = fmt.Errorf("starting admin server: %w", err)
+			if a.tracing != nil {
+				err = errors.Join(err, a.tracing.Close())
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Close stops the admin server and flushes the tracing provider, if they are
+// configured.
+func (a *app) Close() error {
+	var errs []error
+	if a.admin != nil {
+		errs = append(errs, a.admin.Close())
+	}
+	if a.tracing != nil {
+		errs = append(errs, a.tracing.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Reload reloads the supervisor from configMap. Changes to the admin server and
+// tracing provider are applied when fnrunner restarts.
+func (a *app) Reload(ctx context.Context, configMap map[string]interface{}) error {
+	if err := a.supervisor.Reload(ctx, pipelinesConfig(configMap)); err != nil {
+		return err
+	}
+
+	if !reflect.DeepEqual(a.config[adminKey], configMap[adminKey]) {
+		log.Println("Admin configuration changed; it will be applied when fnrunner restarts")
+	}
+	if !reflect.DeepEqual(a.config[tracingKey], configMap[tracingKey]) {
+		log.Println("Tracing configuration changed; it will be applied when fnrunner restarts")
+	}
+
+	a.config = configMap
+	if a.admin != nil {
+		a.admin.SetConfig(configMap)
+	}
+	return nil
+}
+
+// pipelinesConfig returns configMap without the keys that are not part of the
+// supervisor's configuration.
+func pipelinesConfig(configMap map[string]interface{}) map[string]interface{} {
+	pipelines := make(map[string]interface{}, len(configMap))
+	for key, value := range configMap {
+		if key != adminKey && key != tracingKey {
+			pipelines[key] = value
+		}
+	}
+	return pipelines
+}
+
+func newApp(registry run.Registry, policy supervisor.RestartPolicy) *app {
+	return &app{
+		supervisor: supervisor.New(registry, policy),
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/fnrun/fnrun/run/config"
+	"gopkg.in/yaml.v3"
+)
+
+// configFilePath returns the path of the configuration file, preferring the
+// CONFIG_FILE environment variable over the value of the -f flag.
+func configFilePath(flagValue string) string {
+	if envFilePath := os.Getenv("CONFIG_FILE"); envFilePath != "" {
+		return envFilePath
+	}
+	return flagValue
+}
+
+// loadConfig reads the YAML configuration file at filePath after expanding any
+// environment variables it references.
+func loadConfig(filePath string) (map[string]interface{}, error) {
+	configBytes, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseConfig(configBytes)
+}
+
+// parseConfig parses the contents of a YAML configuration file after expanding
+// any environment variables it references.
+func parseConfig(configBytes []byte) (map[string]interface{}, error) {
+	configStr := os.ExpandEnv(string(configBytes))
+
+	var configMap map[string]interface{}
+	if err := yaml.Unmarshal([]byte(configStr), &configMap); err != nil {
+		return nil, err
+	}
+
+	return configMap, nil
+}
+
+// printErrors writes each configuration error contained in err on its own
+// line.
+func printErrors(w io.Writer, err error) {
+	for _, e := range config.Errors(err) {
+		fmt.Fprintf(w, "  %v\n", e)
+	}
+}
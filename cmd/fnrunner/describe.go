@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fnrun/fnrun/run/config"
+	"github.com/fnrun/fnrun/run/schema"
+)
+
+// list prints the key and a summary of every source, middleware, and fn that
+// ships with fnrunner.
+func list(args []string) int {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	flags.Parse(args)
+
+	registry := newRegistry()
+	groups := []struct {
+		title string
+		keys  []string
+	}{
+		{"Sources", registry.SourceKeys()},
+		{"Middleware", registry.MiddlewareKeys()},
+		{"Fns", registry.FnKeys()},
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for i, group := range groups {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s:\n", group.title)
+		for _, key := range group.keys {
+			s, _ := schema.Describe(registry, key)
+			fmt.Fprintf(w, "  %s\t%s\n", key, summary(s.Description))
+		}
+	}
+	w.Flush()
+
+	return exitOK
+}
+
+// summary returns the first sentence of description.
+func summary(description string) string {
+	if i := strings.Index(description, ". "); i >= 0 {
+		return description[:i+1]
+	}
+	return description
+}
+
+// describe prints the JSON Schema of the component registered under the key
+// given in args. If no key is given, describe prints a JSON Schema document
+// for fnrun.yaml that editors can use to validate configuration files.
+func describe(args []string) int {
+	flags := flag.NewFlagSet("describe", flag.ExitOnError)
+	flags.Parse(args)
+
+	registry := newRegistry()
+
+	var s *config.Schema
+	switch flags.NArg() {
+	case 0:
+		root := newApp(registry, defaultRestartPolicy).Describe()
+		s = schema.Document(registry, root)
+	case 1:
+		var exists bool
+		s, exists = schema.Describe(registry, flags.Arg(0))
+		if !exists {
+			fmt.Fprintf(os.Stderr, "no source, middleware, or fn is registered for key %q\n", flags.Arg(0))
+			return exitError
+		}
+	default:
+		fmt.Fprintln(os.Stderr, "describe accepts at most one key")
+		return exitError
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(s); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return exitError
+	}
+
+	return exitOK
+}
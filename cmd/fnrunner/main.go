@@ -2,110 +2,173 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/fnrun/fnrun/run"
 	"github.com/fnrun/fnrun/run/config"
-	"github.com/fnrun/fnrun/run/fn/cli"
-	httpfn "github.com/fnrun/fnrun/run/fn/http"
-	"github.com/fnrun/fnrun/run/fn/identity"
-	fnloader "github.com/fnrun/fnrun/run/fn/loader"
-	"github.com/fnrun/fnrun/run/fn/pool"
-	"github.com/fnrun/fnrun/run/middleware/circuitbreaker"
-	"github.com/fnrun/fnrun/run/middleware/debug"
-	"github.com/fnrun/fnrun/run/middleware/healthcheck"
-	"github.com/fnrun/fnrun/run/middleware/jq"
-	"github.com/fnrun/fnrun/run/middleware/json"
-	kafkamiddleware "github.com/fnrun/fnrun/run/middleware/kafka"
-	"github.com/fnrun/fnrun/run/middleware/key"
-	"github.com/fnrun/fnrun/run/middleware/pipeline"
-	"github.com/fnrun/fnrun/run/middleware/ratelimiter"
-	"github.com/fnrun/fnrun/run/middleware/tap"
-	"github.com/fnrun/fnrun/run/middleware/timeout"
-	"github.com/fnrun/fnrun/run/runner"
-	"github.com/fnrun/fnrun/run/source/azure/servicebus"
-	"github.com/fnrun/fnrun/run/source/cron"
-	"github.com/fnrun/fnrun/run/source/http"
-	"github.com/fnrun/fnrun/run/source/kafka"
-	"github.com/fnrun/fnrun/run/source/lambda"
-	sourceloader "github.com/fnrun/fnrun/run/source/loader"
-	"github.com/fnrun/fnrun/run/source/sqs"
-	"gopkg.in/yaml.v3"
+	"github.com/fnrun/fnrun/run/supervisor"
 )
 
+// Exit codes returned by fnrunner. A forced exit caused by a second signal
+// exits with 128 plus the signal number, following shell conventions.
+const (
+	exitOK           = 0
+	exitError        = 1
+	exitDrainTimeout = 3
+)
+
+func signalExitCode(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return exitError
+}
+
+// awaitShutdown waits for the supervisor, which sends the error it returns on
+// done, and returns the exit code of fnrunner. The first SIGINT or SIGTERM
+// received on signals calls cancel, after which in-flight inputs have up to
+// drainTimeout to drain, or unlimited time if it is 0. A second signal ends the
+// wait at once, and forced reports that the process should exit without
+// closing its components.
+func awaitShutdown(done <-chan error, signals <-chan os.Signal, cancel context.CancelFunc, drainTimeout time.Duration) (code int, forced bool) {
+	var err error
+	select {
+	case err = <-done:
+	case sig := <-signals:
+		log.Printf("Received %s, shutting down...\n", sig)
+		cancel()
+
+		var deadline <-chan time.Time
+		if drainTimeout > 0 {
+			deadline = time.After(drainTimeout)
+		}
+
+		select {
+		case err = <-done:
+		case <-deadline:
+			log.Printf("In-flight inputs did not drain within %s\n", drainTimeout.String())
+			return exitDrainTimeout, false
+		case sig := <-signals:
+			log.Printf("Received %s during shutdown, forcing exit\n", sig)
+			return signalExitCode(sig), true
+		}
+	}
+
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Printf("Received error: %+v\n", err)
+		return exitError, false
+	}
+
+	log.Println("Runner stopped")
+	return exitOK, false
+}
+
+// defaultRestartPolicy is the restart policy used by pipelines when it is not
+// overridden by flags or configuration.
+var defaultRestartPolicy = supervisor.RestartPolicy{
+	Restart:     true,
+	RestartWait: 10 * time.Second,
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage:\n")
+	fmt.Fprintf(out, "  %s [flags]           run the configured pipelines\n", os.Args[0])
+	fmt.Fprintf(out, "  %s validate [flags]  check the configuration without running it\n", os.Args[0])
+	fmt.Fprintf(out, "  %s list              list the available sources, middleware, and fns\n", os.Args[0])
+	fmt.Fprintf(out, "  %s describe [key]    print the JSON Schema of a component, or of fnrun.yaml if no key is given\n\n", os.Args[0])
+	fmt.Fprintf(out, "Flags:\n")
+	flag.PrintDefaults()
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "validate":
+			os.Exit(validate(os.Args[2:]))
+		case "list":
+			os.Exit(list(os.Args[2:]))
+		case "describe":
+			os.Exit(describe(os.Args[2:]))
+		}
+	}
+
+	os.Exit(serve(os.Args[1:]))
+}
+
+func serve(args []string) int {
 	var filePath string
 	var autoRestart bool
 	var restartWait time.Duration
+	var drainTimeout time.Duration
+	var watchInterval time.Duration
 	flag.StringVar(&filePath, "f", "fnrun.yaml", "path to configuration yaml file")
-	flag.BoolVar(&autoRestart, "restart", true, "indication of whether source should automatically restart")
-	flag.DurationVar(&restartWait, "restart-wait", 10*time.Second, "the amount of time to wait before automatically restarting")
-	flag.Parse()
+	flag.BoolVar(&autoRestart, "restart", defaultRestartPolicy.Restart, "indication of whether source should automatically restart")
+	flag.DurationVar(&restartWait, "restart-wait", defaultRestartPolicy.RestartWait, "the amount of time to wait before automatically restarting")
+	flag.DurationVar(&drainTimeout, "drain-timeout", 30*time.Second, "the maximum amount of time to wait for in-flight inputs after a shutdown signal (0 waits indefinitely)")
+	flag.DurationVar(&watchInterval, "watch", 0, "the interval at which the configuration file is checked for changes to reload (0 disables watching; SIGHUP always reloads)")
+	flag.Usage = usage
+	flag.CommandLine.Parse(args)
 
-	if envFilePath := os.Getenv("CONFIG_FILE"); envFilePath != "" {
-		filePath = envFilePath
+	filePath = configFilePath(filePath)
+	configBytes, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		log.Printf("Error loading configuration: %+v\n", err)
+		return exitError
+	}
+	configMap, err := parseConfig(configBytes)
+	if err != nil {
+		log.Printf("Error loading configuration: %+v\n", err)
+		return exitError
 	}
 
-	registry := run.NewRegistry()
-
-	registry.RegisterFn("fnrun.fn/cli", cli.New)
-	registry.RegisterFn("fnrun.fn/http", httpfn.New)
-	registry.RegisterFn("fnrun.fn/identity", identity.New)
-	registry.RegisterFnWithRegistry("fnrun.fn/pool", pool.New)
-	registry.RegisterFnWithRegistry("fn", fnloader.New)
-
-	registry.RegisterMiddleware("fnrun.middleware/circuitbreaker", circuitbreaker.New)
-	registry.RegisterMiddleware("fnrun.middleware/debug", debug.New)
-	registry.RegisterMiddleware("fnrun.middleware/healthcheck", healthcheck.New)
-	registry.RegisterMiddleware("fnrun.middleware/jq", jq.New)
-	registry.RegisterMiddleware("fnrun.middleware/json", json.New)
-	registry.RegisterMiddleware("fnrun.middleware/kafka", kafkamiddleware.New)
-	registry.RegisterMiddleware("fnrun.middleware/key", key.New)
-	registry.RegisterMiddleware("fnrun.middleware/ratelimiter", ratelimiter.New)
-	registry.RegisterMiddleware("fnrun.middleware/tap", tap.New)
-	registry.RegisterMiddleware("fnrun.middleware/timeout", timeout.New)
-	registry.RegisterMiddlewareWithRegistry("middleware", pipeline.NewWithRegistry)
-
-	registry.RegisterSource("fnrun.source/azure/servicebus", servicebus.New)
-	registry.RegisterSource("fnrun.source/cron", cron.New)
-	registry.RegisterSource("fnrun.source/http", http.New)
-	registry.RegisterSource("fnrun.source/kafka", kafka.New)
-	registry.RegisterSource("fnrun.source/lambda", lambda.New)
-	registry.RegisterSource("fnrun.source/sqs", sqs.New)
-	registry.RegisterSourceWithRegistry("source", sourceloader.New)
-
-	configBytes, err := ioutil.ReadFile(filePath)
+	app := newApp(newRegistry(), supervisor.RestartPolicy{
+		Restart:     autoRestart,
+		RestartWait: restartWait,
+	})
+	err = config.Configure(app, configMap)
 	if err != nil {
-		panic(err)
+		log.Println("Invalid configuration:")
+		printErrors(log.Writer(), err)
+		return exitError
 	}
 
-	configStr := os.ExpandEnv(string(configBytes))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
 
-	var configMap map[string]interface{}
-	err = yaml.Unmarshal([]byte(configStr), &configMap)
-	if err != nil {
-		panic(err)
+	if err := app.Start(ctx); err != nil {
+		log.Printf("Error starting fnrunner: %+v\n", err)
+		return exitError
 	}
+	defer app.Close()
 
-	runner := runner.New(registry)
-	err = config.Configure(runner, configMap)
-	if err != nil {
-		panic(err)
+	reloader := &reloader{
+		app:      app,
+		filePath: filePath,
+		contents: configBytes,
 	}
+	go reloader.watch(ctx, watchInterval)
 
+	done := make(chan error, 1)
 	log.Println("Running fnrun runner...")
-	for {
-		err = runner.Run(context.Background())
-		if !autoRestart {
-			panic(err)
-		}
-		log.Printf("Received error: %+v\n", err)
-		log.Printf("Restarting runner in %s\n", restartWait.String())
-		<-time.After(restartWait)
-		log.Println("Restarting runner...")
+	go func() {
+		done <- app.supervisor.Run(ctx)
+	}()
+
+	code, forced := awaitShutdown(done, signals, cancel, drainTimeout)
+	if forced {
+		// Closing the components could block on the inputs that are still in
+		// flight.
+		os.Exit(code)
 	}
+	return code
 }
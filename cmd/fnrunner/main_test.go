@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestAwaitShutdown(t *testing.T) {
+	tests := []struct {
+		name         string
+		signals      []os.Signal
+		err          error
+		drainTimeout time.Duration
+		wantCode     int
+		wantForced   bool
+	}{
+		{name: "supervisor stops", wantCode: exitOK},
+		{name: "supervisor fails", err: errors.New("failed"), wantCode: exitError},
+		{name: "signal drains", signals: []os.Signal{syscall.SIGTERM}, err: context.Canceled, drainTimeout: time.Second, wantCode: exitOK},
+		{name: "second signal", signals: []os.Signal{syscall.SIGTERM, syscall.SIGINT}, drainTimeout: time.Minute, wantCode: 128 + int(syscall.SIGINT), wantForced: true},
+		{name: "drain timeout", signals: []os.Signal{syscall.SIGTERM}, drainTimeout: 10 * time.Millisecond, wantCode: exitDrainTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signals := make(chan os.Signal, 2)
+			done := make(chan error, 1)
+			for _, sig := range tt.signals {
+				signals <- sig
+			}
+
+			// Without signals, the supervisor stops on its own. Otherwise, it
+			// stops when it is cancelled if the test gives it an error.
+			if len(tt.signals) == 0 {
+				done <- tt.err
+			}
+			cancelled := false
+			cancel := func() {
+				cancelled = true
+				if tt.err != nil {
+					done <- tt.err
+				}
+			}
+
+			code, forced := awaitShutdown(done, signals, cancel, tt.drainTimeout)
+			if code != tt.wantCode || forced != tt.wantForced {
+				t.Errorf("unexpected result: want %d and forced %t, got %d and forced %t", tt.wantCode, tt.wantForced, code, forced)
+			}
+			if cancelled != (len(tt.signals) > 0) {
+				t.Errorf("unexpected cancellation: want %t, got %t", len(tt.signals) > 0, cancelled)
+			}
+		})
+	}
+}
+
+func TestAwaitShutdown_noDrainTimeout(t *testing.T) {
+	signals := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	signals <- syscall.SIGTERM
+
+	resultCh := make(chan int, 1)
+	go func() {
+		code, _ := awaitShutdown(done, signals, func() {}, 0)
+		resultCh <- code
+	}()
+
+	select {
+	case code := <-resultCh:
+		t.Fatalf("expected awaitShutdown to wait for the supervisor but it returned %d", code)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	done <- context.Canceled
+	if code := <-resultCh; code != exitOK {
+		t.Errorf("unexpected exit code: want %d, got %d", exitOK, code)
+	}
+}
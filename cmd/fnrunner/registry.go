@@ -0,0 +1,78 @@
+package main
+
+import (
+	"github.com/fnrun/fnrun/run"
+	"github.com/fnrun/fnrun/run/fn/cli"
+	httpfn "github.com/fnrun/fnrun/run/fn/http"
+	"github.com/fnrun/fnrun/run/fn/identity"
+	kafkafn "github.com/fnrun/fnrun/run/fn/kafka"
+	fnloader "github.com/fnrun/fnrun/run/fn/loader"
+	"github.com/fnrun/fnrun/run/fn/pool"
+	snsfn "github.com/fnrun/fnrun/run/fn/sns"
+	sqsfn "github.com/fnrun/fnrun/run/fn/sqs"
+	"github.com/fnrun/fnrun/run/middleware/circuitbreaker"
+	"github.com/fnrun/fnrun/run/middleware/deadletter"
+	"github.com/fnrun/fnrun/run/middleware/debug"
+	"github.com/fnrun/fnrun/run/middleware/healthcheck"
+	"github.com/fnrun/fnrun/run/middleware/jq"
+	"github.com/fnrun/fnrun/run/middleware/json"
+	kafkamiddleware "github.com/fnrun/fnrun/run/middleware/kafka"
+	"github.com/fnrun/fnrun/run/middleware/key"
+	"github.com/fnrun/fnrun/run/middleware/metrics"
+	"github.com/fnrun/fnrun/run/middleware/pipeline"
+	"github.com/fnrun/fnrun/run/middleware/ratelimiter"
+	"github.com/fnrun/fnrun/run/middleware/retry"
+	snsmiddleware "github.com/fnrun/fnrun/run/middleware/sns"
+	sqsmiddleware "github.com/fnrun/fnrun/run/middleware/sqs"
+	"github.com/fnrun/fnrun/run/middleware/tap"
+	"github.com/fnrun/fnrun/run/middleware/timeout"
+	"github.com/fnrun/fnrun/run/source/azure/servicebus"
+	"github.com/fnrun/fnrun/run/source/cron"
+	"github.com/fnrun/fnrun/run/source/http"
+	"github.com/fnrun/fnrun/run/source/kafka"
+	"github.com/fnrun/fnrun/run/source/lambda"
+	sourceloader "github.com/fnrun/fnrun/run/source/loader"
+	"github.com/fnrun/fnrun/run/source/sqs"
+)
+
+// newRegistry returns a registry containing every source, middleware, and fn
+// that ships with fnrunner.
+func newRegistry() run.Registry {
+	registry := run.NewRegistry()
+
+	registry.RegisterFn("fnrun.fn/cli", cli.New)
+	registry.RegisterFn("fnrun.fn/http", httpfn.New)
+	registry.RegisterFn("fnrun.fn/identity", identity.New)
+	registry.RegisterFn("fnrun.fn/kafka", kafkafn.New)
+	registry.RegisterFnWithRegistry("fnrun.fn/pool", pool.New)
+	registry.RegisterFn("fnrun.fn/sns", snsfn.New)
+	registry.RegisterFn("fnrun.fn/sqs", sqsfn.New)
+	registry.RegisterFnWithRegistry("fn", fnloader.New)
+
+	registry.RegisterMiddleware("fnrun.middleware/circuitbreaker", circuitbreaker.New)
+	registry.RegisterMiddleware("fnrun.middleware/deadletter", deadletter.New)
+	registry.RegisterMiddleware("fnrun.middleware/debug", debug.New)
+	registry.RegisterMiddleware("fnrun.middleware/healthcheck", healthcheck.New)
+	registry.RegisterMiddleware("fnrun.middleware/jq", jq.New)
+	registry.RegisterMiddleware("fnrun.middleware/json", json.New)
+	registry.RegisterMiddleware("fnrun.middleware/kafka", kafkamiddleware.New)
+	registry.RegisterMiddleware("fnrun.middleware/key", key.New)
+	registry.RegisterMiddleware("fnrun.middleware/metrics", metrics.New)
+	registry.RegisterMiddleware("fnrun.middleware/ratelimiter", ratelimiter.New)
+	registry.RegisterMiddleware("fnrun.middleware/retry", retry.New)
+	registry.RegisterMiddleware("fnrun.middleware/sns", snsmiddleware.New)
+	registry.RegisterMiddleware("fnrun.middleware/sqs", sqsmiddleware.New)
+	registry.RegisterMiddleware("fnrun.middleware/tap", tap.New)
+	registry.RegisterMiddleware("fnrun.middleware/timeout", timeout.New)
+	registry.RegisterMiddlewareWithRegistry("middleware", pipeline.NewWithRegistry)
+
+	registry.RegisterSource("fnrun.source/azure/servicebus", servicebus.New)
+	registry.RegisterSource("fnrun.source/cron", cron.New)
+	registry.RegisterSource("fnrun.source/http", http.New)
+	registry.RegisterSource("fnrun.source/kafka", kafka.New)
+	registry.RegisterSource("fnrun.source/lambda", lambda.New)
+	registry.RegisterSource("fnrun.source/sqs", sqs.New)
+	registry.RegisterSourceWithRegistry("source", sourceloader.New)
+
+	return registry
+}
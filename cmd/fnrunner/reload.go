@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// reloader reloads a running app from its configuration file.
+type reloader struct {
+	app      *app
+	filePath string
+
+	// contents holds the contents of the configuration file as of the last
+	// reload attempt.
+	contents []byte
+}
+
+// watch reloads the configuration whenever the process receives SIGHUP and, if
+// interval is positive, whenever the contents of the configuration file change.
+// It returns when ctx is cancelled.
+func (r *reloader) watch(ctx context.Context, interval time.Duration) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+
+	var ticks <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangups:
+			log.Println("Received SIGHUP, reloading configuration...")
+			r.reload(ctx, nil)
+		case <-ticks:
+			contents, err := ioutil.ReadFile(r.filePath)
+			if err != nil || bytes.Equal(contents, r.contents) {
+				continue
+			}
+			log.Printf("%s changed, reloading configuration...\n", r.filePath)
+			r.reload(ctx, contents)
+		}
+	}
+}
+
+// reload reloads the supervisor from contents, reading the configuration file
+// if contents is nil. The running pipelines are left in place if the new
+// configuration is invalid.
+func (r *reloader) reload(ctx context.Context, contents []byte) {
+	if contents == nil {
+		var err error
+		contents, err = ioutil.ReadFile(r.filePath)
+		if err != nil {
+			log.Printf("Error loading configuration, keeping current configuration: %+v\n", err)
+			return
+		}
+	}
+	r.contents = contents
+
+	configMap, err := parseConfig(contents)
+	if err != nil {
+		log.Printf("Error loading configuration, keeping current configuration: %+v\n", err)
+		return
+	}
+
+	if err := r.app.Reload(ctx, configMap); err != nil {
+		log.Println("Error reloading configuration, keeping current configuration:")
+		printErrors(log.Writer(), err)
+		return
+	}
+
+	log.Println("Configuration reloaded")
+}
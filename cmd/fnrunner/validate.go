@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/fnrun/fnrun/run/config"
+	"github.com/fnrun/fnrun/run/supervisor"
+)
+
+// validate builds every pipeline described by the configuration file without
+// starting any of its components, so no network connections are opened and no
+// processes are started. It reports every configuration error along with the
+// path of the value that caused it and returns a non-zero exit code if the
+// configuration is invalid.
+func validate(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	filePath := flags.String("f", "fnrun.yaml", "path to configuration yaml file")
+	flags.Parse(args)
+
+	path := configFilePath(*filePath)
+	configMap, err := loadConfig(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return exitError
+	}
+
+	app := newApp(newRegistry(), supervisor.RestartPolicy{})
+	if err := config.Configure(app, configMap); err != nil {
+		fmt.Fprintf(os.Stderr, "%s is invalid:\n", path)
+		printErrors(os.Stderr, err)
+		return exitError
+	}
+
+	fmt.Printf("%s is valid\n", path)
+	return exitOK
+}
@@ -0,0 +1,210 @@
+// Package admin provides an HTTP server for inspecting a running supervisor.
+// The server listens on its own address, separate from any source, and serves
+// the following routes:
+//
+// - /status: the state, components, uptime, restart count, and last error of
+// each pipeline
+// - /config: the effective configuration after environment variable expansion,
+// with secrets redacted
+// - /metrics: the metrics recorded by fnrun in the Prometheus text format
+// - /debug/pprof/: the runtime profiles provided by net/http/pprof
+//
+// The server may be configured with a string containing the address to listen
+// on or with a map containing an `address` and a list of additional
+// `redactKeys`. A configuration value is redacted if its key contains any of
+// DefaultRedactKeys or the configured redact keys, ignoring case. Passwords in
+// URLs are always redacted.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fnrun/fnrun/run/config"
+	"github.com/fnrun/fnrun/run/metrics"
+	"github.com/fnrun/fnrun/run/supervisor"
+)
+
+// DefaultRedactKeys are the key fragments whose values are redacted by default.
+var DefaultRedactKeys = []string{
+	"password",
+	"secret",
+	"token",
+	"credential",
+	"connectionString",
+	"apiKey",
+	"privateKey",
+	"authorization",
+}
+
+// Server is an admin HTTP server for a supervisor.
+type Server struct {
+	Address    string   `mapstructure:"address"`
+	RedactKeys []string `mapstructure:"redactKeys"`
+
+	supervisor *supervisor.Supervisor
+	createdAt  time.Time
+
+	mu     sync.Mutex
+	config map[string]interface{}
+	server *http.Server
+}
+
+// Status is the response of the /status route.
+type Status struct {
+	Uptime        string                      `json:"uptime"`
+	UptimeSeconds float64                     `json:"uptimeSeconds"`
+	Pipelines     []supervisor.PipelineStatus `json:"pipelines"`
+}
+
+// RequiresConfig always returns true. The server must be configured with the
+// address to listen on.
+func (s *Server) RequiresConfig() bool {
+	return true
+}
+
+// ConfigureString configures the address the server listens on.
+func (s *Server) ConfigureString(address string) error {
+	s.Address = address
+	return nil
+}
+
+// ConfigureMap configures the server from a map.
+func (s *Server) ConfigureMap(configMap map[string]interface{}) error {
+	return config.Decode(configMap, s)
+}
+
+// Validate checks that the server has an address to listen on.
+func (s *Server) Validate() error {
+	if s.Address == "" {
+		return errors.New("address is required")
+	}
+	return nil
+}
+
+// Describe describes the configuration of the server.
+func (*Server) Describe() *config.Schema {
+	address := &config.Schema{
+		Type:        "string",
+		Description: "The address the admin server listens on. It must differ from the address of any source.",
+		Examples:    []interface{}{"127.0.0.1:9090"},
+	}
+
+	return &config.Schema{
+		Description: "An HTTP server that serves /status, /config, and /debug/pprof/ for the running pipelines.",
+		OneOf: []*config.Schema{
+			address,
+			{
+				Type: "object",
+				Properties: map[string]*config.Schema{
+					"address": address,
+					"redactKeys": {
+						Type:        "array",
+						Description: "Values whose keys contain any of these fragments, ignoring case, are redacted from /config in addition to values whose keys contain any of " + strings.Join(DefaultRedactKeys, ", ") + ".",
+						Items:       &config.Schema{Type: "string"},
+					},
+				},
+				Required:             []string{"address"},
+				AdditionalProperties: config.NoAdditionalProperties(),
+			},
+		},
+	}
+}
+
+// SetConfig sets the configuration served by /config. It should be called with
+// the effective configuration whenever the supervisor is configured or
+// reloaded.
+func (s *Server) SetConfig(configMap map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config = configMap
+}
+
+// Handler returns the handler that serves the admin routes.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/config", s.handleConfig)
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	uptime := time.Since(s.createdAt)
+	writeJSON(w, &Status{
+		Uptime:        uptime.Round(time.Second).String(),
+		UptimeSeconds: uptime.Seconds(),
+		Pipelines:     s.supervisor.Status(),
+	})
+}
+
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	configMap := s.config
+	s.mu.Unlock()
+
+	redactKeys := append(append([]string(nil), DefaultRedactKeys...), s.RedactKeys...)
+	writeJSON(w, Redact(configMap, redactKeys))
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
+
+// Start listens on the configured address and serves the admin routes until
+// the server is closed.
+func (s *Server) Start(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.Address)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{Handler: s.Handler()}
+
+	s.mu.Lock()
+	s.server = srv
+	s.mu.Unlock()
+
+	go func() {
+		srv.Serve(ln)
+	}()
+
+	return nil
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	srv := s.server
+	s.server = nil
+	s.mu.Unlock()
+
+	if srv == nil {
+		return nil
+	}
+	return srv.Close()
+}
+
+// New returns an admin server for supervisor that must be configured before
+// use.
+func New(supervisor *supervisor.Supervisor) *Server {
+	return &Server{
+		supervisor: supervisor,
+		createdAt:  time.Now(),
+	}
+}
@@ -0,0 +1,188 @@
+package admin_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fnrun/fnrun/fn"
+	"github.com/fnrun/fnrun/run"
+	"github.com/fnrun/fnrun/run/admin"
+	"github.com/fnrun/fnrun/run/config"
+	"github.com/fnrun/fnrun/run/fn/loader"
+	sourceloader "github.com/fnrun/fnrun/run/source/loader"
+	"github.com/fnrun/fnrun/run/supervisor"
+)
+
+func newSupervisor(t *testing.T) *supervisor.Supervisor {
+	t.Helper()
+
+	reg := run.NewRegistry()
+	reg.RegisterSourceWithRegistry("source", sourceloader.New)
+	reg.RegisterSource("blocking", newBlockingSource)
+	reg.RegisterFnWithRegistry("fn", loader.New)
+	reg.RegisterFn("identity", newIdentityFn)
+
+	s := supervisor.New(reg, supervisor.RestartPolicy{})
+	if err := config.Configure(s, map[string]interface{}{"source": "blocking", "fn": "identity"}); err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+	return s
+}
+
+func TestConfigure(t *testing.T) {
+	server := admin.New(newSupervisor(t))
+
+	err := config.Configure(server, map[string]interface{}{
+		"address":    "127.0.0.1:0",
+		"redactKeys": []interface{}{"sasl"},
+	})
+	if err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+
+	if server.Address != "127.0.0.1:0" {
+		t.Errorf("unexpected address: %q", server.Address)
+	}
+}
+
+func TestConfigure_missingAddress(t *testing.T) {
+	server := admin.New(newSupervisor(t))
+
+	err := config.Configure(server, map[string]interface{}{})
+	if err == nil {
+		t.Error("expected config.Configure to return an error but it did not")
+	}
+}
+
+func TestHandler_status(t *testing.T) {
+	server := admin.New(newSupervisor(t))
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", rec.Code)
+	}
+
+	var status admin.Status
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("json.Unmarshal returned error: %+v", err)
+	}
+
+	if len(status.Pipelines) != 1 {
+		t.Fatalf("expected 1 pipeline but got %d", len(status.Pipelines))
+	}
+
+	got := status.Pipelines[0]
+	if got.Name != supervisor.DefaultPipelineName || got.State != supervisor.StatePending {
+		t.Errorf("unexpected pipeline status: %+v", got)
+	}
+	if got.Components.Source != "blocking" || got.Components.Fn != "identity" {
+		t.Errorf("unexpected components: %+v", got.Components)
+	}
+}
+
+func TestHandler_config(t *testing.T) {
+	server := admin.New(newSupervisor(t))
+	config.Configure(server, map[string]interface{}{
+		"address":    "127.0.0.1:0",
+		"redactKeys": []interface{}{"sasl"},
+	})
+	server.SetConfig(map[string]interface{}{
+		"source": map[string]interface{}{
+			"fnrun.source/azure/servicebus": map[string]interface{}{
+				"connectionString": "Endpoint=sb://example/;SharedAccessKey=abc",
+				"queueName":        "queue",
+			},
+		},
+		"fn": map[string]interface{}{
+			"fnrun.fn/cli": map[string]interface{}{
+				"command": "app",
+				"env":     []interface{}{"DB_PASSWORD=hunter2", "DB_URL=postgres://user:hunter2@db/app", "MODE=prod"},
+			},
+		},
+		"saslUser": "user",
+	})
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/config", nil))
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal returned error: %+v", err)
+	}
+
+	want := map[string]interface{}{
+		"source": map[string]interface{}{
+			"fnrun.source/azure/servicebus": map[string]interface{}{
+				"connectionString": admin.Redacted,
+				"queueName":        "queue",
+			},
+		},
+		"fn": map[string]interface{}{
+			"fnrun.fn/cli": map[string]interface{}{
+				"command": "app",
+				"env":     []interface{}{"DB_PASSWORD=REDACTED", "DB_URL=postgres://user:REDACTED@db/app", "MODE=prod"},
+			},
+		},
+		"saslUser": admin.Redacted,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected config:\nwant %v\ngot  %v", want, got)
+	}
+}
+
+func TestHandler_metrics(t *testing.T) {
+	server := admin.New(newSupervisor(t))
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", rec.Code)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "go_goroutines") {
+		t.Errorf("expected response to contain runtime metrics but got:\n%s", body)
+	}
+}
+
+func TestStartAndClose(t *testing.T) {
+	server := admin.New(newSupervisor(t))
+	server.Address = "127.0.0.1:0"
+
+	if err := server.Start(context.Background()); err != nil {
+		t.Fatalf("Start returned error: %+v", err)
+	}
+	if err := server.Close(); err != nil {
+		t.Errorf("Close returned error: %+v", err)
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Test components
+
+type blockingSource struct{}
+
+func (*blockingSource) Serve(ctx context.Context, f fn.Fn) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func newBlockingSource() run.Source {
+	return &blockingSource{}
+}
+
+type identityFn struct{}
+
+func (*identityFn) Invoke(ctx context.Context, input interface{}) (interface{}, error) {
+	return input, nil
+}
+
+func newIdentityFn() fn.Fn {
+	return &identityFn{}
+}
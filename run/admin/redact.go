@@ -0,0 +1,73 @@
+package admin
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Redacted replaces the values removed by Redact.
+const Redacted = "REDACTED"
+
+// Redact returns a copy of v in which the values of map keys that contain any
+// of redactKeys, ignoring case, are replaced with Redacted. The same applies to
+// strings of the form KEY=value, such as environment variables, and to
+// passwords in string values that are URLs.
+func Redact(v interface{}, redactKeys []string) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			if isSecretKey(key, redactKeys) {
+				redacted[key] = Redacted
+				continue
+			}
+			redacted[key] = Redact(value, redactKeys)
+		}
+		return redacted
+
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, value := range v {
+			redacted[i] = Redact(value, redactKeys)
+		}
+		return redacted
+
+	case string:
+		if key, value, found := strings.Cut(v, "="); found && !strings.ContainsAny(key, " /:") {
+			if isSecretKey(key, redactKeys) {
+				return key + "=" + Redacted
+			}
+			return key + "=" + redactURL(value)
+		}
+		return redactURL(v)
+	}
+
+	return v
+}
+
+func isSecretKey(key string, redactKeys []string) bool {
+	key = strings.ToLower(key)
+	for _, redactKey := range redactKeys {
+		if strings.Contains(key, strings.ToLower(redactKey)) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactURL(s string) string {
+	if !strings.Contains(s, "://") {
+		return s
+	}
+
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	if _, hasPassword := u.User.Password(); !hasPassword {
+		return s
+	}
+
+	u.User = url.UserPassword(u.User.Username(), Redacted)
+	return u.String()
+}
@@ -0,0 +1,74 @@
+// Package awspublisher provides what the SQS and SNS publishers of fnrun fns
+// and middleware have in common: the endpoint override that lets them and the
+// sqs source talk to SQS-compatible services, a Message that builds the
+// messages to publish from values with jq programs, and publishers for queues
+// and topics.
+package awspublisher
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/fnrun/fnrun/run/config"
+)
+
+// Endpoint overrides the endpoint of an AWS service, for use with compatible
+// services such as a local stand-in during tests. It is meant to be squashed
+// into the configuration of a component.
+type Endpoint struct {
+	EndpointURL   string `mapstructure:"endpointURL,omitempty"`
+	PartitionID   string `mapstructure:"partitionID,omitempty"`
+	SigningRegion string `mapstructure:"signingRegion,omitempty"`
+}
+
+// DefaultEndpoint returns an Endpoint with the default partition and signing
+// region and no endpoint URL.
+func DefaultEndpoint() Endpoint {
+	return Endpoint{
+		PartitionID:   "aws",
+		SigningRegion: "us-east-1",
+	}
+}
+
+// LoadConfig loads the default AWS configuration and resolves the endpoints of
+// every service to EndpointURL if it is set.
+func (e *Endpoint) LoadConfig(ctx context.Context) (aws.Config, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return cfg, err
+	}
+	if e.EndpointURL != "" {
+		customResolver := aws.EndpointResolverFunc(func(service, region string) (aws.Endpoint, error) {
+			return aws.Endpoint{
+				PartitionID:   e.PartitionID,
+				URL:           e.EndpointURL,
+				SigningRegion: e.SigningRegion,
+			}, nil
+		})
+		cfg.EndpointResolver = customResolver
+	}
+
+	return cfg, nil
+}
+
+// DescribeProperties describes the configuration keys of Endpoint. service is
+// the name of the AWS service whose endpoint is overridden.
+func (*Endpoint) DescribeProperties(service string) map[string]*config.Schema {
+	return map[string]*config.Schema{
+		"endpointURL": {
+			Type:        "string",
+			Description: "The URL of the " + service + " endpoint, for use with " + service + "-compatible services.",
+		},
+		"partitionID": {
+			Type:        "string",
+			Description: "The AWS partition of endpointURL.",
+			Default:     "aws",
+		},
+		"signingRegion": {
+			Type:        "string",
+			Description: "The region used to sign requests to endpointURL.",
+			Default:     "us-east-1",
+		},
+	}
+}
@@ -0,0 +1,41 @@
+package awspublisher
+
+import (
+	"context"
+
+	"github.com/fnrun/fnrun/fn"
+	"github.com/pkg/errors"
+)
+
+// Forward invokes f with input and publishes its output with success if it
+// succeeds, or its error message with failure if it fails. The jq programs of
+// m are evaluated against an object with the input under "input" and the
+// output under "output" or the error message under "error". Either publisher
+// may be nil, and nil outputs are not published.
+func (m *Message) Forward(ctx context.Context, input interface{}, f fn.Fn, success, failure Publisher) (interface{}, error) {
+	output, err := f.Invoke(ctx, input)
+
+	if err != nil && failure != nil {
+		v := map[string]interface{}{"input": input, "error": err.Error()}
+		if newErr := m.publish(ctx, failure, v, err.Error()); newErr != nil {
+			err = errors.Wrap(err, newErr.Error())
+		}
+	}
+
+	if err == nil && success != nil && output != nil {
+		v := map[string]interface{}{"input": input, "output": output}
+		err = m.publish(ctx, success, v, output)
+	}
+
+	return output, err
+}
+
+func (m *Message) publish(ctx context.Context, publisher Publisher, v interface{}, body interface{}) error {
+	message, err := m.Build(ctx, v, body)
+	if err != nil {
+		return err
+	}
+
+	_, err = publisher.Publish(ctx, message)
+	return err
+}
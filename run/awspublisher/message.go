@@ -0,0 +1,223 @@
+package awspublisher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/fnrun/fnrun/run/config"
+	"github.com/itchyny/gojq"
+)
+
+// Message builds the messages to publish from values. Body, GroupID,
+// DeduplicationID, and the values of Attributes are jq programs evaluated
+// against the value, and an empty program leaves that part of the message
+// unset. It is meant to be squashed into the configuration of a component,
+// which must call Compile after decoding it.
+type Message struct {
+	Body            string
+	Attributes      map[string]string
+	GroupID         string `mapstructure:"groupID"`
+	DeduplicationID string `mapstructure:"deduplicationID"`
+
+	body            *gojq.Code
+	groupID         *gojq.Code
+	deduplicationID *gojq.Code
+	attributes      []attribute
+}
+
+type attribute struct {
+	name string
+	code *gojq.Code
+}
+
+// Attribute is a message attribute of a published message.
+type Attribute struct {
+	DataType    string
+	StringValue string
+}
+
+// Published is a message to publish to a queue or topic.
+type Published struct {
+	Body            string
+	Attributes      map[string]Attribute
+	GroupID         *string
+	DeduplicationID *string
+}
+
+func compile(pattern string) (*gojq.Code, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+
+	query, err := gojq.Parse(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return gojq.Compile(query)
+}
+
+// Compile compiles the jq programs of m.
+func (m *Message) Compile() error {
+	var errs []error
+
+	var err error
+	m.body, err = compile(m.Body)
+	errs = append(errs, config.WithPath("body", err))
+	m.groupID, err = compile(m.GroupID)
+	errs = append(errs, config.WithPath("groupID", err))
+	m.deduplicationID, err = compile(m.DeduplicationID)
+	errs = append(errs, config.WithPath("deduplicationID", err))
+
+	names := make([]string, 0, len(m.Attributes))
+	for name := range m.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	m.attributes = nil
+	for _, name := range names {
+		code, err := compile(m.Attributes[name])
+		if err != nil {
+			errs = append(errs, config.WithPath("attributes", config.WithPath(name, err)))
+			continue
+		}
+		m.attributes = append(m.attributes, attribute{name: name, code: code})
+	}
+
+	return errors.Join(errs...)
+}
+
+// Build returns a message built from v. The body of the message is body unless
+// m has a Body program.
+func (m *Message) Build(ctx context.Context, v interface{}, body interface{}) (*Published, error) {
+	if m.body != nil {
+		var err error
+		if body, err = evaluate(ctx, m.body, v); err != nil {
+			return nil, config.WithPath("body", err)
+		}
+	}
+	encoded, err := Encode(body)
+	if err != nil {
+		return nil, config.WithPath("body", err)
+	}
+	published := &Published{
+		Body:       encoded,
+		Attributes: make(map[string]Attribute),
+	}
+
+	if published.GroupID, err = m.evaluateID(ctx, m.groupID, v); err != nil {
+		return nil, config.WithPath("groupID", err)
+	}
+	if published.DeduplicationID, err = m.evaluateID(ctx, m.deduplicationID, v); err != nil {
+		return nil, config.WithPath("deduplicationID", err)
+	}
+
+	for _, a := range m.attributes {
+		value, err := evaluate(ctx, a.code, v)
+		if err != nil {
+			return nil, config.WithPath("attributes", config.WithPath(a.name, err))
+		}
+		if value == nil {
+			continue
+		}
+		if published.Attributes[a.name], err = toAttribute(value); err != nil {
+			return nil, config.WithPath("attributes", config.WithPath(a.name, err))
+		}
+	}
+
+	return published, nil
+}
+
+// evaluateID evaluates the program of a group or deduplication ID, which may be
+// nil.
+func (m *Message) evaluateID(ctx context.Context, code *gojq.Code, v interface{}) (*string, error) {
+	if code == nil {
+		return nil, nil
+	}
+
+	id, err := evaluate(ctx, code, v)
+	if err != nil || id == nil {
+		return nil, err
+	}
+	encoded, err := Encode(id)
+	if err != nil {
+		return nil, err
+	}
+	return &encoded, nil
+}
+
+// toAttribute converts the result of a jq program to a message attribute.
+// Numbers become Number attributes, and anything else a String attribute
+// encoded like a body.
+func toAttribute(v interface{}) (Attribute, error) {
+	switch v := v.(type) {
+	case int:
+		return Attribute{DataType: "Number", StringValue: strconv.Itoa(v)}, nil
+	case float64:
+		return Attribute{DataType: "Number", StringValue: strconv.FormatFloat(v, 'f', -1, 64)}, nil
+	}
+
+	encoded, err := Encode(v)
+	if err != nil {
+		return Attribute{}, err
+	}
+	return Attribute{DataType: "String", StringValue: encoded}, nil
+}
+
+// evaluate returns the first value code produces for v.
+func evaluate(ctx context.Context, code *gojq.Code, v interface{}) (interface{}, error) {
+	result, ok := code.RunWithContext(ctx, v).Next()
+	if !ok {
+		return nil, errors.New("the jq program produced no value")
+	}
+	if err, ok := result.(error); ok {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Encode encodes v as the body of a message. Strings and byte slices are used
+// as they are, and anything else is encoded as JSON.
+func Encode(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", fmt.Errorf("error encoding %T as JSON: %w", v, err)
+		}
+		return string(b), nil
+	}
+}
+
+// DescribeProperties describes the configuration keys of Message. subject
+// describes the value the jq programs are evaluated against.
+func (*Message) DescribeProperties(subject string) map[string]*config.Schema {
+	return map[string]*config.Schema{
+		"body": {
+			Type:        "string",
+			Description: "The jq program that produces the body of each message from " + subject + ". Strings are published as they are and other values as JSON.",
+		},
+		"attributes": {
+			Type:                 "object",
+			Description:          "The message attributes of each message, mapping each attribute name to a jq program that produces its value from " + subject + ". Numbers are published as Number attributes and other values as String attributes. An attribute is omitted if its value is null.",
+			AdditionalProperties: &config.Schema{Type: "string"},
+		},
+		"groupID": {
+			Type:        "string",
+			Description: "The jq program that produces the message group ID of each message from " + subject + ". It is required by FIFO queues and topics.",
+		},
+		"deduplicationID": {
+			Type:        "string",
+			Description: "The jq program that produces the deduplication ID of each message from " + subject + ". FIFO queues and topics without content-based deduplication require it.",
+		},
+	}
+}
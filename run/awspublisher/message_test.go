@@ -0,0 +1,92 @@
+package awspublisher
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fnrun/fnrun/run/config"
+)
+
+func compiled(t *testing.T, m Message) *Message {
+	t.Helper()
+
+	if err := m.Compile(); err != nil {
+		t.Fatalf("Compile returned error: %+v", err)
+	}
+	return &m
+}
+
+func TestBuild_defaults(t *testing.T) {
+	m := compiled(t, Message{})
+
+	published, err := m.Build(context.Background(), nil, map[string]interface{}{"id": 7})
+	if err != nil {
+		t.Fatalf("Build returned error: %+v", err)
+	}
+
+	want := &Published{Body: `{"id":7}`, Attributes: map[string]Attribute{}}
+	if !reflect.DeepEqual(published, want) {
+		t.Errorf("unexpected message: want %+v, got %+v", want, published)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	m := compiled(t, Message{
+		Body: ".order",
+		Attributes: map[string]string{
+			"source":   ".source",
+			"priority": ".priority",
+			"missing":  ".missing",
+		},
+		GroupID:         ".customer",
+		DeduplicationID: ".order.id",
+	})
+
+	v := map[string]interface{}{
+		"order":    map[string]interface{}{"id": "order-1"},
+		"source":   "web",
+		"priority": 2.5,
+		"customer": 42,
+	}
+	published, err := m.Build(context.Background(), v, nil)
+	if err != nil {
+		t.Fatalf("Build returned error: %+v", err)
+	}
+
+	if published.Body != `{"id":"order-1"}` {
+		t.Errorf("unexpected body: %q", published.Body)
+	}
+	wantAttributes := map[string]Attribute{
+		"source":   {DataType: "String", StringValue: "web"},
+		"priority": {DataType: "Number", StringValue: "2.5"},
+	}
+	if !reflect.DeepEqual(published.Attributes, wantAttributes) {
+		t.Errorf("unexpected attributes: want %+v, got %+v", wantAttributes, published.Attributes)
+	}
+	if published.GroupID == nil || *published.GroupID != "42" {
+		t.Errorf("unexpected group ID: %v", published.GroupID)
+	}
+	if published.DeduplicationID == nil || *published.DeduplicationID != "order-1" {
+		t.Errorf("unexpected deduplication ID: %v", published.DeduplicationID)
+	}
+}
+
+func TestCompile_reportsEveryProgram(t *testing.T) {
+	m := Message{
+		Body:       ".a |",
+		Attributes: map[string]string{"source": ".b |"},
+	}
+
+	want := []string{"body: ", "attributes.source: "}
+	errs := config.Errors(m.Compile())
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors but got %d: %+v", len(want), len(errs), errs)
+	}
+	for i, err := range errs {
+		if !strings.HasPrefix(err.Error(), want[i]) {
+			t.Errorf("unexpected error: want prefix %q, got %q", want[i], err.Error())
+		}
+	}
+}
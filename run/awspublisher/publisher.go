@@ -0,0 +1,155 @@
+package awspublisher
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fnrun/fnrun/run/tracing"
+)
+
+// Publisher publishes messages to a queue or topic. Each message carries the
+// trace context of ctx in its traceparent attribute.
+type Publisher interface {
+	Publish(ctx context.Context, message *Published) (*Receipt, error)
+}
+
+// Receipt identifies a published message. SequenceNumber is only set for
+// messages published to FIFO queues and topics.
+type Receipt struct {
+	MessageID      string
+	SequenceNumber string
+}
+
+// Output returns the receipt as the output of a fn.
+func (r *Receipt) Output() map[string]interface{} {
+	output := map[string]interface{}{"messageId": r.MessageID}
+	if r.SequenceNumber != "" {
+		output["sequenceNumber"] = r.SequenceNumber
+	}
+	return output
+}
+
+// SQSAPI is the subset of the SQS client used by SQS publishers.
+type SQSAPI interface {
+	GetQueueUrl(ctx context.Context, params *sqs.GetQueueUrlInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error)
+	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+}
+
+// SNSAPI is the subset of the SNS client used by SNS publishers.
+type SNSAPI interface {
+	Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error)
+}
+
+type sqsPublisher struct {
+	client   SQSAPI
+	queueURL *string
+}
+
+// NewSQSPublisher returns a Publisher that sends messages to the queue with
+// the given name.
+func NewSQSPublisher(ctx context.Context, client SQSAPI, queue string) (Publisher, error) {
+	result, err := client.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(queue)})
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqsPublisher{client: client, queueURL: result.QueueUrl}, nil
+}
+
+func (p *sqsPublisher) Publish(ctx context.Context, message *Published) (*Receipt, error) {
+	attributes := make(map[string]sqstypes.MessageAttributeValue, len(message.Attributes)+1)
+	for name, a := range withTraceContext(ctx, message.Attributes) {
+		attributes[name] = sqstypes.MessageAttributeValue{
+			DataType:    aws.String(a.DataType),
+			StringValue: aws.String(a.StringValue),
+		}
+	}
+
+	result, err := p.client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:               p.queueURL,
+		MessageBody:            aws.String(message.Body),
+		MessageAttributes:      attributes,
+		MessageGroupId:         message.GroupID,
+		MessageDeduplicationId: message.DeduplicationID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Receipt{
+		MessageID:      aws.ToString(result.MessageId),
+		SequenceNumber: aws.ToString(result.SequenceNumber),
+	}, nil
+}
+
+type snsPublisher struct {
+	client   SNSAPI
+	topicARN *string
+}
+
+// NewSNSPublisher returns a Publisher that publishes messages to the topic
+// with the given ARN.
+func NewSNSPublisher(client SNSAPI, topicARN string) Publisher {
+	return &snsPublisher{client: client, topicARN: aws.String(topicARN)}
+}
+
+func (p *snsPublisher) Publish(ctx context.Context, message *Published) (*Receipt, error) {
+	attributes := make(map[string]snstypes.MessageAttributeValue, len(message.Attributes)+1)
+	for name, a := range withTraceContext(ctx, message.Attributes) {
+		attributes[name] = snstypes.MessageAttributeValue{
+			DataType:    aws.String(a.DataType),
+			StringValue: aws.String(a.StringValue),
+		}
+	}
+
+	result, err := p.client.Publish(ctx, &sns.PublishInput{
+		TopicArn:               p.topicARN,
+		Message:                aws.String(message.Body),
+		MessageAttributes:      attributes,
+		MessageGroupId:         message.GroupID,
+		MessageDeduplicationId: message.DeduplicationID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Receipt{
+		MessageID:      aws.ToString(result.MessageId),
+		SequenceNumber: aws.ToString(result.SequenceNumber),
+	}, nil
+}
+
+// withTraceContext returns a copy of attributes that carries the trace context
+// of ctx. attributes is not modified and may be nil.
+func withTraceContext(ctx context.Context, attributes map[string]Attribute) attributeCarrier {
+	carrier := make(attributeCarrier, len(attributes)+1)
+	for name, a := range attributes {
+		carrier[name] = a
+	}
+	tracing.Inject(ctx, carrier)
+	return carrier
+}
+
+// attributeCarrier adapts the attributes of a message to a
+// propagation.TextMapCarrier.
+type attributeCarrier map[string]Attribute
+
+func (c attributeCarrier) Get(key string) string {
+	return c[key].StringValue
+}
+
+func (c attributeCarrier) Set(key, value string) {
+	c[key] = Attribute{DataType: "String", StringValue: value}
+}
+
+func (c attributeCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
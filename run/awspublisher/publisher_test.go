@@ -0,0 +1,193 @@
+package awspublisher
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/fnrun/fnrun/fn"
+	"github.com/fnrun/fnrun/run/tracing"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type fakeSQS struct {
+	sent []*sqs.SendMessageInput
+}
+
+func (c *fakeSQS) GetQueueUrl(ctx context.Context, params *sqs.GetQueueUrlInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error) {
+	return &sqs.GetQueueUrlOutput{QueueUrl: aws.String("https://sqs.local/" + aws.ToString(params.QueueName))}, nil
+}
+
+func (c *fakeSQS) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	c.sent = append(c.sent, params)
+	return &sqs.SendMessageOutput{MessageId: aws.String("message-1"), SequenceNumber: aws.String("1000")}, nil
+}
+
+type fakeSNS struct {
+	published []*sns.PublishInput
+}
+
+func (c *fakeSNS) Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	c.published = append(c.published, params)
+	return &sns.PublishOutput{MessageId: aws.String("message-1")}, nil
+}
+
+func remoteContext() context.Context {
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	return trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+}
+
+func TestSQSPublisher(t *testing.T) {
+	client := &fakeSQS{}
+	publisher, err := NewSQSPublisher(context.Background(), client, "orders.fifo")
+	if err != nil {
+		t.Fatalf("NewSQSPublisher returned error: %+v", err)
+	}
+
+	ctx := remoteContext()
+	receipt, err := publisher.Publish(ctx, &Published{
+		Body:       "some body",
+		Attributes: map[string]Attribute{"source": {DataType: "String", StringValue: "web"}},
+		GroupID:    aws.String("customer-1"),
+	})
+	if err != nil {
+		t.Fatalf("Publish returned error: %+v", err)
+	}
+
+	want := map[string]interface{}{"messageId": "message-1", "sequenceNumber": "1000"}
+	if !reflect.DeepEqual(receipt.Output(), want) {
+		t.Errorf("unexpected output: want %v, got %v", want, receipt.Output())
+	}
+
+	sent := client.sent[0]
+	if aws.ToString(sent.QueueUrl) != "https://sqs.local/orders.fifo" || aws.ToString(sent.MessageBody) != "some body" || aws.ToString(sent.MessageGroupId) != "customer-1" {
+		t.Errorf("unexpected message: %+v", sent)
+	}
+	if got := aws.ToString(sent.MessageAttributes["source"].StringValue); got != "web" {
+		t.Errorf("unexpected source attribute: %q", got)
+	}
+	if got := aws.ToString(sent.MessageAttributes["traceparent"].StringValue); got != tracing.Traceparent(ctx) {
+		t.Errorf("unexpected traceparent attribute: want %q, got %q", tracing.Traceparent(ctx), got)
+	}
+}
+
+func TestSNSPublisher(t *testing.T) {
+	client := &fakeSNS{}
+	publisher := NewSNSPublisher(client, "arn:aws:sns:us-east-1:123456789012:orders")
+
+	receipt, err := publisher.Publish(context.Background(), &Published{
+		Body:       "some body",
+		Attributes: map[string]Attribute{"priority": {DataType: "Number", StringValue: "2"}},
+	})
+	if err != nil {
+		t.Fatalf("Publish returned error: %+v", err)
+	}
+
+	want := map[string]interface{}{"messageId": "message-1"}
+	if !reflect.DeepEqual(receipt.Output(), want) {
+		t.Errorf("unexpected output: want %v, got %v", want, receipt.Output())
+	}
+
+	published := client.published[0]
+	if aws.ToString(published.TopicArn) != "arn:aws:sns:us-east-1:123456789012:orders" || aws.ToString(published.Message) != "some body" {
+		t.Errorf("unexpected message: %+v", published)
+	}
+	if got := published.MessageAttributes["priority"]; aws.ToString(got.DataType) != "Number" || aws.ToString(got.StringValue) != "2" {
+		t.Errorf("unexpected priority attribute: %+v", got)
+	}
+}
+
+func TestSQSPublisher_doesNotModifyAttributes(t *testing.T) {
+	client := &fakeSQS{}
+	publisher, err := NewSQSPublisher(context.Background(), client, "orders")
+	if err != nil {
+		t.Fatalf("NewSQSPublisher returned error: %+v", err)
+	}
+
+	ctx := remoteContext()
+	attributes := map[string]Attribute{"source": {DataType: "String", StringValue: "web"}}
+	for _, message := range []*Published{{Body: "nil attributes"}, {Body: "attributes", Attributes: attributes}} {
+		if _, err := publisher.Publish(ctx, message); err != nil {
+			t.Fatalf("Publish returned error: %+v", err)
+		}
+	}
+
+	if len(attributes) != 1 {
+		t.Errorf("expected the attributes of the message to be unchanged but got %v", attributes)
+	}
+	for _, sent := range client.sent {
+		if got := aws.ToString(sent.MessageAttributes["traceparent"].StringValue); got != tracing.Traceparent(ctx) {
+			t.Errorf("unexpected traceparent attribute: want %q, got %q", tracing.Traceparent(ctx), got)
+		}
+	}
+}
+
+type recordingPublisher struct {
+	published []*Published
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, message *Published) (*Receipt, error) {
+	p.published = append(p.published, message)
+	return &Receipt{MessageID: "message-1"}, nil
+}
+
+func TestForward(t *testing.T) {
+	m := compiled(t, Message{Attributes: map[string]string{"id": ".input.id"}})
+	success, failure := &recordingPublisher{}, &recordingPublisher{}
+	input := map[string]interface{}{"id": "order-1"}
+
+	output, err := m.Forward(context.Background(), input, fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		return "shipped", nil
+	}), success, failure)
+	if err != nil || output != "shipped" {
+		t.Fatalf("unexpected result: %v, %+v", output, err)
+	}
+
+	expectedErr := errors.New("expected error")
+	_, err = m.Forward(context.Background(), input, fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		return nil, expectedErr
+	}), success, failure)
+	if err != expectedErr {
+		t.Errorf("unexpected error: want %v, got %+v", expectedErr, err)
+	}
+
+	if len(success.published) != 1 || success.published[0].Body != "shipped" || success.published[0].Attributes["id"].StringValue != "order-1" {
+		t.Errorf("unexpected successes: %+v", success.published)
+	}
+	if len(failure.published) != 1 || failure.published[0].Body != "expected error" {
+		t.Errorf("unexpected failures: %+v", failure.published)
+	}
+}
+
+func TestForward_ignoresNilOutputAndMissingPublishers(t *testing.T) {
+	m := compiled(t, Message{})
+	success := &recordingPublisher{}
+
+	_, err := m.Forward(context.Background(), "input", fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		return nil, nil
+	}), success, nil)
+	if err != nil {
+		t.Fatalf("Forward returned error: %+v", err)
+	}
+
+	expectedErr := errors.New("expected error")
+	_, err = m.Forward(context.Background(), "input", fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		return nil, expectedErr
+	}), success, nil)
+	if err != expectedErr {
+		t.Errorf("unexpected error: want %v, got %+v", expectedErr, err)
+	}
+
+	if len(success.published) != 0 {
+		t.Errorf("expected nothing to be published, got %+v", success.published)
+	}
+}
@@ -52,13 +52,34 @@ type EmptyConfigurer interface {
 	Configure() error
 }
 
+// Validator checks an object's configuration for problems that would otherwise
+// only be detected when the object is first used, such as a missing required
+// value. Validate must not open network connections or start processes.
+type Validator interface {
+	Validate() error
+}
+
 // Configure applies the config to the target object. Configure will select the
 // most appropriate *Configurer interface on the target and call the method from
 // that interface. Configure will return an error if an appropriate
 // implementation of a *Configurer interface is not found and the object
-// requires configuration, as specified by the Required interface.
-//gocyclo:ignore
+// requires configuration, as specified by the Required interface. If the target
+// is configured successfully and implements Validator, Configure returns the
+// result of Validate.
 func Configure(target interface{}, config interface{}) error {
+	if err := configure(target, config); err != nil {
+		return err
+	}
+
+	if t, ok := target.(Validator); ok {
+		return t.Validate()
+	}
+
+	return nil
+}
+
+//gocyclo:ignore
+func configure(target interface{}, config interface{}) error {
 	switch config.(type) {
 	case nil:
 		if t, ok := target.(EmptyConfigurer); ok {
@@ -0,0 +1,332 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// UnknownKeyError is an error indicating that a configuration key does not
+// correspond to any option of the component being configured. Suggestion holds
+// the most similar known key, if any is close enough to be a likely typo.
+type UnknownKeyError struct {
+	Key        string
+	Suggestion string
+}
+
+func (e *UnknownKeyError) Error() string {
+	if e.Suggestion != "" {
+		return fmt.Sprintf("unknown configuration key (did you mean %q?)", e.Suggestion)
+	}
+	return "unknown configuration key"
+}
+
+// Decode decodes input into result, which must be a pointer to a struct, using
+// mapstructure. Keys are matched to fields case-insensitively, and the given
+// hooks are composed and run before each value is decoded.
+//
+// Decode is strict: any key in input that does not correspond to a field of
+// result causes an UnknownKeyError, wrapped with the path of the key, to be
+// returned. Every unknown key is reported, along with every value that cannot
+// be decoded, each wrapped with its path.
+func Decode(input interface{}, result interface{}, hooks ...mapstructure.DecodeHookFunc) error {
+	var hook mapstructure.DecodeHookFunc
+	if len(hooks) > 0 {
+		hook = mapstructure.ComposeDecodeHookFunc(hooks...)
+	}
+
+	unused, err := decode(input, result, hook)
+	var decodeErr *mapstructure.Error
+	if errors.As(err, &decodeErr) {
+		// mapstructure does not report the unused keys of a struct with a value
+		// that cannot be decoded, so input is decoded again into a scratch
+		// value, ignoring the errors of the hooks, to find them.
+		unused, _ = decode(input, reflect.New(reflect.TypeOf(result).Elem()).Interface(), ignoreErrors(hook))
+		return errors.Join(decodeErrors(input, decodeErr), unknownKeys(unused, reflect.TypeOf(result)))
+	}
+	if err != nil {
+		return err
+	}
+
+	return unknownKeys(unused, reflect.TypeOf(result))
+}
+
+// decode decodes input into result and returns the keys of input that do not
+// correspond to a field of result.
+func decode(input interface{}, result interface{}, hook mapstructure.DecodeHookFunc) ([]string, error) {
+	var metadata mapstructure.Metadata
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: hook,
+		Metadata:   &metadata,
+		Result:     result,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = decoder.Decode(input)
+	return metadata.Unused, err
+}
+
+// ignoreErrors returns a hook that runs hook and decodes the zero value of the
+// target type in place of any value that hook or the decoder would reject.
+func ignoreErrors(hook mapstructure.DecodeHookFunc) mapstructure.DecodeHookFunc {
+	return func(from, to reflect.Value) (interface{}, error) {
+		zero := reflect.Zero(to.Type()).Interface()
+
+		v := from.Interface()
+		if hook != nil {
+			var err error
+			if v, err = mapstructure.DecodeHookExec(hook, from, to); err != nil {
+				return zero, nil
+			}
+		}
+		if !decodable(v, to.Type()) {
+			return zero, nil
+		}
+		return v, nil
+	}
+}
+
+// decodable reports whether the decoder accepts v for a value of type t. The
+// elements and fields of containers are not checked, since the hook is run for
+// each of them.
+func decodable(v interface{}, t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if v == nil {
+		return true
+	}
+
+	kind := reflect.Indirect(reflect.ValueOf(v)).Kind()
+	switch t.Kind() {
+	case reflect.Interface:
+		return true
+	case reflect.Struct, reflect.Map:
+		return kind == reflect.Map || kind == reflect.Struct
+	case reflect.Slice, reflect.Array:
+		return kind == reflect.Slice || kind == reflect.Array
+	default:
+		return mapstructure.Decode(v, reflect.New(t).Interface()) == nil
+	}
+}
+
+var quotedName = regexp.MustCompile(`'([^']*)'`)
+
+// decodeErrors converts the messages of err, which name the value that could
+// not be decoded in quotes, into errors wrapped with the path of the value.
+func decodeErrors(input interface{}, err *mapstructure.Error) error {
+	errs := make([]error, len(err.Errors))
+	for i, message := range err.Errors {
+		name, text := "", message
+		if rest, ok := strings.CutPrefix(message, "error decoding '"); ok {
+			name, text, _ = strings.Cut(rest, "': ")
+		} else if match := quotedName.FindStringSubmatchIndex(message); match != nil {
+			name = message[match[2]:match[3]]
+			before := strings.TrimSpace(message[:match[0]])
+			after := strings.TrimPrefix(strings.TrimSpace(message[match[1]:]), ": ")
+			if before == "" {
+				text = after
+			} else if strings.HasPrefix(after, ",") {
+				text = before + after
+			} else {
+				text = before + " " + after
+			}
+		}
+
+		errs[i] = errors.New(text)
+		if name != "" {
+			errs[i] = WithPath(inputPath(input, name), errs[i])
+		}
+	}
+
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errors.Join(errs...)
+}
+
+// inputPath returns name, the path of a value as mapstructure names it, with
+// each key spelled as it is in input, since mapstructure names fields by their
+// tags rather than by the keys that match them case-insensitively.
+func inputPath(input interface{}, name string) string {
+	segments := strings.Split(name, ".")
+	for i, segment := range segments {
+		key, index, _ := strings.Cut(segment, "[")
+		m, ok := input.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		found := false
+		for k, v := range m {
+			if strings.EqualFold(k, key) {
+				segments[i], input, found = k, v, true
+				break
+			}
+		}
+		if !found {
+			break
+		}
+
+		if index != "" {
+			segments[i] += "[" + index
+			input = element(input, strings.TrimSuffix(index, "]"))
+		}
+	}
+	return strings.Join(segments, ".")
+}
+
+// element returns the element of a slice or map at index, or nil if there is
+// none.
+func element(v interface{}, index string) interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		if n, err := strconv.Atoi(index); err == nil && n >= 0 && n < len(v) {
+			return v[n]
+		}
+	case map[string]interface{}:
+		return v[index]
+	}
+	return nil
+}
+
+func unknownKeys(unused []string, t reflect.Type) error {
+	sort.Strings(unused)
+
+	var errs []error
+	for _, key := range unused {
+		parent, name := "", key
+		if i := strings.LastIndex(key, "."); i >= 0 {
+			parent, name = key[:i], key[i+1:]
+		}
+
+		err := &UnknownKeyError{
+			Key:        name,
+			Suggestion: suggest(name, fieldKeys(nestedType(t, parent))),
+		}
+		errs = append(errs, WithPath(key, err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// nestedType returns the struct type reached by following the dot-separated
+// path of keys from t, or nil if path does not lead to a struct.
+func nestedType(t reflect.Type, path string) reflect.Type {
+	t = structType(t)
+	if path == "" || t == nil {
+		return t
+	}
+
+	var fields []reflect.StructField
+	collectFields(t, &fields)
+
+	head, rest, _ := strings.Cut(path, ".")
+	for _, field := range fields {
+		if strings.EqualFold(fieldKey(field), head) {
+			return nestedType(field.Type, rest)
+		}
+	}
+	return nil
+}
+
+func structType(t reflect.Type) reflect.Type {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	return t
+}
+
+// collectFields appends the exported fields of t to fields, flattening fields
+// that are squashed into their parent.
+func collectFields(t reflect.Type, fields *[]reflect.StructField) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("mapstructure")
+		if strings.Contains(tag, ",squash") {
+			if st := structType(field.Type); st != nil {
+				collectFields(st, fields)
+			}
+			continue
+		}
+		if field.PkgPath != "" || tag == "-" {
+			continue
+		}
+
+		*fields = append(*fields, field)
+	}
+}
+
+func fieldKey(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+func fieldKeys(t reflect.Type) []string {
+	if t == nil {
+		return nil
+	}
+
+	var fields []reflect.StructField
+	collectFields(t, &fields)
+
+	keys := make([]string, len(fields))
+	for i, field := range fields {
+		keys[i] = fieldKey(field)
+	}
+	return keys
+}
+
+// suggest returns the candidate closest to key by edit distance, ignoring case,
+// or an empty string if no candidate is close enough to be a likely typo.
+func suggest(key string, candidates []string) string {
+	maxDistance := len(key) / 3
+	if maxDistance < 2 {
+		maxDistance = 2
+	}
+
+	best, bestDistance := "", maxDistance+1
+	for _, candidate := range candidates {
+		d := distance(strings.ToLower(key), strings.ToLower(candidate))
+		if d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// distance returns the Levenshtein distance between a and b.
+func distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
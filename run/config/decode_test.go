@@ -0,0 +1,116 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+type decodeTestConfig struct {
+	decodeTestEmbedded `mapstructure:",squash"`
+
+	BatchSize int           `mapstructure:"batchSize"`
+	Timeout   time.Duration `mapstructure:"timeout"`
+	Nested    struct {
+		MaxWaitDuration string `mapstructure:"maxWaitDuration"`
+	} `mapstructure:"nested"`
+	Brokers []string
+}
+
+type decodeTestEmbedded struct {
+	Restart bool `mapstructure:"restart"`
+}
+
+func TestDecode(t *testing.T) {
+	var cfg decodeTestConfig
+	err := Decode(map[string]interface{}{
+		"batchsize": 10,
+		"timeout":   "2s",
+		"restart":   true,
+		"nested":    map[string]interface{}{"maxWaitDuration": "1s"},
+		"brokers":   []string{"localhost:9092"},
+	}, &cfg, mapstructure.StringToTimeDurationHookFunc())
+	if err != nil {
+		t.Fatalf("Decode returned error: %+v", err)
+	}
+
+	if cfg.BatchSize != 10 || cfg.Timeout != 2*time.Second || !cfg.Restart || cfg.Nested.MaxWaitDuration != "1s" || len(cfg.Brokers) != 1 {
+		t.Errorf("unexpected decoded config: %+v", cfg)
+	}
+}
+
+func TestDecode_unknownKeys(t *testing.T) {
+	var cfg decodeTestConfig
+	err := Decode(map[string]interface{}{
+		"batchSise": 10,
+		"restat":    true,
+		"nested":    map[string]interface{}{"maxWaitDur": "1s"},
+		"something": "else",
+	}, &cfg)
+
+	want := []string{
+		`batchSise: unknown configuration key (did you mean "batchSize"?)`,
+		`nested.maxWaitDur: unknown configuration key`,
+		`restat: unknown configuration key (did you mean "restart"?)`,
+		`something: unknown configuration key`,
+	}
+	errs := Errors(err)
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors but got %d: %+v", len(want), len(errs), errs)
+	}
+	for i, e := range errs {
+		if e.Error() != want[i] {
+			t.Errorf("unexpected error message: want %q, got %q", want[i], e.Error())
+		}
+	}
+
+	var unknownKeyErr *UnknownKeyError
+	if !errors.As(err, &unknownKeyErr) {
+		t.Fatalf("expected error to be an UnknownKeyError but got %+v", err)
+	}
+	if unknownKeyErr.Key != "batchSise" {
+		t.Errorf("unexpected key: want %q, got %q", "batchSise", unknownKeyErr.Key)
+	}
+}
+
+func TestDecode_nestedSuggestion(t *testing.T) {
+	var cfg decodeTestConfig
+	err := Decode(map[string]interface{}{
+		"nested": map[string]interface{}{"maxWaitDuraton": "1s"},
+	}, &cfg)
+
+	want := `nested.maxWaitDuraton: unknown configuration key (did you mean "maxWaitDuration"?)`
+	if err == nil || err.Error() != want {
+		t.Errorf("unexpected error: want %q, got %v", want, err)
+	}
+}
+
+func TestDecode_invalidValues(t *testing.T) {
+	var cfg decodeTestConfig
+	err := Decode(map[string]interface{}{
+		"batchsize": "ten",
+		"timeout":   "banana",
+		"brokers":   5,
+		"nested":    map[string]interface{}{"maxWaitDur": "1s"},
+		"restat":    true,
+	}, &cfg, mapstructure.StringToTimeDurationHookFunc())
+
+	want := []string{
+		`batchsize: expected type 'int', got unconvertible type 'string', value: 'ten'`,
+		`brokers: source data must be an array or slice, got int`,
+		`timeout: time: invalid duration "banana"`,
+		`nested.maxWaitDur: unknown configuration key`,
+		`restat: unknown configuration key (did you mean "restart"?)`,
+	}
+	errs := Errors(err)
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors but got %d: %+v", len(want), len(errs), errs)
+	}
+	for i, e := range errs {
+		if e.Error() != want[i] {
+			t.Errorf("unexpected error message: want %q, got %q", want[i], e.Error())
+		}
+	}
+}
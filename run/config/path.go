@@ -0,0 +1,82 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// PathError records an error along with the path to the configuration value
+// that caused it, such as `middleware[2].fnrun.middleware/jq.input`.
+type PathError struct {
+	Path string
+	Err  error
+}
+
+func (e *PathError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
+
+func joinPath(segment, path string) string {
+	if path == "" {
+		return segment
+	}
+	if segment == "" {
+		return path
+	}
+	if strings.HasPrefix(path, "[") {
+		return segment + path
+	}
+	return segment + "." + path
+}
+
+// WithPath prefixes the path of err with segment. If err is a joined error,
+// each of the joined errors is prefixed. WithPath returns nil if err is nil.
+func WithPath(segment string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs := joined.Unwrap()
+		wrapped := make([]error, len(errs))
+		for i, e := range errs {
+			wrapped[i] = WithPath(segment, e)
+		}
+		return errors.Join(wrapped...)
+	}
+
+	if pathErr, ok := err.(*PathError); ok {
+		return &PathError{Path: joinPath(segment, pathErr.Path), Err: pathErr.Err}
+	}
+
+	return &PathError{Path: segment, Err: err}
+}
+
+// Index returns the path segment for the element at index i of an array.
+func Index(i int) string {
+	return fmt.Sprintf("[%d]", i)
+}
+
+// Errors flattens err into the list of errors it contains. Joined errors are
+// expanded recursively; any other error is returned as the only element.
+func Errors(err error) []error {
+	if err == nil {
+		return nil
+	}
+
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []error{err}
+	}
+
+	var errs []error
+	for _, e := range joined.Unwrap() {
+		errs = append(errs, Errors(e)...)
+	}
+	return errs
+}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestWithPath_nested(t *testing.T) {
+	errBase := errors.New("unexpected EOF")
+	err := WithPath("middleware",
+		WithPath(Index(2),
+			WithPath("fnrun.middleware/jq",
+				WithPath("input", errBase))))
+
+	want := "middleware[2].fnrun.middleware/jq.input: unexpected EOF"
+	if got := err.Error(); got != want {
+		t.Errorf("unexpected error message: want %q, got %q", want, got)
+	}
+
+	if !errors.Is(err, errBase) {
+		t.Errorf("expected error to wrap %+v but got %+v", errBase, err)
+	}
+}
+
+func TestWithPath_nil(t *testing.T) {
+	if err := WithPath("source", nil); err != nil {
+		t.Errorf("expected nil error but got %+v", err)
+	}
+}
+
+func TestWithPath_joinedErrors(t *testing.T) {
+	err := WithPath("fn", errors.Join(
+		WithPath("input", errors.New("first")),
+		WithPath("output", errors.New("second")),
+	))
+
+	errs := Errors(err)
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors but got %d: %+v", len(errs), errs)
+	}
+
+	want := []string{"fn.input: first", "fn.output: second"}
+	for i, e := range errs {
+		if e.Error() != want[i] {
+			t.Errorf("unexpected error message: want %q, got %q", want[i], e.Error())
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package config
+
+// Schema is a JSON Schema description of a configuration value. It supports the
+// subset of JSON Schema needed to describe the configuration of sources,
+// middleware, and fns, and it marshals to a valid JSON Schema document.
+type Schema struct {
+	SchemaURI   string             `json:"$schema,omitempty"`
+	Ref         string             `json:"$ref,omitempty"`
+	Title       string             `json:"title,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	Default     interface{}        `json:"default,omitempty"`
+	Enum        []interface{}      `json:"enum,omitempty"`
+	Examples    []interface{}      `json:"examples,omitempty"`
+	Minimum     *float64           `json:"minimum,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	OneOf       []*Schema          `json:"oneOf,omitempty"`
+	Defs        map[string]*Schema `json:"$defs,omitempty"`
+
+	// AdditionalProperties describes the values of keys not listed in
+	// Properties. A nil value allows any additional keys, and a Schema with
+	// Not set rejects them.
+	AdditionalProperties *Schema `json:"additionalProperties,omitempty"`
+	Not                  *Schema `json:"not,omitempty"`
+
+	MinProperties int `json:"minProperties,omitempty"`
+	MaxProperties int `json:"maxProperties,omitempty"`
+}
+
+// Describer describes the configuration accepted by an object. Describe should
+// return a new Schema on each call so that callers may modify it.
+type Describer interface {
+	Describe() *Schema
+}
+
+// Describe returns the description of target's configuration if it implements
+// Describer. Otherwise, Describe returns an empty Schema, which accepts any
+// value.
+func Describe(target interface{}) *Schema {
+	if d, ok := target.(Describer); ok {
+		return d.Describe()
+	}
+	return &Schema{}
+}
+
+// Minimum returns a pointer to v for use as the Minimum of a Schema.
+func Minimum(v float64) *float64 {
+	return &v
+}
+
+// NoAdditionalProperties returns a Schema for use as AdditionalProperties that
+// rejects keys not listed in Properties, matching the behavior of Decode.
+func NoAdditionalProperties() *Schema {
+	return &Schema{Not: &Schema{}}
+}
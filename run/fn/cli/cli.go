@@ -12,11 +12,18 @@
 // Systems that use this as the base Fn will have developers write functions as
 // CLI applications using any technology that can read and write standard
 // standard streams.
+//
+// A script receives the trace context of its invocation in the TRACEPARENT and
+// TRACESTATE environment variables. Because a long-running command cannot
+// receive new environment variables, the fn may instead be configured with
+// `traceEnvelope` to write each input as a single-line JSON object with a
+// `traceparent` field and an `input` field containing the original input.
 package cli
 
 import (
 	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
@@ -24,7 +31,9 @@ import (
 	"os/exec"
 
 	"github.com/fnrun/fnrun/fn"
-	"github.com/mitchellh/mapstructure"
+	"github.com/fnrun/fnrun/run"
+	"github.com/fnrun/fnrun/run/config"
+	"github.com/fnrun/fnrun/run/tracing"
 	"github.com/tessellator/executil"
 )
 
@@ -56,7 +65,23 @@ func scanAndLogMessages(stream io.ReadCloser) error {
 var ErrUnconfiguredCmd = fmt.Errorf("cli: unconfigured command")
 
 type cliFn struct {
-	f fn.Fn
+	f             fn.Fn
+	traceEnvelope bool
+}
+
+type envelope struct {
+	Traceparent string      `json:"traceparent,omitempty"`
+	Input       interface{} `json:"input"`
+}
+
+// wrapInput returns input wrapped in an envelope with the trace context of ctx
+// as a single-line JSON string.
+func wrapInput(ctx context.Context, input interface{}) (string, error) {
+	b, err := json.Marshal(&envelope{
+		Traceparent: tracing.Traceparent(ctx),
+		Input:       input,
+	})
+	return string(b), err
 }
 
 func (c *cliFn) RequiresConfig() bool {
@@ -75,11 +100,12 @@ func (c *cliFn) ConfigureString(commandStr string) error {
 
 func (c *cliFn) ConfigureMap(configMap map[string]interface{}) error {
 	cfg := struct {
-		Command string   `mapstructure:"command"`
-		Env     []string `mapstructure:"env"`
-		Script  bool     `mapstructure:"script"`
+		Command       string   `mapstructure:"command"`
+		Env           []string `mapstructure:"env"`
+		Script        bool     `mapstructure:"script"`
+		TraceEnvelope bool     `mapstructure:"traceEnvelope"`
 	}{}
-	err := mapstructure.Decode(configMap, &cfg)
+	err := config.Decode(configMap, &cfg)
 	if err != nil {
 		return err
 	}
@@ -89,6 +115,8 @@ func (c *cliFn) ConfigureMap(configMap map[string]interface{}) error {
 		return err
 	}
 
+	c.traceEnvelope = cfg.TraceEnvelope
+
 	if cfg.Script {
 		c.f = newScript(baseCmd)
 		return nil
@@ -103,9 +131,68 @@ func (c *cliFn) Invoke(ctx context.Context, input interface{}) (interface{}, err
 		return nil, ErrUnconfiguredCmd
 	}
 
+	if c.traceEnvelope {
+		wrapped, err := wrapInput(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		input = wrapped
+	}
+
 	return c.f.Invoke(ctx, input)
 }
 
+func (c *cliFn) Start(ctx context.Context) error {
+	if c.f == nil {
+		return ErrUnconfiguredCmd
+	}
+
+	return run.Start(ctx, c.f)
+}
+
+func (c *cliFn) Close() error {
+	return run.Close(c.f)
+}
+
+// Describe describes the configuration of the cli fn.
+func (*cliFn) Describe() *config.Schema {
+	return &config.Schema{
+		Description: "Runs an external command and exchanges single-line inputs and outputs with it over stdin and stdout.",
+		OneOf: []*config.Schema{
+			{
+				Type:        "string",
+				Description: "The command to run as a long-running service.",
+			},
+			{
+				Type: "object",
+				Properties: map[string]*config.Schema{
+					"command": {
+						Type:        "string",
+						Description: "The command to run.",
+					},
+					"env": {
+						Type:        "array",
+						Description: "Additional environment variables for the command in KEY=value form.",
+						Items:       &config.Schema{Type: "string"},
+					},
+					"script": {
+						Type:        "boolean",
+						Description: "Whether to run a new instance of the command for each input instead of a long-running service.",
+						Default:     false,
+					},
+					"traceEnvelope": {
+						Type:        "boolean",
+						Description: "Whether to write each input as a JSON object with traceparent and input fields.",
+						Default:     false,
+					},
+				},
+				Required:             []string{"command"},
+				AdditionalProperties: config.NoAdditionalProperties(),
+			},
+		},
+	}
+}
+
 // New creates an unconfigured Fn. The result of this function must be
 // configured with a command string, otherwise ErrUnconfiguredCmd will be
 // returned from calls to Invoke.
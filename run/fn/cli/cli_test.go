@@ -7,6 +7,8 @@ import (
 	"testing"
 
 	"github.com/fnrun/fnrun/run/config"
+	"github.com/fnrun/fnrun/run/tracing"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 func TestNew_withoutConfigReturnsUnconfiguredError(t *testing.T) {
@@ -96,3 +98,31 @@ func TestCliFn_Invoke(t *testing.T) {
 		t.Errorf("unexpected output: want %q, got %q", want, got)
 	}
 }
+
+func TestCliFn_Invoke_traceEnvelope(t *testing.T) {
+	configMap := map[string]interface{}{
+		"command":       fmt.Sprintf("%s -test.run=%s", os.Args[0], "Test_HelperSubprocess"),
+		"env":           []string{"GO_RUNNING_SUBPROCESS=1"},
+		"traceEnvelope": true,
+	}
+	f := New()
+	err := config.Configure(f, configMap)
+	if err != nil {
+		t.Fatalf("Configure returned err: %+v", err)
+	}
+
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	ctx := tracing.Extract(context.Background(), propagation.MapCarrier{"traceparent": traceparent})
+
+	output, err := f.Invoke(ctx, "some input")
+	if err != nil {
+		t.Fatalf("Invoke returned error: %+v", err)
+	}
+
+	want := `from subprocess: {"traceparent":"` + traceparent + `","input":"some input"}`
+	got := output.(string)
+
+	if got != want {
+		t.Errorf("unexpected output: want %q, got %q", want, got)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os/exec"
 
+	"github.com/fnrun/fnrun/run/tracing"
 	"github.com/tessellator/executil"
 )
 
@@ -14,6 +15,9 @@ type script struct {
 
 func (s *script) Invoke(ctx context.Context, input interface{}) (interface{}, error) {
 	cmd := executil.CloneCmd(s.baseCmd)
+	// Copy the environment before appending to it so that concurrent
+	// invocations do not share a backing array.
+	cmd.Env = append(cmd.Env[:len(cmd.Env):len(cmd.Env)], tracing.Environ(ctx)...)
 
 	stderr, err := cmd.StderrPipe()
 	if err != nil {
@@ -11,6 +11,9 @@ import (
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/fnrun/fnrun/run/tracing"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 func TestScript_Invoke(t *testing.T) {
@@ -42,6 +45,33 @@ func TestScript_Invoke(t *testing.T) {
 	}
 }
 
+func TestScript_Invoke_setsTraceparent(t *testing.T) {
+	commandStr := fmt.Sprintf("%s -test.run=%s", os.Args[0], "Test_HelperScript")
+	env := []string{"GO_RUNNING_SUBPROCESS=1"}
+
+	baseCmd, err := createBaseCmd(commandStr, env...)
+	if err != nil {
+		t.Fatalf("createBaseCmd returned error: %+v", err)
+	}
+
+	s := newScript(baseCmd)
+
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	ctx := tracing.Extract(context.Background(), propagation.MapCarrier{"traceparent": traceparent})
+
+	output, err := s.Invoke(ctx, "traceparent")
+	if err != nil {
+		t.Fatalf("Invoke returned error: %+v", err)
+	}
+
+	want := "from subprocess: " + traceparent
+	got := strings.Split(output.(string), "\n")[0]
+
+	if got != want {
+		t.Errorf("unexpected output: want %q, got %q", want, got)
+	}
+}
+
 func TestScript_Invoke_crashingProcess(t *testing.T) {
 	commandStr := fmt.Sprintf("%s -test.run=%s", os.Args[0], "Test_HelperScript")
 	env := []string{"GO_RUNNING_SUBPROCESS=1"}
@@ -134,6 +164,11 @@ func Test_HelperScript(t *testing.T) {
 		os.Exit(1)
 	}
 
+	if input == "traceparent" {
+		fmt.Printf("from subprocess: %s\n", os.Getenv("TRACEPARENT"))
+		return
+	}
+
 	if input == "sleep" {
 		<-time.After(100 * time.Millisecond)
 	}
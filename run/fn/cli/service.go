@@ -98,6 +98,22 @@ func (s *service) start() error {
 	return nil
 }
 
+// Start starts the long-running command so that it is ready before the first
+// invocation.
+func (s *service) Start(ctx context.Context) error {
+	return s.start()
+}
+
+// Close stops the command if it is running.
+func (s *service) Close() error {
+	if !s.getAlive() {
+		return nil
+	}
+
+	_ = s.stdin.Close()
+	return s.kill()
+}
+
 func (s *service) Invoke(ctx context.Context, input interface{}) (interface{}, error) {
 	if err := s.start(); err != nil {
 		return nil, err
@@ -117,6 +117,24 @@ func TestService_Invoke_hangingSubprocess(t *testing.T) {
 	}
 }
 
+func TestService_StartAndClose(t *testing.T) {
+	f := newSubprocessFn(t).(*service)
+
+	if err := f.Start(context.Background()); err != nil {
+		t.Fatalf("Start returned error: %+v", err)
+	}
+	if !f.getAlive() {
+		t.Fatal("expected subprocess to be running after Start")
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close returned error: %+v", err)
+	}
+	if f.getAlive() {
+		t.Error("expected subprocess to be stopped after Close")
+	}
+}
+
 // -----------------------------------------------------------------------------
 
 func Test_HelperSubprocess(t *testing.T) {
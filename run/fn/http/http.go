@@ -2,6 +2,9 @@
 // endpoint and return the response body as output. The fn considers 2xx and 3xx
 // HTTP status codes on the response as successfully invocations, and other
 // status codes as errors.
+//
+// The fn sends the trace context of each invocation in the traceparent header
+// of its request.
 package http
 
 import (
@@ -10,11 +13,31 @@ import (
 	"errors"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 
 	"github.com/fnrun/fnrun/fn"
-	"github.com/mitchellh/mapstructure"
+	"github.com/fnrun/fnrun/run/config"
+	"github.com/fnrun/fnrun/run/tracing"
+	"go.opentelemetry.io/otel/propagation"
 )
 
+// StatusError is the error returned when the endpoint responds with a 4xx or
+// 5xx status code. Its message is the body of the response.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return e.Body
+}
+
+// HTTPStatus returns the status code of the response, which the retry
+// middleware uses to classify the error.
+func (e *StatusError) HTTPStatus() int {
+	return e.StatusCode
+}
+
 type httpFn struct {
 	config *httpFnConfig
 }
@@ -30,8 +53,14 @@ func (h *httpFn) Invoke(ctx context.Context, input interface{}) (interface{}, er
 		return nil, errors.New("expected input to be a string")
 	}
 
-	resp, err := http.Post(h.config.TargetURL, h.config.ContentType, bytes.NewBuffer([]byte(body)))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.config.TargetURL, bytes.NewBufferString(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", h.config.ContentType)
+	tracing.Inject(ctx, propagation.HeaderCarrier(req.Header))
 
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -45,7 +74,7 @@ func (h *httpFn) Invoke(ctx context.Context, input interface{}) (interface{}, er
 	output := string(outputBytes)
 
 	if resp.StatusCode >= 400 {
-		return nil, errors.New(output)
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: output}
 	}
 	return output, nil
 }
@@ -55,7 +84,38 @@ func (*httpFn) RequiresConfig() bool {
 }
 
 func (h *httpFn) ConfigureMap(configMap map[string]interface{}) error {
-	return mapstructure.Decode(configMap, h.config)
+	return config.Decode(configMap, h.config)
+}
+
+func (h *httpFn) Validate() error {
+	if h.config.TargetURL == "" {
+		return errors.New("targetURL is required")
+	}
+	if _, err := url.ParseRequestURI(h.config.TargetURL); err != nil {
+		return config.WithPath("targetURL", err)
+	}
+	return nil
+}
+
+// Describe describes the configuration of the http fn.
+func (*httpFn) Describe() *config.Schema {
+	return &config.Schema{
+		Description: "Posts its input to a remote HTTP endpoint and returns the response body. Responses with status codes of 400 or greater are errors.",
+		Type:        "object",
+		Properties: map[string]*config.Schema{
+			"targetURL": {
+				Type:        "string",
+				Description: "The URL to post inputs to.",
+			},
+			"contentType": {
+				Type:        "string",
+				Description: "The Content-Type header of each request.",
+				Default:     "application/json",
+			},
+		},
+		Required:             []string{"targetURL"},
+		AdditionalProperties: config.NoAdditionalProperties(),
+	}
 }
 
 // New returns an http fn with default values. The result of this must be
@@ -2,6 +2,7 @@ package http_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -10,6 +11,8 @@ import (
 
 	"github.com/fnrun/fnrun/run/config"
 	httpfn "github.com/fnrun/fnrun/run/fn/http"
+	"github.com/fnrun/fnrun/run/tracing"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 func TestConfigure_invalidValue(t *testing.T) {
@@ -100,6 +103,13 @@ func TestInvoke_clientReceivesErrorHTTPResponse(t *testing.T) {
 	}
 
 	equals(t, err.Error(), "some response")
+
+	var statusErr *httpfn.StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("expected a StatusError but got %T", err)
+	}
+	equals(t, statusErr.StatusCode, 400)
+	equals(t, statusErr.HTTPStatus(), 400)
 }
 
 func TestInvoke_clientReceivesOKResponse(t *testing.T) {
@@ -132,3 +142,26 @@ func TestInvoke_clientReceivesOKResponse(t *testing.T) {
 
 	equals(t, output, "some response")
 }
+
+func TestInvoke_sendsTraceContext(t *testing.T) {
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		equals(t, req.Header.Get("traceparent"), traceparent)
+		rw.WriteHeader(200)
+	}))
+	defer server.Close()
+
+	f := httpfn.New()
+	err := config.Configure(f, map[string]interface{}{
+		"targetURL": server.URL,
+	})
+	if err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+
+	ctx := tracing.Extract(context.Background(), propagation.MapCarrier{"traceparent": traceparent})
+	if _, err := f.Invoke(ctx, "some input"); err != nil {
+		t.Errorf("Invoke returned error: %+v", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 
 	"github.com/fnrun/fnrun/fn"
+	"github.com/fnrun/fnrun/run/config"
 )
 
 type identityFn struct{}
@@ -13,6 +14,13 @@ func (*identityFn) Invoke(ctx context.Context, input interface{}) (interface{},
 	return input, nil
 }
 
+// Describe describes the identity fn, which takes no configuration.
+func (*identityFn) Describe() *config.Schema {
+	return &config.Schema{
+		Description: "Returns its input as output. It takes no configuration.",
+	}
+}
+
 // New returns a function that returns its input.
 //
 // The identity function is useful for testing or when all processing of an
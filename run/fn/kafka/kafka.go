@@ -0,0 +1,218 @@
+// Package kafka provides a kafka fn. The kafka fn publishes each input to a
+// topic and returns the topic, partition, and offset of the message as
+// output, so a pipeline from another source to Kafka needs no other fn.
+//
+// The key, value, partition, and headers of each message may be chosen from
+// the input with jq programs. By default, messages have no key, are
+// partitioned by the hash of their key, and their value is the input, encoded
+// as JSON unless it is a string. To echo the output as the body of an http
+// source response, serialize it with the json middleware.
+//
+// In transactional mode, the fn publishes each input in the transaction that a
+// transactional kafka source began for the message being processed, instead
+// of with its own producer.
+//
+// The fn sends the trace context of each invocation in the traceparent header
+// of its message.
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/Shopify/sarama"
+	"github.com/fnrun/fnrun/fn"
+	"github.com/fnrun/fnrun/run/config"
+	"github.com/fnrun/fnrun/run/kafkaproducer"
+	"github.com/fnrun/fnrun/run/tracing"
+	"github.com/mitchellh/mapstructure"
+)
+
+type kafkaFn struct {
+	kafkaproducer.Config `mapstructure:",squash"`
+	kafkaproducer.Record `mapstructure:",squash"`
+
+	Topic         string
+	Transactional bool
+
+	mutex    sync.Mutex
+	producer sarama.SyncProducer
+}
+
+func (*kafkaFn) RequiresConfig() bool {
+	return true
+}
+
+func (k *kafkaFn) ConfigureMap(configMap map[string]interface{}) error {
+	if err := config.Decode(configMap, k, mapstructure.StringToSliceHookFunc(",")); err != nil {
+		return err
+	}
+
+	return k.Compile()
+}
+
+func (k *kafkaFn) Validate() error {
+	if k.Topic == "" {
+		return errors.New("topic is required")
+	}
+	if k.Transactional {
+		return k.Config.ValidateTransactional()
+	}
+
+	return k.Config.Validate()
+}
+
+// connect creates the producer if it has not been created. k.mutex must be
+// held.
+func (k *kafkaFn) connect() error {
+	if k.producer != nil {
+		return nil
+	}
+
+	saramaConfig, err := k.NewSaramaConfig()
+	if err != nil {
+		return err
+	}
+	if k.Partitioned() {
+		saramaConfig.Producer.Partitioner = kafkaproducer.NewPartitioner
+	}
+
+	producer, err := sarama.NewSyncProducer(k.Brokers, saramaConfig)
+	if err != nil {
+		return err
+	}
+	k.producer = producer
+	return nil
+}
+
+// Start connects the producer to the brokers unless the fn is transactional.
+func (k *kafkaFn) Start(ctx context.Context) error {
+	if k.Transactional {
+		return nil
+	}
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	return k.connect()
+}
+
+// Close closes the producer if it has been created.
+func (k *kafkaFn) Close() error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if k.producer == nil {
+		return nil
+	}
+
+	producer := k.producer
+	k.producer = nil
+	return producer.Close()
+}
+
+// transactionOrProducer returns the producer that publishes the message of an
+// invocation: that of the transaction in ctx in transactional mode, and the
+// producer of k otherwise.
+func (k *kafkaFn) transactionOrProducer(ctx context.Context) (sarama.SyncProducer, error) {
+	if k.Transactional {
+		return kafkaproducer.Transaction(ctx)
+	}
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if err := k.connect(); err != nil {
+		return nil, err
+	}
+	return k.producer, nil
+}
+
+func (k *kafkaFn) Invoke(ctx context.Context, input interface{}) (interface{}, error) {
+	producer, err := k.transactionOrProducer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := k.Message(ctx, k.Topic, input, input)
+	if err != nil {
+		return nil, err
+	}
+	tracing.Inject(ctx, headerCarrier{message})
+
+	partition, offset, err := producer.SendMessage(message)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"topic":     k.Topic,
+		"partition": int(partition),
+		"offset":    int(offset),
+	}, nil
+}
+
+// Describe describes the configuration of the kafka fn.
+func (k *kafkaFn) Describe() *config.Schema {
+	properties := map[string]*config.Schema{
+		"topic": {
+			Type:        "string",
+			Description: "The topic inputs are published to.",
+		},
+		"transactional": {
+			Type: "boolean",
+			Description: "Whether inputs are published in the transaction of a transactional kafka source, so that they are committed together with the offset of the consumed message. " +
+				"The topic must be in the cluster of the source, and the options of the producer such as brokers cannot be set.",
+			Default: false,
+		},
+	}
+	for key, schema := range k.Config.DescribeProperties() {
+		properties[key] = schema
+	}
+	for key, schema := range k.Record.DescribeProperties("the input") {
+		properties[key] = schema
+	}
+
+	return &config.Schema{
+		Description: "Publishes its input to a Kafka topic and returns the topic, partition, and offset of the message.",
+		Type:        "object",
+		Properties:  properties,
+		Required:    []string{"topic"},
+
+		AdditionalProperties: config.NoAdditionalProperties(),
+	}
+}
+
+// New returns a kafka fn. It must be configured with a topic, and with brokers
+// unless it is transactional.
+func New() fn.Fn {
+	return &kafkaFn{}
+}
+
+// headerCarrier adapts the headers of a message being produced to a
+// propagation.TextMapCarrier.
+type headerCarrier struct {
+	message *sarama.ProducerMessage
+}
+
+func (c headerCarrier) Get(key string) string {
+	for _, header := range c.message.Headers {
+		if string(header.Key) == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+func (c headerCarrier) Set(key, value string) {
+	c.message.Headers = append(c.message.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, len(c.message.Headers))
+	for i, header := range c.message.Headers {
+		keys[i] = string(header.Key)
+	}
+	return keys
+}
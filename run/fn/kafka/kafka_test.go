@@ -0,0 +1,158 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/fnrun/fnrun/run/config"
+	"github.com/fnrun/fnrun/run/kafkaproducer"
+	"github.com/fnrun/fnrun/run/tracing"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func configure(t *testing.T, configMap map[string]interface{}) *kafkaFn {
+	t.Helper()
+
+	k := New().(*kafkaFn)
+	if err := config.Configure(k, configMap); err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+	return k
+}
+
+func TestInvoke(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(message *sarama.ProducerMessage) error {
+		key, _ := message.Key.Encode()
+		value, _ := message.Value.Encode()
+		if message.Topic != "orders" || string(key) != "order-1" || string(value) != `{"id":"order-1","total":12}` {
+			return fmt.Errorf("unexpected message: %s %s %s", message.Topic, key, value)
+		}
+		return nil
+	})
+
+	k := configure(t, map[string]interface{}{
+		"brokers": "127.0.0.1",
+		"topic":   "orders",
+		"key":     ".id",
+	})
+	k.producer = producer
+
+	output, err := k.Invoke(context.Background(), map[string]interface{}{"id": "order-1", "total": 12})
+	if err != nil {
+		t.Fatalf("Invoke returned error: %+v", err)
+	}
+
+	want := map[string]interface{}{"topic": "orders", "partition": 0, "offset": 1}
+	if !reflect.DeepEqual(output, want) {
+		t.Errorf("unexpected output: want %v, got %v", want, output)
+	}
+
+	if err := k.Close(); err != nil {
+		t.Errorf("Close returned error: %+v", err)
+	}
+}
+
+func TestInvoke_stringInput(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithCheckerFunctionAndSucceed(func(value []byte) error {
+		if string(value) != "some value" {
+			return fmt.Errorf("unexpected value: %q", value)
+		}
+		return nil
+	})
+
+	k := configure(t, map[string]interface{}{"brokers": "127.0.0.1", "topic": "orders"})
+	k.producer = producer
+
+	if _, err := k.Invoke(context.Background(), "some value"); err != nil {
+		t.Fatalf("Invoke returned error: %+v", err)
+	}
+}
+
+func TestInvoke_sendError(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageAndFail(sarama.ErrNotLeaderForPartition)
+
+	k := configure(t, map[string]interface{}{"brokers": "127.0.0.1", "topic": "orders"})
+	k.producer = producer
+
+	if _, err := k.Invoke(context.Background(), "some value"); err != sarama.ErrNotLeaderForPartition {
+		t.Errorf("unexpected error: want %v, got %+v", sarama.ErrNotLeaderForPartition, err)
+	}
+}
+
+func TestInvoke_transactional(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageAndSucceed()
+
+	k := configure(t, map[string]interface{}{"topic": "orders", "transactional": true})
+	if err := k.Start(context.Background()); err != nil {
+		t.Fatalf("Start returned error: %+v", err)
+	}
+
+	if _, err := k.Invoke(context.Background(), "some value"); err != kafkaproducer.ErrNoTransaction {
+		t.Errorf("unexpected error: want %v, got %+v", kafkaproducer.ErrNoTransaction, err)
+	}
+
+	ctx := kafkaproducer.WithTransaction(context.Background(), producer)
+	if _, err := k.Invoke(ctx, "some value"); err != nil {
+		t.Fatalf("Invoke returned error: %+v", err)
+	}
+	if k.producer != nil {
+		t.Error("expected the fn not to create a producer of its own")
+	}
+}
+
+func TestInvoke_injectsTraceContext(t *testing.T) {
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(message *sarama.ProducerMessage) error {
+		if got := (headerCarrier{message}).Get("traceparent"); got != traceparent {
+			return fmt.Errorf("unexpected traceparent: want %q, got %q", traceparent, got)
+		}
+		return nil
+	})
+
+	k := configure(t, map[string]interface{}{"brokers": "127.0.0.1", "topic": "orders"})
+	k.producer = producer
+
+	ctx := tracing.Extract(context.Background(), propagation.MapCarrier{"traceparent": traceparent})
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		t.Fatal("expected the context to carry a span context")
+	}
+
+	if _, err := k.Invoke(ctx, "some value"); err != nil {
+		t.Fatalf("Invoke returned error: %+v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		configMap map[string]interface{}
+		want      string
+	}{
+		{configMap: map[string]interface{}{"brokers": "127.0.0.1", "topic": "orders", "partition": ".shard", "headers": map[string]interface{}{"type": ".type"}}},
+		{configMap: map[string]interface{}{"brokers": "127.0.0.1"}, want: "topic is required"},
+		{configMap: map[string]interface{}{"topic": "orders"}, want: "brokers must contain at least one broker"},
+		{configMap: map[string]interface{}{"brokers": "127.0.0.1", "topic": "orders", "compression": "brotli"}, want: `compression: unknown compression codec "brotli"`},
+	}
+
+	for _, test := range tests {
+		err := config.Configure(New(), test.configMap)
+
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != test.want {
+			t.Errorf("unexpected error for %v: want %q, got %q", test.configMap, test.want, got)
+		}
+	}
+}
@@ -1,5 +1,6 @@
 // Package loader provides an Fn implementation that can be configured with a
-// function configuration and registry.
+// function configuration and registry. The loaded fn is invoked in a tracing
+// span named by its registry key.
 package loader
 
 import (
@@ -9,10 +10,13 @@ import (
 	"github.com/fnrun/fnrun/fn"
 	"github.com/fnrun/fnrun/run"
 	"github.com/fnrun/fnrun/run/config"
+	"github.com/fnrun/fnrun/run/schema"
+	"github.com/fnrun/fnrun/run/tracing"
 )
 
 type wrappedFn struct {
 	fn       fn.Fn
+	key      string
 	registry run.Registry
 }
 
@@ -24,10 +28,11 @@ func (w *wrappedFn) ConfigureString(fnKey string) error {
 	fn := fnFactory()
 	err := config.Configure(fn, nil)
 	if err != nil {
-		return err
+		return config.WithPath(fnKey, err)
 	}
 
 	w.fn = fn
+	w.key = fnKey
 	return nil
 }
 
@@ -44,10 +49,11 @@ func (w *wrappedFn) ConfigureMap(configMap map[string]interface{}) error {
 
 	fn := fnFactory()
 	if err := config.Configure(fn, fnConfig); err != nil {
-		return err
+		return config.WithPath(fnKey, err)
 	}
 
 	w.fn = fn
+	w.key = fnKey
 	return nil
 }
 
@@ -55,8 +61,23 @@ func (w *wrappedFn) RequiresConfig() bool {
 	return true
 }
 
+func (w *wrappedFn) Start(ctx context.Context) error {
+	return run.Start(ctx, w.fn)
+}
+
+func (w *wrappedFn) Close() error {
+	return run.Close(w.fn)
+}
+
 func (w *wrappedFn) Invoke(ctx context.Context, input interface{}) (interface{}, error) {
-	return w.fn.Invoke(ctx, input)
+	return tracing.Invoke(ctx, w.key, w.fn, input)
+}
+
+// Describe describes the configuration of the fn selected by the loader.
+func (w *wrappedFn) Describe() *config.Schema {
+	s := schema.Components(w.registry.FnKeys())
+	s.Description = "The fn that processes inputs."
+	return s
 }
 
 // New creates a configurable Fn that can be configured with a string or map
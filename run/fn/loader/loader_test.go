@@ -50,7 +50,7 @@ func TestConfigureString_invalidFnConfiguration(t *testing.T) {
 	}
 
 	got := err.Error()
-	want := "*loader_test.prefixFn could not be configured with object of type <nil>"
+	want := "prefix: *loader_test.prefixFn could not be configured with object of type <nil>"
 	if got != want {
 		t.Errorf("unexpected error message: want %q, got %q", want, got)
 	}
@@ -3,6 +3,7 @@ package middleware
 
 import (
 	"context"
+	"errors"
 
 	"github.com/fnrun/fnrun/fn"
 	"github.com/fnrun/fnrun/run"
@@ -17,6 +18,23 @@ func (m *middlewareFn) Invoke(ctx context.Context, input interface{}) (interface
 	return m.middleware.Invoke(ctx, input, m.fn)
 }
 
+// Start starts the fn and then the middleware. If the middleware fails to
+// start, the fn is closed.
+func (m *middlewareFn) Start(ctx context.Context) error {
+	if err := run.Start(ctx, m.fn); err != nil {
+		return err
+	}
+	if err := run.Start(ctx, m.middleware); err != nil {
+		return errors.Join(err, run.Close(m.fn))
+	}
+	return nil
+}
+
+// Close closes the middleware and then the fn.
+func (m *middlewareFn) Close() error {
+	return run.CloseAll(m.fn, m.middleware)
+}
+
 // New creates an Fn that wraps fn with middleware.
 func New(middleware run.Middleware, fn fn.Fn) fn.Fn {
 	return &middlewareFn{
@@ -10,6 +10,11 @@
 // - concurrency: an int that describes how many Fns will exist in the pool
 // - maxWaitDuration: a string that can be parsed into a time.Duration
 // - template: a string or map configuration for an Fn
+//
+// The time spent waiting for an Fn is recorded in the
+// fnrun_pool_wait_duration_seconds metric, and the number of
+// ErrAvailabilityTimeout errors in the fnrun_pool_availability_timeouts_total
+// metric.
 package pool
 
 import (
@@ -21,26 +26,62 @@ import (
 	"github.com/fnrun/fnrun/fn"
 	"github.com/fnrun/fnrun/run"
 	"github.com/fnrun/fnrun/run/config"
-	"github.com/mitchellh/mapstructure"
+	"github.com/fnrun/fnrun/run/metrics"
+	"github.com/fnrun/fnrun/run/schema"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // ErrAvailabilityTimeout is an error that occurs when an Fn was not fetched
-// from the pool before a timeout occurred.
-var ErrAvailabilityTimeout = errors.New("could not get access to Fn before timeout")
+// from the pool before a timeout occurred. It reports itself as unavailable,
+// which the retry middleware can be configured to retry.
+var ErrAvailabilityTimeout error = availabilityTimeoutError{}
+
+type availabilityTimeoutError struct{}
+
+func (availabilityTimeoutError) Error() string {
+	return "could not get access to Fn before timeout"
+}
+
+// Unavailable reports that no Fn of the pool was available to handle the
+// input.
+func (availabilityTimeoutError) Unavailable() bool {
+	return true
+}
+
+var (
+	waitDuration = metrics.MustRegister(prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "pool",
+		Name:      "wait_duration_seconds",
+		Help:      "The time spent waiting for an Fn in the pool to become available.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 8),
+	}))
+	availabilityTimeouts = metrics.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "pool",
+		Name:      "availability_timeouts_total",
+		Help:      "The number of inputs that failed with ErrAvailabilityTimeout.",
+	}))
+)
 
 type poolFn struct {
 	maxWaitDuration time.Duration
 	registry        run.Registry
 	fnChan          chan fn.Fn
+	fns             []fn.Fn
 }
 
 func (p *poolFn) Invoke(ctx context.Context, input interface{}) (interface{}, error) {
+	start := time.Now()
 	select {
 	case f := <-p.fnChan:
+		waitDuration.Observe(time.Since(start).Seconds())
 		output, err := f.Invoke(ctx, input)
 		p.fnChan <- f
 		return output, err
 	case <-time.After(p.maxWaitDuration):
+		waitDuration.Observe(time.Since(start).Seconds())
+		availabilityTimeouts.Inc()
 		return nil, ErrAvailabilityTimeout
 	}
 }
@@ -55,7 +96,7 @@ func createFn(r run.Registry, fnName string, cfg interface{}) (fn.Fn, error) {
 		return nil, fmt.Errorf("a registered fn not found for key %q", fnName)
 	}
 	f := factory()
-	return f, config.Configure(f, cfg)
+	return f, config.WithPath(fnName, config.Configure(f, cfg))
 }
 
 func createFnFromTemplate(r run.Registry, cfg interface{}) (fn.Fn, error) {
@@ -80,7 +121,7 @@ func (p *poolFn) ConfigureMap(configMap map[string]interface{}) error {
 		Template        interface{} `mapstructure:"template"`
 	}{}
 
-	err := mapstructure.Decode(configMap, &cfg)
+	err := config.Decode(configMap, &cfg)
 	if err != nil {
 		return err
 	}
@@ -100,18 +141,64 @@ func (p *poolFn) ConfigureMap(configMap map[string]interface{}) error {
 	}
 
 	p.fnChan = make(chan fn.Fn, concurrency)
+	p.fns = make([]fn.Fn, 0, concurrency)
 
 	for i := 0; i < concurrency; i++ {
 		f, err := createFnFromTemplate(p.registry, cfg.Template)
 		if err != nil {
-			return err
+			return config.WithPath("template", err)
 		}
 		p.fnChan <- f
+		p.fns = append(p.fns, f)
 	}
 
 	return nil
 }
 
+func (p *poolFn) Start(ctx context.Context) error {
+	for _, f := range p.fns {
+		if err := run.Start(ctx, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *poolFn) Close() error {
+	values := make([]interface{}, len(p.fns))
+	for i, f := range p.fns {
+		values[i] = f
+	}
+	return run.CloseAll(values...)
+}
+
+// Describe describes the configuration of the pool fn.
+func (p *poolFn) Describe() *config.Schema {
+	template := schema.Components(p.registry.FnKeys())
+	template.Description = "The configuration of each fn in the pool."
+
+	return &config.Schema{
+		Description: "Maintains a pool of fns that each process one input at a time.",
+		Type:        "object",
+		Properties: map[string]*config.Schema{
+			"concurrency": {
+				Type:        "integer",
+				Description: "The number of fns in the pool.",
+				Default:     8,
+				Minimum:     config.Minimum(0),
+			},
+			"maxWaitDuration": {
+				Type:        "string",
+				Description: "How long to wait for an fn to become available before returning an error, as a Go duration string.",
+				Default:     "500ms",
+			},
+			"template": template,
+		},
+		Required:             []string{"template"},
+		AdditionalProperties: config.NoAdditionalProperties(),
+	}
+}
+
 // New creates a new Fn pool that must be configured before use.
 func New(registry run.Registry) fn.Fn {
 	return &poolFn{
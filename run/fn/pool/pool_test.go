@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -84,6 +85,10 @@ func TestNew_withTimeout(t *testing.T) {
 		t.Errorf("expected Invoke on tapped pool to return ErrAvailabilityTime but returned: %+v", err)
 	}
 
+	if unavailable, ok := err.(interface{ Unavailable() bool }); !ok || !unavailable.Unavailable() {
+		t.Errorf("expected ErrAvailabilityTimeout to report that the pool was unavailable")
+	}
+
 	if output != nil {
 		t.Errorf("expected output to be nil but it was: %#v", output)
 	}
@@ -111,7 +116,7 @@ func TestConfigure_unknownFn(t *testing.T) {
 	}
 
 	got := err.Error()
-	want := `a registered fn not found for key "unknown-fn"`
+	want := `template: a registered fn not found for key "unknown-fn"`
 
 	if got != want {
 		t.Errorf("unexecpted error message: want %q, got %q", want, got)
@@ -130,7 +135,7 @@ func TestConfigureMap_configWithInvalidUndecodableValue(t *testing.T) {
 	}
 
 	got := err.Error()
-	want := "1 error(s) decoding:\n\n* 'concurrency' expected type 'int', got unconvertible type 'string', value: 'not an int'"
+	want := "concurrency: expected type 'int', got unconvertible type 'string', value: 'not an int'"
 
 	if got != want {
 		t.Errorf("unexpected error message: want %q, got %q", want, got)
@@ -156,6 +161,27 @@ func TestConfigureMap_configWithInvalidDurationString(t *testing.T) {
 	}
 }
 
+func TestConfigureMap_unknownKey(t *testing.T) {
+	r := run.NewRegistry()
+	r.RegisterFn("echo", NewEchoFn)
+	p := pool.New(r)
+
+	err := config.Configure(p, map[string]interface{}{
+		"maxWaitDuraton": "5ms",
+		"template":       "echo",
+	})
+	if err == nil {
+		t.Fatal("expected config.Configure to return an error and it did not")
+	}
+
+	got := err.Error()
+	want := `maxWaitDuraton: unknown configuration key (did you mean "maxWaitDuration"?)`
+
+	if got != want {
+		t.Errorf("unexpected error message: want %q, got %q", want, got)
+	}
+}
+
 func TestConfigureMap_templateMapConfig(t *testing.T) {
 	r := run.NewRegistry()
 	r.RegisterFn("map", func() fn.Fn { return &mapFn{} })
@@ -205,7 +231,7 @@ func TestConfigureMap_templateMapConfig_multipleValues(t *testing.T) {
 	}
 
 	got := err.Error()
-	want := "expected map to have exactly one entry"
+	want := "template: expected map to have exactly one entry"
 
 	if got != want {
 		t.Errorf("unexpected error message: want %q, got %q", want, got)
@@ -225,13 +251,44 @@ func TestConfigureMap_templateInvalidType(t *testing.T) {
 	}
 
 	got := err.Error()
-	want := "unsupported config type"
+	want := "template: unsupported config type"
 
 	if got != want {
 		t.Errorf("unexpected error message: want %q, got %q", want, got)
 	}
 }
 
+func TestStartAndClose(t *testing.T) {
+	var started, closed int32
+	r := run.NewRegistry()
+	r.RegisterFn("counting", func() fn.Fn {
+		return &countingFn{started: &started, closed: &closed}
+	})
+
+	p := pool.New(r)
+	err := config.Configure(p, map[string]interface{}{
+		"concurrency": 3,
+		"template":    "counting",
+	})
+	if err != nil {
+		t.Fatalf("Configuring the pool returned an err: %+v", err)
+	}
+
+	if err := run.Start(context.Background(), p); err != nil {
+		t.Fatalf("Start returned error: %+v", err)
+	}
+	if err := run.Close(p); err != nil {
+		t.Fatalf("Close returned error: %+v", err)
+	}
+
+	if started != 3 {
+		t.Errorf("unexpected number of started fns: want 3, got %d", started)
+	}
+	if closed != 3 {
+		t.Errorf("unexpected number of closed fns: want 3, got %d", closed)
+	}
+}
+
 // -----------------------------------------------------------------------------
 // Sample functions
 
@@ -270,3 +327,22 @@ func (m *mapFn) ConfigureMap(configMap map[string]interface{}) error {
 func (m *mapFn) Invoke(context.Context, interface{}) (interface{}, error) {
 	return fmt.Sprintf("count: %d, name: %s", m.Count, m.Name), nil
 }
+
+type countingFn struct {
+	started *int32
+	closed  *int32
+}
+
+func (c *countingFn) Start(context.Context) error {
+	atomic.AddInt32(c.started, 1)
+	return nil
+}
+
+func (c *countingFn) Close() error {
+	atomic.AddInt32(c.closed, 1)
+	return nil
+}
+
+func (*countingFn) Invoke(ctx context.Context, input interface{}) (interface{}, error) {
+	return input, nil
+}
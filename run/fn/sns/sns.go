@@ -0,0 +1,144 @@
+// Package sns provides an sns fn. The sns fn publishes each input to an SNS
+// topic and returns the ID of the message as output under messageId, along
+// with its sequenceNumber if the topic is a FIFO topic.
+//
+// The body, message attributes, message group ID, and deduplication ID of each
+// message may be chosen from the input with jq programs. By default, the body
+// is the input, encoded as JSON unless it is a string. Messages published to
+// FIFO topics need a groupID, and a deduplicationID unless the topic uses
+// content-based deduplication.
+//
+// The fn sends the trace context of each invocation in the traceparent message
+// attribute.
+package sns
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/fnrun/fnrun/fn"
+	"github.com/fnrun/fnrun/run/awspublisher"
+	"github.com/fnrun/fnrun/run/config"
+)
+
+type snsFn struct {
+	awspublisher.Endpoint `mapstructure:",squash"`
+	awspublisher.Message  `mapstructure:",squash"`
+
+	TopicARN string `mapstructure:"topicARN"`
+
+	mutex     sync.Mutex
+	client    awspublisher.SNSAPI
+	publisher awspublisher.Publisher
+}
+
+func (*snsFn) RequiresConfig() bool {
+	return true
+}
+
+func (s *snsFn) ConfigureString(topicARN string) error {
+	s.TopicARN = topicARN
+	return nil
+}
+
+func (s *snsFn) ConfigureMap(configMap map[string]interface{}) error {
+	if err := config.Decode(configMap, s); err != nil {
+		return err
+	}
+
+	return s.Compile()
+}
+
+func (s *snsFn) Validate() error {
+	if s.TopicARN == "" {
+		return config.WithPath("topicARN", errors.New("topicARN is required"))
+	}
+	return nil
+}
+
+// connect creates the publisher if it has not been created. s.mutex must be
+// held.
+func (s *snsFn) connect(ctx context.Context) error {
+	if s.publisher != nil {
+		return nil
+	}
+
+	if s.client == nil {
+		cfg, err := s.LoadConfig(ctx)
+		if err != nil {
+			return err
+		}
+		s.client = sns.NewFromConfig(cfg)
+	}
+
+	s.publisher = awspublisher.NewSNSPublisher(s.client, s.TopicARN)
+	return nil
+}
+
+// Start loads the AWS configuration and creates the client.
+func (s *snsFn) Start(ctx context.Context) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.connect(ctx)
+}
+
+func (s *snsFn) Invoke(ctx context.Context, input interface{}) (interface{}, error) {
+	s.mutex.Lock()
+	err := s.connect(ctx)
+	publisher := s.publisher
+	s.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := s.Build(ctx, input, input)
+	if err != nil {
+		return nil, err
+	}
+
+	receipt, err := publisher.Publish(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	return receipt.Output(), nil
+}
+
+// Describe describes the configuration of the sns fn.
+func (s *snsFn) Describe() *config.Schema {
+	properties := map[string]*config.Schema{
+		"topicARN": {
+			Type:        "string",
+			Description: "The ARN of the topic inputs are published to.",
+		},
+	}
+	for key, schema := range s.Endpoint.DescribeProperties("SNS") {
+		properties[key] = schema
+	}
+	for key, schema := range s.Message.DescribeProperties("the input") {
+		properties[key] = schema
+	}
+
+	return &config.Schema{
+		Description: "Publishes each input to an SNS topic and returns the ID of the message.",
+		OneOf: []*config.Schema{
+			{
+				Type:        "string",
+				Description: "The ARN of the topic.",
+			},
+			{
+				Type:                 "object",
+				Properties:           properties,
+				Required:             []string{"topicARN"},
+				AdditionalProperties: config.NoAdditionalProperties(),
+			},
+		},
+	}
+}
+
+// New returns an sns fn, which must be configured with a topic ARN.
+func New() fn.Fn {
+	return &snsFn{Endpoint: awspublisher.DefaultEndpoint()}
+}
@@ -0,0 +1,99 @@
+package sns
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/fnrun/fnrun/run/config"
+)
+
+const topicARN = "arn:aws:sns:us-east-1:123456789012:orders.fifo"
+
+type fakeClient struct {
+	published []*sns.PublishInput
+	err       error
+}
+
+func (c *fakeClient) Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	c.published = append(c.published, params)
+	return &sns.PublishOutput{MessageId: aws.String("message-1"), SequenceNumber: aws.String("1000")}, nil
+}
+
+func configure(t *testing.T, configMap map[string]interface{}) *snsFn {
+	t.Helper()
+
+	s := New().(*snsFn)
+	if err := config.Configure(s, configMap); err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+	return s
+}
+
+func TestInvoke(t *testing.T) {
+	client := &fakeClient{}
+	s := configure(t, map[string]interface{}{
+		"topicARN":   topicARN,
+		"groupID":    ".customer",
+		"attributes": map[string]interface{}{"type": ".type"},
+	})
+	s.client = client
+
+	output, err := s.Invoke(context.Background(), map[string]interface{}{"customer": "customer-1", "type": "created"})
+	if err != nil {
+		t.Fatalf("Invoke returned error: %+v", err)
+	}
+
+	want := map[string]interface{}{"messageId": "message-1", "sequenceNumber": "1000"}
+	if !reflect.DeepEqual(output, want) {
+		t.Errorf("unexpected output: want %v, got %v", want, output)
+	}
+
+	published := client.published[0]
+	if aws.ToString(published.TopicArn) != topicARN || aws.ToString(published.MessageGroupId) != "customer-1" || aws.ToString(published.Message) != `{"customer":"customer-1","type":"created"}` {
+		t.Errorf("unexpected message: %+v", published)
+	}
+	if got := aws.ToString(published.MessageAttributes["type"].StringValue); got != "created" {
+		t.Errorf("unexpected type attribute: %q", got)
+	}
+}
+
+func TestInvoke_publishError(t *testing.T) {
+	client := &fakeClient{err: errors.New("publish failed")}
+	s := configure(t, map[string]interface{}{"topicARN": topicARN})
+	s.client = client
+
+	if _, err := s.Invoke(context.Background(), "some value"); err != client.err {
+		t.Errorf("unexpected error: want %v, got %+v", client.err, err)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	tests := []struct {
+		config interface{}
+		want   string
+	}{
+		{config: topicARN},
+		{config: map[string]interface{}{"body": ".order"}, want: "topicARN: topicARN is required"},
+		{config: map[string]interface{}{"topicARN": topicARN, "topicARM": "orders"}, want: `topicARM: unknown configuration key (did you mean "topicARN"?)`},
+	}
+
+	for _, test := range tests {
+		err := config.Configure(New(), test.config)
+
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != test.want {
+			t.Errorf("unexpected error for %v: want %q, got %q", test.config, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// Package sqs provides an sqs fn. The sqs fn sends each input to an SQS queue
+// and returns the ID of the message as output under messageId, along with its
+// sequenceNumber if the queue is a FIFO queue.
+//
+// The body, message attributes, message group ID, and deduplication ID of each
+// message may be chosen from the input with jq programs. By default, the body
+// is the input, encoded as JSON unless it is a string. Messages sent to FIFO
+// queues need a groupID, and a deduplicationID unless the queue uses
+// content-based deduplication.
+//
+// The fn sends the trace context of each invocation in the traceparent message
+// attribute, which the sqs source continues.
+package sqs
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/fnrun/fnrun/fn"
+	"github.com/fnrun/fnrun/run/awspublisher"
+	"github.com/fnrun/fnrun/run/config"
+)
+
+type sqsFn struct {
+	awspublisher.Endpoint `mapstructure:",squash"`
+	awspublisher.Message  `mapstructure:",squash"`
+
+	Queue string
+
+	mutex     sync.Mutex
+	client    awspublisher.SQSAPI
+	publisher awspublisher.Publisher
+}
+
+func (*sqsFn) RequiresConfig() bool {
+	return true
+}
+
+func (s *sqsFn) ConfigureString(queue string) error {
+	s.Queue = queue
+	return nil
+}
+
+func (s *sqsFn) ConfigureMap(configMap map[string]interface{}) error {
+	if err := config.Decode(configMap, s); err != nil {
+		return err
+	}
+
+	return s.Compile()
+}
+
+func (s *sqsFn) Validate() error {
+	if s.Queue == "" {
+		return config.WithPath("queue", errors.New("queue is required"))
+	}
+	return nil
+}
+
+// connect creates the publisher if it has not been created. s.mutex must be
+// held.
+func (s *sqsFn) connect(ctx context.Context) error {
+	if s.publisher != nil {
+		return nil
+	}
+
+	if s.client == nil {
+		cfg, err := s.LoadConfig(ctx)
+		if err != nil {
+			return err
+		}
+		s.client = sqs.NewFromConfig(cfg)
+	}
+
+	publisher, err := awspublisher.NewSQSPublisher(ctx, s.client, s.Queue)
+	if err != nil {
+		return err
+	}
+	s.publisher = publisher
+	return nil
+}
+
+// Start resolves the URL of the queue.
+func (s *sqsFn) Start(ctx context.Context) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.connect(ctx)
+}
+
+func (s *sqsFn) Invoke(ctx context.Context, input interface{}) (interface{}, error) {
+	s.mutex.Lock()
+	err := s.connect(ctx)
+	publisher := s.publisher
+	s.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := s.Build(ctx, input, input)
+	if err != nil {
+		return nil, err
+	}
+
+	receipt, err := publisher.Publish(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	return receipt.Output(), nil
+}
+
+// Describe describes the configuration of the sqs fn.
+func (s *sqsFn) Describe() *config.Schema {
+	properties := map[string]*config.Schema{
+		"queue": {
+			Type:        "string",
+			Description: "The name of the queue inputs are sent to.",
+		},
+	}
+	for key, schema := range s.Endpoint.DescribeProperties("SQS") {
+		properties[key] = schema
+	}
+	for key, schema := range s.Message.DescribeProperties("the input") {
+		properties[key] = schema
+	}
+
+	return &config.Schema{
+		Description: "Sends each input to an SQS queue and returns the ID of the message.",
+		OneOf: []*config.Schema{
+			{
+				Type:        "string",
+				Description: "The name of the queue.",
+			},
+			{
+				Type:                 "object",
+				Properties:           properties,
+				Required:             []string{"queue"},
+				AdditionalProperties: config.NoAdditionalProperties(),
+			},
+		},
+	}
+}
+
+// New returns an sqs fn, which must be configured with a queue.
+func New() fn.Fn {
+	return &sqsFn{Endpoint: awspublisher.DefaultEndpoint()}
+}
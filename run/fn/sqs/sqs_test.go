@@ -0,0 +1,147 @@
+package sqs
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/fnrun/fnrun/run/config"
+)
+
+// standIn is a local SQS-compatible stand-in that serves GetQueueUrl and
+// SendMessage requests and records the messages it is sent.
+type standIn struct {
+	*httptest.Server
+
+	mutex sync.Mutex
+	sent  []map[string]interface{}
+}
+
+func newStandIn(t *testing.T) *standIn {
+	t.Helper()
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+	s := &standIn{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		switch r.Header.Get("X-Amz-Target") {
+		case "AmazonSQS.GetQueueUrl":
+			json.NewEncoder(w).Encode(map[string]interface{}{"QueueUrl": s.URL + "/123456789012/" + request["QueueName"].(string)})
+		case "AmazonSQS.SendMessage":
+			s.mutex.Lock()
+			s.sent = append(s.sent, request)
+			s.mutex.Unlock()
+
+			sum := md5.Sum([]byte(request["MessageBody"].(string)))
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"MessageId":        "message-1",
+				"MD5OfMessageBody": hex.EncodeToString(sum[:]),
+			})
+		default:
+			http.Error(w, "unexpected target "+r.Header.Get("X-Amz-Target"), http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func configure(t *testing.T, configMap map[string]interface{}) *sqsFn {
+	t.Helper()
+
+	s := New().(*sqsFn)
+	if err := config.Configure(s, configMap); err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+	return s
+}
+
+func TestInvoke(t *testing.T) {
+	standIn := newStandIn(t)
+	s := configure(t, map[string]interface{}{
+		"queue":       "orders",
+		"endpointURL": standIn.URL,
+	})
+
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start returned error: %+v", err)
+	}
+
+	output, err := s.Invoke(context.Background(), map[string]interface{}{"id": "order-1"})
+	if err != nil {
+		t.Fatalf("Invoke returned error: %+v", err)
+	}
+
+	want := map[string]interface{}{"messageId": "message-1"}
+	if !reflect.DeepEqual(output, want) {
+		t.Errorf("unexpected output: want %v, got %v", want, output)
+	}
+
+	sent := standIn.sent[0]
+	if sent["QueueUrl"] != standIn.URL+"/123456789012/orders" || sent["MessageBody"] != `{"id":"order-1"}` {
+		t.Errorf("unexpected message: %v", sent)
+	}
+}
+
+func TestInvoke_fifo(t *testing.T) {
+	standIn := newStandIn(t)
+	s := configure(t, map[string]interface{}{
+		"queue":           "orders.fifo",
+		"endpointURL":     standIn.URL,
+		"body":            ".order",
+		"groupID":         ".customer",
+		"deduplicationID": ".order.id",
+	})
+
+	_, err := s.Invoke(context.Background(), map[string]interface{}{
+		"customer": "customer-1",
+		"order":    map[string]interface{}{"id": "order-1"},
+	})
+	if err != nil {
+		t.Fatalf("Invoke returned error: %+v", err)
+	}
+
+	sent := standIn.sent[0]
+	if sent["MessageGroupId"] != "customer-1" || sent["MessageDeduplicationId"] != "order-1" || sent["MessageBody"] != `{"id":"order-1"}` {
+		t.Errorf("unexpected message: %v", sent)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	tests := []struct {
+		config interface{}
+		want   string
+	}{
+		{config: "orders"},
+		{config: map[string]interface{}{"endpointURL": "http://localhost:9324"}, want: "queue: queue is required"},
+		{config: map[string]interface{}{"queue": "orders", "groupID": ".customer |"}, want: "groupID: unexpected EOF"},
+	}
+
+	for _, test := range tests {
+		err := config.Configure(New(), test.config)
+
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != test.want {
+			t.Errorf("unexpected error for %v: want %q, got %q", test.config, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+// Package kafkaauth configures how Kafka components authenticate to brokers.
+// TLS and SASL are configured separately, and Apply sets either or both on a
+// sarama configuration.
+package kafkaauth
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Shopify/sarama"
+	"github.com/fnrun/fnrun/run/config"
+	"github.com/xdg-go/scram"
+)
+
+// TLS configures TLS connections to brokers. The zero value connects with TLS
+// using the system certificate authorities and no client certificate.
+type TLS struct {
+	CertFile           string
+	KeyFile            string
+	CAFile             string `mapstructure:"caFile"`
+	InsecureSkipVerify bool
+}
+
+// Validate checks that a client certificate is configured together with its
+// key.
+func (t *TLS) Validate() error {
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return errors.New("certFile and keyFile must be set together")
+	}
+	return nil
+}
+
+// Config loads the certificates named by t into a tls.Config.
+func (t *TLS) Config() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if t.CAFile != "" {
+		caCert, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificates found in %s", t.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+// Describe describes the configuration of TLS.
+func (*TLS) Describe() *config.Schema {
+	return &config.Schema{
+		Description: "Connects to the brokers with TLS. An empty object uses the system certificate authorities.",
+		Type:        "object",
+		Properties: map[string]*config.Schema{
+			"certFile": {
+				Type:        "string",
+				Description: "The path to the client certificate. It must be set together with keyFile.",
+			},
+			"keyFile": {
+				Type:        "string",
+				Description: "The path to the client key. It must be set together with certFile.",
+			},
+			"caFile": {
+				Type:        "string",
+				Description: "The path to the certificate authority that signed the broker certificates.",
+			},
+			"insecureSkipVerify": {
+				Type:        "boolean",
+				Description: "Whether to accept any broker certificate. This should only be used for testing.",
+				Default:     false,
+			},
+		},
+		AdditionalProperties: config.NoAdditionalProperties(),
+	}
+}
+
+// The SASL mechanisms supported by SASL.
+const (
+	MechanismPlain       = sarama.SASLTypePlaintext
+	MechanismSCRAMSHA256 = sarama.SASLTypeSCRAMSHA256
+	MechanismSCRAMSHA512 = sarama.SASLTypeSCRAMSHA512
+)
+
+// SASL configures SASL authentication with the brokers. An empty Mechanism is
+// treated as PLAIN.
+type SASL struct {
+	Mechanism string
+	Username  string
+	Password  string
+}
+
+// Validate checks that the mechanism is supported and that credentials are
+// present.
+func (s *SASL) Validate() error {
+	switch s.Mechanism {
+	case "", MechanismPlain, MechanismSCRAMSHA256, MechanismSCRAMSHA512:
+	default:
+		return config.WithPath("mechanism", fmt.Errorf("unsupported mechanism %q", s.Mechanism))
+	}
+
+	if s.Username == "" {
+		return config.WithPath("username", errors.New("username is required"))
+	}
+	return nil
+}
+
+// Describe describes the configuration of SASL.
+func (*SASL) Describe() *config.Schema {
+	return &config.Schema{
+		Description: "Authenticates with the brokers using SASL.",
+		Type:        "object",
+		Properties: map[string]*config.Schema{
+			"mechanism": {
+				Type:        "string",
+				Description: "The SASL mechanism.",
+				Enum:        []interface{}{MechanismPlain, MechanismSCRAMSHA256, MechanismSCRAMSHA512},
+				Default:     MechanismPlain,
+			},
+			"username": {
+				Type:        "string",
+				Description: "The username to authenticate as.",
+			},
+			"password": {
+				Type:        "string",
+				Description: "The password of the user. Use an environment variable reference such as ${KAFKA_PASSWORD} to keep it out of the configuration file.",
+			},
+		},
+		Required:             []string{"username"},
+		AdditionalProperties: config.NoAdditionalProperties(),
+	}
+}
+
+// Apply configures c to connect with t and authenticate with s. Either may be
+// nil to leave that part of c unchanged. Apply should be called after the
+// version of c is set.
+func Apply(c *sarama.Config, t *TLS, s *SASL) error {
+	if t != nil {
+		tlsConfig, err := t.Config()
+		if err != nil {
+			return err
+		}
+		c.Net.TLS.Enable = true
+		c.Net.TLS.Config = tlsConfig
+	}
+
+	if s != nil {
+		c.Net.SASL.Enable = true
+		c.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+		if s.Mechanism != "" {
+			c.Net.SASL.Mechanism = sarama.SASLMechanism(s.Mechanism)
+		}
+		c.Net.SASL.User = s.Username
+		c.Net.SASL.Password = s.Password
+		if c.Version.IsAtLeast(sarama.V1_0_0_0) {
+			c.Net.SASL.Version = sarama.SASLHandshakeV1
+		}
+
+		switch s.Mechanism {
+		case MechanismSCRAMSHA256:
+			c.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+				return &scramClient{hashGenerator: sha256.New}
+			}
+		case MechanismSCRAMSHA512:
+			c.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+				return &scramClient{hashGenerator: sha512.New}
+			}
+		}
+	}
+
+	return nil
+}
+
+// scramClient adapts a scram conversation to sarama.SCRAMClient.
+type scramClient struct {
+	hashGenerator scram.HashGeneratorFcn
+	conversation  *scram.ClientConversation
+}
+
+func (c *scramClient) Begin(username, password, authzID string) error {
+	client, err := c.hashGenerator.NewClient(username, password, authzID)
+	if err != nil {
+		return err
+	}
+	c.conversation = client.NewConversation()
+	return nil
+}
+
+func (c *scramClient) Step(challenge string) (string, error) {
+	return c.conversation.Step(challenge)
+}
+
+func (c *scramClient) Done() bool {
+	return c.conversation.Done()
+}
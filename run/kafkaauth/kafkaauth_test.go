@@ -0,0 +1,107 @@
+package kafkaauth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Shopify/sarama"
+)
+
+func TestTLS_Validate(t *testing.T) {
+	if err := (&TLS{}).Validate(); err != nil {
+		t.Errorf("Validate returned error: %+v", err)
+	}
+	if err := (&TLS{CertFile: "client.pem"}).Validate(); err == nil {
+		t.Error("expected Validate to return an error but it did not")
+	}
+}
+
+func TestTLS_Config_invalidCAFile(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := (&TLS{CAFile: caFile}).Config()
+	if err == nil || !strings.Contains(err.Error(), "no certificates found") {
+		t.Errorf("unexpected error: %+v", err)
+	}
+}
+
+func TestSASL_Validate(t *testing.T) {
+	tests := []struct {
+		sasl SASL
+		want string
+	}{
+		{sasl: SASL{Username: "user"}},
+		{sasl: SASL{Mechanism: MechanismSCRAMSHA512, Username: "user"}},
+		{sasl: SASL{Mechanism: "GSSAPI", Username: "user"}, want: `mechanism: unsupported mechanism "GSSAPI"`},
+		{sasl: SASL{Mechanism: MechanismPlain}, want: "username: username is required"},
+	}
+
+	for _, test := range tests {
+		err := test.sasl.Validate()
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != test.want {
+			t.Errorf("unexpected error for %+v: want %q, got %q", test.sasl, test.want, got)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	c := sarama.NewConfig()
+	c.Version = sarama.V2_1_0_0
+
+	err := Apply(c, &TLS{}, &SASL{Mechanism: MechanismSCRAMSHA256, Username: "user", Password: "secret"})
+	if err != nil {
+		t.Fatalf("Apply returned error: %+v", err)
+	}
+
+	if !c.Net.TLS.Enable || c.Net.TLS.Config == nil {
+		t.Error("expected TLS to be enabled")
+	}
+	if !c.Net.SASL.Enable || c.Net.SASL.Mechanism != sarama.SASLTypeSCRAMSHA256 {
+		t.Errorf("unexpected SASL configuration: %+v", c.Net.SASL)
+	}
+	if c.Net.SASL.Version != sarama.SASLHandshakeV1 {
+		t.Errorf("unexpected SASL handshake version: %d", c.Net.SASL.Version)
+	}
+	if err := c.Validate(); err != nil {
+		t.Errorf("sarama configuration is invalid: %+v", err)
+	}
+
+	client := c.Net.SASL.SCRAMClientGeneratorFunc()
+	if err := client.Begin("user", "secret", ""); err != nil {
+		t.Fatalf("Begin returned error: %+v", err)
+	}
+	first, err := client.Step("")
+	if err != nil {
+		t.Fatalf("Step returned error: %+v", err)
+	}
+	if !strings.HasPrefix(first, "n,,n=user,r=") {
+		t.Errorf("unexpected first client message: %q", first)
+	}
+	if client.Done() {
+		t.Error("expected the conversation not to be done")
+	}
+}
+
+func TestApply_defaultMechanism(t *testing.T) {
+	c := sarama.NewConfig()
+
+	if err := Apply(c, nil, &SASL{Username: "user", Password: "secret"}); err != nil {
+		t.Fatalf("Apply returned error: %+v", err)
+	}
+
+	if c.Net.TLS.Enable {
+		t.Error("expected TLS to be disabled")
+	}
+	if c.Net.SASL.Mechanism != sarama.SASLTypePlaintext {
+		t.Errorf("unexpected mechanism: %q", c.Net.SASL.Mechanism)
+	}
+}
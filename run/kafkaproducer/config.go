@@ -0,0 +1,164 @@
+// Package kafkaproducer provides what the Kafka producers of fnrun middleware
+// and fns have in common: the configuration of the producer itself, and a
+// Record that builds the messages to produce from values with jq programs.
+package kafkaproducer
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Shopify/sarama"
+	"github.com/fnrun/fnrun/run/config"
+	"github.com/fnrun/fnrun/run/kafkaauth"
+)
+
+var compressionCodecs = map[string]sarama.CompressionCodec{
+	"none":   sarama.CompressionNone,
+	"gzip":   sarama.CompressionGZIP,
+	"snappy": sarama.CompressionSnappy,
+	"lz4":    sarama.CompressionLZ4,
+	"zstd":   sarama.CompressionZSTD,
+}
+
+// DefaultVersion is the Kafka protocol version used when none is configured.
+const DefaultVersion = "2.1.1"
+
+// Config configures a producer. It is meant to be squashed into the
+// configuration of a component.
+type Config struct {
+	Brokers     []string
+	Version     string
+	ClientID    string `mapstructure:"clientID"`
+	Idempotent  bool
+	Compression string
+
+	TLS  *kafkaauth.TLS
+	SASL *kafkaauth.SASL
+}
+
+// Validate checks the configuration for problems that sarama would otherwise
+// only report when the producer is created.
+func (c *Config) Validate() error {
+	if len(c.Brokers) == 0 {
+		return errors.New("brokers must contain at least one broker")
+	}
+	if _, ok := compressionCodecs[c.Compression]; c.Compression != "" && !ok {
+		return config.WithPath("compression", fmt.Errorf("unknown compression codec %q", c.Compression))
+	}
+	if c.TLS != nil {
+		if err := c.TLS.Validate(); err != nil {
+			return config.WithPath("tls", err)
+		}
+	}
+	if c.SASL != nil {
+		if err := c.SASL.Validate(); err != nil {
+			return config.WithPath("sasl", err)
+		}
+	}
+
+	saramaConfig, err := c.NewSaramaConfig()
+	if err != nil {
+		return err
+	}
+	return saramaConfig.Validate()
+}
+
+// ValidateTransactional checks that c is empty, as it must be for components
+// that produce in the transaction of a kafka source. Their messages are
+// produced by the transactional producer of the source, which connects to the
+// cluster of the source with its own configuration.
+func (c *Config) ValidateTransactional() error {
+	options := []struct {
+		key string
+		set bool
+	}{
+		{"brokers", len(c.Brokers) > 0},
+		{"version", c.Version != ""},
+		{"clientID", c.ClientID != ""},
+		{"idempotent", c.Idempotent},
+		{"compression", c.Compression != ""},
+		{"tls", c.TLS != nil},
+		{"sasl", c.SASL != nil},
+	}
+	for _, option := range options {
+		if option.set {
+			return config.WithPath(option.key, fmt.Errorf("%s cannot be combined with transactional; messages are produced by the producer of the kafka source", option.key))
+		}
+	}
+	return nil
+}
+
+// NewSaramaConfig returns a sarama configuration for a producer that waits
+// for every in-sync replica and reports each success.
+func (c *Config) NewSaramaConfig() (*sarama.Config, error) {
+	version := c.Version
+	if version == "" {
+		version = DefaultVersion
+	}
+	kafkaVersion, err := sarama.ParseKafkaVersion(version)
+	if err != nil {
+		return nil, config.WithPath("version", err)
+	}
+
+	saramaConfig := sarama.NewConfig()
+	saramaConfig.Version = kafkaVersion
+	saramaConfig.Producer.RequiredAcks = sarama.WaitForAll
+	saramaConfig.Producer.Retry.Max = 10
+	saramaConfig.Producer.Return.Successes = true
+
+	if c.ClientID != "" {
+		saramaConfig.ClientID = c.ClientID
+	}
+	if c.Compression != "" {
+		saramaConfig.Producer.Compression = compressionCodecs[c.Compression]
+	}
+
+	// An idempotent producer must not have more than one request in flight to
+	// a broker, or retries could reorder messages.
+	if c.Idempotent {
+		saramaConfig.Producer.Idempotent = true
+		saramaConfig.Net.MaxOpenRequests = 1
+	}
+
+	if err := kafkaauth.Apply(saramaConfig, c.TLS, c.SASL); err != nil {
+		return nil, err
+	}
+
+	return saramaConfig, nil
+}
+
+// DescribeProperties describes the configuration keys of Config.
+func (*Config) DescribeProperties() map[string]*config.Schema {
+	return map[string]*config.Schema{
+		"brokers": {
+			Description: "The addresses of the Kafka brokers, as a list or a comma-separated string.",
+			OneOf: []*config.Schema{
+				{Type: "array", Items: &config.Schema{Type: "string"}},
+				{Type: "string"},
+			},
+		},
+		"version": {
+			Type:        "string",
+			Description: "The Kafka protocol version. Idempotence requires at least 0.11.0.0, and zstd compression requires at least 2.1.0.0.",
+			Default:     DefaultVersion,
+		},
+		"clientID": {
+			Type:        "string",
+			Description: "The client ID sent to the brokers with each request.",
+			Default:     "sarama",
+		},
+		"idempotent": {
+			Type:        "boolean",
+			Description: "Whether the producer is idempotent, so that retries never write a message twice.",
+			Default:     false,
+		},
+		"compression": {
+			Type:        "string",
+			Description: "The compression codec of produced messages.",
+			Enum:        []interface{}{"none", "gzip", "snappy", "lz4", "zstd"},
+			Default:     "none",
+		},
+		"tls":  config.Describe(&kafkaauth.TLS{}),
+		"sasl": config.Describe(&kafkaauth.SASL{}),
+	}
+}
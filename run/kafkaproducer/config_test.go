@@ -0,0 +1,85 @@
+package kafkaproducer
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/fnrun/fnrun/run/kafkaauth"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		config Config
+		want   string
+	}{
+		{config: Config{Brokers: []string{"localhost:9092"}, Idempotent: true, Compression: "zstd"}},
+		{config: Config{}, want: "brokers must contain at least one broker"},
+		{config: Config{Brokers: []string{"localhost:9092"}, Compression: "brotli"}, want: `compression: unknown compression codec "brotli"`},
+		{config: Config{Brokers: []string{"localhost:9092"}, Version: "latest"}, want: "version: invalid version `latest`"},
+		{config: Config{Brokers: []string{"localhost:9092"}, Version: "0.10.2.0", Idempotent: true}, want: "kafka: invalid configuration (Idempotent producer requires Version >= V0_11_0_0)"},
+		{config: Config{Brokers: []string{"localhost:9092"}, SASL: &kafkaauth.SASL{}}, want: "sasl.username: username is required"},
+	}
+
+	for _, test := range tests {
+		err := test.config.Validate()
+
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != test.want {
+			t.Errorf("unexpected error for %+v: want %q, got %q", test.config, test.want, got)
+		}
+	}
+}
+
+func TestConfig_ValidateTransactional(t *testing.T) {
+	tests := []struct {
+		config Config
+		want   string
+	}{
+		{config: Config{}},
+		{config: Config{Brokers: []string{"localhost:9092"}}, want: "brokers: brokers cannot be combined with transactional; messages are produced by the producer of the kafka source"},
+		{config: Config{Compression: "zstd"}, want: "compression: compression cannot be combined with transactional; messages are produced by the producer of the kafka source"},
+		{config: Config{SASL: &kafkaauth.SASL{}}, want: "sasl: sasl cannot be combined with transactional; messages are produced by the producer of the kafka source"},
+	}
+
+	for _, test := range tests {
+		err := test.config.ValidateTransactional()
+
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != test.want {
+			t.Errorf("unexpected error for %+v: want %q, got %q", test.config, test.want, got)
+		}
+	}
+}
+
+func TestConfig_NewSaramaConfig(t *testing.T) {
+	c := Config{
+		Brokers:     []string{"localhost:9092"},
+		ClientID:    "fnrunner",
+		Idempotent:  true,
+		Compression: "gzip",
+	}
+
+	saramaConfig, err := c.NewSaramaConfig()
+	if err != nil {
+		t.Fatalf("NewSaramaConfig returned error: %+v", err)
+	}
+
+	if saramaConfig.Version.String() != DefaultVersion {
+		t.Errorf("unexpected version: %s", saramaConfig.Version)
+	}
+	if saramaConfig.ClientID != "fnrunner" {
+		t.Errorf("unexpected client ID: %q", saramaConfig.ClientID)
+	}
+	if !saramaConfig.Producer.Idempotent || saramaConfig.Net.MaxOpenRequests != 1 {
+		t.Errorf("expected an idempotent producer with one open request, got %v and %d", saramaConfig.Producer.Idempotent, saramaConfig.Net.MaxOpenRequests)
+	}
+	if saramaConfig.Producer.Compression != sarama.CompressionGZIP {
+		t.Errorf("unexpected compression: %s", saramaConfig.Producer.Compression)
+	}
+}
@@ -0,0 +1,38 @@
+package kafkaproducer
+
+import "github.com/Shopify/sarama"
+
+// chosenPartition is the metadata of the messages whose partition was chosen
+// by a Record.
+type chosenPartition struct{}
+
+// partitioner produces the messages whose partition was chosen by a Record to
+// that partition, and hashes the key of other messages as sarama does by
+// default.
+type partitioner struct {
+	manual sarama.Partitioner
+	hash   sarama.Partitioner
+}
+
+// NewPartitioner returns the partitioner of producers that produce messages
+// built by a Record. Because it only honors the partitions chosen by a Record,
+// one producer can serve components that choose partitions and components that
+// do not, such as the transactional producer that a kafka source shares with
+// the middleware and fns of its pipeline.
+func NewPartitioner(topic string) sarama.Partitioner {
+	return &partitioner{
+		manual: sarama.NewManualPartitioner(topic),
+		hash:   sarama.NewHashPartitioner(topic),
+	}
+}
+
+func (p *partitioner) Partition(message *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	if _, ok := message.Metadata.(chosenPartition); ok {
+		return p.manual.Partition(message, numPartitions)
+	}
+	return p.hash.Partition(message, numPartitions)
+}
+
+func (p *partitioner) RequiresConsistency() bool {
+	return true
+}
@@ -0,0 +1,37 @@
+package kafkaproducer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Shopify/sarama"
+)
+
+func TestNewPartitioner(t *testing.T) {
+	partitioned := Record{Partition: ".shard"}
+	if err := partitioned.Compile(); err != nil {
+		t.Fatalf("Compile returned error: %+v", err)
+	}
+
+	v := map[string]interface{}{"shard": 5}
+	chosen, err := partitioned.Message(context.Background(), "my-topic", v, "value")
+	if err != nil {
+		t.Fatalf("Message returned error: %+v", err)
+	}
+
+	p := NewPartitioner("my-topic")
+	if partition, err := p.Partition(chosen, 8); err != nil || partition != 5 {
+		t.Errorf("expected the chosen partition 5, got %d (%+v)", partition, err)
+	}
+
+	// A message whose partition was not chosen is hashed by its key, like it
+	// would be by the default partitioner.
+	keyed := &sarama.ProducerMessage{Topic: "my-topic", Key: sarama.StringEncoder("customer-1")}
+	want, err := sarama.NewHashPartitioner("my-topic").Partition(keyed, 8)
+	if err != nil {
+		t.Fatalf("Partition returned error: %+v", err)
+	}
+	if partition, err := p.Partition(keyed, 8); err != nil || partition != want {
+		t.Errorf("expected the hashed partition %d, got %d (%+v)", want, partition, err)
+	}
+}
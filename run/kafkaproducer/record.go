@@ -0,0 +1,215 @@
+package kafkaproducer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/Shopify/sarama"
+	"github.com/fnrun/fnrun/run/config"
+	"github.com/itchyny/gojq"
+)
+
+// Record builds the messages to produce from values. Key, Value, Partition,
+// and the values of Headers are jq programs evaluated against the value, and
+// an empty program leaves that part of the message unset. It is meant to be
+// squashed into the configuration of a component, which must call Compile
+// after decoding it.
+type Record struct {
+	Key       string
+	Headers   map[string]string
+	Value     string
+	Partition string
+
+	key       *gojq.Code
+	value     *gojq.Code
+	partition *gojq.Code
+	headers   []header
+}
+
+type header struct {
+	name string
+	code *gojq.Code
+}
+
+func compile(pattern string) (*gojq.Code, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+
+	query, err := gojq.Parse(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return gojq.Compile(query)
+}
+
+// Compile compiles the jq programs of r.
+func (r *Record) Compile() error {
+	var errs []error
+
+	var err error
+	r.key, err = compile(r.Key)
+	errs = append(errs, config.WithPath("key", err))
+	r.value, err = compile(r.Value)
+	errs = append(errs, config.WithPath("value", err))
+	r.partition, err = compile(r.Partition)
+	errs = append(errs, config.WithPath("partition", err))
+
+	names := make([]string, 0, len(r.Headers))
+	for name := range r.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	r.headers = nil
+	for _, name := range names {
+		code, err := compile(r.Headers[name])
+		if err != nil {
+			errs = append(errs, config.WithPath("headers", config.WithPath(name, err)))
+			continue
+		}
+		r.headers = append(r.headers, header{name: name, code: code})
+	}
+
+	return errors.Join(errs...)
+}
+
+// Partitioned reports whether r chooses the partition of its messages. The
+// producer must then use NewPartitioner.
+func (r *Record) Partitioned() bool {
+	return r.Partition != ""
+}
+
+// Message returns a message to produce to topic built from v. The value of the
+// message is value unless r has a Value program.
+func (r *Record) Message(ctx context.Context, topic string, v interface{}, value interface{}) (*sarama.ProducerMessage, error) {
+	message := &sarama.ProducerMessage{Topic: topic}
+
+	if r.value != nil {
+		var err error
+		if value, err = evaluate(ctx, r.value, v); err != nil {
+			return nil, config.WithPath("value", err)
+		}
+	}
+	encoded, err := Encode(value)
+	if err != nil {
+		return nil, config.WithPath("value", err)
+	}
+	message.Value = encoded
+
+	if r.key != nil {
+		key, err := evaluate(ctx, r.key, v)
+		if err != nil {
+			return nil, config.WithPath("key", err)
+		}
+		if message.Key, err = Encode(key); err != nil {
+			return nil, config.WithPath("key", err)
+		}
+	}
+
+	if r.partition != nil {
+		partition, err := evaluate(ctx, r.partition, v)
+		if err != nil {
+			return nil, config.WithPath("partition", err)
+		}
+		p, err := toPartition(partition)
+		if err != nil {
+			return nil, config.WithPath("partition", err)
+		}
+		message.Partition = p
+		message.Metadata = chosenPartition{}
+	}
+
+	for _, h := range r.headers {
+		headerValue, err := evaluate(ctx, h.code, v)
+		if err != nil {
+			return nil, config.WithPath("headers", config.WithPath(h.name, err))
+		}
+		if headerValue == nil {
+			continue
+		}
+		encoded, err := Encode(headerValue)
+		if err != nil {
+			return nil, config.WithPath("headers", config.WithPath(h.name, err))
+		}
+		b, _ := encoded.Encode()
+		message.Headers = append(message.Headers, sarama.RecordHeader{Key: []byte(h.name), Value: b})
+	}
+
+	return message, nil
+}
+
+// toPartition converts the result of a jq program to a partition. Numbers
+// decoded from JSON are float64, so integral floats are accepted.
+func toPartition(v interface{}) (int32, error) {
+	switch v := v.(type) {
+	case int:
+		return int32(v), nil
+	case float64:
+		if v == math.Trunc(v) {
+			return int32(v), nil
+		}
+	}
+	return 0, fmt.Errorf("expected an integer but got %v", v)
+}
+
+// evaluate returns the first value code produces for v.
+func evaluate(ctx context.Context, code *gojq.Code, v interface{}) (interface{}, error) {
+	result, ok := code.RunWithContext(ctx, v).Next()
+	if !ok {
+		return nil, errors.New("the jq program produced no value")
+	}
+	if err, ok := result.(error); ok {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Encode encodes v as the key or value of a message. Strings and byte slices
+// are used as they are, nil is encoded as a null value, and anything else is
+// encoded as JSON.
+func Encode(v interface{}) (sarama.Encoder, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return sarama.StringEncoder(v), nil
+	case []byte:
+		return sarama.ByteEncoder(v), nil
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return sarama.ByteEncoder(b), nil
+	}
+}
+
+// DescribeProperties describes the configuration keys of Record. subject
+// describes the value the jq programs are evaluated against.
+func (*Record) DescribeProperties(subject string) map[string]*config.Schema {
+	return map[string]*config.Schema{
+		"key": {
+			Type:        "string",
+			Description: "The jq program that produces the key of each message from " + subject + ". Messages have no key if it is empty.",
+		},
+		"value": {
+			Type:        "string",
+			Description: "The jq program that produces the value of each message from " + subject + ". Strings are produced as they are and other values as JSON.",
+		},
+		"partition": {
+			Type:        "string",
+			Description: "The jq program that produces the partition of each message from " + subject + ". Messages are partitioned by the hash of their key if it is empty.",
+		},
+		"headers": {
+			Type:                 "object",
+			Description:          "The headers of each message, mapping each header name to a jq program that produces its value from " + subject + ". A header is omitted if its value is null.",
+			AdditionalProperties: &config.Schema{Type: "string"},
+		},
+	}
+}
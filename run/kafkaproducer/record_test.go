@@ -0,0 +1,140 @@
+package kafkaproducer
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/fnrun/fnrun/run/config"
+)
+
+func encoded(t *testing.T, e sarama.Encoder) string {
+	t.Helper()
+
+	if e == nil {
+		return "<nil>"
+	}
+	b, err := e.Encode()
+	if err != nil {
+		t.Fatalf("Encode returned error: %+v", err)
+	}
+	return string(b)
+}
+
+func TestRecord_Message(t *testing.T) {
+	r := Record{
+		Key:       ".id",
+		Value:     "{name: .name}",
+		Partition: ".shard",
+		Headers: map[string]string{
+			"source":  `"fnrun"`,
+			"missing": ".nothing",
+			"count":   ".count",
+		},
+	}
+	if err := r.Compile(); err != nil {
+		t.Fatalf("Compile returned error: %+v", err)
+	}
+
+	v := map[string]interface{}{"id": "abc", "name": "widget", "shard": float64(2), "count": 3}
+	message, err := r.Message(context.Background(), "my-topic", v, "ignored")
+	if err != nil {
+		t.Fatalf("Message returned error: %+v", err)
+	}
+
+	if message.Topic != "my-topic" {
+		t.Errorf("unexpected topic: %q", message.Topic)
+	}
+	if got := encoded(t, message.Key); got != "abc" {
+		t.Errorf("unexpected key: %q", got)
+	}
+	if got := encoded(t, message.Value); got != `{"name":"widget"}` {
+		t.Errorf("unexpected value: %q", got)
+	}
+	if message.Partition != 2 {
+		t.Errorf("unexpected partition: %d", message.Partition)
+	}
+
+	want := []sarama.RecordHeader{
+		{Key: []byte("count"), Value: []byte("3")},
+		{Key: []byte("source"), Value: []byte("fnrun")},
+	}
+	if !reflect.DeepEqual(message.Headers, want) {
+		t.Errorf("unexpected headers: want %v, got %v", want, message.Headers)
+	}
+}
+
+func TestRecord_Message_defaults(t *testing.T) {
+	var r Record
+	if err := r.Compile(); err != nil {
+		t.Fatalf("Compile returned error: %+v", err)
+	}
+
+	message, err := r.Message(context.Background(), "my-topic", nil, map[string]interface{}{"a": 1})
+	if err != nil {
+		t.Fatalf("Message returned error: %+v", err)
+	}
+
+	if message.Key != nil {
+		t.Errorf("expected no key but got %v", message.Key)
+	}
+	if got := encoded(t, message.Value); got != `{"a":1}` {
+		t.Errorf("unexpected value: %q", got)
+	}
+	if r.Partitioned() {
+		t.Error("expected the record not to be partitioned")
+	}
+}
+
+func TestRecord_Message_invalidPartition(t *testing.T) {
+	r := Record{Partition: ".shard"}
+	if err := r.Compile(); err != nil {
+		t.Fatalf("Compile returned error: %+v", err)
+	}
+
+	_, err := r.Message(context.Background(), "my-topic", map[string]interface{}{"shard": "two"}, nil)
+
+	want := "partition: expected an integer but got two"
+	if err == nil || err.Error() != want {
+		t.Errorf("unexpected error: want %q, got %+v", want, err)
+	}
+}
+
+func TestRecord_Compile_errors(t *testing.T) {
+	r := Record{Key: ".[", Headers: map[string]string{"trace": "..."}}
+
+	errs := config.Errors(r.Compile())
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors but got %d: %+v", len(errs), errs)
+	}
+	for i, prefix := range []string{"key: ", "headers.trace: "} {
+		if !strings.HasPrefix(errs[i].Error(), prefix) {
+			t.Errorf("expected an error starting with %q, got %q", prefix, errs[i].Error())
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		want string
+	}{
+		{v: nil, want: "<nil>"},
+		{v: "text", want: "text"},
+		{v: []byte("bytes"), want: "bytes"},
+		{v: map[string]interface{}{"a": []interface{}{1, "b"}}, want: `{"a":[1,"b"]}`},
+		{v: 42, want: "42"},
+	}
+
+	for _, test := range tests {
+		e, err := Encode(test.v)
+		if err != nil {
+			t.Fatalf("Encode returned error: %+v", err)
+		}
+		if got := encoded(t, e); got != test.want {
+			t.Errorf("unexpected encoding of %v: want %q, got %q", test.v, test.want, got)
+		}
+	}
+}
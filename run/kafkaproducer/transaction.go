@@ -0,0 +1,33 @@
+package kafkaproducer
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Shopify/sarama"
+)
+
+// ErrNoTransaction is returned by transactional producers invoked without a
+// transaction in their context, which happens when the source of the pipeline
+// is not a transactional kafka source.
+var ErrNoTransaction = errors.New("transactional producer invoked without a transaction; the source must be a kafka source with transactional set")
+
+type transactionKey struct{}
+
+// WithTransaction returns a copy of ctx carrying producer, whose transaction
+// has begun. A kafka source uses it to let producers later in the pipeline
+// take part in the transaction that commits the offset of the message being
+// processed.
+func WithTransaction(ctx context.Context, producer sarama.SyncProducer) context.Context {
+	return context.WithValue(ctx, transactionKey{}, producer)
+}
+
+// Transaction returns the producer of the transaction carried by ctx, or
+// ErrNoTransaction if ctx does not carry one.
+func Transaction(ctx context.Context) (sarama.SyncProducer, error) {
+	producer, ok := ctx.Value(transactionKey{}).(sarama.SyncProducer)
+	if !ok {
+		return nil, ErrNoTransaction
+	}
+	return producer, nil
+}
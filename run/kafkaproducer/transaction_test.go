@@ -0,0 +1,23 @@
+package kafkaproducer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Shopify/sarama/mocks"
+)
+
+func TestTransaction(t *testing.T) {
+	if _, err := Transaction(context.Background()); err != ErrNoTransaction {
+		t.Errorf("unexpected error: want %v, got %+v", ErrNoTransaction, err)
+	}
+
+	producer := mocks.NewSyncProducer(t, nil)
+	got, err := Transaction(WithTransaction(context.Background(), producer))
+	if err != nil {
+		t.Fatalf("Transaction returned error: %+v", err)
+	}
+	if got != producer {
+		t.Errorf("unexpected producer: want %v, got %v", producer, got)
+	}
+}
@@ -0,0 +1,67 @@
+// Package metrics provides the Prometheus registry shared by fnrun components
+// and the handler that serves it in the Prometheus text format.
+//
+// Components may be created many times over the life of a process, for
+// example when a pipeline restarts or its configuration is reloaded. Register
+// therefore returns the collector that is already registered when an
+// equivalent one is registered again, so that a recreated component continues
+// to update the same series.
+package metrics
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace is the prefix of the names of the metrics recorded by fnrun.
+const Namespace = "fnrun"
+
+// Registry is the registry of the metrics recorded by fnrun. It also collects
+// the standard Go runtime and process metrics.
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Register registers c with Registry. If an equivalent collector is already
+// registered, Register returns the existing collector instead. An error is
+// returned if c is invalid or conflicts with a registered collector, for
+// example because it has the same name but different label names.
+func Register[T prometheus.Collector](c T) (T, error) {
+	err := Registry.Register(c)
+	if err == nil {
+		return c, nil
+	}
+
+	var registered prometheus.AlreadyRegisteredError
+	if errors.As(err, &registered) {
+		if existing, ok := registered.ExistingCollector.(T); ok {
+			return existing, nil
+		}
+	}
+	return c, err
+}
+
+// MustRegister is like Register but panics if c cannot be registered. It is
+// intended for collectors declared as package variables.
+func MustRegister[T prometheus.Collector](c T) T {
+	c, err := Register(c)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// Handler returns an http.Handler that serves the metrics in Registry in the
+// Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
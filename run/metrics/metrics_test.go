@@ -0,0 +1,53 @@
+package metrics_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fnrun/fnrun/run/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func newCounter(labelNames ...string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "test_registrations_total",
+		Help:      "A counter registered by tests.",
+	}, labelNames)
+}
+
+func TestRegister_returnsExistingCollector(t *testing.T) {
+	first, err := metrics.Register(newCounter("label"))
+	if err != nil {
+		t.Fatalf("Register returned error: %+v", err)
+	}
+
+	second, err := metrics.Register(newCounter("label"))
+	if err != nil {
+		t.Fatalf("Register returned error: %+v", err)
+	}
+	if second != first {
+		t.Error("expected Register to return the registered collector")
+	}
+
+	if _, err := metrics.Register(newCounter("other")); err == nil {
+		t.Error("expected Register to return an error for conflicting label names but it did not")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	counter := metrics.MustRegister(newCounter("label"))
+	counter.WithLabelValues("value").Inc()
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	want := `fnrun_test_registrations_total{label="value"} 1`
+	if body := rec.Body.String(); !strings.Contains(body, want) {
+		t.Errorf("expected response to contain %q but got:\n%s", want, body)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("unexpected content type: %q", ct)
+	}
+}
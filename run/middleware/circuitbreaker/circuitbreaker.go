@@ -8,6 +8,7 @@ import (
 
 	"github.com/fnrun/fnrun/fn"
 	"github.com/fnrun/fnrun/run"
+	"github.com/fnrun/fnrun/run/config"
 	"github.com/mitchellh/mapstructure"
 	"github.com/sony/gobreaker"
 )
@@ -40,13 +41,46 @@ func (cbm *circuitBreakerMiddleware) Invoke(ctx context.Context, input interface
 
 func (cbm *circuitBreakerMiddleware) ConfigureMap(configMap map[string]interface{}) error {
 	cfg := &breakerConfig{}
-	mapstructure.Decode(configMap, cfg)
+	if err := config.Decode(configMap, cfg, mapstructure.StringToTimeDurationHookFunc()); err != nil {
+		return err
+	}
 
 	cbm.cb = gobreaker.NewCircuitBreaker(cfg.toSettings())
 
 	return nil
 }
 
+// Describe describes the configuration of the circuit breaker middleware.
+func (*circuitBreakerMiddleware) Describe() *config.Schema {
+	return &config.Schema{
+		Description: "Stops invoking the fn after it fails repeatedly, and returns errors until the circuit breaker's timeout has passed.",
+		Type:        "object",
+		Properties: map[string]*config.Schema{
+			"name": {
+				Type:        "string",
+				Description: "The name of the circuit breaker.",
+			},
+			"maxRequests": {
+				Type:        "integer",
+				Description: "The number of requests allowed through while the circuit breaker is half-open. 0 allows one request.",
+				Default:     0,
+				Minimum:     config.Minimum(0),
+			},
+			"interval": {
+				Type:        "string",
+				Description: "The period after which failure counts are cleared while the circuit breaker is closed, as a Go duration string. 0 never clears them.",
+				Default:     "0s",
+			},
+			"timeout": {
+				Type:        "string",
+				Description: "How long the circuit breaker stays open before becoming half-open, as a Go duration string. 0 uses 60s.",
+				Default:     "0s",
+			},
+		},
+		AdditionalProperties: config.NoAdditionalProperties(),
+	}
+}
+
 func New() run.Middleware {
 	return &circuitBreakerMiddleware{}
 }
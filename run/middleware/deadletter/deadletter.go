@@ -0,0 +1,206 @@
+// Package deadletter provides a middleware that sends inputs whose invocation
+// fails to a dead-letter sink.
+//
+// Each failed input is wrapped in an Envelope that records the input, the
+// error, the number of attempts made by an enclosed retry middleware, the time
+// of the failure, and the name of the pipeline. The envelope is encoded as JSON
+// and sent to the configured sink. Once the envelope is sent, the middleware
+// returns a nil output and error so that the source acknowledges the input,
+// unless `reraise` is set. If the envelope cannot be sent, the original error
+// is returned along with the error from the sink.
+//
+// The middleware must be configured with a map containing a `sink`, which is a
+// map with a single key naming one of the Sinks and the configuration of that
+// sink as its value:
+//
+// - file: appends envelopes as JSON lines to a local file
+// - http: posts envelopes to an HTTP endpoint
+// - kafka: produces envelopes to a Kafka topic
+// - sqs: sends envelopes to an SQS queue
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/fnrun/fnrun/fn"
+	"github.com/fnrun/fnrun/run"
+	"github.com/fnrun/fnrun/run/config"
+	"github.com/fnrun/fnrun/run/middleware/retry"
+)
+
+// Sink receives the encoded envelopes of failed inputs. A sink may implement
+// run.Starter and run.Closer to manage its connections.
+type Sink interface {
+	Send(ctx context.Context, envelope []byte) error
+}
+
+// Sinks maps the keys accepted in the `sink` configuration to functions that
+// create sinks. Additional sinks may be added before the middleware is
+// configured.
+var Sinks = map[string]func() Sink{
+	"file":  newFileSink,
+	"http":  newHTTPSink,
+	"kafka": newKafkaSink,
+	"sqs":   newSQSSink,
+}
+
+// Envelope is the record of a failed input that is sent to a sink.
+type Envelope struct {
+	Input     interface{} `json:"input"`
+	Error     string      `json:"error"`
+	Attempts  int         `json:"attempts"`
+	Timestamp time.Time   `json:"timestamp"`
+	Pipeline  string      `json:"pipeline,omitempty"`
+}
+
+// newEnvelope returns the envelope of input, which failed with err.
+func newEnvelope(ctx context.Context, input interface{}, err error) *Envelope {
+	attempts := 1
+	var retryErr *retry.Error
+	if errors.As(err, &retryErr) {
+		attempts = retryErr.Attempts
+	}
+
+	return &Envelope{
+		Input:     input,
+		Error:     err.Error(),
+		Attempts:  attempts,
+		Timestamp: time.Now().UTC(),
+		Pipeline:  run.Pipeline(ctx),
+	}
+}
+
+// encode encodes e as JSON. If the input cannot be encoded, it is replaced by
+// its string representation.
+func (e *Envelope) encode() ([]byte, error) {
+	b, err := json.Marshal(e)
+	if err == nil {
+		return b, nil
+	}
+
+	fallback := *e
+	fallback.Input = fmt.Sprint(e.Input)
+	return json.Marshal(&fallback)
+}
+
+type deadLetterMiddleware struct {
+	sink    Sink
+	reraise bool
+}
+
+func (*deadLetterMiddleware) RequiresConfig() bool {
+	return true
+}
+
+func (d *deadLetterMiddleware) ConfigureMap(configMap map[string]interface{}) error {
+	var cfg struct {
+		Sink    map[string]interface{} `mapstructure:"sink"`
+		Reraise bool                   `mapstructure:"reraise"`
+	}
+	if err := config.Decode(configMap, &cfg); err != nil {
+		return err
+	}
+
+	if cfg.Sink == nil {
+		return errors.New("sink is a required configuration key")
+	}
+	key, sinkConfig, err := config.GetSinglePair(cfg.Sink)
+	if err != nil {
+		return config.WithPath("sink", err)
+	}
+	newSink, exists := Sinks[key]
+	if !exists {
+		return config.WithPath("sink", fmt.Errorf("unknown sink %q; expected one of %v", key, sinkKeys()))
+	}
+
+	sink := newSink()
+	if err := config.Configure(sink, sinkConfig); err != nil {
+		return config.WithPath("sink."+key, err)
+	}
+
+	d.sink = sink
+	d.reraise = cfg.Reraise
+	return nil
+}
+
+func sinkKeys() []string {
+	keys := make([]string, 0, len(Sinks))
+	for key := range Sinks {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Start starts the sink.
+func (d *deadLetterMiddleware) Start(ctx context.Context) error {
+	return run.Start(ctx, d.sink)
+}
+
+// Close closes the sink.
+func (d *deadLetterMiddleware) Close() error {
+	return run.Close(d.sink)
+}
+
+func (d *deadLetterMiddleware) Invoke(ctx context.Context, input interface{}, f fn.Fn) (interface{}, error) {
+	output, err := f.Invoke(ctx, input)
+	if err == nil {
+		return output, nil
+	}
+
+	envelope, encodeErr := newEnvelope(ctx, input, err).encode()
+	if encodeErr != nil {
+		return output, errors.Join(err, fmt.Errorf("could not encode dead-letter envelope: %w", encodeErr))
+	}
+
+	// The envelope is sent even if the invocation failed because its context
+	// was cancelled or timed out.
+	if sendErr := d.sink.Send(context.WithoutCancel(ctx), envelope); sendErr != nil {
+		return output, errors.Join(err, fmt.Errorf("could not send input to dead-letter sink: %w", sendErr))
+	}
+
+	if d.reraise {
+		return output, err
+	}
+	return nil, nil
+}
+
+// Describe describes the configuration of the dead-letter middleware.
+func (*deadLetterMiddleware) Describe() *config.Schema {
+	sinks := make(map[string]*config.Schema, len(Sinks))
+	for key, newSink := range Sinks {
+		sinks[key] = config.Describe(newSink())
+	}
+
+	return &config.Schema{
+		Description: "Sends failed inputs, wrapped in an envelope with the error, attempt count, timestamp, and pipeline name, to a dead-letter sink.",
+		Type:        "object",
+		Properties: map[string]*config.Schema{
+			"sink": {
+				Type:                 "object",
+				Description:          "The sink that receives envelopes, as a map with a single key naming the sink.",
+				Properties:           sinks,
+				MinProperties:        1,
+				MaxProperties:        1,
+				AdditionalProperties: config.NoAdditionalProperties(),
+			},
+			"reraise": {
+				Type:        "boolean",
+				Description: "Whether to return the error after sending the envelope instead of acknowledging the input.",
+				Default:     false,
+			},
+		},
+		Required:             []string{"sink"},
+		AdditionalProperties: config.NoAdditionalProperties(),
+	}
+}
+
+// New returns a middleware that sends failed inputs to a dead-letter sink.
+func New() run.Middleware {
+	return &deadLetterMiddleware{}
+}
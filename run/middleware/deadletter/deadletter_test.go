@@ -0,0 +1,312 @@
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Shopify/sarama/mocks"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/fnrun/fnrun/fn"
+	"github.com/fnrun/fnrun/run"
+	"github.com/fnrun/fnrun/run/config"
+	"github.com/fnrun/fnrun/run/fn/identity"
+	"github.com/fnrun/fnrun/run/middleware/retry"
+)
+
+var errFailed = errors.New("failed")
+
+var failingFn = fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+	return nil, errFailed
+})
+
+func newMiddleware(t *testing.T, configMap map[string]interface{}) run.Middleware {
+	t.Helper()
+
+	m := New()
+	if err := config.Configure(m, configMap); err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+	t.Cleanup(func() { run.Close(m) })
+	return m
+}
+
+func readEnvelopes(t *testing.T, path string) []Envelope {
+	t.Helper()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("os.ReadFile returned error: %+v", err)
+	}
+
+	var envelopes []Envelope
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var e Envelope
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("json.Unmarshal returned error for %q: %+v", line, err)
+		}
+		envelopes = append(envelopes, e)
+	}
+	return envelopes
+}
+
+func TestInvoke_swallowsError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deadletter.jsonl")
+	m := newMiddleware(t, map[string]interface{}{
+		"sink": map[string]interface{}{"file": path},
+	})
+
+	ctx := run.WithPipeline(context.Background(), "orders")
+	for _, input := range []interface{}{"first", map[string]interface{}{"id": 2}} {
+		output, err := m.Invoke(ctx, input, failingFn)
+		if output != nil || err != nil {
+			t.Errorf("expected a nil output and error but got %v, %v", output, err)
+		}
+	}
+
+	envelopes := readEnvelopes(t, path)
+	if len(envelopes) != 2 {
+		t.Fatalf("expected 2 envelopes but got %d", len(envelopes))
+	}
+	got := envelopes[0]
+	if got.Input != "first" || got.Error != "failed" || got.Attempts != 1 || got.Pipeline != "orders" || got.Timestamp.IsZero() {
+		t.Errorf("unexpected envelope: %+v", got)
+	}
+	if input, _ := envelopes[1].Input.(map[string]interface{}); input["id"] != float64(2) {
+		t.Errorf("unexpected input: %#v", envelopes[1].Input)
+	}
+}
+
+func TestInvoke_reraise(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deadletter.jsonl")
+	m := newMiddleware(t, map[string]interface{}{
+		"sink":    map[string]interface{}{"file": map[string]interface{}{"path": path}},
+		"reraise": true,
+	})
+
+	if _, err := m.Invoke(context.Background(), "input", failingFn); !errors.Is(err, errFailed) {
+		t.Errorf("expected Invoke to return %v but got %v", errFailed, err)
+	}
+	if n := len(readEnvelopes(t, path)); n != 1 {
+		t.Errorf("expected 1 envelope but got %d", n)
+	}
+}
+
+func TestInvoke_success(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deadletter.jsonl")
+	m := newMiddleware(t, map[string]interface{}{
+		"sink": map[string]interface{}{"file": path},
+	})
+
+	output, err := m.Invoke(context.Background(), "input", identity.New())
+	if output != "input" || err != nil {
+		t.Errorf("unexpected result: %v, %v", output, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected no envelopes to be written but got %v", err)
+	}
+}
+
+func TestInvoke_recordsRetryAttempts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deadletter.jsonl")
+	m := newMiddleware(t, map[string]interface{}{
+		"sink": map[string]interface{}{"file": path},
+	})
+
+	f := fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		return nil, &retry.Error{Attempts: 3, Err: errFailed}
+	})
+	m.Invoke(context.Background(), "input", f)
+
+	if got := readEnvelopes(t, path)[0].Attempts; got != 3 {
+		t.Errorf("unexpected attempts: want 3, got %d", got)
+	}
+}
+
+func TestInvoke_sinkFails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	m := newMiddleware(t, map[string]interface{}{
+		"sink": map[string]interface{}{"http": server.URL},
+	})
+
+	_, err := m.Invoke(context.Background(), "input", failingFn)
+	if !errors.Is(err, errFailed) {
+		t.Errorf("expected error to wrap %v but got %v", errFailed, err)
+	}
+	if err == nil || !strings.Contains(err.Error(), "unexpected status 503") {
+		t.Errorf("expected error to contain the sink error but got %v", err)
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	bodyCh := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if got := req.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("unexpected authorization header: %q", got)
+		}
+		body, _ := io.ReadAll(req.Body)
+		bodyCh <- body
+	}))
+	defer server.Close()
+
+	m := newMiddleware(t, map[string]interface{}{
+		"sink": map[string]interface{}{"http": map[string]interface{}{
+			"url":     server.URL,
+			"headers": map[string]interface{}{"Authorization": "Bearer secret"},
+		}},
+	})
+
+	if _, err := m.Invoke(context.Background(), "input", failingFn); err != nil {
+		t.Fatalf("Invoke returned error: %+v", err)
+	}
+
+	var e Envelope
+	if err := json.Unmarshal(<-bodyCh, &e); err != nil {
+		t.Fatalf("json.Unmarshal returned error: %+v", err)
+	}
+	if e.Input != "input" || e.Error != "failed" {
+		t.Errorf("unexpected envelope: %+v", e)
+	}
+}
+
+func TestKafkaSink(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithCheckerFunctionAndSucceed(func(value []byte) error {
+		var e Envelope
+		if err := json.Unmarshal(value, &e); err != nil {
+			return err
+		}
+		if e.Input != "input" {
+			return errors.New("unexpected input")
+		}
+		return nil
+	})
+
+	sink := &kafkaSink{Topic: "deadletter", producer: producer}
+	sink.Brokers = []string{"localhost:9092"}
+	m := &deadLetterMiddleware{sink: sink}
+
+	if _, err := m.Invoke(context.Background(), "input", failingFn); err != nil {
+		t.Errorf("Invoke returned error: %+v", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Errorf("Close returned error: %+v", err)
+	}
+}
+
+type fakeSQSClient struct {
+	sent []*sqs.SendMessageInput
+}
+
+func (c *fakeSQSClient) GetQueueUrl(ctx context.Context, params *sqs.GetQueueUrlInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error) {
+	return &sqs.GetQueueUrlOutput{QueueUrl: aws.String("https://sqs.local/" + aws.ToString(params.QueueName))}, nil
+}
+
+func (c *fakeSQSClient) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	c.sent = append(c.sent, params)
+	return &sqs.SendMessageOutput{MessageId: aws.String("message-1")}, nil
+}
+
+func TestSQSSink(t *testing.T) {
+	client := &fakeSQSClient{}
+	sink := &sqsSink{QueueName: "deadletter", client: client}
+	m := &deadLetterMiddleware{sink: sink}
+
+	if _, err := m.Invoke(context.Background(), "input", failingFn); err != nil {
+		t.Fatalf("Invoke returned error: %+v", err)
+	}
+
+	if len(client.sent) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(client.sent))
+	}
+	if got := aws.ToString(client.sent[0].QueueUrl); got != "https://sqs.local/deadletter" {
+		t.Errorf("unexpected queue URL: %q", got)
+	}
+
+	var e Envelope
+	if err := json.Unmarshal([]byte(aws.ToString(client.sent[0].MessageBody)), &e); err != nil {
+		t.Fatalf("message body is not an envelope: %+v", err)
+	}
+	if e.Input != "input" {
+		t.Errorf("unexpected input: %v", e.Input)
+	}
+}
+
+func TestSQSSink_fifo(t *testing.T) {
+	client := &fakeSQSClient{}
+	sink := newSQSSink().(*sqsSink)
+	err := config.Configure(sink, map[string]interface{}{
+		"queue":           "deadletter.fifo",
+		"groupID":         ".input.customer",
+		"deduplicationID": ".input.id",
+	})
+	if err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+	sink.client = client
+	m := &deadLetterMiddleware{sink: sink}
+
+	input := map[string]interface{}{"customer": "customer-1", "id": 7}
+	if _, err := m.Invoke(context.Background(), input, failingFn); err != nil {
+		t.Fatalf("Invoke returned error: %+v", err)
+	}
+
+	sent := client.sent[0]
+	if got := aws.ToString(sent.MessageGroupId); got != "customer-1" {
+		t.Errorf("unexpected message group ID: %q", got)
+	}
+	if got := aws.ToString(sent.MessageDeduplicationId); got != "7" {
+		t.Errorf("unexpected deduplication ID: %q", got)
+	}
+}
+
+func TestConfigureMap_invalid(t *testing.T) {
+	tests := []struct {
+		config map[string]interface{}
+		want   string
+	}{
+		{
+			config: map[string]interface{}{},
+			want:   "sink is a required configuration key",
+		},
+		{
+			config: map[string]interface{}{"sink": map[string]interface{}{"s3": "bucket"}},
+			want:   `sink: unknown sink "s3"; expected one of [file http kafka sqs]`,
+		},
+		{
+			config: map[string]interface{}{"sink": map[string]interface{}{"kafka": map[string]interface{}{"brokers": "localhost:9092"}}},
+			want:   "sink.kafka.topic: topic is required",
+		},
+		{
+			config: map[string]interface{}{"sink": map[string]interface{}{"kafka": map[string]interface{}{
+				"brokers": "localhost:9092",
+				"topic":   "deadletter",
+				"sasl":    map[string]interface{}{"mechanism": "PLAIN"},
+			}}},
+			want: "sink.kafka.sasl.username: username is required",
+		},
+		{
+			config: map[string]interface{}{"sink": map[string]interface{}{"sqs": "deadletter.fifo"}},
+			want:   "sink.sqs.groupID: groupID is required for FIFO queues",
+		},
+	}
+
+	for _, tt := range tests {
+		err := config.Configure(New(), tt.config)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("unexpected error for %v: want %q, got %v", tt.config, tt.want, err)
+		}
+	}
+}
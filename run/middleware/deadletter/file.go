@@ -0,0 +1,110 @@
+package deadletter
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+
+	"github.com/fnrun/fnrun/run/config"
+)
+
+// fileSink appends envelopes as JSON lines to a local file.
+type fileSink struct {
+	Path string `mapstructure:"path"`
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+func (*fileSink) RequiresConfig() bool {
+	return true
+}
+
+func (s *fileSink) ConfigureString(path string) error {
+	s.Path = path
+	return nil
+}
+
+func (s *fileSink) ConfigureMap(configMap map[string]interface{}) error {
+	return config.Decode(configMap, s)
+}
+
+func (s *fileSink) Validate() error {
+	if s.Path == "" {
+		return errors.New("path is required")
+	}
+	return nil
+}
+
+// open opens the file if it is not already open. s.mu must be held.
+func (s *fileSink) open() error {
+	if s.file != nil {
+		return nil
+	}
+
+	f, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	s.file = f
+	return nil
+}
+
+// Start opens the file so that a path that cannot be written is reported
+// before the first input fails.
+func (s *fileSink) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.open()
+}
+
+func (s *fileSink) Send(ctx context.Context, envelope []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.open(); err != nil {
+		return err
+	}
+	_, err := s.file.Write(append(envelope, '\n'))
+	return err
+}
+
+// Close closes the file.
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+func (*fileSink) Describe() *config.Schema {
+	path := &config.Schema{
+		Type:        "string",
+		Description: "The path of the file that envelopes are appended to, one JSON object per line.",
+		Examples:    []interface{}{"/var/log/fnrun/deadletter.jsonl"},
+	}
+
+	return &config.Schema{
+		Description: "Appends envelopes to a local JSON lines file. A string configures the path.",
+		OneOf: []*config.Schema{
+			path,
+			{
+				Type:                 "object",
+				Properties:           map[string]*config.Schema{"path": path},
+				Required:             []string{"path"},
+				AdditionalProperties: config.NoAdditionalProperties(),
+			},
+		},
+	}
+}
+
+func newFileSink() Sink {
+	return &fileSink{}
+}
@@ -0,0 +1,106 @@
+package deadletter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/fnrun/fnrun/run/config"
+	"github.com/fnrun/fnrun/run/tracing"
+	"github.com/mitchellh/mapstructure"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// httpSink posts envelopes to an HTTP endpoint.
+type httpSink struct {
+	URL     string            `mapstructure:"url"`
+	Headers map[string]string `mapstructure:"headers"`
+	Timeout time.Duration     `mapstructure:"timeout"`
+}
+
+func (*httpSink) RequiresConfig() bool {
+	return true
+}
+
+func (s *httpSink) ConfigureString(url string) error {
+	s.URL = url
+	return nil
+}
+
+func (s *httpSink) ConfigureMap(configMap map[string]interface{}) error {
+	return config.Decode(configMap, s, mapstructure.StringToTimeDurationHookFunc())
+}
+
+func (s *httpSink) Validate() error {
+	if s.URL == "" {
+		return errors.New("url is required")
+	}
+	return nil
+}
+
+func (s *httpSink) Send(ctx context.Context, envelope []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(envelope))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range s.Headers {
+		req.Header.Set(key, value)
+	}
+	tracing.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+func (*httpSink) Describe() *config.Schema {
+	url := &config.Schema{
+		Type:        "string",
+		Description: "The URL that envelopes are posted to.",
+	}
+
+	return &config.Schema{
+		Description: "Posts each envelope as JSON to an HTTP endpoint. Responses with status codes of 300 or greater are errors. A string configures the URL.",
+		OneOf: []*config.Schema{
+			url,
+			{
+				Type: "object",
+				Properties: map[string]*config.Schema{
+					"url": url,
+					"headers": {
+						Type:                 "object",
+						Description:          "Headers sent with each request.",
+						AdditionalProperties: &config.Schema{Type: "string"},
+					},
+					"timeout": {
+						Type:        "string",
+						Description: "The timeout of each request, as a Go duration string.",
+						Default:     "10s",
+					},
+				},
+				Required:             []string{"url"},
+				AdditionalProperties: config.NoAdditionalProperties(),
+			},
+		},
+	}
+}
+
+func newHTTPSink() Sink {
+	return &httpSink{Timeout: 10 * time.Second}
+}
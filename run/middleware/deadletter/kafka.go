@@ -0,0 +1,118 @@
+package deadletter
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/Shopify/sarama"
+	"github.com/fnrun/fnrun/run/config"
+	"github.com/fnrun/fnrun/run/kafkaproducer"
+	"github.com/mitchellh/mapstructure"
+)
+
+// kafkaSink produces envelopes to a Kafka topic.
+type kafkaSink struct {
+	kafkaproducer.Config `mapstructure:",squash"`
+
+	Topic string `mapstructure:"topic"`
+
+	mu       sync.Mutex
+	producer sarama.SyncProducer
+}
+
+func (*kafkaSink) RequiresConfig() bool {
+	return true
+}
+
+func (s *kafkaSink) ConfigureMap(configMap map[string]interface{}) error {
+	return config.Decode(configMap, s, mapstructure.StringToSliceHookFunc(","))
+}
+
+func (s *kafkaSink) Validate() error {
+	if s.Topic == "" {
+		return config.WithPath("topic", errors.New("topic is required"))
+	}
+
+	return s.Config.Validate()
+}
+
+// connect creates the producer if it has not been created. s.mu must be held.
+func (s *kafkaSink) connect() error {
+	if s.producer != nil {
+		return nil
+	}
+
+	saramaConfig, err := s.NewSaramaConfig()
+	if err != nil {
+		return err
+	}
+
+	producer, err := sarama.NewSyncProducer(s.Brokers, saramaConfig)
+	if err != nil {
+		return err
+	}
+	s.producer = producer
+	return nil
+}
+
+// Start connects the producer to the brokers.
+func (s *kafkaSink) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.connect()
+}
+
+func (s *kafkaSink) Send(ctx context.Context, envelope []byte) error {
+	s.mu.Lock()
+	err := s.connect()
+	producer := s.producer
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	_, _, err = producer.SendMessage(&sarama.ProducerMessage{
+		Topic: s.Topic,
+		Value: sarama.ByteEncoder(envelope),
+	})
+	return err
+}
+
+// Close closes the producer.
+func (s *kafkaSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.producer == nil {
+		return nil
+	}
+	err := s.producer.Close()
+	s.producer = nil
+	return err
+}
+
+func (s *kafkaSink) Describe() *config.Schema {
+	properties := map[string]*config.Schema{
+		"topic": {
+			Type:        "string",
+			Description: "The topic that envelopes are produced to.",
+		},
+	}
+	for key, schema := range s.Config.DescribeProperties() {
+		properties[key] = schema
+	}
+
+	return &config.Schema{
+		Description:          "Produces each envelope as a message to a Kafka topic.",
+		Type:                 "object",
+		Properties:           properties,
+		Required:             []string{"brokers", "topic"},
+		AdditionalProperties: config.NoAdditionalProperties(),
+	}
+}
+
+func newKafkaSink() Sink {
+	return &kafkaSink{}
+}
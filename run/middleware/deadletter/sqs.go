@@ -0,0 +1,142 @@
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/fnrun/fnrun/run/awspublisher"
+	"github.com/fnrun/fnrun/run/config"
+)
+
+// sqsSink sends envelopes to an SQS queue. The message group and deduplication
+// IDs, which FIFO queues use, are produced from the envelope by jq programs.
+type sqsSink struct {
+	awspublisher.Endpoint `mapstructure:",squash"`
+
+	QueueName       string `mapstructure:"queue"`
+	GroupID         string `mapstructure:"groupID"`
+	DeduplicationID string `mapstructure:"deduplicationID"`
+
+	message   awspublisher.Message
+	mu        sync.Mutex
+	client    awspublisher.SQSAPI
+	publisher awspublisher.Publisher
+}
+
+func (*sqsSink) RequiresConfig() bool {
+	return true
+}
+
+func (s *sqsSink) ConfigureString(queueName string) error {
+	s.QueueName = queueName
+	return nil
+}
+
+func (s *sqsSink) ConfigureMap(configMap map[string]interface{}) error {
+	if err := config.Decode(configMap, s); err != nil {
+		return err
+	}
+
+	s.message = awspublisher.Message{GroupID: s.GroupID, DeduplicationID: s.DeduplicationID}
+	return s.message.Compile()
+}
+
+func (s *sqsSink) Validate() error {
+	if s.QueueName == "" {
+		return config.WithPath("queue", errors.New("queue is required"))
+	}
+	if strings.HasSuffix(s.QueueName, ".fifo") && s.GroupID == "" {
+		return config.WithPath("groupID", errors.New("groupID is required for FIFO queues"))
+	}
+	return nil
+}
+
+// connect creates the publisher if it has not been created. s.mu must be held.
+func (s *sqsSink) connect(ctx context.Context) error {
+	if s.publisher != nil {
+		return nil
+	}
+
+	if s.client == nil {
+		cfg, err := s.LoadConfig(ctx)
+		if err != nil {
+			return err
+		}
+		s.client = sqs.NewFromConfig(cfg)
+	}
+
+	publisher, err := awspublisher.NewSQSPublisher(ctx, s.client, s.QueueName)
+	if err != nil {
+		return err
+	}
+	s.publisher = publisher
+	return nil
+}
+
+// Start creates the client and looks up the URL of the queue.
+func (s *sqsSink) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.connect(ctx)
+}
+
+func (s *sqsSink) Send(ctx context.Context, envelope []byte) error {
+	s.mu.Lock()
+	err := s.connect(ctx)
+	publisher := s.publisher
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(envelope, &v); err != nil {
+		return err
+	}
+	message, err := s.message.Build(ctx, v, envelope)
+	if err != nil {
+		return err
+	}
+
+	_, err = publisher.Publish(ctx, message)
+	return err
+}
+
+func (s *sqsSink) Describe() *config.Schema {
+	queue := &config.Schema{
+		Type:        "string",
+		Description: "The name of the queue that envelopes are sent to.",
+	}
+
+	messageProperties := s.message.DescribeProperties("the envelope")
+	properties := map[string]*config.Schema{
+		"queue":           queue,
+		"groupID":         messageProperties["groupID"],
+		"deduplicationID": messageProperties["deduplicationID"],
+	}
+	for key, schema := range s.Endpoint.DescribeProperties("SQS") {
+		properties[key] = schema
+	}
+
+	return &config.Schema{
+		Description: "Sends each envelope as a message to an SQS queue. A string configures the queue name.",
+		OneOf: []*config.Schema{
+			queue,
+			{
+				Type:                 "object",
+				Properties:           properties,
+				Required:             []string{"queue"},
+				AdditionalProperties: config.NoAdditionalProperties(),
+			},
+		},
+	}
+}
+
+func newSQSSink() Sink {
+	return &sqsSink{Endpoint: awspublisher.DefaultEndpoint()}
+}
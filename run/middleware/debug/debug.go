@@ -11,6 +11,7 @@ import (
 
 	"github.com/fnrun/fnrun/fn"
 	"github.com/fnrun/fnrun/run"
+	"github.com/fnrun/fnrun/run/config"
 )
 
 type debugMiddleware struct {
@@ -39,6 +40,15 @@ func (d *debugMiddleware) Invoke(ctx context.Context, input interface{}, f fn.Fn
 	return output, err
 }
 
+// Describe describes the configuration of the debug middleware.
+func (*debugMiddleware) Describe() *config.Schema {
+	return &config.Schema{
+		Description: "Prints inputs, outputs, and errors to stdout. It may be configured with whether printing is enabled.",
+		Type:        "boolean",
+		Default:     true,
+	}
+}
+
 // New returns a debug middleware with printing enabled. The value may be
 // configured with a bool to indicate whether printing should be enabled
 // explicitly.
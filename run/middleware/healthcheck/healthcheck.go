@@ -1,35 +1,62 @@
-// Package healthcheck provides a simple HTTP health check. It sets up an HTTP
-// server on port 8080 that returns a 200 response from the `/` route.
+// Package healthcheck provides a simple HTTP health check. When the runner
+// starts, it sets up an HTTP server on port 8080 that returns a 200 response
+// from the `/` route. The server is shut down when the runner is closed.
 package healthcheck
 
 import (
 	"context"
+	"net"
 	"net/http"
 
 	"github.com/fnrun/fnrun/fn"
 	"github.com/fnrun/fnrun/run"
+	"github.com/fnrun/fnrun/run/config"
 )
 
 type healthcheckMiddleware struct {
+	server *http.Server
 }
 
-func (h *healthcheckMiddleware) Configure() error {
+func (h *healthcheckMiddleware) Start(ctx context.Context) error {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("OK"))
 	})
 
+	ln, err := net.Listen("tcp", ":8080")
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{Handler: mux}
+	h.server = srv
+
 	go func() {
-		http.ListenAndServe(":8080", mux)
+		srv.Serve(ln)
 	}()
 
 	return nil
 }
 
+func (h *healthcheckMiddleware) Close() error {
+	if h.server == nil {
+		return nil
+	}
+
+	return h.server.Close()
+}
+
 func (h *healthcheckMiddleware) Invoke(ctx context.Context, input interface{}, f fn.Fn) (interface{}, error) {
 	return f.Invoke(ctx, input)
 }
 
+// Describe describes the healthcheck middleware, which takes no configuration.
+func (*healthcheckMiddleware) Describe() *config.Schema {
+	return &config.Schema{
+		Description: "Serves a 200 response from the / route on port 8080 while the runner is running. It takes no configuration.",
+	}
+}
+
 // New returns a new healthcheck middleware.
 func New() run.Middleware {
 	return &healthcheckMiddleware{}
@@ -4,12 +4,12 @@ package jq
 
 import (
 	"context"
+	"errors"
 
 	"github.com/fnrun/fnrun/fn"
 	"github.com/fnrun/fnrun/run"
+	"github.com/fnrun/fnrun/run/config"
 	"github.com/itchyny/gojq"
-	"github.com/mitchellh/mapstructure"
-	"github.com/pkg/errors"
 )
 
 type jqMiddleware struct {
@@ -65,21 +65,18 @@ func (*jqMiddleware) RequiresConfig() bool {
 }
 
 func (j *jqMiddleware) ConfigureMap(configMap map[string]interface{}) error {
-	var config jqMiddlewareConfig
-	if err := mapstructure.Decode(configMap, &config); err != nil {
+	var cfg jqMiddlewareConfig
+	if err := config.Decode(configMap, &cfg); err != nil {
 		return err
 	}
 
-	inputCode, err := compile(config.Input)
-	if err != nil {
-		return errors.Wrap(err, "invalid input configuration")
+	inputCode, inputErr := compile(cfg.Input)
+	outputCode, outputErr := compile(cfg.Output)
+	if err := errors.Join(config.WithPath("input", inputErr), config.WithPath("output", outputErr)); err != nil {
+		return err
 	}
-	j.input = inputCode
 
-	outputCode, err := compile(config.Output)
-	if err != nil {
-		return errors.Wrap(err, "invalid output configuration")
-	}
+	j.input = inputCode
 	j.output = outputCode
 
 	return nil
@@ -99,6 +96,26 @@ func (j *jqMiddleware) Invoke(ctx context.Context, input interface{}, f fn.Fn) (
 	return apply(ctx, j.output, output)
 }
 
+// Describe describes the configuration of the jq middleware.
+func (*jqMiddleware) Describe() *config.Schema {
+	return &config.Schema{
+		Description: "Transforms inputs and outputs with jq programs. A program that produces several values produces an array.",
+		Type:        "object",
+		Properties: map[string]*config.Schema{
+			"input": {
+				Type:        "string",
+				Description: "The jq program applied to each input. Inputs are passed through unchanged if it is empty.",
+				Examples:    []interface{}{".body"},
+			},
+			"output": {
+				Type:        "string",
+				Description: "The jq program applied to each output. Outputs are passed through unchanged if it is empty.",
+			},
+		},
+		AdditionalProperties: config.NoAdditionalProperties(),
+	}
+}
+
 // New returns a middleware that applies jq patterns to inputs and/or outputs.
 func New() run.Middleware {
 	return &jqMiddleware{}
@@ -29,7 +29,7 @@ func TestConfigureMap_invalidDestructure(t *testing.T) {
 		t.Fatal("expected config.Configure to return an error but it did not")
 	}
 
-	want := "1 error(s) decoding:\n\n* 'input' expected type 'string', got unconvertible type 'int', value: '4'"
+	want := "input: expected type 'string', got unconvertible type 'int', value: '4'"
 	got := err.Error()
 
 	if got != want {
@@ -44,7 +44,7 @@ func TestConfigureMap_invalidInputConfiguration(t *testing.T) {
 		t.Error("expected config.Configure to return an error but it did not")
 	}
 
-	want := "invalid input configuration: unexpected EOF"
+	want := "input: unexpected EOF"
 	got := err.Error()
 
 	if got != want {
@@ -59,7 +59,7 @@ func TestConfigureMap_invalidOutputConfiguration(t *testing.T) {
 		t.Error("expected config.Configure to return an error but it did not")
 	}
 
-	want := "invalid output configuration: unexpected EOF"
+	want := "output: unexpected EOF"
 	got := err.Error()
 
 	if got != want {
@@ -10,7 +10,7 @@ import (
 
 	"github.com/fnrun/fnrun/fn"
 	"github.com/fnrun/fnrun/run"
-	"github.com/mitchellh/mapstructure"
+	"github.com/fnrun/fnrun/run/config"
 )
 
 var errUnknownStrategy = errors.New("unknown strategy")
@@ -67,7 +67,28 @@ func (jm *jsonMiddleware) Invoke(ctx context.Context, input interface{}, f fn.Fn
 }
 
 func (jm *jsonMiddleware) ConfigureMap(configMap map[string]interface{}) error {
-	return mapstructure.Decode(configMap, jm.config)
+	return config.Decode(configMap, jm.config)
+}
+
+// Describe describes the configuration of the json middleware.
+func (*jsonMiddleware) Describe() *config.Schema {
+	strategy := func(description string) *config.Schema {
+		return &config.Schema{
+			Type:        "string",
+			Description: description,
+			Enum:        []interface{}{"serialize", "deserialize"},
+		}
+	}
+
+	return &config.Schema{
+		Description: "Serializes values to and deserializes values from JSON strings.",
+		Type:        "object",
+		Properties: map[string]*config.Schema{
+			"input":  strategy("How each input is transformed. Inputs are passed through unchanged if it is not set."),
+			"output": strategy("How each output is transformed. Outputs are passed through unchanged if it is not set."),
+		},
+		AdditionalProperties: config.NoAdditionalProperties(),
+	}
 }
 
 // New returns a json middleware that does not manipulate input or output.
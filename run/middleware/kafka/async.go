@@ -0,0 +1,71 @@
+package kafka
+
+import (
+	"context"
+	"log"
+
+	"github.com/Shopify/sarama"
+)
+
+// asyncProducer produces messages without waiting for them to be acknowledged.
+// At most maxInFlight messages are unacknowledged at a time, so Send blocks
+// while the brokers catch up. Errors are logged because the invocation that
+// produced the message has already returned.
+type asyncProducer struct {
+	producer sarama.AsyncProducer
+	inFlight chan struct{}
+	done     chan struct{}
+}
+
+func newAsyncProducer(producer sarama.AsyncProducer, maxInFlight int) *asyncProducer {
+	p := &asyncProducer{
+		producer: producer,
+		inFlight: make(chan struct{}, maxInFlight),
+		done:     make(chan struct{}),
+	}
+	go p.acknowledge()
+
+	return p
+}
+
+// Send queues message to be produced once there is room in flight for it.
+func (p *asyncProducer) Send(ctx context.Context, message *sarama.ProducerMessage) error {
+	select {
+	case p.inFlight <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	p.producer.Input() <- message
+	return nil
+}
+
+func (p *asyncProducer) acknowledge() {
+	defer close(p.done)
+
+	successes, errs := p.producer.Successes(), p.producer.Errors()
+	for successes != nil || errs != nil {
+		select {
+		case _, ok := <-successes:
+			if !ok {
+				successes = nil
+				continue
+			}
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			log.Printf("Error producing message to topic %s: %+v\n", err.Msg.Topic, err.Err)
+		}
+		<-p.inFlight
+	}
+}
+
+// Close flushes buffered messages and waits for every message in flight to be
+// acknowledged.
+func (p *asyncProducer) Close() error {
+	p.producer.AsyncClose()
+	<-p.done
+	return nil
+}
@@ -1,90 +1,142 @@
+// Package kafka provides a middleware that publishes the results of
+// invocations to Kafka. The output of each successful invocation is published
+// to the success topic, and the message of each error to the error topic.
+//
+// The key, value, partition, and headers of published messages may be chosen
+// with jq programs. They are evaluated against an object with the input of the
+// invocation under "input" and either its output under "output" or its error
+// message under "error". By default, messages have no key and their value is
+// the output or error message, encoded as JSON unless it is a string.
+//
+// In async mode, the middleware returns without waiting for messages to be
+// acknowledged. Messages are batched by the producer, at most maxInFlight
+// messages are unacknowledged at a time, and buffered messages are flushed
+// when the middleware is closed. Errors producing messages are logged.
+//
+// In transactional mode, the middleware publishes messages in the transaction
+// that a transactional kafka source began for the message being processed,
+// instead of with its own producer. The messages are then only visible to
+// read_committed consumers once the source commits the offset of the message.
+// Errors are not published in transactional mode, because the source aborts
+// the transaction of a message that the fn failed to process.
 package kafka
 
 import (
 	"context"
-	"crypto/tls"
-	"crypto/x509"
-	"fmt"
-	"io/ioutil"
 	"sync"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/fnrun/fnrun/fn"
 	"github.com/fnrun/fnrun/run"
+	"github.com/fnrun/fnrun/run/config"
+	"github.com/fnrun/fnrun/run/kafkaauth"
+	"github.com/fnrun/fnrun/run/kafkaproducer"
 	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
 )
 
+// defaultMaxInFlight is the number of unacknowledged messages allowed in async
+// mode when maxInFlight is not set.
+const defaultMaxInFlight = 1000
+
 type kafkaMiddleware struct {
-	Brokers      []string
+	kafkaproducer.Config `mapstructure:",squash"`
+	kafkaproducer.Record `mapstructure:",squash"`
+
 	SuccessTopic string
 	ErrorTopic   string
 
+	// These options predate tls and enable TLS only if all three files are
+	// set.
 	CertFile  string
 	KeyFile   string
 	CAFile    string `mapstructure:"caFile,omitempty"`
 	VerifySSL bool   `mapstructure:"verifySSL,omitempty"`
 
-	producer            sarama.SyncProducer
-	initializationError error
-	once                sync.Once
+	Async         *asyncOptions
+	Transactional bool
+
+	// mutex is held for reading while a message is sent, so that Close waits
+	// for the sends in flight before closing the producer.
+	mutex         sync.RWMutex
+	closed        bool
+	producer      sarama.SyncProducer
+	asyncProducer *asyncProducer
 }
 
-func sendMessage(producer sarama.SyncProducer, topic string, message interface{}) error {
-	_, _, err := producer.SendMessage(&sarama.ProducerMessage{
-		Topic: topic,
-		Value: sarama.StringEncoder(fmt.Sprint(message)),
-	})
+// errClosed is returned by invocations of a middleware that has been closed.
+var errClosed = errors.New("kafka middleware is closed")
 
-	return err
+type asyncOptions struct {
+	MaxInFlight    int
+	FlushFrequency time.Duration
+	FlushMessages  int
 }
 
-func (m *kafkaMiddleware) newTLSConfiguration() (*tls.Config, error) {
+// legacyTLS returns the TLS configuration of the certFile, keyFile, and caFile
+// options, or nil if they do not enable TLS.
+func (m *kafkaMiddleware) legacyTLS() *kafkaauth.TLS {
 	if m.CertFile != "" && m.KeyFile != "" && m.CAFile != "" {
-		cert, err := tls.LoadX509KeyPair(m.CertFile, m.KeyFile)
-		if err != nil {
-			return nil, err
+		return &kafkaauth.TLS{
+			CertFile:           m.CertFile,
+			KeyFile:            m.KeyFile,
+			CAFile:             m.CAFile,
+			InsecureSkipVerify: m.VerifySSL,
 		}
+	}
 
-		caCert, err := ioutil.ReadFile(m.CAFile)
-		if err != nil {
-			return nil, err
-		}
+	return nil
+}
 
-		caCertPool := x509.NewCertPool()
-		caCertPool.AppendCertsFromPEM(caCert)
+func (m *kafkaMiddleware) newSaramaConfig() (*sarama.Config, error) {
+	producerConfig := m.Config
+	if producerConfig.TLS == nil {
+		producerConfig.TLS = m.legacyTLS()
+	}
 
-		return &tls.Config{
-			Certificates:       []tls.Certificate{cert},
-			RootCAs:            caCertPool,
-			InsecureSkipVerify: m.VerifySSL,
-		}, nil
+	saramaConfig, err := producerConfig.NewSaramaConfig()
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, nil
+	if m.Partitioned() {
+		saramaConfig.Producer.Partitioner = kafkaproducer.NewPartitioner
+	}
+	if m.Async != nil {
+		saramaConfig.Producer.Return.Errors = true
+		saramaConfig.Producer.Flush.Frequency = m.Async.FlushFrequency
+		saramaConfig.Producer.Flush.Messages = m.Async.FlushMessages
+	}
+
+	return saramaConfig, nil
 }
 
 func (m *kafkaMiddleware) initializeProducer() error {
-	if m.producer != nil {
+	if m.producer != nil || m.asyncProducer != nil || m.Transactional {
 		return nil
 	}
 
-	config := sarama.NewConfig()
-	config.Producer.RequiredAcks = sarama.WaitForAll // Wait for all in-sync replicas to ack the message
-	config.Producer.Retry.Max = 10                   // Retry up to 10 times to produce the message
-	config.Producer.Return.Successes = true
-
-	tlsConfig, err := m.newTLSConfiguration()
+	saramaConfig, err := m.newSaramaConfig()
 	if err != nil {
 		return err
 	}
 
-	if tlsConfig != nil {
-		config.Net.TLS.Config = tlsConfig
-		config.Net.TLS.Enable = true
+	if m.Async != nil {
+		producer, err := sarama.NewAsyncProducer(m.Brokers, saramaConfig)
+		if err != nil {
+			return err
+		}
+
+		maxInFlight := m.Async.MaxInFlight
+		if maxInFlight == 0 {
+			maxInFlight = defaultMaxInFlight
+		}
+		m.asyncProducer = newAsyncProducer(producer, maxInFlight)
+		return nil
 	}
 
-	producer, err := sarama.NewSyncProducer(m.Brokers, config)
+	producer, err := sarama.NewSyncProducer(m.Brokers, saramaConfig)
 	if err != nil {
 		return err
 	}
@@ -93,52 +145,239 @@ func (m *kafkaMiddleware) initializeProducer() error {
 	return nil
 }
 
+// Start connects the producer to the brokers. A middleware that has been
+// closed may be started again.
+func (m *kafkaMiddleware) Start(ctx context.Context) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.closed = false
+	return m.initializeProducer()
+}
+
+// initialize creates the producer unless it exists, so that a middleware that
+// was not started connects on its first invocation. An error is returned to
+// the caller so that the next invocation tries again.
+func (m *kafkaMiddleware) initialize() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.closed {
+		return errClosed
+	}
+	return m.initializeProducer()
+}
+
+// Close closes the producer if it has been created, once the messages being
+// sent have been sent. In async mode, buffered messages are flushed first.
+// Invocations fail until the middleware is started again.
+func (m *kafkaMiddleware) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.closed = true
+
+	if m.asyncProducer != nil {
+		producer := m.asyncProducer
+		m.asyncProducer = nil
+		return producer.Close()
+	}
+
+	if m.producer == nil {
+		return nil
+	}
+
+	producer := m.producer
+	m.producer = nil
+	return producer.Close()
+}
+
 func (m *kafkaMiddleware) RequiresConfig() bool {
 	return true
 }
 
 func (m *kafkaMiddleware) ConfigureMap(configMap map[string]interface{}) error {
-	decoderConfig := &mapstructure.DecoderConfig{
-		Metadata: nil,
-		Result:   m,
-		DecodeHook: mapstructure.ComposeDecodeHookFunc(
-			mapstructure.StringToSliceHookFunc(","),
-		),
-	}
-	decoder, err := mapstructure.NewDecoder(decoderConfig)
+	err := config.Decode(configMap, m,
+		mapstructure.StringToSliceHookFunc(","),
+		mapstructure.StringToTimeDurationHookFunc(),
+	)
 	if err != nil {
 		return err
 	}
 
-	return decoder.Decode(configMap)
+	return m.Compile()
 }
 
-func (m *kafkaMiddleware) Invoke(ctx context.Context, input interface{}, f fn.Fn) (interface{}, error) {
-	m.once.Do(func() {
-		if nil == m.producer {
-			m.initializationError = m.initializeProducer()
+func (m *kafkaMiddleware) Validate() error {
+	if m.Transactional {
+		return m.validateTransactional()
+	}
+	if m.TLS != nil && m.legacyTLS() != nil {
+		return config.WithPath("tls", errors.New("certFile, keyFile, and caFile cannot be combined with tls"))
+	}
+	if m.Async != nil {
+		if m.Async.MaxInFlight < 0 {
+			return config.WithPath("async", errors.New("maxInFlight must not be negative"))
 		}
-	})
+		if m.Async.FlushMessages < 0 {
+			return config.WithPath("async", errors.New("flushMessages must not be negative"))
+		}
+	}
 
-	if m.initializationError != nil {
-		return nil, m.initializationError
+	return m.Config.Validate()
+}
+
+// validateTransactional checks that the options of the middleware's own
+// producer are not set in transactional mode, where messages are produced by
+// the producer of the source instead.
+func (m *kafkaMiddleware) validateTransactional() error {
+	if m.Async != nil {
+		return config.WithPath("async", errors.New("async cannot be combined with transactional"))
+	}
+	// Error messages would be produced in the transaction that the source
+	// aborts because the fn failed, so they would never be visible.
+	if m.ErrorTopic != "" {
+		return config.WithPath("errorTopic", errors.New("errorTopic cannot be combined with transactional"))
+	}
+	for _, option := range []struct{ key, value string }{
+		{"certFile", m.CertFile}, {"keyFile", m.KeyFile}, {"caFile", m.CAFile},
+	} {
+		if option.value != "" {
+			return config.WithPath(option.key, errors.New("certFile, keyFile, and caFile cannot be combined with transactional"))
+		}
+	}
+
+	return m.Config.ValidateTransactional()
+}
+
+// send produces a message to topic built from v, with value unless the value
+// is chosen by a jq program.
+func (m *kafkaMiddleware) send(ctx context.Context, topic string, v interface{}, value interface{}) error {
+	message, err := m.Message(ctx, topic, v, value)
+	if err != nil {
+		return err
+	}
+
+	if m.Transactional {
+		producer, err := kafkaproducer.Transaction(ctx)
+		if err != nil {
+			return err
+		}
+		_, _, err = producer.SendMessage(message)
+		return err
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	switch {
+	case m.closed:
+		return errClosed
+	case m.asyncProducer != nil:
+		return m.asyncProducer.Send(ctx, message)
+	case m.producer != nil:
+		_, _, err = m.producer.SendMessage(message)
+		return err
+	default:
+		return errors.New("kafka middleware is not connected")
+	}
+}
+
+func (m *kafkaMiddleware) Invoke(ctx context.Context, input interface{}, f fn.Fn) (interface{}, error) {
+	if err := m.initialize(); err != nil {
+		return nil, err
 	}
 
 	output, err := f.Invoke(ctx, input)
 
 	if err != nil && m.ErrorTopic != "" {
-		if newErr := sendMessage(m.producer, m.ErrorTopic, err); newErr != nil {
+		v := map[string]interface{}{"input": input, "error": err.Error()}
+		if newErr := m.send(ctx, m.ErrorTopic, v, err.Error()); newErr != nil {
 			err = errors.Wrap(err, newErr.Error())
 		}
 	}
 
 	if err == nil && m.SuccessTopic != "" && output != nil {
-		err = sendMessage(m.producer, m.SuccessTopic, output)
+		v := map[string]interface{}{"input": input, "output": output}
+		err = m.send(ctx, m.SuccessTopic, v, output)
 	}
 
 	return output, err
 }
 
+// Describe describes the configuration of the kafka middleware.
+func (m *kafkaMiddleware) Describe() *config.Schema {
+	properties := map[string]*config.Schema{
+		"successTopic": {
+			Type:        "string",
+			Description: "The topic outputs are published to. Outputs are not published if it is empty.",
+		},
+		"errorTopic": {
+			Type:        "string",
+			Description: "The topic error messages are published to. Errors are not published if it is empty.",
+		},
+		"certFile": {
+			Type:        "string",
+			Description: "The path to the client certificate used for TLS. Prefer tls.certFile.",
+		},
+		"keyFile": {
+			Type:        "string",
+			Description: "The path to the client key used for TLS. Prefer tls.keyFile.",
+		},
+		"caFile": {
+			Type:        "string",
+			Description: "The path to the certificate authority used for TLS. TLS is enabled only if certFile, keyFile, and caFile are all set. Prefer tls.caFile.",
+		},
+		"verifySSL": {
+			Type:        "boolean",
+			Description: "Passed to the TLS configuration as InsecureSkipVerify. Prefer tls.insecureSkipVerify.",
+			Default:     false,
+		},
+		"async": {
+			Type:        "object",
+			Description: "Publishes messages without waiting for them to be acknowledged.",
+			Properties: map[string]*config.Schema{
+				"maxInFlight": {
+					Type:        "integer",
+					Description: "The maximum number of unacknowledged messages. Invocations wait when it is reached.",
+					Minimum:     config.Minimum(1),
+					Default:     defaultMaxInFlight,
+				},
+				"flushFrequency": {
+					Type:        "string",
+					Description: "How often buffered messages are sent, as a duration such as 100ms. Messages are sent as soon as possible if it is not set.",
+				},
+				"flushMessages": {
+					Type:        "integer",
+					Description: "The number of buffered messages that triggers a send.",
+					Minimum:     config.Minimum(0),
+				},
+			},
+			AdditionalProperties: config.NoAdditionalProperties(),
+		},
+		"transactional": {
+			Type: "boolean",
+			Description: "Whether messages are published in the transaction of a transactional kafka source, so that they are committed together with the offset of the consumed message. " +
+				"The success topic must be in the cluster of the source, and errorTopic, async, and the options of the producer such as brokers cannot be set.",
+			Default: false,
+		},
+	}
+	for key, schema := range m.Config.DescribeProperties() {
+		properties[key] = schema
+	}
+	for key, schema := range m.Record.DescribeProperties(`an object with the input under "input" and the output under "output" or the error message under "error"`) {
+		properties[key] = schema
+	}
+
+	return &config.Schema{
+		Description: "Publishes the output of each successful invocation to one topic and the message of each error to another.",
+		Type:        "object",
+		Properties:  properties,
+
+		AdditionalProperties: config.NoAdditionalProperties(),
+	}
+}
+
 func New() run.Middleware {
 	return &kafkaMiddleware{}
 }
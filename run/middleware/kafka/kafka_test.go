@@ -8,11 +8,13 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/Shopify/sarama/mocks"
 	"github.com/fnrun/fnrun/fn"
 	"github.com/fnrun/fnrun/run/config"
+	"github.com/fnrun/fnrun/run/kafkaproducer"
 )
 
 func stringIs(t *testing.T, got, want, message string) {
@@ -169,6 +171,240 @@ func TestInvoke_withError(t *testing.T) {
 	)
 }
 
+func TestInvoke_afterClose(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	m := &kafkaMiddleware{
+		producer:     producer,
+		SuccessTopic: "successTopic",
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close returned error: %+v", err)
+	}
+
+	f := fn.NewFnFromInvokeFunc(echoJsonInvokeFunc)
+	if _, err := m.Invoke(context.Background(), "some value", f); err != errClosed {
+		t.Errorf("unexpected error: want %v, got %+v", errClosed, err)
+	}
+	if m.producer != nil {
+		t.Error("expected Invoke not to reconnect the closed middleware")
+	}
+}
+
+func TestClose_waitsForSend(t *testing.T) {
+	sending := make(chan struct{})
+	release := make(chan struct{})
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithCheckerFunctionAndSucceed(func([]byte) error {
+		close(sending)
+		<-release
+		return nil
+	})
+
+	m := &kafkaMiddleware{
+		producer:     producer,
+		SuccessTopic: "successTopic",
+	}
+
+	invoked := make(chan error, 1)
+	go func() {
+		_, err := m.Invoke(context.Background(), "some value", fn.NewFnFromInvokeFunc(echoJsonInvokeFunc))
+		invoked <- err
+	}()
+	<-sending
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- m.Close()
+	}()
+
+	select {
+	case <-closed:
+		t.Fatal("expected Close to wait for the message being sent")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-invoked; err != nil {
+		t.Errorf("Invoke returned error: %+v", err)
+	}
+	if err := <-closed; err != nil {
+		t.Errorf("Close returned error: %+v", err)
+	}
+}
+
+func TestInvoke_record(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(message *sarama.ProducerMessage) error {
+		key, _ := message.Key.Encode()
+		value, _ := message.Value.Encode()
+		if string(key) != "order-1" {
+			return fmt.Errorf("unexpected key: %q", key)
+		}
+		if string(value) != `{"status":"shipped"}` {
+			return fmt.Errorf("unexpected value: %q", value)
+		}
+		if len(message.Headers) != 1 || string(message.Headers[0].Key) != "source" || string(message.Headers[0].Value) != "web" {
+			return fmt.Errorf("unexpected headers: %v", message.Headers)
+		}
+		return nil
+	})
+
+	m := New().(*kafkaMiddleware)
+	err := config.Configure(m, map[string]interface{}{
+		"brokers":      "127.0.0.1",
+		"successTopic": "successTopic",
+		"key":          ".input.id",
+		"headers":      map[string]interface{}{"source": ".input.source"},
+	})
+	if err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+	m.producer = producer
+
+	_, err = m.Invoke(
+		context.Background(),
+		map[string]interface{}{"id": "order-1", "source": "web"},
+		fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+			return map[string]interface{}{"status": "shipped"}, nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Invoke returned error: %+v", err)
+	}
+}
+
+func TestInvoke_async(t *testing.T) {
+	saramaConfig := mocks.NewTestConfig()
+	saramaConfig.Producer.Return.Successes = true
+	producer := mocks.NewAsyncProducer(t, saramaConfig)
+	producer.ExpectInputWithCheckerFunctionAndSucceed(makeChecker(t, "first"))
+	producer.ExpectInputAndFail(errors.New("broker unavailable"))
+	producer.ExpectInputWithCheckerFunctionAndSucceed(makeChecker(t, "third"))
+
+	m := kafkaMiddleware{
+		SuccessTopic:  "successTopic",
+		asyncProducer: newAsyncProducer(producer, 1),
+	}
+
+	for _, value := range []string{"first", "second", "third"} {
+		_, err := m.Invoke(context.Background(), value, fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+			return input, nil
+		}))
+		if err != nil {
+			t.Fatalf("Invoke returned error: %+v", err)
+		}
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close returned error: %+v", err)
+	}
+}
+
+func TestInvoke_asyncWaitsForRoomInFlight(t *testing.T) {
+	saramaConfig := mocks.NewTestConfig()
+	saramaConfig.Producer.Return.Successes = true
+	producer := mocks.NewAsyncProducer(t, saramaConfig)
+
+	p := newAsyncProducer(producer, 1)
+	p.inFlight <- struct{}{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := p.Send(ctx, &sarama.ProducerMessage{Topic: "successTopic"}); err != context.Canceled {
+		t.Errorf("expected Send to return %v, got %+v", context.Canceled, err)
+	}
+
+	<-p.inFlight
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close returned error: %+v", err)
+	}
+}
+
+func TestInvoke_transactional(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageAndSucceed()
+
+	m := New().(*kafkaMiddleware)
+	err := config.Configure(m, map[string]interface{}{
+		"successTopic":  "successTopic",
+		"transactional": true,
+	})
+	if err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+
+	f := fn.NewFnFromInvokeFunc(echoJsonInvokeFunc)
+	if _, err := m.Invoke(context.Background(), `{"value":"some value"}`, f); err != kafkaproducer.ErrNoTransaction {
+		t.Errorf("unexpected error: want %v, got %+v", kafkaproducer.ErrNoTransaction, err)
+	}
+
+	ctx := kafkaproducer.WithTransaction(context.Background(), producer)
+	if _, err := m.Invoke(ctx, `{"value":"some value"}`, f); err != nil {
+		t.Fatalf("Invoke returned error: %+v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		configMap map[string]interface{}
+		want      string
+	}{
+		{
+			configMap: map[string]interface{}{
+				"brokers":     "127.0.0.1",
+				"idempotent":  true,
+				"compression": "snappy",
+				"sasl":        map[string]interface{}{"mechanism": "SCRAM-SHA-256", "username": "user", "password": "secret"},
+				"async":       map[string]interface{}{"maxInFlight": 100, "flushFrequency": "100ms", "flushMessages": 50},
+			},
+		},
+		{
+			configMap: map[string]interface{}{
+				"brokers":  "127.0.0.1",
+				"certFile": "/path/to/cert/file",
+				"keyFile":  "/path/to/key/file",
+				"caFile":   "/path/to/ca/file",
+				"tls":      map[string]interface{}{},
+			},
+			want: "tls: certFile, keyFile, and caFile cannot be combined with tls",
+		},
+		{
+			configMap: map[string]interface{}{"brokers": "127.0.0.1", "value": ".output |"},
+			want:      "value: unexpected EOF",
+		},
+		{
+			configMap: map[string]interface{}{"transactional": true, "async": map[string]interface{}{}},
+			want:      "async: async cannot be combined with transactional",
+		},
+		{
+			configMap: map[string]interface{}{"transactional": true, "successTopic": "successTopic", "errorTopic": "errorTopic"},
+			want:      "errorTopic: errorTopic cannot be combined with transactional",
+		},
+		{
+			configMap: map[string]interface{}{"transactional": true, "brokers": "127.0.0.1"},
+			want:      "brokers: brokers cannot be combined with transactional",
+		},
+		{
+			configMap: map[string]interface{}{"transactional": true, "compression": "gzip"},
+			want:      "compression: compression cannot be combined with transactional",
+		},
+	}
+
+	for _, test := range tests {
+		err := config.Configure(New(), test.configMap)
+
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if !strings.HasPrefix(got, test.want) || (test.want == "") != (got == "") {
+			t.Errorf("unexpected error for %v: want %q, got %q", test.configMap, test.want, got)
+		}
+	}
+}
+
 // -----------------------------------------------------------------------------
 // Mock SyncProducer that fails on send
 
@@ -13,6 +13,7 @@ import (
 
 	"github.com/fnrun/fnrun/fn"
 	"github.com/fnrun/fnrun/run"
+	"github.com/fnrun/fnrun/run/config"
 )
 
 type keyMiddleware struct {
@@ -34,6 +35,15 @@ func (k *keyMiddleware) Invoke(ctx context.Context, input interface{}, f fn.Fn)
 	return f.Invoke(ctx, m[k.Key])
 }
 
+// Describe describes the configuration of the key middleware.
+func (*keyMiddleware) Describe() *config.Schema {
+	return &config.Schema{
+		Description: "Invokes the fn with the value of a single key of each input, which must be a map.",
+		Type:        "string",
+		Default:     "",
+	}
+}
+
 // New returns a key middleware configured with the key as an empty string.
 func New() run.Middleware {
 	return &keyMiddleware{}
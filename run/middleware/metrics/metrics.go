@@ -0,0 +1,360 @@
+// Package metrics provides a middleware that records Prometheus metrics about
+// the invocations of the fn it wraps. The following metrics are recorded:
+//
+// - fnrun_invocations_total: the number of invocations
+// - fnrun_invocation_errors_total: the number of invocations that returned an
+// error
+// - fnrun_invocations_in_flight: the number of invocations in progress
+// - fnrun_invocation_duration_seconds: a histogram of invocation latency
+//
+// Every metric has a `name` label, which defaults to "default" and may be set
+// with a string configuration or the `name` key of a map configuration. A map
+// configuration may also contain `labels`, a map from label names to jq
+// programs that extract label values from each input, and `buckets`, the upper
+// bounds of the latency histogram in seconds. A label whose program fails or
+// produces no value is empty.
+//
+// Metrics are collected by the shared registry in the run/metrics package,
+// which the admin server serves on its /metrics route, from the time an
+// instance is started until it is closed. Instances with the same name and
+// label names record the same series, so they must also use the same buckets.
+// Instances that differ in name or label names are independent.
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fnrun/fnrun/fn"
+	"github.com/fnrun/fnrun/run"
+	"github.com/fnrun/fnrun/run/config"
+	runmetrics "github.com/fnrun/fnrun/run/metrics"
+	"github.com/itchyny/gojq"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultName is the value of the name label when no name is configured.
+const DefaultName = "default"
+
+type label struct {
+	name string
+	code *gojq.Code
+}
+
+// family holds the metrics recorded by the started instances that share a name
+// and label names.
+type family struct {
+	key     string
+	buckets []float64
+	refs    int
+
+	invocations *prometheus.CounterVec
+	errors      *prometheus.CounterVec
+	inFlight    *prometheus.GaugeVec
+	duration    *prometheus.HistogramVec
+}
+
+func newFamily(key, name string, labelNames []string, buckets []float64) *family {
+	constLabels := prometheus.Labels{"name": name}
+	return &family{
+		key:     key,
+		buckets: buckets,
+		invocations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   runmetrics.Namespace,
+			Name:        "invocations_total",
+			Help:        "The number of fn invocations.",
+			ConstLabels: constLabels,
+		}, labelNames),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   runmetrics.Namespace,
+			Name:        "invocation_errors_total",
+			Help:        "The number of fn invocations that returned an error.",
+			ConstLabels: constLabels,
+		}, labelNames),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   runmetrics.Namespace,
+			Name:        "invocations_in_flight",
+			Help:        "The number of fn invocations in progress.",
+			ConstLabels: constLabels,
+		}, labelNames),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   runmetrics.Namespace,
+			Name:        "invocation_duration_seconds",
+			Help:        "The latency of fn invocations in seconds.",
+			ConstLabels: constLabels,
+			Buckets:     buckets,
+		}, labelNames),
+	}
+}
+
+func (f *family) Describe(ch chan<- *prometheus.Desc) {
+	f.invocations.Describe(ch)
+	f.errors.Describe(ch)
+	f.inFlight.Describe(ch)
+	f.duration.Describe(ch)
+}
+
+func (f *family) Collect(ch chan<- prometheus.Metric) {
+	f.invocations.Collect(ch)
+	f.errors.Collect(ch)
+	f.inFlight.Collect(ch)
+	f.duration.Collect(ch)
+}
+
+// families is a collector of the families of the started instances. It is
+// registered once and is unchecked, because the label names and buckets of its
+// metrics change as instances are started and closed, which the registry does
+// not allow for the collectors registered with it.
+type families struct {
+	mutex sync.Mutex
+	byKey map[string]*family
+}
+
+var started = runmetrics.MustRegister(&families{byKey: map[string]*family{}})
+
+// acquire returns the family of the instance with name and labelNames,
+// creating it if no started instance shares it.
+func (fs *families) acquire(name string, labelNames []string, buckets []float64) (*family, error) {
+	key := name + "\x00" + strings.Join(labelNames, "\x00")
+
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	f, ok := fs.byKey[key]
+	if !ok {
+		f = newFamily(key, name, labelNames, buckets)
+		fs.byKey[key] = f
+	} else if !slices.Equal(f.buckets, buckets) {
+		return nil, fmt.Errorf("buckets %v differ from the buckets %v of a started instance with name %q and the same labels", buckets, f.buckets, name)
+	}
+	f.refs++
+	return f, nil
+}
+
+// release removes f from the collector once no started instance uses it.
+func (fs *families) release(f *family) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	f.refs--
+	if f.refs == 0 {
+		delete(fs.byKey, f.key)
+	}
+}
+
+func (*families) Describe(chan<- *prometheus.Desc) {}
+
+func (fs *families) Collect(ch chan<- prometheus.Metric) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	for _, f := range fs.byKey {
+		f.Collect(ch)
+	}
+}
+
+type metricsMiddleware struct {
+	name    string
+	labels  []label
+	buckets []float64
+
+	family atomic.Pointer[family]
+}
+
+type metricsMiddlewareConfig struct {
+	Name    string            `mapstructure:"name"`
+	Labels  map[string]string `mapstructure:"labels"`
+	Buckets []float64         `mapstructure:"buckets"`
+}
+
+func (m *metricsMiddleware) Configure() error {
+	return m.configure(metricsMiddlewareConfig{})
+}
+
+func (m *metricsMiddleware) ConfigureString(name string) error {
+	return m.configure(metricsMiddlewareConfig{Name: name})
+}
+
+func (m *metricsMiddleware) ConfigureMap(configMap map[string]interface{}) error {
+	var cfg metricsMiddlewareConfig
+	if err := config.Decode(configMap, &cfg); err != nil {
+		return err
+	}
+	return m.configure(cfg)
+}
+
+func (m *metricsMiddleware) configure(cfg metricsMiddlewareConfig) error {
+	m.name = cfg.Name
+	if m.name == "" {
+		m.name = DefaultName
+	}
+
+	names := make([]string, 0, len(cfg.Labels))
+	for name := range cfg.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	m.labels = make([]label, len(names))
+	for i, name := range names {
+		code, err := compile(cfg.Labels[name])
+		errs = append(errs, config.WithPath("labels."+name, err))
+		m.labels[i] = label{name: name, code: code}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	m.buckets = cfg.Buckets
+	if len(m.buckets) == 0 {
+		m.buckets = prometheus.DefBuckets
+	}
+	for i := 1; i < len(m.buckets); i++ {
+		if m.buckets[i] <= m.buckets[i-1] {
+			return config.WithPath("buckets", errors.New("buckets must be in increasing order"))
+		}
+	}
+
+	// Registering the metrics with a registry of their own reports invalid
+	// label names, such as "name", before the middleware is started.
+	err := prometheus.NewRegistry().Register(newFamily("", m.name, names, m.buckets))
+	return config.WithPath("labels", err)
+}
+
+// Start adds the metrics of the middleware to the shared registry.
+func (m *metricsMiddleware) Start(context.Context) error {
+	labelNames := make([]string, len(m.labels))
+	for i, l := range m.labels {
+		labelNames[i] = l.name
+	}
+
+	f, err := started.acquire(m.name, labelNames, m.buckets)
+	if err != nil {
+		return config.WithPath("buckets", err)
+	}
+	if previous := m.family.Swap(f); previous != nil {
+		started.release(previous)
+	}
+	return nil
+}
+
+// Close removes the metrics of the middleware from the shared registry unless
+// another started instance records them.
+func (m *metricsMiddleware) Close() error {
+	if f := m.family.Swap(nil); f != nil {
+		started.release(f)
+	}
+	return nil
+}
+
+func compile(pattern string) (*gojq.Code, error) {
+	query, err := gojq.Parse(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return gojq.Compile(query)
+}
+
+// labelValues returns the values of the labels of the metrics recorded for
+// input.
+func (m *metricsMiddleware) labelValues(ctx context.Context, input interface{}) []string {
+	values := make([]string, len(m.labels))
+	for i, l := range m.labels {
+		values[i] = labelValue(ctx, l.code, input)
+	}
+	return values
+}
+
+func labelValue(ctx context.Context, code *gojq.Code, input interface{}) string {
+	v, ok := code.RunWithContext(ctx, input).Next()
+	if !ok {
+		return ""
+	}
+
+	switch v := v.(type) {
+	case nil, error:
+		return ""
+	case string:
+		return v
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		return string(b)
+	}
+}
+
+// Invoke records metrics about the invocation of f. Nothing is recorded when
+// the middleware is not started.
+func (m *metricsMiddleware) Invoke(ctx context.Context, input interface{}, f fn.Fn) (interface{}, error) {
+	family := m.family.Load()
+	if family == nil {
+		return f.Invoke(ctx, input)
+	}
+	labels := m.labelValues(ctx, input)
+
+	inFlight := family.inFlight.WithLabelValues(labels...)
+	inFlight.Inc()
+	defer inFlight.Dec()
+
+	start := time.Now()
+	output, err := f.Invoke(ctx, input)
+
+	family.duration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+	family.invocations.WithLabelValues(labels...).Inc()
+	if err != nil {
+		family.errors.WithLabelValues(labels...).Inc()
+	}
+
+	return output, err
+}
+
+// Describe describes the configuration of the metrics middleware.
+func (*metricsMiddleware) Describe() *config.Schema {
+	name := &config.Schema{
+		Type:        "string",
+		Description: "The value of the name label of every metric.",
+		Default:     DefaultName,
+	}
+
+	return &config.Schema{
+		Description: "Records Prometheus metrics about the invocations of the wrapped fn. A string configures the name label.",
+		OneOf: []*config.Schema{
+			name,
+			{
+				Type: "object",
+				Properties: map[string]*config.Schema{
+					"name": name,
+					"labels": {
+						Type:                 "object",
+						Description:          "A map from label names to jq programs that extract label values from each input.",
+						AdditionalProperties: &config.Schema{Type: "string"},
+						Examples:             []interface{}{map[string]interface{}{"topic": ".topic"}},
+					},
+					"buckets": {
+						Type:        "array",
+						Description: "The upper bounds of the latency histogram buckets in seconds.",
+						Items:       &config.Schema{Type: "number"},
+					},
+				},
+				AdditionalProperties: config.NoAdditionalProperties(),
+			},
+		},
+	}
+}
+
+// New returns a middleware that records metrics about each invocation.
+func New() run.Middleware {
+	return &metricsMiddleware{}
+}
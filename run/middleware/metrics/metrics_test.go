@@ -0,0 +1,252 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/fnrun/fnrun/fn"
+	"github.com/fnrun/fnrun/run/config"
+	"github.com/fnrun/fnrun/run/fn/identity"
+	runmetrics "github.com/fnrun/fnrun/run/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// newMiddleware returns a started middleware with the given name and a topic
+// label unless configMap is given. The middleware is closed when the test ends.
+func newMiddleware(t *testing.T, name string, configMap ...map[string]interface{}) *metricsMiddleware {
+	t.Helper()
+
+	cfg := map[string]interface{}{
+		"name":   name,
+		"labels": map[string]interface{}{"topic": ".topic"},
+	}
+	if len(configMap) > 0 {
+		cfg = configMap[0]
+	}
+
+	m := New().(*metricsMiddleware)
+	if err := config.Configure(m, cfg); err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatalf("Start returned error: %+v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+// gather returns the number of series of the invocations_total metric with
+// the given name label, failing the test if the shared registry cannot be
+// gathered.
+func gather(t *testing.T, name string) int {
+	t.Helper()
+
+	families, err := runmetrics.Registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather returned error: %+v", err)
+	}
+
+	var n int
+	for _, family := range families {
+		if family.GetName() != "fnrun_invocations_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "name" && label.GetValue() == name {
+					n++
+				}
+			}
+		}
+	}
+	return n
+}
+
+type failingFn struct{}
+
+func (failingFn) Invoke(context.Context, interface{}) (interface{}, error) {
+	return nil, errors.New("failed")
+}
+
+func TestInvoke(t *testing.T) {
+	m := newMiddleware(t, "TestInvoke")
+	ctx := context.Background()
+
+	for _, f := range []fn.Fn{identity.New(), identity.New(), failingFn{}} {
+		m.Invoke(ctx, map[string]interface{}{"topic": "orders"}, f)
+	}
+	m.Invoke(ctx, map[string]interface{}{}, identity.New())
+
+	tests := []struct {
+		topic       string
+		invocations float64
+		errors      float64
+	}{
+		{topic: "orders", invocations: 3, errors: 1},
+		{topic: "", invocations: 1, errors: 0},
+	}
+	family := m.family.Load()
+	for _, tt := range tests {
+		if got := testutil.ToFloat64(family.invocations.WithLabelValues(tt.topic)); got != tt.invocations {
+			t.Errorf("unexpected invocations for topic %q: want %v, got %v", tt.topic, tt.invocations, got)
+		}
+		if got := testutil.ToFloat64(family.errors.WithLabelValues(tt.topic)); got != tt.errors {
+			t.Errorf("unexpected errors for topic %q: want %v, got %v", tt.topic, tt.errors, got)
+		}
+		if got := testutil.ToFloat64(family.inFlight.WithLabelValues(tt.topic)); got != 0 {
+			t.Errorf("unexpected in-flight invocations for topic %q: want 0, got %v", tt.topic, got)
+		}
+	}
+}
+
+func TestInvoke_sharesMetricsAcrossInstances(t *testing.T) {
+	ctx := context.Background()
+	input := map[string]interface{}{"topic": "orders"}
+
+	first := newMiddleware(t, "TestInvoke_sharesMetricsAcrossInstances")
+	first.Invoke(ctx, input, identity.New())
+
+	second := newMiddleware(t, "TestInvoke_sharesMetricsAcrossInstances")
+	second.Invoke(ctx, input, identity.New())
+
+	got := testutil.ToFloat64(second.family.Load().invocations.WithLabelValues("orders"))
+	if got != 2 {
+		t.Errorf("unexpected invocations: want 2, got %v", got)
+	}
+}
+
+func TestInvoke_notStarted(t *testing.T) {
+	m := New().(*metricsMiddleware)
+	if err := config.Configure(m, "TestInvoke_notStarted"); err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+
+	output, err := m.Invoke(context.Background(), "input", identity.New())
+	if err != nil || output != "input" {
+		t.Errorf("unexpected result: want input and no error, got %v and %+v", output, err)
+	}
+}
+
+func TestStart_differentLabelNames(t *testing.T) {
+	ctx := context.Background()
+	input := map[string]interface{}{"topic": "orders", "partition": 3}
+
+	newMiddleware(t, "TestStart_differentLabelNames").Invoke(ctx, input, identity.New())
+	newMiddleware(t, "TestStart_differentLabelNames", map[string]interface{}{
+		"name":    "TestStart_differentLabelNames",
+		"labels":  map[string]interface{}{"partition": ".partition"},
+		"buckets": []interface{}{0.1, 1},
+	}).Invoke(ctx, input, identity.New())
+
+	if got := gather(t, "TestStart_differentLabelNames"); got != 2 {
+		t.Errorf("unexpected number of series: want 2, got %d", got)
+	}
+}
+
+func TestStart_conflictingBuckets(t *testing.T) {
+	newMiddleware(t, "TestStart_conflictingBuckets")
+
+	m := New()
+	err := config.Configure(m, map[string]interface{}{
+		"name":    "TestStart_conflictingBuckets",
+		"labels":  map[string]interface{}{"topic": ".topic"},
+		"buckets": []interface{}{0.1, 1},
+	})
+	if err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+
+	err = m.(*metricsMiddleware).Start(context.Background())
+	var pathErr *config.PathError
+	if !errors.As(err, &pathErr) || pathErr.Path != "buckets" {
+		t.Errorf("expected an error at buckets but got %+v", err)
+	}
+}
+
+func TestClose_removesMetrics(t *testing.T) {
+	m := newMiddleware(t, "TestClose_removesMetrics")
+	m.Invoke(context.Background(), map[string]interface{}{"topic": "orders"}, identity.New())
+	if got := gather(t, "TestClose_removesMetrics"); got != 1 {
+		t.Fatalf("unexpected number of series: want 1, got %d", got)
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close returned error: %+v", err)
+	}
+	if got := gather(t, "TestClose_removesMetrics"); got != 0 {
+		t.Errorf("unexpected number of series after Close: want 0, got %d", got)
+	}
+
+	// A replacement may now use different buckets.
+	newMiddleware(t, "TestClose_removesMetrics", map[string]interface{}{
+		"name":    "TestClose_removesMetrics",
+		"labels":  map[string]interface{}{"topic": ".topic"},
+		"buckets": []interface{}{0.1, 1},
+	})
+}
+
+func TestLabelValue(t *testing.T) {
+	tests := []struct {
+		program string
+		want    string
+	}{
+		{program: ".topic", want: "orders"},
+		{program: ".partition", want: "3"},
+		{program: ".missing", want: ""},
+		{program: ".topic.name", want: ""},
+		{program: "empty", want: ""},
+		{program: ".tags", want: `["a","b"]`},
+	}
+
+	input := map[string]interface{}{
+		"topic":     "orders",
+		"partition": 3,
+		"tags":      []interface{}{"a", "b"},
+	}
+	for _, tt := range tests {
+		code, err := compile(tt.program)
+		if err != nil {
+			t.Fatalf("compile(%q) returned error: %+v", tt.program, err)
+		}
+		if got := labelValue(context.Background(), code, input); got != tt.want {
+			t.Errorf("unexpected label value for %q: want %q, got %q", tt.program, tt.want, got)
+		}
+	}
+}
+
+func TestConfigureMap_invalidLabelProgram(t *testing.T) {
+	err := config.Configure(New(), map[string]interface{}{
+		"labels": map[string]interface{}{"topic": ".topic |"},
+	})
+	if err == nil {
+		t.Fatal("expected config.Configure to return an error but it did not")
+	}
+
+	var pathErr *config.PathError
+	if !errors.As(err, &pathErr) || pathErr.Path != "labels.topic" {
+		t.Errorf("expected an error at labels.topic but got %+v", err)
+	}
+}
+
+func TestConfigureMap_invalidLabelName(t *testing.T) {
+	err := config.Configure(New(), map[string]interface{}{
+		"labels": map[string]interface{}{"name": ".name"},
+	})
+
+	var pathErr *config.PathError
+	if !errors.As(err, &pathErr) || pathErr.Path != "labels" {
+		t.Errorf("expected an error at labels but got %+v", err)
+	}
+}
+
+func TestConfigureMap_unorderedBuckets(t *testing.T) {
+	err := config.Configure(New(), map[string]interface{}{
+		"buckets": []interface{}{1, 0.1},
+	})
+
+	var pathErr *config.PathError
+	if !errors.As(err, &pathErr) || pathErr.Path != "buckets" {
+		t.Errorf("expected an error at buckets but got %+v", err)
+	}
+}
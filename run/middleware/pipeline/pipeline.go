@@ -7,6 +7,8 @@
 //
 //  If no middleware are defined, the pipeline simply invokes the Fn and returns
 // its output.
+//
+// Each middleware is invoked in a tracing span named by its registry key.
 package pipeline
 
 import (
@@ -18,6 +20,8 @@ import (
 	"github.com/fnrun/fnrun/run"
 	"github.com/fnrun/fnrun/run/config"
 	"github.com/fnrun/fnrun/run/fn/middleware"
+	"github.com/fnrun/fnrun/run/schema"
+	"github.com/fnrun/fnrun/run/tracing"
 )
 
 var errSingleKey = errors.New("middleware config should be object with single key")
@@ -48,60 +52,109 @@ func compose(middlewares ...run.Middleware) run.Middleware {
 }
 
 type pipelineMiddleware struct {
-	middleware run.Middleware
-	registry   run.Registry
+	middleware  run.Middleware
+	middlewares []run.Middleware
+	registry    run.Registry
 }
 
 func (p *pipelineMiddleware) Invoke(ctx context.Context, input interface{}, f fn.Fn) (interface{}, error) {
 	return p.middleware.Invoke(ctx, input, f)
 }
 
+func (p *pipelineMiddleware) newMiddleware(key string, cfg interface{}) (run.Middleware, error) {
+	factory, exists := p.registry.FindMiddleware(key)
+	if !exists {
+		return nil, fmt.Errorf("no middleware registered with key %s", key)
+	}
+	middleware := factory()
+	if err := config.Configure(middleware, cfg); err != nil {
+		return nil, config.WithPath(key, err)
+	}
+	return middleware, nil
+}
+
+// ConfigureArray creates and configures each middleware in cfg. Every
+// middleware is configured even if an earlier one fails so that all errors are
+// reported, each annotated with the index of its middleware.
 func (p *pipelineMiddleware) ConfigureArray(cfg []interface{}) error {
 	middlewares := make([]run.Middleware, 0)
+	traced := make([]run.Middleware, 0)
+	var errs []error
+
+	for i, middlewareConfig := range cfg {
+		var middleware run.Middleware
+		var key string
+		var err error
 
-	for _, middlewareConfig := range cfg {
 		switch middlewareConfig := middlewareConfig.(type) {
 		case string:
-			factory, exists := p.registry.FindMiddleware(middlewareConfig)
-			if !exists {
-				return fmt.Errorf("no middleware registered with key %s", middlewareConfig)
-			}
-			middleware := factory()
-			err := config.Configure(middleware, nil)
-			if err != nil {
-				return err
-			}
-			middlewares = append(middlewares, middleware)
+			key = middlewareConfig
+			middleware, err = p.newMiddleware(key, nil)
 
 		case map[string]interface{}:
 			mapConfig := middlewareConfig
 			if len(mapConfig) != 1 {
-				return errSingleKey
+				err = errSingleKey
+				break
 			}
-			key := ""
 			for k := range mapConfig {
 				key = k
 			}
-			factory, exists := p.registry.FindMiddleware(key)
-			if !exists {
-				return fmt.Errorf("no middleware registered with key %s", key)
-			}
-			middleware := factory()
-			err := config.Configure(middleware, mapConfig[key])
-			if err != nil {
-				return err
-			}
-			middlewares = append(middlewares, middleware)
+			middleware, err = p.newMiddleware(key, mapConfig[key])
 
 		default:
-			return fmt.Errorf("wrong middleware configuration type: %T, expected string or object", middlewareConfig)
+			err = fmt.Errorf("wrong middleware configuration type: %T, expected string or object", middlewareConfig)
 		}
+
+		if err != nil {
+			errs = append(errs, config.WithPath(config.Index(i), err))
+			continue
+		}
+		middlewares = append(middlewares, middleware)
+		traced = append(traced, tracing.Middleware(key, middleware))
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
 	}
 
-	p.middleware = compose(middlewares...)
+	p.middleware = compose(traced...)
+	p.middlewares = middlewares
 	return nil
 }
 
+// Start starts each middleware in order. If one fails to start, the middleware
+// started before it are closed.
+func (p *pipelineMiddleware) Start(ctx context.Context) error {
+	for i, m := range p.middlewares {
+		if err := run.Start(ctx, m); err != nil {
+			return errors.Join(err, closeAll(p.middlewares[:i]))
+		}
+	}
+	return nil
+}
+
+func (p *pipelineMiddleware) Close() error {
+	return closeAll(p.middlewares)
+}
+
+func closeAll(middlewares []run.Middleware) error {
+	values := make([]interface{}, len(middlewares))
+	for i, m := range middlewares {
+		values[i] = m
+	}
+	return run.CloseAll(values...)
+}
+
+// Describe describes the configuration of the pipeline.
+func (pm *pipelineMiddleware) Describe() *config.Schema {
+	return &config.Schema{
+		Description: "The middleware applied to each input and output, in order.",
+		Type:        "array",
+		Items:       schema.Components(pm.registry.MiddlewareKeys()),
+	}
+}
+
 // NewWithRegistry creates a pipeline middleware with registry. The middleware
 // has no behavior unless configured.
 func NewWithRegistry(registry run.Registry) run.Middleware {
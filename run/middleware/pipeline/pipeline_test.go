@@ -2,6 +2,7 @@ package pipeline
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
@@ -21,6 +22,27 @@ func newRegistry() run.Registry {
 	return r
 }
 
+func TestStart_closesStartedMiddlewareOnFailure(t *testing.T) {
+	var events []string
+	r := run.NewRegistry()
+	r.RegisterMiddleware("lifecycle", func() run.Middleware { return &lifecycleMiddleware{events: &events} })
+	r.RegisterMiddleware("failing", func() run.Middleware { return &lifecycleMiddleware{events: &events, fail: true} })
+
+	m := NewWithRegistry(r)
+	if err := config.Configure(m, []interface{}{"lifecycle", "lifecycle", "failing", "lifecycle"}); err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+
+	if err := run.Start(context.Background(), m); !errors.Is(err, errStartFailed) {
+		t.Fatalf("expected error %+v but got %+v", errStartFailed, err)
+	}
+
+	want := []string{"started", "started", "failed to start", "closed", "closed"}
+	if fmt.Sprint(events) != fmt.Sprint(want) {
+		t.Errorf("unexpected lifecycle events: want %v, got %v", want, events)
+	}
+}
+
 func TestInvoke_unconfigured(t *testing.T) {
 	r := run.NewRegistry()
 	m := NewWithRegistry(r)
@@ -111,7 +133,7 @@ func TestConfigureArray_mapWithMultiKeysAsSingleMiddlewareConfig(t *testing.T) {
 
 	want := errSingleKey
 
-	if got != want {
+	if !errors.Is(got, want) {
 		t.Errorf("want %+v; got %+v", want, got)
 	}
 }
@@ -131,7 +153,7 @@ func TestConfigureArray_mapWithMissingMiddleware(t *testing.T) {
 	}
 
 	got := err.Error()
-	want := "no middleware registered with key unknown"
+	want := "[0]: no middleware registered with key unknown"
 
 	if got != want {
 		t.Errorf("error message: want %q, got %q", want, got)
@@ -166,7 +188,7 @@ func TestConfigureArray_invalidMiddlewareType(t *testing.T) {
 	}
 
 	got := err.Error()
-	want := "wrong middleware configuration type: int, expected string or object"
+	want := "[0]: wrong middleware configuration type: int, expected string or object"
 	if got != want {
 		t.Errorf("error message: want %q; got %q", want, got)
 	}
@@ -296,3 +318,25 @@ func (m *mapConfigMiddleware) Invoke(context.Context, interface{}, fn.Fn) (inter
 func NewMapConfigMiddleware() run.Middleware {
 	return &mapConfigMiddleware{}
 }
+
+var errStartFailed = errors.New("start failed")
+
+type lifecycleMiddleware struct {
+	*upperMiddleware
+	events *[]string
+	fail   bool
+}
+
+func (l *lifecycleMiddleware) Start(context.Context) error {
+	if l.fail {
+		*l.events = append(*l.events, "failed to start")
+		return errStartFailed
+	}
+	*l.events = append(*l.events, "started")
+	return nil
+}
+
+func (l *lifecycleMiddleware) Close() error {
+	*l.events = append(*l.events, "closed")
+	return nil
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/fnrun/fnrun/fn"
 	"github.com/fnrun/fnrun/run"
+	"github.com/fnrun/fnrun/run/config"
 	"github.com/mitchellh/mapstructure"
 	"golang.org/x/time/rate"
 )
@@ -25,16 +26,7 @@ type rlmiddleware struct {
 }
 
 func (rl *rlmiddleware) ConfigureMap(configMap map[string]interface{}) error {
-	decoderConfig := &mapstructure.DecoderConfig{
-		Metadata: nil,
-		Result:   rl,
-		DecodeHook: mapstructure.ComposeDecodeHookFunc(
-			mapstructure.StringToTimeDurationHookFunc(),
-		),
-	}
-	decoder, _ := mapstructure.NewDecoder(decoderConfig)
-
-	return decoder.Decode(configMap)
+	return config.Decode(configMap, rl, mapstructure.StringToTimeDurationHookFunc())
 }
 
 func (rl *rlmiddleware) Invoke(ctx context.Context, input interface{}, f fn.Fn) (interface{}, error) {
@@ -49,6 +41,28 @@ func (rl *rlmiddleware) Invoke(ctx context.Context, input interface{}, f fn.Fn)
 	return f.Invoke(ctx, input)
 }
 
+// Describe describes the configuration of the rate limiter middleware.
+func (*rlmiddleware) Describe() *config.Schema {
+	return &config.Schema{
+		Description: "Limits how often the fn is invoked to one invocation per interval, allowing bursts.",
+		Type:        "object",
+		Properties: map[string]*config.Schema{
+			"burst": {
+				Type:        "integer",
+				Description: "The maximum number of invocations allowed at once.",
+				Default:     1,
+				Minimum:     config.Minimum(0),
+			},
+			"every": {
+				Type:        "string",
+				Description: "The interval between invocations, as a Go duration string.",
+				Default:     "1s",
+			},
+		},
+		AdditionalProperties: config.NoAdditionalProperties(),
+	}
+}
+
 // New returns a ratelimiter middleware configured to allow one token to be
 // generated every second with a burst of one.
 func New() run.Middleware {
@@ -0,0 +1,292 @@
+// Package retry provides a middleware that retries failed invocations with
+// exponential backoff.
+//
+// The middleware is configured with a map. After each failed attempt, it waits
+// for a backoff that starts at `initialBackoff` and is multiplied by
+// `multiplier` after every attempt, up to `maxBackoff`. Each backoff is reduced
+// by a random fraction of up to `jitter` so that inputs that fail together do
+// not retry together. The middleware makes at most `maxAttempts` attempts, and
+// if `deadline` is set, every attempt and backoff must complete within it.
+// Backoffs end early if the context is cancelled.
+//
+// By default every error is retried. If `retryableErrors` or
+// `retryableMessages` is set, only errors that match one of them are retried.
+// `retryableErrors` contains names from RetryableErrors, and
+// `retryableMessages` contains regular expressions that are matched against
+// error messages.
+//
+// Fns opt in to the named kinds through methods on their errors, so that the
+// middleware does not depend on them. An error, or an error it wraps, is
+// unavailable if it has an `Unavailable() bool` method that returns true, as
+// the availability timeout of the pool fn does, and is an HTTP 5xx error if it
+// has an `HTTPStatus() int` method that returns a 5xx status, as the status
+// errors of the http fn do.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/fnrun/fnrun/fn"
+	"github.com/fnrun/fnrun/run"
+	"github.com/fnrun/fnrun/run/config"
+	"github.com/mitchellh/mapstructure"
+)
+
+// unavailableError is implemented by errors of fns that could not handle an
+// input because they had no capacity for it.
+type unavailableError interface {
+	Unavailable() bool
+}
+
+// httpStatusError is implemented by errors that carry the status code of an
+// HTTP response.
+type httpStatusError interface {
+	HTTPStatus() int
+}
+
+func isUnavailable(err error) bool {
+	var unavailableErr unavailableError
+	return errors.As(err, &unavailableErr) && unavailableErr.Unavailable()
+}
+
+// RetryableErrors maps the names that may be used in `retryableErrors` to
+// functions that report whether an error is of that kind.
+// "pool.ErrAvailabilityTimeout" is kept as another name for "unavailable".
+var RetryableErrors = map[string]func(error) bool{
+	"context.DeadlineExceeded": func(err error) bool {
+		return errors.Is(err, context.DeadlineExceeded)
+	},
+	"unavailable":                 isUnavailable,
+	"pool.ErrAvailabilityTimeout": isUnavailable,
+	"http.5xx": func(err error) bool {
+		var statusErr httpStatusError
+		return errors.As(err, &statusErr) && statusErr.HTTPStatus() >= 500 && statusErr.HTTPStatus() < 600
+	},
+}
+
+// Error is the error returned when an input fails after more than one attempt.
+// It wraps the error of the last attempt.
+type Error struct {
+	Attempts int
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+type retryMiddleware struct {
+	MaxAttempts       int           `mapstructure:"maxAttempts"`
+	InitialBackoff    time.Duration `mapstructure:"initialBackoff"`
+	MaxBackoff        time.Duration `mapstructure:"maxBackoff"`
+	Multiplier        float64       `mapstructure:"multiplier"`
+	Jitter            float64       `mapstructure:"jitter"`
+	Deadline          time.Duration `mapstructure:"deadline"`
+	RetryableErrors   []string      `mapstructure:"retryableErrors"`
+	RetryableMessages []string      `mapstructure:"retryableMessages"`
+
+	matchers []func(error) bool
+}
+
+func (r *retryMiddleware) ConfigureMap(configMap map[string]interface{}) error {
+	return config.Decode(configMap, r, mapstructure.StringToTimeDurationHookFunc())
+}
+
+// Validate checks the backoff settings and compiles the retryable errors.
+func (r *retryMiddleware) Validate() error {
+	var errs []error
+	if r.MaxAttempts < 1 {
+		errs = append(errs, config.WithPath("maxAttempts", errors.New("maxAttempts must be at least 1")))
+	}
+	if r.MaxBackoff < r.InitialBackoff {
+		errs = append(errs, config.WithPath("maxBackoff", errors.New("maxBackoff must not be less than initialBackoff")))
+	}
+	if r.Multiplier < 1 {
+		errs = append(errs, config.WithPath("multiplier", errors.New("multiplier must be at least 1")))
+	}
+	if r.Jitter < 0 || r.Jitter > 1 {
+		errs = append(errs, config.WithPath("jitter", errors.New("jitter must be between 0 and 1")))
+	}
+	if r.Deadline < 0 {
+		errs = append(errs, config.WithPath("deadline", errors.New("deadline must not be negative")))
+	}
+
+	r.matchers = nil
+	for i, name := range r.RetryableErrors {
+		matcher, exists := RetryableErrors[name]
+		if !exists {
+			err := fmt.Errorf("unknown error %q; expected one of %v", name, retryableErrorNames())
+			errs = append(errs, config.WithPath("retryableErrors"+config.Index(i), err))
+			continue
+		}
+		r.matchers = append(r.matchers, matcher)
+	}
+	for i, pattern := range r.RetryableMessages {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			errs = append(errs, config.WithPath("retryableMessages"+config.Index(i), err))
+			continue
+		}
+		r.matchers = append(r.matchers, func(err error) bool {
+			return re.MatchString(err.Error())
+		})
+	}
+
+	return errors.Join(errs...)
+}
+
+func retryableErrorNames() []string {
+	names := make([]string, 0, len(RetryableErrors))
+	for name := range RetryableErrors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *retryMiddleware) retryable(err error) bool {
+	if len(r.matchers) == 0 {
+		return true
+	}
+	for _, matches := range r.matchers {
+		if matches(err) {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the time to wait after the given attempt, starting at 1.
+func (r *retryMiddleware) backoff(attempt int) time.Duration {
+	d := float64(r.InitialBackoff)
+	for i := 1; i < attempt && d < float64(r.MaxBackoff); i++ {
+		d *= r.Multiplier
+	}
+	d = min(d, float64(r.MaxBackoff))
+	return time.Duration(d * (1 - r.Jitter*rand.Float64()))
+}
+
+// sleep waits for d and reports whether it did so before ctx was done.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (r *retryMiddleware) Invoke(ctx context.Context, input interface{}, f fn.Fn) (interface{}, error) {
+	if r.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Deadline)
+		defer cancel()
+	}
+
+	var output interface{}
+	var err error
+	attempt := 1
+	for ; ; attempt++ {
+		output, err = f.Invoke(ctx, input)
+		if err == nil {
+			return output, nil
+		}
+		if attempt >= r.MaxAttempts || !r.retryable(err) || !sleep(ctx, r.backoff(attempt)) {
+			break
+		}
+	}
+
+	if attempt > 1 {
+		err = &Error{Attempts: attempt, Err: err}
+	}
+	return output, err
+}
+
+// Describe describes the configuration of the retry middleware.
+func (*retryMiddleware) Describe() *config.Schema {
+	names := retryableErrorNames()
+	enum := make([]interface{}, len(names))
+	for i, name := range names {
+		enum[i] = name
+	}
+
+	return &config.Schema{
+		Description: "Retries failed invocations with exponential backoff and jitter.",
+		Type:        "object",
+		Properties: map[string]*config.Schema{
+			"maxAttempts": {
+				Type:        "integer",
+				Description: "The maximum number of attempts, including the first.",
+				Default:     3,
+				Minimum:     config.Minimum(1),
+			},
+			"initialBackoff": {
+				Type:        "string",
+				Description: "The backoff after the first failed attempt, as a Go duration string.",
+				Default:     "100ms",
+			},
+			"maxBackoff": {
+				Type:        "string",
+				Description: "The maximum backoff, as a Go duration string.",
+				Default:     "10s",
+			},
+			"multiplier": {
+				Type:        "number",
+				Description: "The factor by which the backoff grows after each failed attempt.",
+				Default:     2,
+				Minimum:     config.Minimum(1),
+			},
+			"jitter": {
+				Type:        "number",
+				Description: "The maximum fraction by which each backoff is randomly reduced.",
+				Default:     0.2,
+				Minimum:     config.Minimum(0),
+			},
+			"deadline": {
+				Type:        "string",
+				Description: "The time within which all attempts and backoffs must complete, as a Go duration string. 0 disables the deadline.",
+				Default:     "0s",
+			},
+			"retryableErrors": {
+				Type:        "array",
+				Description: "The kinds of errors to retry. Every error is retried if neither this nor retryableMessages is set.",
+				Items: &config.Schema{
+					Type: "string",
+					Enum: enum,
+				},
+			},
+			"retryableMessages": {
+				Type:        "array",
+				Description: "Regular expressions matched against error messages to decide whether to retry.",
+				Items:       &config.Schema{Type: "string"},
+				Examples:    []interface{}{[]interface{}{"connection refused"}},
+			},
+		},
+		AdditionalProperties: config.NoAdditionalProperties(),
+	}
+}
+
+// New returns a middleware that makes up to 3 attempts with backoffs starting
+// at 100ms.
+func New() run.Middleware {
+	return &retryMiddleware{
+		MaxAttempts:    3,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
@@ -0,0 +1,234 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/fnrun/fnrun/fn"
+	"github.com/fnrun/fnrun/run/config"
+)
+
+var errFailed = errors.New("connection refused")
+
+type unavailableErr struct{}
+
+func (unavailableErr) Error() string     { return "no fn available" }
+func (unavailableErr) Unavailable() bool { return true }
+
+type statusErr int
+
+func (e statusErr) Error() string   { return "status error" }
+func (e statusErr) HTTPStatus() int { return int(e) }
+
+func newMiddleware(t *testing.T, configMap map[string]interface{}) *retryMiddleware {
+	t.Helper()
+
+	m := New().(*retryMiddleware)
+	if _, exists := configMap["initialBackoff"]; !exists {
+		configMap["initialBackoff"] = "1ms"
+	}
+	if err := config.Configure(m, configMap); err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+	return m
+}
+
+// failingFn returns a fn that returns the given errors in order and then
+// succeeds, and a pointer to the number of times it was invoked.
+func failingFn(errs ...error) (fn.Fn, *int) {
+	attempts := 0
+	return fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		attempts++
+		if attempts <= len(errs) {
+			return nil, errs[attempts-1]
+		}
+		return input, nil
+	}), &attempts
+}
+
+func TestInvoke_retriesUntilSuccess(t *testing.T) {
+	m := newMiddleware(t, map[string]interface{}{"maxAttempts": 3})
+	f, attempts := failingFn(errFailed, errFailed)
+
+	output, err := m.Invoke(context.Background(), "input", f)
+	if err != nil {
+		t.Fatalf("Invoke returned error: %+v", err)
+	}
+	if output != "input" {
+		t.Errorf("unexpected output: want %q, got %v", "input", output)
+	}
+	if *attempts != 3 {
+		t.Errorf("unexpected number of attempts: want 3, got %d", *attempts)
+	}
+}
+
+func TestInvoke_exhaustsAttempts(t *testing.T) {
+	m := newMiddleware(t, map[string]interface{}{"maxAttempts": 2})
+	f, attempts := failingFn(errFailed, errFailed, errFailed)
+
+	_, err := m.Invoke(context.Background(), "input", f)
+
+	var retryErr *Error
+	if !errors.As(err, &retryErr) {
+		t.Fatalf("expected Invoke to return an Error but got %+v", err)
+	}
+	if retryErr.Attempts != 2 || *attempts != 2 {
+		t.Errorf("unexpected number of attempts: want 2, got %d (invoked %d times)", retryErr.Attempts, *attempts)
+	}
+	if !errors.Is(err, errFailed) {
+		t.Errorf("expected error to wrap %v but got %v", errFailed, err)
+	}
+}
+
+func TestInvoke_retryableErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		retryable map[string]interface{}
+		err       error
+		want      int
+	}{
+		{
+			name:      "matching error",
+			retryable: map[string]interface{}{"retryableErrors": []interface{}{"unavailable"}},
+			err:       fmt.Errorf("invoking: %w", unavailableErr{}),
+			want:      3,
+		},
+		{
+			name:      "other error",
+			retryable: map[string]interface{}{"retryableErrors": []interface{}{"unavailable"}},
+			err:       errFailed,
+			want:      1,
+		},
+		{
+			name:      "former name",
+			retryable: map[string]interface{}{"retryableErrors": []interface{}{"pool.ErrAvailabilityTimeout"}},
+			err:       unavailableErr{},
+			want:      3,
+		},
+		{
+			name:      "http 5xx",
+			retryable: map[string]interface{}{"retryableErrors": []interface{}{"http.5xx"}},
+			err:       statusErr(503),
+			want:      3,
+		},
+		{
+			name:      "http 4xx",
+			retryable: map[string]interface{}{"retryableErrors": []interface{}{"http.5xx"}},
+			err:       statusErr(404),
+			want:      1,
+		},
+		{
+			name:      "matching message",
+			retryable: map[string]interface{}{"retryableMessages": []interface{}{"refused$"}},
+			err:       errFailed,
+			want:      3,
+		},
+		{
+			name:      "other message",
+			retryable: map[string]interface{}{"retryableMessages": []interface{}{"^timeout"}},
+			err:       errFailed,
+			want:      1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMiddleware(t, tt.retryable)
+			f, attempts := failingFn(tt.err, tt.err, tt.err)
+
+			if _, err := m.Invoke(context.Background(), "input", f); err == nil {
+				t.Fatal("expected Invoke to return an error but it did not")
+			}
+			if *attempts != tt.want {
+				t.Errorf("unexpected number of attempts: want %d, got %d", tt.want, *attempts)
+			}
+		})
+	}
+}
+
+func TestInvoke_cancelledDuringBackoff(t *testing.T) {
+	m := newMiddleware(t, map[string]interface{}{"initialBackoff": "1h", "maxBackoff": "1h"})
+	f, attempts := failingFn(errFailed, errFailed)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	_, err := m.Invoke(ctx, "input", f)
+	if !errors.Is(err, errFailed) {
+		t.Errorf("expected error to wrap %v but got %v", errFailed, err)
+	}
+	if *attempts != 1 {
+		t.Errorf("unexpected number of attempts: want 1, got %d", *attempts)
+	}
+}
+
+func TestInvoke_deadline(t *testing.T) {
+	m := newMiddleware(t, map[string]interface{}{"initialBackoff": "1h", "maxBackoff": "1h", "deadline": "10ms"})
+	f, attempts := failingFn(errFailed, errFailed)
+
+	start := time.Now()
+	if _, err := m.Invoke(context.Background(), "input", f); err == nil {
+		t.Fatal("expected Invoke to return an error but it did not")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected Invoke to return at the deadline but it took %v", elapsed)
+	}
+	if *attempts != 1 {
+		t.Errorf("unexpected number of attempts: want 1, got %d", *attempts)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	m := newMiddleware(t, map[string]interface{}{
+		"initialBackoff": "100ms",
+		"maxBackoff":     "300ms",
+		"jitter":         0,
+	})
+
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond}
+	for i, w := range want {
+		if got := m.backoff(i + 1); got != w {
+			t.Errorf("unexpected backoff after attempt %d: want %v, got %v", i+1, w, got)
+		}
+	}
+}
+
+func TestBackoff_jitter(t *testing.T) {
+	m := newMiddleware(t, map[string]interface{}{"initialBackoff": "100ms", "jitter": 0.5})
+
+	for i := 0; i < 100; i++ {
+		if got := m.backoff(1); got < 50*time.Millisecond || got > 100*time.Millisecond {
+			t.Fatalf("expected backoff between 50ms and 100ms but got %v", got)
+		}
+	}
+}
+
+func TestConfigureMap_invalid(t *testing.T) {
+	err := config.Configure(New(), map[string]interface{}{
+		"maxAttempts":       0,
+		"jitter":            2,
+		"deadline":          "-1s",
+		"retryableErrors":   []interface{}{"pool.ErrAvailabilityTimeout", "io.EOF"},
+		"retryableMessages": []interface{}{"("},
+	})
+
+	want := []string{
+		"maxAttempts: maxAttempts must be at least 1",
+		"jitter: jitter must be between 0 and 1",
+		"deadline: deadline must not be negative",
+		`retryableErrors[1]: unknown error "io.EOF"; expected one of [context.DeadlineExceeded http.5xx pool.ErrAvailabilityTimeout unavailable]`,
+		"retryableMessages[0]: error parsing regexp: missing closing ): `(`",
+	}
+	errs := config.Errors(err)
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors but got %d: %+v", len(want), len(errs), errs)
+	}
+	for i, e := range errs {
+		if e.Error() != want[i] {
+			t.Errorf("unexpected error message: want %q, got %q", want[i], e.Error())
+		}
+	}
+}
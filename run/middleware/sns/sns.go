@@ -0,0 +1,135 @@
+// Package sns provides a middleware that publishes the results of invocations
+// to SNS. The output of each successful invocation is published to the success
+// topic, and the message of each error to the error topic.
+//
+// The body, message attributes, message group ID, and deduplication ID of
+// published messages may be chosen with jq programs. They are evaluated
+// against an object with the input of the invocation under "input" and either
+// its output under "output" or its error message under "error". By default,
+// the body is the output or error message, encoded as JSON unless it is a
+// string.
+package sns
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/fnrun/fnrun/fn"
+	"github.com/fnrun/fnrun/run"
+	"github.com/fnrun/fnrun/run/awspublisher"
+	"github.com/fnrun/fnrun/run/config"
+)
+
+type snsMiddleware struct {
+	awspublisher.Endpoint `mapstructure:",squash"`
+	awspublisher.Message  `mapstructure:",squash"`
+
+	SuccessTopicARN string `mapstructure:"successTopicARN"`
+	ErrorTopicARN   string `mapstructure:"errorTopicARN"`
+
+	mutex     sync.Mutex
+	connected bool
+	client    awspublisher.SNSAPI
+	success   awspublisher.Publisher
+	failure   awspublisher.Publisher
+}
+
+func (*snsMiddleware) RequiresConfig() bool {
+	return true
+}
+
+func (m *snsMiddleware) ConfigureMap(configMap map[string]interface{}) error {
+	if err := config.Decode(configMap, m); err != nil {
+		return err
+	}
+
+	return m.Compile()
+}
+
+func (m *snsMiddleware) Validate() error {
+	if m.SuccessTopicARN == "" && m.ErrorTopicARN == "" {
+		return errors.New("successTopicARN or errorTopicARN is required")
+	}
+	return nil
+}
+
+// connect creates the publishers if they have not been created. m.mutex must
+// be held.
+func (m *snsMiddleware) connect(ctx context.Context) error {
+	if m.connected {
+		return nil
+	}
+
+	if m.client == nil {
+		cfg, err := m.LoadConfig(ctx)
+		if err != nil {
+			return err
+		}
+		m.client = sns.NewFromConfig(cfg)
+	}
+
+	if m.SuccessTopicARN != "" {
+		m.success = awspublisher.NewSNSPublisher(m.client, m.SuccessTopicARN)
+	}
+	if m.ErrorTopicARN != "" {
+		m.failure = awspublisher.NewSNSPublisher(m.client, m.ErrorTopicARN)
+	}
+	m.connected = true
+	return nil
+}
+
+// Start loads the AWS configuration of the publishers.
+func (m *snsMiddleware) Start(ctx context.Context) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.connect(ctx)
+}
+
+func (m *snsMiddleware) Invoke(ctx context.Context, input interface{}, f fn.Fn) (interface{}, error) {
+	m.mutex.Lock()
+	err := m.connect(ctx)
+	success, failure := m.success, m.failure
+	m.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return m.Forward(ctx, input, f, success, failure)
+}
+
+// Describe describes the configuration of the sns middleware.
+func (m *snsMiddleware) Describe() *config.Schema {
+	properties := map[string]*config.Schema{
+		"successTopicARN": {
+			Type:        "string",
+			Description: "The ARN of the topic outputs are published to. Outputs are not published if it is empty.",
+		},
+		"errorTopicARN": {
+			Type:        "string",
+			Description: "The ARN of the topic error messages are published to. Errors are not published if it is empty.",
+		},
+	}
+	for key, schema := range m.Endpoint.DescribeProperties("SNS") {
+		properties[key] = schema
+	}
+	for key, schema := range m.Message.DescribeProperties(`an object with the input under "input" and the output under "output" or the error message under "error"`) {
+		properties[key] = schema
+	}
+
+	return &config.Schema{
+		Description: "Publishes the output of each successful invocation to one SNS topic and the message of each error to another.",
+		Type:        "object",
+		Properties:  properties,
+
+		AdditionalProperties: config.NoAdditionalProperties(),
+	}
+}
+
+// New returns an sns middleware, which must be configured with a success
+// topic, an error topic, or both.
+func New() run.Middleware {
+	return &snsMiddleware{Endpoint: awspublisher.DefaultEndpoint()}
+}
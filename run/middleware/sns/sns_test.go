@@ -0,0 +1,65 @@
+package sns
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/fnrun/fnrun/fn"
+	"github.com/fnrun/fnrun/run/config"
+)
+
+type fakeClient struct {
+	published map[string][]string
+}
+
+func (c *fakeClient) Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	topic := aws.ToString(params.TopicArn)
+	c.published[topic] = append(c.published[topic], aws.ToString(params.Message))
+	return &sns.PublishOutput{MessageId: aws.String("message-1")}, nil
+}
+
+func TestInvoke(t *testing.T) {
+	client := &fakeClient{published: make(map[string][]string)}
+
+	m := New().(*snsMiddleware)
+	err := config.Configure(m, map[string]interface{}{"errorTopicARN": "arn:aws:sns:us-east-1:123456789012:errors"})
+	if err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+	m.client = client
+
+	expectedErr := errors.New("expected error")
+	f := fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		if input == "bad" {
+			return nil, expectedErr
+		}
+		return "ok", nil
+	})
+
+	if _, err := m.Invoke(context.Background(), "good", f); err != nil {
+		t.Errorf("Invoke returned error: %+v", err)
+	}
+	if _, err := m.Invoke(context.Background(), "bad", f); err != expectedErr {
+		t.Errorf("unexpected error: want %v, got %+v", expectedErr, err)
+	}
+
+	want := []string{"expected error"}
+	if got := client.published["arn:aws:sns:us-east-1:123456789012:errors"]; len(got) != 1 || got[0] != want[0] {
+		t.Errorf("unexpected published errors: want %v, got %v", want, got)
+	}
+	if len(client.published) != 1 {
+		t.Errorf("expected only errors to be published, got %v", client.published)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	err := config.Configure(New(), map[string]interface{}{"body": ".output"})
+
+	want := "successTopicARN or errorTopicARN is required"
+	if err == nil || err.Error() != want {
+		t.Errorf("unexpected error: want %q, got %+v", want, err)
+	}
+}
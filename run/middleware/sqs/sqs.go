@@ -0,0 +1,141 @@
+// Package sqs provides a middleware that sends the results of invocations to
+// SQS. The output of each successful invocation is sent to the success queue,
+// and the message of each error to the error queue.
+//
+// The body, message attributes, message group ID, and deduplication ID of sent
+// messages may be chosen with jq programs. They are evaluated against an
+// object with the input of the invocation under "input" and either its output
+// under "output" or its error message under "error". By default, the body is
+// the output or error message, encoded as JSON unless it is a string.
+package sqs
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/fnrun/fnrun/fn"
+	"github.com/fnrun/fnrun/run"
+	"github.com/fnrun/fnrun/run/awspublisher"
+	"github.com/fnrun/fnrun/run/config"
+)
+
+type sqsMiddleware struct {
+	awspublisher.Endpoint `mapstructure:",squash"`
+	awspublisher.Message  `mapstructure:",squash"`
+
+	SuccessQueue string
+	ErrorQueue   string
+
+	mutex     sync.Mutex
+	connected bool
+	client    awspublisher.SQSAPI
+	success   awspublisher.Publisher
+	failure   awspublisher.Publisher
+}
+
+func (*sqsMiddleware) RequiresConfig() bool {
+	return true
+}
+
+func (m *sqsMiddleware) ConfigureMap(configMap map[string]interface{}) error {
+	if err := config.Decode(configMap, m); err != nil {
+		return err
+	}
+
+	return m.Compile()
+}
+
+func (m *sqsMiddleware) Validate() error {
+	if m.SuccessQueue == "" && m.ErrorQueue == "" {
+		return errors.New("successQueue or errorQueue is required")
+	}
+	return nil
+}
+
+// connect creates the publishers if they have not been created. m.mutex must
+// be held.
+func (m *sqsMiddleware) connect(ctx context.Context) error {
+	if m.connected {
+		return nil
+	}
+
+	if m.client == nil {
+		cfg, err := m.LoadConfig(ctx)
+		if err != nil {
+			return err
+		}
+		m.client = sqs.NewFromConfig(cfg)
+	}
+
+	var success, failure awspublisher.Publisher
+	var err error
+	if m.SuccessQueue != "" {
+		if success, err = awspublisher.NewSQSPublisher(ctx, m.client, m.SuccessQueue); err != nil {
+			return err
+		}
+	}
+	if m.ErrorQueue != "" {
+		if failure, err = awspublisher.NewSQSPublisher(ctx, m.client, m.ErrorQueue); err != nil {
+			return err
+		}
+	}
+
+	m.success, m.failure, m.connected = success, failure, true
+	return nil
+}
+
+// Start resolves the URLs of the queues.
+func (m *sqsMiddleware) Start(ctx context.Context) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.connect(ctx)
+}
+
+func (m *sqsMiddleware) Invoke(ctx context.Context, input interface{}, f fn.Fn) (interface{}, error) {
+	m.mutex.Lock()
+	err := m.connect(ctx)
+	success, failure := m.success, m.failure
+	m.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return m.Forward(ctx, input, f, success, failure)
+}
+
+// Describe describes the configuration of the sqs middleware.
+func (m *sqsMiddleware) Describe() *config.Schema {
+	properties := map[string]*config.Schema{
+		"successQueue": {
+			Type:        "string",
+			Description: "The name of the queue outputs are sent to. Outputs are not sent if it is empty.",
+		},
+		"errorQueue": {
+			Type:        "string",
+			Description: "The name of the queue error messages are sent to. Errors are not sent if it is empty.",
+		},
+	}
+	for key, schema := range m.Endpoint.DescribeProperties("SQS") {
+		properties[key] = schema
+	}
+	for key, schema := range m.Message.DescribeProperties(`an object with the input under "input" and the output under "output" or the error message under "error"`) {
+		properties[key] = schema
+	}
+
+	return &config.Schema{
+		Description: "Sends the output of each successful invocation to one SQS queue and the message of each error to another.",
+		Type:        "object",
+		Properties:  properties,
+
+		AdditionalProperties: config.NoAdditionalProperties(),
+	}
+}
+
+// New returns an sqs middleware, which must be configured with a success
+// queue, an error queue, or both.
+func New() run.Middleware {
+	return &sqsMiddleware{Endpoint: awspublisher.DefaultEndpoint()}
+}
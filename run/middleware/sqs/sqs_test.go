@@ -0,0 +1,104 @@
+package sqs
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/fnrun/fnrun/fn"
+	"github.com/fnrun/fnrun/run/config"
+)
+
+type fakeClient struct {
+	sent map[string][]string
+
+	// lookupErr is returned by the next call to GetQueueUrl, if it is set.
+	lookupErr error
+}
+
+func (c *fakeClient) GetQueueUrl(ctx context.Context, params *sqs.GetQueueUrlInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error) {
+	if err := c.lookupErr; err != nil {
+		c.lookupErr = nil
+		return nil, err
+	}
+	return &sqs.GetQueueUrlOutput{QueueUrl: params.QueueName}, nil
+}
+
+func (c *fakeClient) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	queue := aws.ToString(params.QueueUrl)
+	c.sent[queue] = append(c.sent[queue], aws.ToString(params.MessageBody))
+	return &sqs.SendMessageOutput{MessageId: aws.String("message-1")}, nil
+}
+
+func TestInvoke(t *testing.T) {
+	client := &fakeClient{sent: make(map[string][]string)}
+
+	m := New().(*sqsMiddleware)
+	err := config.Configure(m, map[string]interface{}{
+		"successQueue": "successes",
+		"errorQueue":   "errors",
+		"body":         `{"input": .input, "result": (.output // .error)}`,
+	})
+	if err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+	m.client = client
+
+	expectedErr := errors.New("expected error")
+	f := fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		if input == "bad" {
+			return nil, expectedErr
+		}
+		return "ok", nil
+	})
+
+	if _, err := m.Invoke(context.Background(), "good", f); err != nil {
+		t.Errorf("Invoke returned error: %+v", err)
+	}
+	if _, err := m.Invoke(context.Background(), "bad", f); err != expectedErr {
+		t.Errorf("unexpected error: want %v, got %+v", expectedErr, err)
+	}
+
+	if got := client.sent["successes"]; len(got) != 1 || got[0] != `{"input":"good","result":"ok"}` {
+		t.Errorf("unexpected successes: %v", got)
+	}
+	if got := client.sent["errors"]; len(got) != 1 || got[0] != `{"input":"bad","result":"expected error"}` {
+		t.Errorf("unexpected errors: %v", got)
+	}
+}
+
+func TestStart_retriesAfterError(t *testing.T) {
+	lookupErr := errors.New("queue does not exist")
+	client := &fakeClient{sent: make(map[string][]string), lookupErr: lookupErr}
+
+	m := New().(*sqsMiddleware)
+	if err := config.Configure(m, map[string]interface{}{"successQueue": "successes"}); err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+	m.client = client
+
+	if err := m.Start(context.Background()); err != lookupErr {
+		t.Fatalf("unexpected error: want %v, got %+v", lookupErr, err)
+	}
+
+	f := fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		return "ok", nil
+	})
+	if _, err := m.Invoke(context.Background(), "good", f); err != nil {
+		t.Fatalf("Invoke returned error: %+v", err)
+	}
+	if got := client.sent["successes"]; len(got) != 1 || got[0] != "ok" {
+		t.Errorf("unexpected successes: %v", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	err := config.Configure(New(), map[string]interface{}{"endpointURL": "http://localhost:9324"})
+
+	want := "successQueue or errorQueue is required"
+	if err == nil || err.Error() != want {
+		t.Errorf("unexpected error: want %q, got %+v", want, err)
+	}
+}
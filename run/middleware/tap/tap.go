@@ -13,7 +13,7 @@ import (
 
 	"github.com/fnrun/fnrun/fn"
 	"github.com/fnrun/fnrun/run"
-	"github.com/mitchellh/mapstructure"
+	"github.com/fnrun/fnrun/run/config"
 	"github.com/tessellator/executil"
 )
 
@@ -72,7 +72,7 @@ func (m *tapMiddleware) ConfigureMap(configMap map[string]interface{}) error {
 		TapError:  true,
 	}
 
-	err := mapstructure.Decode(configMap, &cfg)
+	err := config.Decode(configMap, &cfg)
 	if err != nil {
 		return err
 	}
@@ -161,6 +161,32 @@ func (m *tapMiddleware) start() error {
 	return nil
 }
 
+func (m *tapMiddleware) Start(ctx context.Context) error {
+	if m.baseCmd == nil {
+		return ErrUnconfiguredCmd
+	}
+
+	return m.start()
+}
+
+func (m *tapMiddleware) Close() error {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	if !m.alive {
+		return nil
+	}
+
+	// Closing stdin lets the external program exit on its own; the process is
+	// killed in case it does not.
+	_ = m.stdin.Close()
+	err := m.cmd.Process.Kill()
+	if err != nil && err != os.ErrProcessDone {
+		return err
+	}
+	return nil
+}
+
 func (m *tapMiddleware) getAlive() bool {
 	m.locker.RLock()
 	defer m.locker.RUnlock()
@@ -168,6 +194,42 @@ func (m *tapMiddleware) getAlive() bool {
 	return m.alive
 }
 
+// Describe describes the configuration of the tap middleware.
+func (*tapMiddleware) Describe() *config.Schema {
+	return &config.Schema{
+		Description: "Sends inputs, outputs, and errors to an external command over stdin without waiting for a response.",
+		Type:        "object",
+		Properties: map[string]*config.Schema{
+			"command": {
+				Type:        "string",
+				Description: "The command to run.",
+			},
+			"env": {
+				Type:        "array",
+				Description: "Additional environment variables for the command in KEY=value form.",
+				Items:       &config.Schema{Type: "string"},
+			},
+			"tapInput": {
+				Type:        "boolean",
+				Description: "Whether inputs are sent to the command.",
+				Default:     true,
+			},
+			"tapOutput": {
+				Type:        "boolean",
+				Description: "Whether outputs are sent to the command.",
+				Default:     true,
+			},
+			"tapError": {
+				Type:        "boolean",
+				Description: "Whether errors are sent to the command.",
+				Default:     true,
+			},
+		},
+		Required:             []string{"command"},
+		AdditionalProperties: config.NoAdditionalProperties(),
+	}
+}
+
 func New() run.Middleware {
 	return &tapMiddleware{
 		tapInput:  true,
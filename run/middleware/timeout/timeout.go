@@ -10,6 +10,7 @@ import (
 
 	"github.com/fnrun/fnrun/fn"
 	"github.com/fnrun/fnrun/run"
+	"github.com/fnrun/fnrun/run/config"
 )
 
 type timeoutMiddleware struct {
@@ -33,6 +34,15 @@ func (t *timeoutMiddleware) Invoke(ctx context.Context, input interface{}, f fn.
 	return f.Invoke(newCtx, input)
 }
 
+// Describe describes the configuration of the timeout middleware.
+func (*timeoutMiddleware) Describe() *config.Schema {
+	return &config.Schema{
+		Description: "Cancels the context of each invocation after a timeout, given as a Go duration string.",
+		Type:        "string",
+		Default:     "30s",
+	}
+}
+
 // New returns a middleware that applies a 30s timeout to the context. The
 // duration may be changed via configuration.
 func New() run.Middleware {
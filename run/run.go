@@ -2,6 +2,8 @@ package run
 
 import (
 	"context"
+	"errors"
+	"sort"
 
 	"github.com/fnrun/fnrun/fn"
 )
@@ -17,6 +19,63 @@ type Source interface {
 	Serve(context.Context, fn.Fn) error
 }
 
+// Starter is an optional interface for sources, middleware, and fns that need
+// to acquire resources, such as subprocesses or network connections, before
+// they are used.
+type Starter interface {
+	Start(context.Context) error
+}
+
+// Closer is an optional interface for sources, middleware, and fns that hold
+// resources that must be released when they are no longer used. Close should
+// be safe to call on a value that was never started.
+type Closer interface {
+	Close() error
+}
+
+type pipelineKey struct{}
+
+// WithPipeline returns a copy of ctx that carries the name of the pipeline
+// whose source, middleware, and fn use it.
+func WithPipeline(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, pipelineKey{}, name)
+}
+
+// Pipeline returns the name of the pipeline carried by ctx, or an empty string
+// if ctx does not carry one.
+func Pipeline(ctx context.Context) string {
+	name, _ := ctx.Value(pipelineKey{}).(string)
+	return name
+}
+
+// Start calls Start on v if it implements Starter. Otherwise, it does nothing.
+func Start(ctx context.Context, v interface{}) error {
+	if s, ok := v.(Starter); ok {
+		return s.Start(ctx)
+	}
+	return nil
+}
+
+// Close calls Close on v if it implements Closer. Otherwise, it does nothing.
+func Close(v interface{}) error {
+	if c, ok := v.(Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// CloseAll calls Close on each value that implements Closer, in reverse order.
+// All values are closed even if some return errors, and the errors are joined.
+func CloseAll(values ...interface{}) error {
+	var errs []error
+	for i := len(values) - 1; i >= 0; i-- {
+		if err := Close(values[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
 // Registry represents an object that sources and finds factories for sources,
 // middlewares, and functions under specified keys.
 type Registry interface {
@@ -31,6 +90,10 @@ type Registry interface {
 	FindSource(key string) (func() Source, bool)
 	FindMiddleware(key string) (func() Middleware, bool)
 	FindFn(key string) (func() fn.Fn, bool)
+
+	SourceKeys() []string
+	MiddlewareKeys() []string
+	FnKeys() []string
 }
 
 type registry struct {
@@ -76,6 +139,30 @@ func (r *registry) FindFn(key string) (func() fn.Fn, bool) {
 	return f, exists
 }
 
+// SourceKeys returns the keys of the registered sources in sorted order.
+func (r *registry) SourceKeys() []string {
+	return sortedKeys(r.source)
+}
+
+// MiddlewareKeys returns the keys of the registered middleware in sorted order.
+func (r *registry) MiddlewareKeys() []string {
+	return sortedKeys(r.middleware)
+}
+
+// FnKeys returns the keys of the registered fns in sorted order.
+func (r *registry) FnKeys() []string {
+	return sortedKeys(r.fn)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // NewRegistry creates a new, empty Registry.
 func NewRegistry() Registry {
 	return &registry{
@@ -2,6 +2,9 @@ package run
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/fnrun/fnrun/fn"
@@ -52,6 +55,24 @@ func TestRegistry_FindFn(t *testing.T) {
 	}
 }
 
+func TestRegistry_Keys(t *testing.T) {
+	r := NewRegistry()
+	r.RegisterSource("b", NewTestSource)
+	r.RegisterSource("a", NewTestSource)
+	r.RegisterMiddleware("test", NewTestMiddleware)
+	r.RegisterFnWithRegistry("fnWithRegistry", NewTestFnWithRegistry)
+
+	if got, want := r.SourceKeys(), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected source keys: want %v, got %v", want, got)
+	}
+	if got, want := r.MiddlewareKeys(), []string{"test"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected middleware keys: want %v, got %v", want, got)
+	}
+	if got, want := r.FnKeys(), []string{"fnWithRegistry"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected fn keys: want %v, got %v", want, got)
+	}
+}
+
 func TestRegistry_RegisterSourceWithRegistry(t *testing.T) {
 	r := NewRegistry()
 	r.RegisterSourceWithRegistry("sourceWithRegistry", NewTestSourceWithRegistry)
@@ -121,9 +142,70 @@ func TestRegistry_RegisterFnWithRegistry(t *testing.T) {
 	}
 }
 
+func TestPipeline(t *testing.T) {
+	if got := Pipeline(context.Background()); got != "" {
+		t.Errorf("expected no pipeline name but got %q", got)
+	}
+
+	ctx := WithPipeline(context.Background(), "orders")
+	if got := Pipeline(ctx); got != "orders" {
+		t.Errorf("unexpected pipeline name: want %q, got %q", "orders", got)
+	}
+}
+
+func TestStart(t *testing.T) {
+	c := &testCloser{}
+	if err := Start(context.Background(), c); err != nil {
+		t.Fatalf("Start returned error: %+v", err)
+	}
+	if !c.started {
+		t.Error("expected Start to start the value but it did not")
+	}
+
+	if err := Start(context.Background(), &testFn{}); err != nil {
+		t.Errorf("Start returned error for value without Start: %+v", err)
+	}
+}
+
+func TestCloseAll(t *testing.T) {
+	var order []string
+	errA := errors.New("error from a")
+	a := &testCloser{name: "a", order: &order, err: errA}
+	b := &testCloser{name: "b", order: &order}
+
+	err := CloseAll(a, &testFn{}, b)
+
+	if !errors.Is(err, errA) {
+		t.Errorf("expected CloseAll to return %+v but got %+v", errA, err)
+	}
+
+	want := "[b a]"
+	got := fmt.Sprint(order)
+	if got != want {
+		t.Errorf("unexpected close order: want %s, got %s", want, got)
+	}
+}
+
 // -----------------------------------------------------------------------------
 // Test types
 
+type testCloser struct {
+	name    string
+	order   *[]string
+	err     error
+	started bool
+}
+
+func (t *testCloser) Start(context.Context) error {
+	t.started = true
+	return nil
+}
+
+func (t *testCloser) Close() error {
+	*t.order = append(*t.order, t.name)
+	return t.err
+}
+
 type testSource struct {
 	Registry Registry
 }
@@ -5,28 +5,156 @@ package runner
 import (
 	"context"
 	"errors"
+	"fmt"
+	"log"
+	"sync"
 
 	"github.com/fnrun/fnrun/fn"
 	"github.com/fnrun/fnrun/run"
 	"github.com/fnrun/fnrun/run/config"
 	"github.com/fnrun/fnrun/run/fn/middleware"
-	"github.com/mitchellh/mapstructure"
+	"github.com/fnrun/fnrun/run/schema"
 )
 
+// ErrClosed is returned when reloading a runner that has been closed.
+var ErrClosed = errors.New("runner is closed")
+
+// ErrRestoreFailed is returned by Reload and Run when the new middleware and fn
+// of a reload fail to start and the previous ones cannot be started again. The
+// runner stops serving inputs and must be replaced.
+var ErrRestoreFailed = errors.New("previous middleware and fn could not be restarted")
+
 // Runner represents a processing pipeline comprising a source, middleware, and
 // an fn.
 type Runner struct {
 	registry run.Registry
 	source   run.Source
-	fn       fn.Fn
+
+	// mu guards fn and the lifecycle state of the runner. The source invokes
+	// swap, which delegates to fn.
+	mu      sync.Mutex
+	fn      fn.Fn
+	swap    *swapFn
+	started bool
+	closed  bool
+	stop    context.CancelCauseFunc
 }
 
-// Run executes the processing pipeline.
+// Run starts the components of the processing pipeline and serves inputs until
+// the source returns. Close should be called after Run returns to release the
+// resources held by the components.
 func (r *Runner) Run(ctx context.Context) error {
-	return r.source.Serve(ctx, r.fn)
+	ctx, stop := context.WithCancelCause(ctx)
+	defer stop(nil)
+
+	r.mu.Lock()
+	err := run.Start(ctx, r.fn)
+	r.started = true
+	r.stop = stop
+	r.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	if err := run.Start(ctx, r.source); err != nil {
+		return err
+	}
+
+	err = r.source.Serve(ctx, r.swap)
+	if cause := context.Cause(ctx); errors.Is(cause, ErrRestoreFailed) {
+		return cause
+	}
+	return err
+}
+
+// Close closes the source and then the middleware and fn. A runner should not
+// be run again after it has been closed.
+func (r *Runner) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closed = true
+	return run.CloseAll(r.fn, r.source)
+}
+
+// Reload replaces the middleware and fn of the runner with those of next,
+// which must be configured but must not have been run. The source of the runner
+// keeps running. Reload takes ownership of next: its source is closed without
+// being started, and its middleware and fn are closed unless they replace the
+// current ones.
+//
+// If the runner has been started, inputs received during the reload are held
+// until it completes. Reload waits for inputs already in flight and then starts
+// the new middleware and fn before closing the current ones. If they fail to
+// start, they are closed, and they are started again once the current ones are
+// closed, so that resources such as listening ports can pass from one to the
+// other. If they still fail to start, they are closed, the previous ones are
+// started again, and Reload returns an error. The runner is only changed if
+// Reload succeeds.
+//
+// If the previous middleware and fn cannot be started again, Reload returns an
+// error wrapping ErrRestoreFailed, inputs fail with that error, and Run stops
+// and returns it.
+func (r *Runner) Reload(ctx context.Context, next *Runner) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := run.Close(next.source); err != nil {
+		log.Printf("Error closing unused source: %+v\n", err)
+	}
+
+	if r.closed {
+		return errors.Join(ErrClosed, run.Close(next.fn))
+	}
+
+	if !r.started {
+		previous := r.fn
+		r.fn = next.fn
+		r.swap.replace(func(fn.Fn) fn.Fn { return next.fn })
+		return run.Close(previous)
+	}
+
+	var err error
+	r.swap.replace(func(previous fn.Fn) fn.Fn {
+		closePrevious := func() {
+			if closeErr := run.Close(previous); closeErr != nil {
+				log.Printf("Error closing previous middleware and fn: %+v\n", closeErr)
+			}
+		}
+
+		if err = run.Start(ctx, next.fn); err == nil {
+			closePrevious()
+			r.fn = next.fn
+			return next.fn
+		}
+		if closeErr := run.Close(next.fn); closeErr != nil {
+			log.Printf("Error closing new middleware and fn: %+v\n", closeErr)
+		}
+
+		closePrevious()
+		if err = run.Start(ctx, next.fn); err == nil {
+			r.fn = next.fn
+			return next.fn
+		}
+		err = errors.Join(err, run.Close(next.fn))
+
+		if restartErr := run.Start(ctx, previous); restartErr != nil {
+			restoreErr := fmt.Errorf("%w: %w", ErrRestoreFailed, errors.Join(err, restartErr))
+			err = restoreErr
+			r.stop(restoreErr)
+			return fn.NewFnFromInvokeFunc(func(context.Context, interface{}) (interface{}, error) {
+				return nil, restoreErr
+			})
+		}
+		return previous
+	})
+	return err
 }
 
 // ConfigureMap configures the runner with source, middleware, and fn values.
+// The source, middleware, and fn are all configured even if one of them fails,
+// and the returned error joins every configuration error, each annotated with
+// the path of the value that caused it.
 func (r *Runner) ConfigureMap(configMap map[string]interface{}) error {
 	cfg := struct {
 		Source     interface{} `mapstructure:"source"`
@@ -34,7 +162,9 @@ func (r *Runner) ConfigureMap(configMap map[string]interface{}) error {
 		Fn         interface{} `mapstructure:"fn"`
 	}{}
 
-	mapstructure.Decode(configMap, &cfg)
+	if err := config.Decode(configMap, &cfg); err != nil {
+		return err
+	}
 
 	if cfg.Source == nil {
 		return errors.New("source is a required configuration key")
@@ -43,48 +173,97 @@ func (r *Runner) ConfigureMap(configMap map[string]interface{}) error {
 		return errors.New("fn is a required configuration key")
 	}
 
-	fnFactory, exists := r.registry.FindFn("fn")
-	if !exists {
-		return errors.New(`a registered fn not found for key "fn"`)
-	}
-	f := fnFactory()
-	if err := config.Configure(f, cfg.Fn); err != nil {
-		return err
+	var errs []error
+
+	f, err := r.configureFn(cfg.Fn)
+	if err != nil {
+		errs = append(errs, err)
 	}
 
 	if cfg.Middleware != nil {
-		middlewareFactory, exists := r.registry.FindMiddleware("middleware")
-		if !exists {
-			return errors.New(`a registered middleware not found for key "middleware"`)
+		m, err := r.configureMiddleware(cfg.Middleware)
+		if err != nil {
+			errs = append(errs, err)
+		} else if f != nil {
+			f = middleware.New(m, f)
 		}
-		m := middlewareFactory()
-		if err := config.Configure(m, cfg.Middleware); err != nil {
-			return err
-		}
-		f = middleware.New(m, f)
 	}
 
-	sourceFactory, exists := r.registry.FindSource("source")
-	if !exists {
-		return errors.New(`a registered source not found for key "source"`)
+	source, err := r.configureSource(cfg.Source)
+	if err != nil {
+		errs = append(errs, err)
 	}
-	source := sourceFactory()
-	if err := config.Configure(source, cfg.Source); err != nil {
-		return err
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
 	}
 
 	r.fn = f
+	r.swap = newSwapFn(f)
 	r.source = source
 
 	return nil
 }
 
+func (r *Runner) configureFn(cfg interface{}) (fn.Fn, error) {
+	fnFactory, exists := r.registry.FindFn("fn")
+	if !exists {
+		return nil, errors.New(`a registered fn not found for key "fn"`)
+	}
+	f := fnFactory()
+	if err := config.Configure(f, cfg); err != nil {
+		return nil, config.WithPath("fn", err)
+	}
+	return f, nil
+}
+
+func (r *Runner) configureMiddleware(cfg interface{}) (run.Middleware, error) {
+	middlewareFactory, exists := r.registry.FindMiddleware("middleware")
+	if !exists {
+		return nil, errors.New(`a registered middleware not found for key "middleware"`)
+	}
+	m := middlewareFactory()
+	if err := config.Configure(m, cfg); err != nil {
+		return nil, config.WithPath("middleware", err)
+	}
+	return m, nil
+}
+
+func (r *Runner) configureSource(cfg interface{}) (run.Source, error) {
+	sourceFactory, exists := r.registry.FindSource("source")
+	if !exists {
+		return nil, errors.New(`a registered source not found for key "source"`)
+	}
+	source := sourceFactory()
+	if err := config.Configure(source, cfg); err != nil {
+		return nil, config.WithPath("source", err)
+	}
+	return source, nil
+}
+
 // RequiresConfig always returns true. This method exists to interoperate with
 // the config package.
 func (r *Runner) RequiresConfig() bool {
 	return true
 }
 
+// Describe describes the configuration of the runner. The source, middleware,
+// and fn are described by the components registered under the "source",
+// "middleware", and "fn" keys.
+func (r *Runner) Describe() *config.Schema {
+	return &config.Schema{
+		Description: "A pipeline comprising a source, middleware, and an fn.",
+		Type:        "object",
+		Properties: map[string]*config.Schema{
+			"source":     {Ref: schema.Ref("source")},
+			"middleware": {Ref: schema.Ref("middleware")},
+			"fn":         {Ref: schema.Ref("fn")},
+		},
+		Required:             []string{"source", "fn"},
+		AdditionalProperties: config.NoAdditionalProperties(),
+	}
+}
+
 // New returns a new instance of a Runner with the specified registry.
 func New(registry run.Registry) *Runner {
 	return &Runner{registry: registry}
@@ -2,7 +2,9 @@ package runner_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -119,7 +121,7 @@ func TestConfigureMap_invalidConfigForFn(t *testing.T) {
 	}
 
 	got := err.Error()
-	want := "*runner_test.prefixFn could not be configured with object of type <nil>"
+	want := "fn.prefix: *runner_test.prefixFn could not be configured with object of type <nil>"
 
 	if got != want {
 		t.Errorf("unexpected error message: want %q, got %q", want, got)
@@ -179,7 +181,7 @@ func TestConfigureMap_invalidConfigForMiddleware(t *testing.T) {
 	}
 
 	got := err.Error()
-	want := "*runner_test.wrapMiddleware could not be configured with object of type bool"
+	want := "middleware[0].wrap: *runner_test.wrapMiddleware could not be configured with object of type bool"
 
 	if got != want {
 		t.Errorf("unexpected error message: want %q, got %q", want, got)
@@ -240,7 +242,7 @@ func TestConfigureMap_invalidConfigForSource(t *testing.T) {
 	}
 
 	got := err.Error()
-	want := "*cron.cronSource could not be configured with object of type bool"
+	want := "source.cron: *cron.cronSource could not be configured with object of type bool"
 
 	if got != want {
 		t.Errorf("unexpected error message: want %q, got %q", want, got)
@@ -332,6 +334,305 @@ func TestRun(t *testing.T) {
 	}
 }
 
+func TestRun_startsAndClosesComponents(t *testing.T) {
+	events := &eventLog{}
+	s := newChanSource()
+	reg := newRegistry()
+	reg.RegisterSource("chan", func() run.Source { return &lifecycleSource{chanSource: s, events: events} })
+	reg.RegisterFn("lifecycle", func() fn.Fn { return &lifecycleFn{prefixFn: &prefixFn{}, events: events} })
+	reg.RegisterMiddleware("lifecycle", func() run.Middleware {
+		return &lifecycleMiddleware{wrapMiddleware: &wrapMiddleware{}, events: events}
+	})
+
+	r := runner.New(reg)
+
+	err := config.Configure(r, map[string]interface{}{
+		"source": "chan",
+		"fn": map[string]interface{}{
+			"lifecycle": "fn-prefix",
+		},
+		"middleware": []interface{}{
+			map[string]interface{}{"lifecycle": "NAME"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	doneCh := make(chan error, 1)
+	go func() {
+		doneCh <- r.Run(ctx)
+	}()
+
+	s.InputCh <- "some input"
+	<-s.OutputCh
+	cancel()
+	<-doneCh
+
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close returned error: %+v", err)
+	}
+
+	want := []string{
+		"fn started",
+		"middleware started",
+		"source started",
+		"source closed",
+		"middleware closed",
+		"fn closed",
+	}
+	got := events.get()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("unexpected lifecycle events: want %v, got %v", want, got)
+	}
+}
+
+func TestReload(t *testing.T) {
+	events := &eventLog{}
+	s := newChanSource()
+	reg := newRegistry()
+	reg.RegisterSource("chan", func() run.Source { return &lifecycleSource{chanSource: s, events: events} })
+	reg.RegisterFn("lifecycle", func() fn.Fn { return &lifecycleFn{prefixFn: &prefixFn{}, events: events} })
+
+	newRunner := func(prefix string) *runner.Runner {
+		r := runner.New(reg)
+		err := config.Configure(r, map[string]interface{}{
+			"source": "chan",
+			"fn":     map[string]interface{}{"lifecycle": prefix},
+		})
+		if err != nil {
+			t.Fatalf("config.Configure returned error: %+v", err)
+		}
+		return r
+	}
+
+	r := newRunner("old")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	doneCh := make(chan error, 1)
+	go func() {
+		doneCh <- r.Run(ctx)
+	}()
+
+	s.InputCh <- "first"
+	if got, want := <-s.OutputCh, "old: first"; got != want {
+		t.Errorf("unexpected output: want %q, got %q", want, got)
+	}
+
+	if err := r.Reload(ctx, newRunner("new")); err != nil {
+		t.Fatalf("Reload returned error: %+v", err)
+	}
+
+	s.InputCh <- "second"
+	if got, want := <-s.OutputCh, "new: second"; got != want {
+		t.Errorf("unexpected output: want %q, got %q", want, got)
+	}
+
+	cancel()
+	<-doneCh
+	r.Close()
+
+	want := []string{
+		"fn started",
+		"source started",
+		"source closed",
+		"fn started",
+		"fn closed",
+		"source closed",
+		"fn closed",
+	}
+	got := events.get()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("unexpected lifecycle events: want %v, got %v", want, got)
+	}
+}
+
+func TestReload_startFailureRestoresPreviousFn(t *testing.T) {
+	events := &eventLog{}
+	s := newChanSource()
+	reg := newRegistry()
+	reg.RegisterSource("chan", func() run.Source { return s })
+	reg.RegisterFn("lifecycle", func() fn.Fn { return &lifecycleFn{prefixFn: &prefixFn{}, events: events} })
+	reg.RegisterFn("failing", func() fn.Fn { return &failingStartFn{prefixFn: &prefixFn{}, events: events} })
+
+	newRunner := func(fnConfig map[string]interface{}) *runner.Runner {
+		r := runner.New(reg)
+		err := config.Configure(r, map[string]interface{}{
+			"source": "chan",
+			"fn":     fnConfig,
+		})
+		if err != nil {
+			t.Fatalf("config.Configure returned error: %+v", err)
+		}
+		return r
+	}
+
+	r := newRunner(map[string]interface{}{"lifecycle": "old"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	go r.Run(ctx)
+	s.InputCh <- "first"
+	if got, want := <-s.OutputCh, "old: first"; got != want {
+		t.Errorf("unexpected output: want %q, got %q", want, got)
+	}
+
+	if err := r.Reload(ctx, newRunner(map[string]interface{}{"failing": "new"})); !errors.Is(err, errStartFailed) {
+		t.Fatalf("expected error %+v but got %+v", errStartFailed, err)
+	}
+
+	s.InputCh <- "second"
+	if got, want := <-s.OutputCh, "old: second"; got != want {
+		t.Errorf("unexpected output: want %q, got %q", want, got)
+	}
+
+	want := []string{
+		"fn started",
+		"failing fn started",
+		"failing fn closed",
+		"fn closed",
+		"failing fn started",
+		"failing fn closed",
+		"fn started",
+	}
+	got := events.get()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("unexpected lifecycle events: want %v, got %v", want, got)
+	}
+}
+
+func TestReload_restoreFailureStopsRunner(t *testing.T) {
+	events := &eventLog{}
+	s := newChanSource()
+	reg := newRegistry()
+	reg.RegisterSource("chan", func() run.Source { return s })
+	reg.RegisterFn("once", func() fn.Fn { return &startOnceFn{prefixFn: &prefixFn{}} })
+	reg.RegisterFn("failing", func() fn.Fn { return &failingStartFn{prefixFn: &prefixFn{}, events: events} })
+
+	newRunner := func(fnConfig map[string]interface{}) *runner.Runner {
+		r := runner.New(reg)
+		err := config.Configure(r, map[string]interface{}{
+			"source": "chan",
+			"fn":     fnConfig,
+		})
+		if err != nil {
+			t.Fatalf("config.Configure returned error: %+v", err)
+		}
+		return r
+	}
+
+	r := newRunner(map[string]interface{}{"once": "old"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	doneCh := make(chan error, 1)
+	go func() {
+		doneCh <- r.Run(ctx)
+	}()
+	s.InputCh <- "first"
+	if got, want := <-s.OutputCh, "old: first"; got != want {
+		t.Errorf("unexpected output: want %q, got %q", want, got)
+	}
+
+	err := r.Reload(ctx, newRunner(map[string]interface{}{"failing": "new"}))
+	if !errors.Is(err, runner.ErrRestoreFailed) || !errors.Is(err, errStartFailed) {
+		t.Fatalf("expected error %+v but got %+v", runner.ErrRestoreFailed, err)
+	}
+
+	if err := <-doneCh; !errors.Is(err, runner.ErrRestoreFailed) {
+		t.Errorf("expected Run to return %+v but got %+v", runner.ErrRestoreFailed, err)
+	}
+}
+
+func TestReload_waitsForInFlightInputs(t *testing.T) {
+	s := newChanSource()
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	reg := newRegistry()
+	reg.RegisterSource("chan", func() run.Source { return s })
+	reg.RegisterFn("gate", func() fn.Fn {
+		return &gateFn{prefixFn: &prefixFn{}, entered: entered, release: release}
+	})
+
+	r := runner.New(reg)
+	err := config.Configure(r, map[string]interface{}{
+		"source": "chan",
+		"fn":     map[string]interface{}{"gate": "old"},
+	})
+	if err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+
+	next := runner.New(reg)
+	err = config.Configure(next, map[string]interface{}{
+		"source": "chan",
+		"fn":     map[string]interface{}{"prefix": "new"},
+	})
+	if err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	go r.Run(ctx)
+	s.InputCh <- "in flight"
+	<-entered
+
+	reloadCh := make(chan error, 1)
+	go func() {
+		reloadCh <- r.Reload(ctx, next)
+	}()
+
+	select {
+	case <-reloadCh:
+		t.Fatal("expected Reload to wait for the in-flight input")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if got, want := <-s.OutputCh, "old: in flight"; got != want {
+		t.Errorf("unexpected output: want %q, got %q", want, got)
+	}
+	if err := <-reloadCh; err != nil {
+		t.Fatalf("Reload returned error: %+v", err)
+	}
+
+	s.InputCh <- "after"
+	if got, want := <-s.OutputCh, "new: after"; got != want {
+		t.Errorf("unexpected output: want %q, got %q", want, got)
+	}
+}
+
+func TestReload_closedRunner(t *testing.T) {
+	newRunner := func() *runner.Runner {
+		r := runner.New(newRegistry())
+		err := config.Configure(r, map[string]interface{}{
+			"source": map[string]interface{}{"cron": "@every 1s"},
+			"fn":     map[string]interface{}{"prefix": "p"},
+		})
+		if err != nil {
+			t.Fatalf("config.Configure returned error: %+v", err)
+		}
+		return r
+	}
+
+	r := newRunner()
+	r.Close()
+
+	err := r.Reload(context.Background(), newRunner())
+	if !errors.Is(err, runner.ErrClosed) {
+		t.Errorf("expected error %+v but got %+v", runner.ErrClosed, err)
+	}
+}
+
 // -----------------------------------------------------------------------------
 // Test components
 
@@ -357,6 +658,18 @@ func newPrefixFn() fn.Fn {
 	return &prefixFn{}
 }
 
+type gateFn struct {
+	*prefixFn
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (g *gateFn) Invoke(ctx context.Context, input interface{}) (interface{}, error) {
+	g.entered <- struct{}{}
+	<-g.release
+	return g.prefixFn.Invoke(ctx, input)
+}
+
 type wrapMiddleware struct {
 	name string
 }
@@ -404,6 +717,99 @@ func (c *chanSource) Serve(ctx context.Context, f fn.Fn) error {
 	}
 }
 
+type eventLog struct {
+	events []string
+	mutex  sync.Mutex
+}
+
+func (e *eventLog) add(event string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.events = append(e.events, event)
+}
+
+func (e *eventLog) get() []string {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return append([]string(nil), e.events...)
+}
+
+type lifecycleFn struct {
+	*prefixFn
+	events *eventLog
+}
+
+func (l *lifecycleFn) Start(context.Context) error {
+	l.events.add("fn started")
+	return nil
+}
+
+func (l *lifecycleFn) Close() error {
+	l.events.add("fn closed")
+	return nil
+}
+
+var errStartFailed = errors.New("start failed")
+
+type failingStartFn struct {
+	*prefixFn
+	events *eventLog
+}
+
+func (f *failingStartFn) Start(context.Context) error {
+	f.events.add("failing fn started")
+	return errStartFailed
+}
+
+func (f *failingStartFn) Close() error {
+	f.events.add("failing fn closed")
+	return nil
+}
+
+// startOnceFn fails to start after its first start.
+type startOnceFn struct {
+	*prefixFn
+	started bool
+}
+
+func (f *startOnceFn) Start(context.Context) error {
+	if f.started {
+		return errStartFailed
+	}
+	f.started = true
+	return nil
+}
+
+type lifecycleMiddleware struct {
+	*wrapMiddleware
+	events *eventLog
+}
+
+func (l *lifecycleMiddleware) Start(context.Context) error {
+	l.events.add("middleware started")
+	return nil
+}
+
+func (l *lifecycleMiddleware) Close() error {
+	l.events.add("middleware closed")
+	return nil
+}
+
+type lifecycleSource struct {
+	*chanSource
+	events *eventLog
+}
+
+func (l *lifecycleSource) Start(context.Context) error {
+	l.events.add("source started")
+	return nil
+}
+
+func (l *lifecycleSource) Close() error {
+	l.events.add("source closed")
+	return nil
+}
+
 func newChanSource() *chanSource {
 	return &chanSource{
 		InputCh:  make(chan interface{}, 1),
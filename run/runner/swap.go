@@ -0,0 +1,47 @@
+package runner
+
+import (
+	"context"
+	"sync"
+
+	"github.com/fnrun/fnrun/fn"
+)
+
+// generation is an fn along with the invocations of it that are in flight.
+type generation struct {
+	fn       fn.Fn
+	inflight sync.WaitGroup
+}
+
+// swapFn is an fn that delegates to another fn, which may be replaced while
+// it is being invoked.
+type swapFn struct {
+	mu      sync.RWMutex
+	current *generation
+}
+
+func (s *swapFn) Invoke(ctx context.Context, input interface{}) (interface{}, error) {
+	s.mu.RLock()
+	g := s.current
+	g.inflight.Add(1)
+	s.mu.RUnlock()
+
+	defer g.inflight.Done()
+	return g.fn.Invoke(ctx, input)
+}
+
+// replace holds new invocations, waits for the in-flight invocations of the
+// current fn to complete, and then makes the fn returned by replacement the
+// current fn. replacement is called with the fn it replaces while invocations
+// are held.
+func (s *swapFn) replace(replacement func(previous fn.Fn) fn.Fn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.current.inflight.Wait()
+	s.current = &generation{fn: replacement(s.current.fn)}
+}
+
+func newSwapFn(f fn.Fn) *swapFn {
+	return &swapFn{current: &generation{fn: f}}
+}
@@ -0,0 +1,89 @@
+// Package schema builds JSON Schema documents that describe the configuration
+// of the sources, middleware, and fns in a registry. Editors can use these
+// documents to validate and complete fnrun.yaml files.
+//
+// Components describe their own configuration by implementing
+// config.Describer. Components that select other components from the registry,
+// such as loaders and pools, refer to them with Ref so that each component is
+// described only once, in the `$defs` section of the document.
+package schema
+
+import (
+	"strings"
+
+	"github.com/fnrun/fnrun/run"
+	"github.com/fnrun/fnrun/run/config"
+)
+
+// Draft is the JSON Schema dialect of the documents returned by Document.
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Ref returns a reference to the definition of the component registered under
+// key within a document returned by Document.
+func Ref(key string) string {
+	key = strings.ReplaceAll(key, "~", "~0")
+	key = strings.ReplaceAll(key, "/", "~1")
+	return "#/$defs/" + key
+}
+
+// Components returns a Schema for a value that selects one of the components
+// registered under keys. The value may be either a string naming a component
+// that does not require configuration or a map with a single key naming the
+// component and whose value configures it.
+func Components(keys []string) *config.Schema {
+	names := make([]interface{}, len(keys))
+	properties := make(map[string]*config.Schema, len(keys))
+	for i, key := range keys {
+		names[i] = key
+		properties[key] = &config.Schema{Ref: Ref(key)}
+	}
+
+	return &config.Schema{
+		OneOf: []*config.Schema{
+			{
+				Type: "string",
+				Enum: names,
+			},
+			{
+				Type:                 "object",
+				Properties:           properties,
+				AdditionalProperties: config.NoAdditionalProperties(),
+				MinProperties:        1,
+				MaxProperties:        1,
+			},
+		},
+	}
+}
+
+// Describe returns the description of the configuration of the component
+// registered under key. Sources are searched first, then middleware, then fns.
+// Describe returns false if no component is registered under key.
+func Describe(registry run.Registry, key string) (*config.Schema, bool) {
+	if f, exists := registry.FindSource(key); exists {
+		return config.Describe(f()), true
+	}
+	if f, exists := registry.FindMiddleware(key); exists {
+		return config.Describe(f()), true
+	}
+	if f, exists := registry.FindFn(key); exists {
+		return config.Describe(f()), true
+	}
+	return nil, false
+}
+
+// Document returns a JSON Schema document whose root is described by root and
+// whose `$defs` section describes every component in registry.
+func Document(registry run.Registry, root *config.Schema) *config.Schema {
+	doc := *root
+	doc.SchemaURI = Draft
+	doc.Defs = make(map[string]*config.Schema)
+
+	for _, keys := range [][]string{registry.SourceKeys(), registry.MiddlewareKeys(), registry.FnKeys()} {
+		for _, key := range keys {
+			s, _ := Describe(registry, key)
+			doc.Defs[key] = s
+		}
+	}
+
+	return &doc
+}
@@ -0,0 +1,121 @@
+package schema_test
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/fnrun/fnrun/fn"
+	"github.com/fnrun/fnrun/run"
+	"github.com/fnrun/fnrun/run/config"
+	"github.com/fnrun/fnrun/run/schema"
+)
+
+func TestRef(t *testing.T) {
+	want := "#/$defs/fnrun.fn~1a~0b"
+	got := schema.Ref("fnrun.fn/a~b")
+	if got != want {
+		t.Errorf("unexpected ref: want %q, got %q", want, got)
+	}
+}
+
+func TestComponents(t *testing.T) {
+	s := schema.Components([]string{"a", "fnrun.fn/b"})
+
+	if len(s.OneOf) != 2 {
+		t.Fatalf("expected 2 alternatives but got %d", len(s.OneOf))
+	}
+
+	want := []interface{}{"a", "fnrun.fn/b"}
+	if got := s.OneOf[0].Enum; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected enum: want %v, got %v", want, got)
+	}
+
+	object := s.OneOf[1]
+	if object.MinProperties != 1 || object.MaxProperties != 1 {
+		t.Errorf("expected object to have exactly one property but got %+v", object)
+	}
+	if got := object.Properties["fnrun.fn/b"].Ref; got != "#/$defs/fnrun.fn~1b" {
+		t.Errorf("unexpected ref: %q", got)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	r := run.NewRegistry()
+	r.RegisterFn("described", newDescribedFn)
+	r.RegisterFn("undescribed", newUndescribedFn)
+
+	s, exists := schema.Describe(r, "described")
+	if !exists {
+		t.Fatal("expected described to exist")
+	}
+	if s.Type != "string" {
+		t.Errorf("unexpected type: want %q, got %q", "string", s.Type)
+	}
+
+	s, exists = schema.Describe(r, "undescribed")
+	if !exists {
+		t.Fatal("expected undescribed to exist")
+	}
+	if !reflect.DeepEqual(s, &config.Schema{}) {
+		t.Errorf("expected an empty schema but got %+v", s)
+	}
+
+	if _, exists := schema.Describe(r, "unknown"); exists {
+		t.Error("expected unknown not to exist")
+	}
+}
+
+func TestDocument(t *testing.T) {
+	r := run.NewRegistry()
+	r.RegisterFn("fnrun.fn/described", newDescribedFn)
+
+	doc := schema.Document(r, &config.Schema{
+		Type: "object",
+		Properties: map[string]*config.Schema{
+			"fn": {Ref: schema.Ref("fnrun.fn/described")},
+		},
+	})
+
+	b, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("json.Marshal returned error: %+v", err)
+	}
+
+	want := `{"$schema":"https://json-schema.org/draft/2020-12/schema","type":"object","properties":{"fn":{"$ref":"#/$defs/fnrun.fn~1described"}},"$defs":{"fnrun.fn/described":{"description":"An fn.","type":"string","default":"value"}}}`
+	if got := string(b); got != want {
+		t.Errorf("unexpected document:\nwant %s\ngot  %s", want, got)
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Test components
+
+type describedFn struct{}
+
+func (*describedFn) Invoke(ctx context.Context, input interface{}) (interface{}, error) {
+	return input, nil
+}
+
+func (*describedFn) Describe() *config.Schema {
+	return &config.Schema{
+		Description: "An fn.",
+		Type:        "string",
+		Default:     "value",
+	}
+}
+
+func newDescribedFn() fn.Fn {
+	return &describedFn{}
+}
+
+type undescribedFn struct{}
+
+func (*undescribedFn) Invoke(ctx context.Context, input interface{}) (interface{}, error) {
+	return input, nil
+}
+
+func newUndescribedFn() fn.Fn {
+	return &undescribedFn{}
+}
@@ -0,0 +1,74 @@
+package servicebus
+
+import (
+	"context"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+)
+
+// entity is a queue or topic subscription that the source receives messages
+// from.
+type entity interface {
+	servicebus.ReceiveOner
+	RenewLocks(ctx context.Context, messages ...*servicebus.Message) error
+	NewDeadLetter() *servicebus.DeadLetter
+
+	// newSession returns a receiver for the next available session of the
+	// entity.
+	newSession() sessionReceiver
+}
+
+// sessionReceiver receives the messages of a single session of an entity.
+type sessionReceiver interface {
+	ReceiveOne(ctx context.Context, handler servicebus.SessionHandler) error
+	Close(ctx context.Context) error
+}
+
+type queueEntity struct {
+	*servicebus.Queue
+}
+
+func (q queueEntity) newSession() sessionReceiver {
+	return q.NewSession(nil)
+}
+
+type subscriptionEntity struct {
+	*servicebus.Subscription
+}
+
+func (s subscriptionEntity) newSession() sessionReceiver {
+	return s.NewSession(nil)
+}
+
+// newEntity returns the queue or topic subscription named by the configuration
+// of the source.
+func (q *queueSource) newEntity(ns *servicebus.Namespace) (entity, error) {
+	if q.QueueName != "" {
+		var opts []servicebus.QueueOption
+		if q.PrefetchCount > 0 {
+			opts = append(opts, servicebus.QueueWithPrefetchCount(uint32(q.PrefetchCount)))
+		}
+
+		queue, err := ns.NewQueue(q.QueueName, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return queueEntity{queue}, nil
+	}
+
+	topic, err := ns.NewTopic(q.TopicName)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []servicebus.SubscriptionOption
+	if q.PrefetchCount > 0 {
+		opts = append(opts, servicebus.SubscriptionWithPrefetchCount(uint32(q.PrefetchCount)))
+	}
+
+	subscription, err := topic.NewSubscription(q.SubscriptionName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return subscriptionEntity{subscription}, nil
+}
@@ -0,0 +1,118 @@
+package servicebus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+	"github.com/fnrun/fnrun/run/config"
+)
+
+// The actions a failurePolicy may take when the fn returns an error for a
+// message.
+const (
+	actionAbandon    = "abandon"
+	actionDeadLetter = "deadLetter"
+	actionDefer      = "defer"
+)
+
+// The keys of the error info that Service Bus records as the reason and
+// description of a dead-lettered message.
+const (
+	infoDeadLetterReason      = "DeadLetterReason"
+	infoDeadLetterDescription = "DeadLetterErrorDescription"
+)
+
+// settler is the part of a servicebus.Message used to settle it once the fn
+// returns.
+type settler interface {
+	Complete(ctx context.Context) error
+	Abandon(ctx context.Context) error
+	Defer(ctx context.Context) error
+	DeadLetterWithInfo(ctx context.Context, err error, condition servicebus.MessageErrorCondition, additionalData map[string]string) error
+}
+
+// failurePolicy describes how the source settles a message when the fn returns
+// an error for it.
+type failurePolicy struct {
+	Action      string
+	Reason      string
+	Description string
+}
+
+func (p *failurePolicy) Validate() error {
+	switch p.Action {
+	case actionAbandon, actionDefer:
+	case actionDeadLetter:
+		if p.Reason == "" {
+			return config.WithPath("reason", errors.New("reason is required when action is deadLetter"))
+		}
+	default:
+		return config.WithPath("action", fmt.Errorf("unknown action %q", p.Action))
+	}
+	return nil
+}
+
+// Describe describes the configuration of a failurePolicy.
+func (*failurePolicy) Describe() *config.Schema {
+	return &config.Schema{
+		Description: "What to do with a message when the fn returns an error for it.",
+		Type:        "object",
+		Properties: map[string]*config.Schema{
+			"action": {
+				Type: "string",
+				Description: "With abandon, the lock on the message is released so that it is delivered again. " +
+					"With deadLetter, the message is moved to the dead-letter queue with reason and description. " +
+					"With defer, the message is set aside and can only be received again by its SequenceNumber.",
+				Enum:    []interface{}{actionAbandon, actionDeadLetter, actionDefer},
+				Default: actionAbandon,
+			},
+			"reason": {
+				Type:        "string",
+				Description: "The dead-letter reason of the message when action is deadLetter.",
+				Default:     "InvocationFailed",
+			},
+			"description": {
+				Type:        "string",
+				Description: "The dead-letter description of the message when action is deadLetter. The error returned by the fn is used if it is empty.",
+			},
+		},
+		AdditionalProperties: config.NoAdditionalProperties(),
+	}
+}
+
+// settle completes msg if err is nil and applies the action of the policy
+// otherwise.
+func (p *failurePolicy) settle(ctx context.Context, msg settler, err error) error {
+	if err == nil {
+		return msg.Complete(ctx)
+	}
+
+	switch p.Action {
+	case actionDeadLetter:
+		log.Printf("Dead-lettering due to error: %+v\n", err)
+		description := p.Description
+		if description == "" {
+			description = err.Error()
+		}
+		return msg.DeadLetterWithInfo(ctx, err, servicebus.ErrorInternalError, map[string]string{
+			infoDeadLetterReason:      p.Reason,
+			infoDeadLetterDescription: description,
+		})
+	case actionDefer:
+		log.Printf("Deferring due to error: %+v\n", err)
+		return msg.Defer(ctx)
+	default:
+		log.Printf("Abandoning due to error: %+v\n", err)
+		return msg.Abandon(ctx)
+	}
+}
+
+func newFailurePolicy() failurePolicy {
+	return failurePolicy{
+		Action: actionAbandon,
+		Reason: "InvocationFailed",
+	}
+}
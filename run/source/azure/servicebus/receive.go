@@ -0,0 +1,119 @@
+package servicebus
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+	"github.com/fnrun/fnrun/fn"
+)
+
+// renewFunc renews the locks on messages.
+type renewFunc func(ctx context.Context, messages ...*servicebus.Message) error
+
+// serveMessages receives messages from r and handles up to MaxConcurrentCalls
+// of them at a time, renewing their locks with renew unless it is nil. When
+// ctx is done, it stops receiving and waits for the messages being handled.
+func (q *queueSource) serveMessages(ctx context.Context, r servicebus.ReceiveOner, f fn.Fn, renew renewFunc) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	slots := make(chan struct{}, q.MaxConcurrentCalls)
+	for {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		received := false
+		err := r.ReceiveOne(ctx, servicebus.HandlerFunc(func(ctx context.Context, msg *servicebus.Message) error {
+			received = true
+			wg.Add(1)
+			go func() {
+				defer func() {
+					<-slots
+					wg.Done()
+				}()
+
+				var renewMessage func(context.Context) error
+				if renew != nil {
+					renewMessage = func(ctx context.Context) error {
+						return renew(ctx, msg)
+					}
+				}
+
+				if err := q.handle(context.WithoutCancel(ctx), msg, f, renewMessage); err != nil {
+					log.Printf("Error settling message: %+v\n", err)
+				}
+			}()
+			return nil
+		}))
+		if !received {
+			<-slots
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// handle invokes f with msg and settles msg according to the result. While f
+// runs, renew is called every AutoRenewLockInterval to keep msg locked, and f
+// is cancelled if the lock cannot be renewed.
+func (q *queueSource) handle(ctx context.Context, msg *servicebus.Message, f fn.Fn, renew func(context.Context) error) error {
+	invokeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stop := q.renewLock(invokeCtx, cancel, renew)
+	_, err := f.Invoke(invokeCtx, newInputFromMessage(msg))
+	stop()
+
+	var s settler = msg
+	if q.settlerOf != nil {
+		s = q.settlerOf(msg)
+	}
+	return q.OnError.settle(ctx, s, err)
+}
+
+// renewLock calls renew every AutoRenewLockInterval in a goroutine until the
+// returned function is called, which waits for the goroutine to exit. If the
+// lock cannot be renewed, it calls cancel and stops renewing.
+func (q *queueSource) renewLock(ctx context.Context, cancel context.CancelFunc, renew func(context.Context) error) func() {
+	if renew == nil || q.AutoRenewLockInterval <= 0 {
+		return func() {}
+	}
+
+	ctx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(q.AutoRenewLockInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := renew(ctx); err != nil {
+					if ctx.Err() == nil {
+						log.Printf("Error renewing lock: %+v\n", err)
+						cancel()
+					}
+					return
+				}
+			}
+		}
+	}()
+
+	return func() {
+		stop()
+		<-done
+	}
+}
@@ -0,0 +1,260 @@
+package servicebus
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+	"github.com/fnrun/fnrun/fn"
+)
+
+// fakeReceiver hands the messages sent to its messages channel to the handler
+// passed to ReceiveOne. When no message is ready, ReceiveOne blocks until its
+// context is cancelled.
+type fakeReceiver struct {
+	messages chan *servicebus.Message
+}
+
+func (r *fakeReceiver) ReceiveOne(ctx context.Context, handler servicebus.Handler) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case msg := <-r.messages:
+		return handler.Handle(ctx, msg)
+	}
+}
+
+func (r *fakeReceiver) Close(context.Context) error {
+	return nil
+}
+
+// settlements records how each message was settled, by message ID.
+type settlements struct {
+	mu   sync.Mutex
+	byID map[string]*recordingSettler
+}
+
+func (s *settlements) settlerOf(msg *servicebus.Message) settler {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.byID == nil {
+		s.byID = map[string]*recordingSettler{}
+	}
+	r := &recordingSettler{}
+	s.byID[msg.ID] = r
+	return r
+}
+
+func (s *settlements) settled(id string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r, ok := s.byID[id]; ok {
+		return r.settled
+	}
+	return ""
+}
+
+func newTestSource(s *settlements) *queueSource {
+	q := New().(*queueSource)
+	q.settlerOf = s.settlerOf
+	return q
+}
+
+func serveInBackground(ctx context.Context, q *queueSource, r servicebus.ReceiveOner, f fn.Fn, renew renewFunc) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- q.serveMessages(ctx, r, f, renew)
+	}()
+	return done
+}
+
+func TestServeMessages_maxConcurrentCalls(t *testing.T) {
+	var s settlements
+	q := newTestSource(&s)
+	q.MaxConcurrentCalls = 3
+
+	var inFlight, maxInFlight int32
+	release := make(chan struct{})
+	f := fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(&inFlight, -1)
+		return nil, nil
+	})
+
+	r := &fakeReceiver{messages: make(chan *servicebus.Message, 6)}
+	for i := 0; i < 6; i++ {
+		r.messages <- &servicebus.Message{ID: strconv.Itoa(i)}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := serveInBackground(ctx, q, r, f, nil)
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&inFlight) < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if got := len(r.messages); got != 3 {
+		t.Errorf("expected 3 messages to wait for a free call, got %d", got)
+	}
+
+	close(release)
+	for len(r.messages) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected serveMessages to return context.Canceled, got %+v", err)
+	}
+
+	if got := atomic.LoadInt32(&maxInFlight); got != 3 {
+		t.Errorf("expected at most 3 concurrent calls, got %d", got)
+	}
+	for i := 0; i < 6; i++ {
+		if got := s.settled(strconv.Itoa(i)); got != "complete" {
+			t.Errorf("expected message %d to be completed, got %q", i, got)
+		}
+	}
+}
+
+func TestServeMessages_drainsOnCancel(t *testing.T) {
+	var s settlements
+	q := newTestSource(&s)
+	q.MaxConcurrentCalls = 2
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var invokeErr error
+	f := fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		close(started)
+		<-release
+		invokeErr = ctx.Err()
+		return nil, nil
+	})
+
+	r := &fakeReceiver{messages: make(chan *servicebus.Message, 1)}
+	r.messages <- &servicebus.Message{ID: "a"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := serveInBackground(ctx, q, r, f, nil)
+
+	<-started
+	cancel()
+
+	select {
+	case err := <-done:
+		t.Fatalf("serveMessages returned before the in-flight message was handled: %+v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected serveMessages to return context.Canceled, got %+v", err)
+	}
+	if invokeErr != nil {
+		t.Errorf("expected the invocation not to be cancelled, got %+v", invokeErr)
+	}
+	if got := s.settled("a"); got != "complete" {
+		t.Errorf("expected the in-flight message to be completed, got %q", got)
+	}
+}
+
+func TestServeMessages_renewsEachMessage(t *testing.T) {
+	var s settlements
+	q := newTestSource(&s)
+	q.MaxConcurrentCalls = 2
+	q.AutoRenewLockInterval = 5 * time.Millisecond
+
+	var mu sync.Mutex
+	renewals := map[string]int{}
+	renew := func(ctx context.Context, messages ...*servicebus.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, msg := range messages {
+			renewals[msg.ID]++
+		}
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	f := fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		wg.Done()
+		time.Sleep(30 * time.Millisecond)
+		return nil, nil
+	})
+
+	r := &fakeReceiver{messages: make(chan *servicebus.Message, 2)}
+	r.messages <- &servicebus.Message{ID: "a"}
+	r.messages <- &servicebus.Message{ID: "b"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := serveInBackground(ctx, q, r, f, renew)
+	wg.Wait()
+	cancel()
+	<-done
+
+	count := func() (int, int) {
+		mu.Lock()
+		defer mu.Unlock()
+		return renewals["a"], renewals["b"]
+	}
+
+	a, b := count()
+	if a < 2 || b < 2 {
+		t.Errorf("expected the lock on each message to be renewed while it was handled, got %d and %d renewals", a, b)
+	}
+
+	// No renewal may happen once the messages have been settled.
+	time.Sleep(20 * time.Millisecond)
+	if gotA, gotB := count(); gotA != a || gotB != b {
+		t.Errorf("expected renewals to stop after the messages were handled, got %d more", gotA+gotB-a-b)
+	}
+}
+
+func TestServeMessages_renewFailureCancelsInvocation(t *testing.T) {
+	var s settlements
+	q := newTestSource(&s)
+	q.AutoRenewLockInterval = 5 * time.Millisecond
+
+	renew := func(ctx context.Context, messages ...*servicebus.Message) error {
+		return errors.New("lock lost")
+	}
+
+	f := fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	r := &fakeReceiver{messages: make(chan *servicebus.Message, 1)}
+	r.messages <- &servicebus.Message{ID: "a"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := serveInBackground(ctx, q, r, f, renew)
+
+	// serveMessages waits for the message to be handled, which only happens
+	// once its invocation is cancelled.
+	for len(r.messages) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if got := s.settled("a"); got != actionAbandon {
+		t.Errorf("expected the message to be abandoned after its lock was lost, got %q", got)
+	}
+}
@@ -1,32 +1,86 @@
 // Package servicebus provides an fnrun source that reads messages from an Azure
-// servicebus queue or DLQ. It will complete or abandon messages based on
-// whether the fn runs successfully.
+// servicebus queue or topic subscription, or from its DLQ. It will complete
+// messages when the fn runs successfully and settle them according to its
+// `onError` policy otherwise, abandoning them by default. Failed messages may
+// instead be dead-lettered with a reason and description, or deferred.
+//
+// The input of the fn contains the ContentType, Data, MessageID,
+// CorrelationID, UserProperties, DeliveryCount, EnqueuedTime, SessionID and
+// SequenceNumber of each message. SequenceNumber is needed to receive a
+// deferred message again.
+//
+// The source handles up to `maxConcurrentCalls` messages at a time, and the
+// receiver requests up to `prefetchCount` messages ahead of time. While the fn
+// runs, the lock on each message is renewed every `autoRenewLockInterval`; if
+// a lock cannot be renewed, the invocation for that message is cancelled. When
+// the context of Serve is cancelled, the source stops receiving and finishes
+// handling the messages it has received.
+//
+// If `sessions` is set, the source receives from a session-enabled queue or
+// subscription. It takes the lock on up to `maxConcurrentCalls` sessions at a
+// time and processes the messages of each session in order, moving on to the
+// next available session once no message has arrived for
+// `sessionIdleTimeout`. While the fn runs, the lock on the session is renewed
+// every `autoRenewLockInterval` instead of the lock on the message.
 package servicebus
 
 import (
 	"context"
 	"errors"
-	"log"
 	"time"
 
 	servicebus "github.com/Azure/azure-service-bus-go"
 	"github.com/fnrun/fnrun/fn"
 	"github.com/fnrun/fnrun/run"
+	"github.com/fnrun/fnrun/run/config"
 	"github.com/mitchellh/mapstructure"
 )
 
 func newInputFromMessage(msg *servicebus.Message) map[string]interface{} {
-	return map[string]interface{}{
-		"ContentType": msg.ContentType,
-		"Data":        string(msg.Data),
+	userProperties := msg.UserProperties
+	if userProperties == nil {
+		userProperties = map[string]interface{}{}
 	}
+
+	input := map[string]interface{}{
+		"ContentType":    msg.ContentType,
+		"Data":           string(msg.Data),
+		"MessageID":      msg.ID,
+		"CorrelationID":  msg.CorrelationID,
+		"UserProperties": userProperties,
+		"DeliveryCount":  int(msg.DeliveryCount),
+		"SessionID":      "",
+	}
+	if msg.SessionID != nil {
+		input["SessionID"] = *msg.SessionID
+	}
+	if sp := msg.SystemProperties; sp != nil {
+		if sp.EnqueuedTime != nil {
+			input["EnqueuedTime"] = sp.EnqueuedTime.Format(time.RFC3339Nano)
+		}
+		if sp.SequenceNumber != nil {
+			input["SequenceNumber"] = *sp.SequenceNumber
+		}
+	}
+	return input
 }
 
 type queueSource struct {
 	ServiceBusConnStr     string        `mapstructure:"connectionString"`
 	QueueName             string        `mapstructure:"queueName"`
+	TopicName             string        `mapstructure:"topicName"`
+	SubscriptionName      string        `mapstructure:"subscriptionName"`
 	IsDeadLetterReceiver  bool          `mapstructure:"isDeadLetterReceiver"`
+	Sessions              bool          `mapstructure:"sessions"`
+	SessionIdleTimeout    time.Duration `mapstructure:"sessionIdleTimeout"`
 	AutoRenewLockInterval time.Duration `mapstructure:"autoRenewLockInterval"`
+	MaxConcurrentCalls    int           `mapstructure:"maxConcurrentCalls"`
+	PrefetchCount         int           `mapstructure:"prefetchCount"`
+	OnError               failurePolicy `mapstructure:"onError"`
+
+	// settlerOf returns the settler of a message in tests. Messages settle
+	// themselves if it is nil.
+	settlerOf func(*servicebus.Message) settler
 }
 
 func (q *queueSource) RequiresConfig() bool {
@@ -34,103 +88,45 @@ func (q *queueSource) RequiresConfig() bool {
 }
 
 func (q *queueSource) ConfigureMap(configMap map[string]interface{}) error {
-	decoderConfig := &mapstructure.DecoderConfig{
-		Metadata:   nil,
-		Result:     q,
-		DecodeHook: mapstructure.StringToTimeDurationHookFunc(),
+	return config.Decode(configMap, q, mapstructure.StringToTimeDurationHookFunc())
+}
+
+func (q *queueSource) Validate() error {
+	if q.ServiceBusConnStr == "" {
+		return config.WithPath("connectionString", errors.New("connectionString is required"))
 	}
-	decoder, err := mapstructure.NewDecoder(decoderConfig)
-	if err != nil {
-		return err
+	switch {
+	case q.QueueName == "" && q.TopicName == "":
+		return config.WithPath("queueName", errors.New("queueName or topicName is required"))
+	case q.QueueName != "" && q.TopicName != "":
+		return config.WithPath("topicName", errors.New("queueName cannot be combined with topicName"))
+	case q.TopicName != "" && q.SubscriptionName == "":
+		return config.WithPath("subscriptionName", errors.New("subscriptionName is required with topicName"))
+	case q.QueueName != "" && q.SubscriptionName != "":
+		return config.WithPath("subscriptionName", errors.New("subscriptionName cannot be combined with queueName"))
 	}
-
-	err = decoder.Decode(configMap)
-	if err != nil {
-		return err
+	if q.Sessions && q.IsDeadLetterReceiver {
+		return config.WithPath("sessions", errors.New("sessions cannot be combined with isDeadLetterReceiver"))
 	}
-
-	if q.ServiceBusConnStr == "" {
-		return errors.New("expected connection string to have a value")
+	if q.Sessions && q.SessionIdleTimeout <= 0 {
+		return config.WithPath("sessionIdleTimeout", errors.New("sessionIdleTimeout must be positive"))
 	}
-	if q.QueueName == "" {
-		return errors.New("expected queue name to be set")
+	if q.AutoRenewLockInterval < 0 {
+		return config.WithPath("autoRenewLockInterval", errors.New("autoRenewLockInterval must not be negative"))
 	}
-
-	return nil
-}
-
-func (q *queueSource) serveQueue(ctx context.Context, queue *servicebus.Queue, f fn.Fn) error {
-	for {
-		err := queue.ReceiveOne(ctx, servicebus.HandlerFunc(func(ctx context.Context, msg *servicebus.Message) error {
-			newCtx, cancel := context.WithCancel(ctx)
-			running := true
-
-			go func() {
-				if q.AutoRenewLockInterval.String() != "0s" {
-					for running {
-						time.Sleep(q.AutoRenewLockInterval)
-
-						err := queue.RenewLocks(newCtx, msg)
-
-						if err != nil && running {
-							log.Printf("error renewing lock: %+v\n", err)
-							cancel()
-						}
-					}
-				}
-			}()
-
-			_, err := f.Invoke(newCtx, newInputFromMessage(msg))
-			running = false
-
-			if err != nil {
-				log.Printf("Abandoning due to error: %+v\n", err)
-				if err = msg.Abandon(newCtx); err != nil {
-					return err
-				}
-			} else {
-				if err = msg.Complete(newCtx); err != nil {
-					return err
-				}
-			}
-
-			return nil
-		}))
-
-		if err != nil {
-			return err
-		}
+	if q.MaxConcurrentCalls < 1 {
+		return config.WithPath("maxConcurrentCalls", errors.New("maxConcurrentCalls must be at least 1"))
 	}
-}
-
-func (q *queueSource) serveDLQ(ctx context.Context, queue *servicebus.Queue, f fn.Fn) error {
-	dlq := queue.NewDeadLetter()
-	defer func() {
-		dlq.Close(ctx)
-	}()
-
-	for {
-		err := dlq.ReceiveOne(ctx, servicebus.HandlerFunc(func(ctx context.Context, msg *servicebus.Message) error {
-			_, err := f.Invoke(ctx, newInputFromMessage(msg))
-
-			if err != nil {
-				log.Printf("Abandoning due to error: %+v\n", err)
-				if err = msg.Abandon(ctx); err != nil {
-					log.Printf("Error abandoning message: %+v\n", err)
-				}
-			} else {
-				if err = msg.Complete(ctx); err != nil {
-					log.Printf("Error completing message: %+v\n", err)
-				}
-			}
-
-			return nil
-		}))
-
-		if err != nil {
-			return err
-		}
+	if q.PrefetchCount < 0 {
+		return config.WithPath("prefetchCount", errors.New("prefetchCount must not be negative"))
+	}
+	if err := q.OnError.Validate(); err != nil {
+		return config.WithPath("onError", err)
+	}
+	if q.IsDeadLetterReceiver && q.OnError.Action == actionDeadLetter {
+		return config.WithPath("isDeadLetterReceiver", errors.New("isDeadLetterReceiver cannot be combined with onError action deadLetter"))
 	}
+	return nil
 }
 
 func (q *queueSource) Serve(ctx context.Context, f fn.Fn) error {
@@ -139,24 +135,96 @@ func (q *queueSource) Serve(ctx context.Context, f fn.Fn) error {
 		return err
 	}
 
-	queue, err := ns.NewQueue(q.QueueName)
+	e, err := q.newEntity(ns)
 	if err != nil {
 		return err
 	}
 	defer func() {
-		_ = queue.Close(ctx)
+		_ = e.Close(context.WithoutCancel(ctx))
 	}()
 
-	if q.IsDeadLetterReceiver {
-		return q.serveDLQ(ctx, queue, f)
+	switch {
+	case q.IsDeadLetterReceiver:
+		dlq := e.NewDeadLetter()
+		defer func() {
+			_ = dlq.Close(context.WithoutCancel(ctx))
+		}()
+		return q.serveMessages(ctx, dlq, f, nil)
+	case q.Sessions:
+		return q.serveSessions(ctx, e, f)
 	}
 
-	return q.serveQueue(ctx, queue, f)
+	return q.serveMessages(ctx, e, f, e.RenewLocks)
+}
+
+// Describe describes the configuration of the servicebus source.
+func (*queueSource) Describe() *config.Schema {
+	return &config.Schema{
+		Description: "Receives messages from an Azure Service Bus queue or topic subscription, completing them when the fn succeeds and settling them according to onError otherwise.",
+		Type:        "object",
+		Properties: map[string]*config.Schema{
+			"connectionString": {
+				Type:        "string",
+				Description: "The Service Bus connection string.",
+			},
+			"queueName": {
+				Type:        "string",
+				Description: "The name of the queue. Either queueName or topicName is required.",
+			},
+			"topicName": {
+				Type:        "string",
+				Description: "The name of the topic. It requires subscriptionName.",
+			},
+			"subscriptionName": {
+				Type:        "string",
+				Description: "The name of the subscription of the topic.",
+			},
+			"isDeadLetterReceiver": {
+				Type:        "boolean",
+				Description: "Whether to receive messages from the dead-letter queue of the queue or subscription.",
+				Default:     false,
+			},
+			"sessions": {
+				Type:        "boolean",
+				Description: "Whether the queue or subscription requires sessions. The messages of each session are processed in order, one session at a time.",
+				Default:     false,
+			},
+			"sessionIdleTimeout": {
+				Type:        "string",
+				Description: "How long to wait for the next message of a session before moving on to the next available session, as a Go duration string.",
+				Default:     "1m",
+			},
+			"autoRenewLockInterval": {
+				Type:        "string",
+				Description: "How often message or session locks are renewed while the fn runs, as a Go duration string. Locks are not renewed if it is 0.",
+				Default:     "0s",
+			},
+			"maxConcurrentCalls": {
+				Type:        "integer",
+				Description: "The maximum number of messages handled at a time. With sessions, it is the maximum number of sessions handled at a time, each of which is processed in order.",
+				Minimum:     config.Minimum(1),
+				Default:     1,
+			},
+			"prefetchCount": {
+				Type:        "integer",
+				Description: "The number of messages the receiver requests ahead of time. Prefetched messages are locked while they wait to be handled, so it should be low enough for them to be handled before their locks expire. Service Bus does not prefetch messages if it is 0.",
+				Minimum:     config.Minimum(0),
+				Default:     0,
+			},
+			"onError": config.Describe(&failurePolicy{}),
+		},
+		Required:             []string{"connectionString"},
+		AdditionalProperties: config.NoAdditionalProperties(),
+	}
 }
 
 // New returns as servicebus source with default values. The resulting value
-// must be configured with at least a connection string and queue name before
-// calling Serve.
+// must be configured with at least a connection string and a queue name or
+// topic and subscription names before calling Serve.
 func New() run.Source {
-	return &queueSource{}
+	return &queueSource{
+		SessionIdleTimeout: time.Minute,
+		MaxConcurrentCalls: 1,
+		OnError:            newFailurePolicy(),
+	}
 }
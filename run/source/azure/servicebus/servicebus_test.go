@@ -0,0 +1,182 @@
+package servicebus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+	"github.com/Azure/go-amqp"
+	"github.com/fnrun/fnrun/run/config"
+)
+
+// recordingSettler records how a message was settled.
+type recordingSettler struct {
+	settled   string
+	condition servicebus.MessageErrorCondition
+	info      map[string]string
+}
+
+func (s *recordingSettler) Complete(context.Context) error {
+	s.settled = "complete"
+	return nil
+}
+
+func (s *recordingSettler) Abandon(context.Context) error {
+	s.settled = actionAbandon
+	return nil
+}
+
+func (s *recordingSettler) Defer(context.Context) error {
+	s.settled = actionDefer
+	return nil
+}
+
+func (s *recordingSettler) DeadLetterWithInfo(_ context.Context, _ error, condition servicebus.MessageErrorCondition, info map[string]string) error {
+	s.settled = actionDeadLetter
+	s.condition = condition
+	s.info = info
+	return nil
+}
+
+func TestSettle(t *testing.T) {
+	fnErr := errors.New("boom")
+
+	tests := []struct {
+		policy failurePolicy
+		err    error
+		want   recordingSettler
+	}{
+		{policy: newFailurePolicy(), want: recordingSettler{settled: "complete"}},
+		{policy: newFailurePolicy(), err: fnErr, want: recordingSettler{settled: actionAbandon}},
+		{policy: failurePolicy{Action: actionDefer}, err: fnErr, want: recordingSettler{settled: actionDefer}},
+		{
+			policy: failurePolicy{Action: actionDeadLetter, Reason: "InvalidOrder"},
+			err:    fnErr,
+			want: recordingSettler{
+				settled:   actionDeadLetter,
+				condition: servicebus.ErrorInternalError,
+				info:      map[string]string{infoDeadLetterReason: "InvalidOrder", infoDeadLetterDescription: "boom"},
+			},
+		},
+		{
+			policy: failurePolicy{Action: actionDeadLetter, Reason: "InvalidOrder", Description: "order could not be processed"},
+			err:    fnErr,
+			want: recordingSettler{
+				settled:   actionDeadLetter,
+				condition: servicebus.ErrorInternalError,
+				info:      map[string]string{infoDeadLetterReason: "InvalidOrder", infoDeadLetterDescription: "order could not be processed"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		var got recordingSettler
+		if err := test.policy.settle(context.Background(), &got, test.err); err != nil {
+			t.Fatalf("settle returned an error: %+v", err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("unexpected settlement for %+v: want %+v, got %+v", test.policy, test.want, got)
+		}
+	}
+}
+
+func TestNewInputFromMessage(t *testing.T) {
+	sessionID := "customer-1"
+	enqueued := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	sequenceNumber := int64(42)
+
+	msg := &servicebus.Message{
+		ContentType:    "application/json",
+		CorrelationID:  "correlation",
+		Data:           []byte(`{"order":1}`),
+		DeliveryCount:  3,
+		SessionID:      &sessionID,
+		ID:             "message",
+		UserProperties: map[string]interface{}{"tenant": "acme"},
+		SystemProperties: &servicebus.SystemProperties{
+			EnqueuedTime:   &enqueued,
+			SequenceNumber: &sequenceNumber,
+		},
+	}
+
+	want := map[string]interface{}{
+		"ContentType":    "application/json",
+		"Data":           `{"order":1}`,
+		"MessageID":      "message",
+		"CorrelationID":  "correlation",
+		"UserProperties": map[string]interface{}{"tenant": "acme"},
+		"DeliveryCount":  3,
+		"SessionID":      "customer-1",
+		"EnqueuedTime":   "2021-03-04T05:06:07Z",
+		"SequenceNumber": int64(42),
+	}
+	if got := newInputFromMessage(msg); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+}
+
+func TestNewInputFromMessage_minimal(t *testing.T) {
+	want := map[string]interface{}{
+		"ContentType":    "",
+		"Data":           "hello",
+		"MessageID":      "",
+		"CorrelationID":  "",
+		"UserProperties": map[string]interface{}{},
+		"DeliveryCount":  0,
+		"SessionID":      "",
+	}
+	if got := newInputFromMessage(&servicebus.Message{Data: []byte("hello")}); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+}
+
+func TestIsNoSessionAvailable(t *testing.T) {
+	timeout := &amqp.Error{Condition: conditionTimeout}
+	if !isNoSessionAvailable(fmt.Errorf("creating receiver: %w", timeout)) {
+		t.Error("expected a timeout to mean that no session is available")
+	}
+	if isNoSessionAvailable(&amqp.Error{Condition: "amqp:unauthorized-access"}) {
+		t.Error("expected an unauthorized error not to mean that no session is available")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	conn := "Endpoint=sb://example.servicebus.windows.net/;SharedAccessKeyName=key;SharedAccessKey=secret"
+
+	tests := []struct {
+		configMap map[string]interface{}
+		want      string
+	}{
+		{configMap: map[string]interface{}{"connectionString": conn, "queueName": "orders"}},
+		{configMap: map[string]interface{}{"connectionString": conn, "queueName": "orders", "maxConcurrentCalls": 16, "prefetchCount": 32}},
+		{configMap: map[string]interface{}{"connectionString": conn, "topicName": "orders", "subscriptionName": "billing", "sessions": true}},
+		{configMap: map[string]interface{}{"connectionString": conn, "queueName": "orders", "onError": map[string]interface{}{"action": "deadLetter"}}},
+		{configMap: map[string]interface{}{"queueName": "orders"}, want: "connectionString: connectionString is required"},
+		{configMap: map[string]interface{}{"connectionString": conn}, want: "queueName: queueName or topicName is required"},
+		{configMap: map[string]interface{}{"connectionString": conn, "queueName": "orders", "topicName": "orders"}, want: "topicName: queueName cannot be combined with topicName"},
+		{configMap: map[string]interface{}{"connectionString": conn, "topicName": "orders"}, want: "subscriptionName: subscriptionName is required with topicName"},
+		{configMap: map[string]interface{}{"connectionString": conn, "queueName": "orders", "sessions": true, "isDeadLetterReceiver": true}, want: "sessions: sessions cannot be combined with isDeadLetterReceiver"},
+		{configMap: map[string]interface{}{"connectionString": conn, "queueName": "orders", "sessions": true, "sessionIdleTimeout": "0s"}, want: "sessionIdleTimeout: sessionIdleTimeout must be positive"},
+		{configMap: map[string]interface{}{"connectionString": conn, "queueName": "orders", "maxConcurrentCalls": 0}, want: "maxConcurrentCalls: maxConcurrentCalls must be at least 1"},
+		{configMap: map[string]interface{}{"connectionString": conn, "queueName": "orders", "prefetchCount": -1}, want: "prefetchCount: prefetchCount must not be negative"},
+		{configMap: map[string]interface{}{"connectionString": conn, "queueName": "orders", "onError": map[string]interface{}{"action": "drop"}}, want: `onError.action: unknown action "drop"`},
+		{configMap: map[string]interface{}{"connectionString": conn, "queueName": "orders", "onError": map[string]interface{}{"action": "deadLetter", "reason": ""}}, want: "onError.reason: reason is required when action is deadLetter"},
+		{configMap: map[string]interface{}{"connectionString": conn, "queueName": "orders", "isDeadLetterReceiver": true, "onError": map[string]interface{}{"action": "deadLetter"}}, want: "isDeadLetterReceiver: isDeadLetterReceiver cannot be combined with onError action deadLetter"},
+	}
+
+	for _, test := range tests {
+		err := config.Configure(New(), test.configMap)
+
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != test.want {
+			t.Errorf("unexpected error for %v: want %q, got %q", test.configMap, test.want, got)
+		}
+	}
+}
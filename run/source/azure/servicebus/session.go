@@ -0,0 +1,129 @@
+package servicebus
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+	"github.com/Azure/go-amqp"
+	"github.com/fnrun/fnrun/fn"
+)
+
+// conditionTimeout is the condition of the error Service Bus returns when no
+// session becomes available while a session receiver is being created.
+const conditionTimeout amqp.ErrorCondition = "com.microsoft:timeout"
+
+func isNoSessionAvailable(err error) bool {
+	var amqpErr *amqp.Error
+	return errors.As(err, &amqpErr) && amqpErr.Condition == conditionTimeout
+}
+
+// serveSessions handles up to MaxConcurrentCalls sessions of e at a time,
+// processing the messages of each session in order. When ctx is done, it
+// waits for the messages being handled.
+func (q *queueSource) serveSessions(ctx context.Context, e entity, f fn.Fn) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, q.MaxConcurrentCalls)
+	for i := 0; i < q.MaxConcurrentCalls; i++ {
+		go func() {
+			err := q.serveNextSessions(ctx, e, f)
+			cancel()
+			errs <- err
+		}()
+	}
+
+	var err error
+	for i := 0; i < q.MaxConcurrentCalls; i++ {
+		if sessionErr := <-errs; err == nil || errors.Is(err, context.Canceled) {
+			err = sessionErr
+		}
+	}
+	return err
+}
+
+// serveNextSessions handles the sessions of e one after another until ctx is
+// done or a session fails.
+func (q *queueSource) serveNextSessions(ctx context.Context, e entity, f fn.Fn) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err := q.serveSession(ctx, e.newSession(), f)
+		if err != nil && !isNoSessionAvailable(err) {
+			return err
+		}
+	}
+}
+
+// serveSession takes the lock on the next available session and handles its
+// messages until the session is given up.
+func (q *queueSource) serveSession(ctx context.Context, session sessionReceiver, f fn.Fn) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		cancel()
+		_ = session.Close(context.WithoutCancel(ctx))
+	}()
+
+	return session.ReceiveOne(ctx, &sessionHandler{source: q, f: f})
+}
+
+// sessionHandler handles the messages of a session in the order they are
+// received, renewing the lock on the session while each one is handled. It
+// gives the session up once no message has arrived for SessionIdleTimeout, or
+// when a message cannot be settled.
+type sessionHandler struct {
+	source *queueSource
+	f      fn.Fn
+
+	mu      sync.Mutex
+	session *servicebus.MessageSession
+	idle    *time.Timer
+	ended   bool
+}
+
+func (h *sessionHandler) Start(session *servicebus.MessageSession) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.session = session
+	h.idle = time.AfterFunc(h.source.SessionIdleTimeout, session.Close)
+	return nil
+}
+
+func (h *sessionHandler) Handle(ctx context.Context, msg *servicebus.Message) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// The session was given up while the message was being received. It is
+	// left unsettled so that it is delivered again once its lock expires.
+	if h.ended {
+		return nil
+	}
+
+	h.idle.Stop()
+	defer h.idle.Reset(h.source.SessionIdleTimeout)
+
+	if err := h.source.handle(context.WithoutCancel(ctx), msg, h.f, h.session.RenewLock); err != nil {
+		log.Printf("Error settling message, giving up session: %+v\n", err)
+		h.session.Close()
+	}
+	return nil
+}
+
+// End waits for the message being handled, if any, and stops the handling of
+// further messages of the session.
+func (h *sessionHandler) End() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.ended = true
+	if h.idle != nil {
+		h.idle.Stop()
+	}
+}
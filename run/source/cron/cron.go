@@ -16,6 +16,7 @@ import (
 
 	"github.com/fnrun/fnrun/fn"
 	"github.com/fnrun/fnrun/run"
+	"github.com/fnrun/fnrun/run/config"
 	"github.com/robfig/cron/v3"
 )
 
@@ -40,7 +41,8 @@ func (cs *cronSource) Serve(ctx context.Context, f fn.Fn) error {
 	c.Start()
 
 	<-ctx.Done()
-	c.Stop()
+	// Wait for any running job to complete before returning.
+	<-c.Stop().Done()
 
 	return nil
 }
@@ -60,6 +62,15 @@ func (cs *cronSource) RequiresConfig() bool {
 	return true
 }
 
+// Describe describes the configuration of the cron source.
+func (*cronSource) Describe() *config.Schema {
+	return &config.Schema{
+		Description: "Invokes the fn on a cron schedule with fields for seconds (optional), minutes, hours, day of month, month, and day of week.",
+		Type:        "string",
+		Examples:    []interface{}{"*/5 * * * *", "@hourly"},
+	}
+}
+
 // New creates and returns a cron source. It must be configured with the desired
 // cronspec.
 func New() run.Source {
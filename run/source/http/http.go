@@ -1,9 +1,11 @@
-// Package http provides a source that is a web server.
+// Package http provides a source that is a web server. Each request is invoked
+// in a tracing span that continues the trace in its traceparent header.
 package http
 
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -13,7 +15,12 @@ import (
 
 	"github.com/fnrun/fnrun/fn"
 	"github.com/fnrun/fnrun/run"
+	"github.com/fnrun/fnrun/run/config"
+	"github.com/fnrun/fnrun/run/tracing"
 	"github.com/mitchellh/mapstructure"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type httpSource struct {
@@ -29,19 +36,21 @@ type httpSource struct {
 }
 
 func (h *httpSource) ConfigureMap(configMap map[string]interface{}) error {
-	decoderConfig := &mapstructure.DecoderConfig{
-		Metadata:   nil,
-		Result:     h,
-		DecodeHook: mapstructure.StringToTimeDurationHookFunc(),
-	}
-	decoder, err := mapstructure.NewDecoder(decoderConfig)
-	if err != nil {
-		return err
+	return config.Decode(configMap, h, mapstructure.StringToTimeDurationHookFunc())
+}
+
+func (h *httpSource) Validate() error {
+	if (h.TLSCertFile == "") != (h.TLSKeyFile == "") {
+		return errors.New("certFile and keyFile must be configured together")
 	}
+	return nil
+}
 
-	err = decoder.Decode(configMap)
-	if err != nil {
-		return err
+// Start opens the listener so that the address is bound before the source
+// begins serving.
+func (h *httpSource) Start(ctx context.Context) error {
+	if h.Listener != nil {
+		return nil
 	}
 
 	ln, err := net.Listen("tcp", h.Addr)
@@ -54,10 +63,19 @@ func (h *httpSource) ConfigureMap(configMap map[string]interface{}) error {
 }
 
 func (h *httpSource) Serve(ctx context.Context, f fn.Fn) error {
+	if err := h.Start(ctx); err != nil {
+		return err
+	}
+
 	errorChan := make(chan error, 1)
 
+	// In-flight invocations should not be cancelled as soon as shutdown begins.
+	// They are given until the end of the grace period to complete.
+	invokeCtx, cancelInvocations := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelInvocations()
+
 	mux := http.NewServeMux()
-	mux.HandleFunc("/", h.makeHandler(ctx, f))
+	mux.HandleFunc("/", h.makeHandler(invokeCtx, f))
 
 	srv := &http.Server{
 		Addr:    h.Addr,
@@ -80,7 +98,24 @@ func (h *httpSource) Serve(ctx context.Context, f fn.Fn) error {
 		return err
 	}
 
-	return <-errorChan
+	if err := <-errorChan; err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
+}
+
+// Close releases the listener opened by Start. It is a no-op if the listener
+// was already closed by shutting down the server.
+func (h *httpSource) Close() error {
+	if h.Listener == nil {
+		return nil
+	}
+
+	if err := h.Listener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
 }
 
 func (h *httpSource) makeHandler(ctx context.Context, f fn.Fn) func(w http.ResponseWriter, r *http.Request) {
@@ -91,7 +126,12 @@ func (h *httpSource) makeHandler(ctx context.Context, f fn.Fn) func(w http.Respo
 			return
 		}
 
-		output, err := f.Invoke(ctx, input)
+		invokeCtx, span := tracing.StartInput(ctx, r.Method, trace.SpanKindServer, propagation.HeaderCarrier(r.Header),
+			semconv.HTTPRequestMethodKey.String(r.Method),
+			semconv.URLPath(r.URL.Path),
+		)
+		output, err := f.Invoke(invokeCtx, input)
+		tracing.End(span, err)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			w.Write([]byte(err.Error()))
@@ -200,6 +240,55 @@ func (h *httpSource) writeResponse(w http.ResponseWriter, m map[string]interface
 	return nil
 }
 
+// Describe describes the configuration of the http source.
+func (*httpSource) Describe() *config.Schema {
+	return &config.Schema{
+		Description: "Serves HTTP requests and invokes the fn with a map describing each request.",
+		Type:        "object",
+		Properties: map[string]*config.Schema{
+			"address": {
+				Type:        "string",
+				Description: "The address to listen on.",
+				Default:     ":8080",
+			},
+			"certFile": {
+				Type:        "string",
+				Description: "The path to the TLS certificate. It must be set together with keyFile.",
+			},
+			"keyFile": {
+				Type:        "string",
+				Description: "The path to the TLS key. It must be set together with certFile.",
+			},
+			"base64EncodeBody": {
+				Type:        "boolean",
+				Description: "Whether request bodies are base64 encoded in inputs.",
+				Default:     false,
+			},
+			"treatOutputAsBody": {
+				Type:        "boolean",
+				Description: "Whether outputs are written as the response body instead of being decoded as a map with statusCode, headers, and body keys.",
+				Default:     false,
+			},
+			"outputHeaders": {
+				Type:                 "object",
+				Description:          "Headers added to every response.",
+				AdditionalProperties: &config.Schema{Type: "string"},
+			},
+			"ignoreOutput": {
+				Type:        "boolean",
+				Description: "Whether outputs are ignored and an empty response is written instead.",
+				Default:     false,
+			},
+			"shutdownGracePeriod": {
+				Type:        "string",
+				Description: "How long in-flight requests are given to complete on shutdown, as a Go duration string.",
+				Default:     "10s",
+			},
+		},
+		AdditionalProperties: config.NoAdditionalProperties(),
+	}
+}
+
 // New returns a new source that with default values. When Serve is called on
 // the resulting object, the source will start a new HTTP server based on its
 // configuration and invoke a function with values received as HTTP requests.
@@ -13,6 +13,7 @@ import (
 	"github.com/fnrun/fnrun/fn"
 	"github.com/fnrun/fnrun/run/config"
 	"github.com/fnrun/fnrun/run/fn/identity"
+	"github.com/fnrun/fnrun/run/tracing"
 )
 
 func TestConfigureMap_invalidInput(t *testing.T) {
@@ -26,6 +27,16 @@ func TestConfigureMap_invalidInput(t *testing.T) {
 	}
 }
 
+func startSource(t *testing.T, src *httpSource) string {
+	t.Helper()
+
+	if err := src.Start(context.Background()); err != nil {
+		t.Fatalf("Start returned an error: %+v", err)
+	}
+
+	return fmt.Sprintf("http://%s/", src.Listener.Addr().String())
+}
+
 func TestServe(t *testing.T) {
 	src := New().(*httpSource)
 	err := config.Configure(src, map[string]interface{}{
@@ -35,7 +46,7 @@ func TestServe(t *testing.T) {
 			"Content-Type": "application/json",
 		},
 	})
-	url := fmt.Sprintf("http://%s/", src.Listener.Addr().String())
+	url := startSource(t, src)
 
 	if err != nil {
 		t.Fatalf("config.Configure returned an error: %+v", err)
@@ -83,7 +94,7 @@ func TestServe_ignoreOutput(t *testing.T) {
 		"ignoreOutput":      true,
 		"treatOutputAsBody": true,
 	})
-	url := fmt.Sprintf("http://%s/", src.Listener.Addr().String())
+	url := startSource(t, src)
 
 	if err != nil {
 		t.Fatalf("config.Configure returned an error: %+v", err)
@@ -129,7 +140,7 @@ func TestServe_fnReturnsInvalidMap(t *testing.T) {
 	err := config.Configure(src, map[string]interface{}{
 		"address": "127.0.0.1:0",
 	})
-	url := fmt.Sprintf("http://%s/", src.Listener.Addr().String())
+	url := startSource(t, src)
 
 	if err != nil {
 		t.Fatalf("config.Configure returned an error: %+v", err)
@@ -180,7 +191,7 @@ func TestServe_fnProvidesResponse(t *testing.T) {
 	err := config.Configure(src, map[string]interface{}{
 		"address": "127.0.0.1:0",
 	})
-	url := fmt.Sprintf("http://%s/", src.Listener.Addr().String())
+	url := startSource(t, src)
 
 	if err != nil {
 		t.Fatalf("config.Configure returned an error: %+v", err)
@@ -240,7 +251,7 @@ func TestServe_fnReturnsError(t *testing.T) {
 	err := config.Configure(src, map[string]interface{}{
 		"address": "127.0.0.1:0",
 	})
-	url := fmt.Sprintf("http://%s/", src.Listener.Addr().String())
+	url := startSource(t, src)
 
 	if err != nil {
 		t.Fatalf("config.Configure returned an error: %+v", err)
@@ -281,12 +292,56 @@ func TestServe_fnReturnsError(t *testing.T) {
 	}
 }
 
+func TestServe_continuesTraceFromHeaders(t *testing.T) {
+	src := New().(*httpSource)
+	err := config.Configure(src, map[string]interface{}{
+		"address":           "127.0.0.1:0",
+		"treatOutputAsBody": true,
+	})
+	url := startSource(t, src)
+
+	if err != nil {
+		t.Fatalf("config.Configure returned an error: %+v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		src.Serve(ctx, fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+			return tracing.Traceparent(ctx), nil
+		}))
+	}()
+
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBufferString("some value"))
+	if err != nil {
+		t.Fatalf("http.NewRequest returned error: %+v", err)
+	}
+	req.Header.Set("traceparent", traceparent)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("error posting: %+v", err)
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	if err != nil {
+		t.Fatalf("ioutil.ReadAll returned error: %+v", err)
+	}
+
+	if got := string(respBody); got != traceparent {
+		t.Errorf("unexpected traceparent: want %q, got %q", traceparent, got)
+	}
+}
+
 func TestServe_nonMapOutput(t *testing.T) {
 	src := New().(*httpSource)
 	err := config.Configure(src, map[string]interface{}{
 		"address": "127.0.0.1:0",
 	})
-	url := fmt.Sprintf("http://%s/", src.Listener.Addr().String())
+	url := startSource(t, src)
 
 	if err != nil {
 		t.Fatalf("config.Configure returned an error: %+v", err)
@@ -338,7 +393,7 @@ func TestServe_base64Encode(t *testing.T) {
 		t.Fatalf("config.Configure returned an error: %+v", err)
 	}
 
-	url := fmt.Sprintf("http://%s/", src.Listener.Addr().String())
+	url := startSource(t, src)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -405,3 +460,57 @@ func TestServe_gracefulShutdown(t *testing.T) {
 		break
 	}
 }
+
+func TestServe_gracefulShutdownCompletesInFlightRequests(t *testing.T) {
+	src := New().(*httpSource)
+	err := config.Configure(src, map[string]interface{}{
+		"address":             "127.0.0.1:0",
+		"treatOutputAsBody":   true,
+		"shutdownGracePeriod": "2s",
+	})
+	if err != nil {
+		t.Fatalf("config.Configure returned an error: %+v", err)
+	}
+	url := startSource(t, src)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	invokedCh := make(chan interface{})
+	serveErrCh := make(chan error, 1)
+
+	go func() {
+		serveErrCh <- src.Serve(ctx, fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+			close(invokedCh)
+			<-time.After(100 * time.Millisecond)
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			return "finished", nil
+		}))
+	}()
+
+	go func() {
+		<-invokedCh
+		cancel()
+	}()
+
+	resp, err := http.Post(url, "text/plain", bytes.NewBuffer([]byte("some value")))
+	if err != nil {
+		t.Fatalf("error posting: %+v", err)
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	if err != nil {
+		t.Fatalf("ioutil.ReadAll returned error: %+v", err)
+	}
+
+	want := "finished"
+	got := string(respBody)
+	if got != want {
+		t.Errorf("unexpected result: want %q, got %q", want, got)
+	}
+
+	if err := <-serveErrCh; err != nil {
+		t.Errorf("Serve returned error: %+v", err)
+	}
+}
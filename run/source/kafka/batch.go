@@ -0,0 +1,144 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/fnrun/fnrun/run/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// consumeBatches accumulates the messages of a claim into batches of up to
+// maxBatchSize messages, invoking the fn with a batch once it is full or once
+// maxBatchWait has passed since its first message. A batch is marked only
+// after every message in it has been handled. A partial batch is still
+// processed when the claim or session ends.
+func (consumer *consumer) consumeBatches(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	var (
+		batch   []*sarama.ConsumerMessage
+		timer   *time.Timer
+		timeout <-chan time.Time
+	)
+
+	flush := func() error {
+		if timer != nil {
+			timer.Stop()
+			timer, timeout = nil, nil
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		messages := batch
+		batch = nil
+		if err := consumer.handleAll(session, messages, consumer.processBatch); err != nil {
+			return err
+		}
+
+		// Marking the last message commits the offsets of the whole batch.
+		consumer.mark(session, claim, messages[len(messages)-1])
+		return nil
+	}
+
+	for {
+		if session.Context().Err() != nil {
+			return flush()
+		}
+
+		select {
+		case message, ok := <-claim.Messages():
+			if !ok {
+				return flush()
+			}
+
+			batch = append(batch, message)
+			if len(batch) == 1 {
+				timer = time.NewTimer(consumer.maxBatchWait)
+				timeout = timer.C
+			}
+			if len(batch) >= consumer.maxBatchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+
+		case <-timeout:
+			if err := flush(); err != nil {
+				return err
+			}
+
+		case <-session.Context().Done():
+			return flush()
+		}
+	}
+}
+
+// processBatch invokes the fn once with the inputs of messages. If the fn
+// returns an error, every message has failed. With batch results, the fn
+// returns a list with a result for each message, and a message has failed if
+// its result is an object with a non-empty error.
+func (consumer *consumer) processBatch(messages []*sarama.ConsumerMessage) []failure {
+	inputs := make([]interface{}, len(messages))
+	for i, message := range messages {
+		inputs[i] = createInput(message)
+	}
+
+	first := messages[0]
+	ctx, span := tracing.StartInput(consumer.ctx, first.Topic+" process", trace.SpanKindConsumer, nil,
+		semconv.MessagingSystemKafka,
+		semconv.MessagingDestinationName(first.Topic),
+		semconv.MessagingDestinationPartitionID(strconv.Itoa(int(first.Partition))),
+		semconv.MessagingBatchMessageCount(len(messages)),
+		semconv.MessagingKafkaConsumerGroup(consumer.group),
+	)
+	output, err := consumer.f.Invoke(ctx, inputs)
+	if err == nil && consumer.batchResults {
+		var failures []failure
+		failures, err = batchFailures(messages, output)
+		tracing.End(span, err)
+		return failures
+	}
+	tracing.End(span, err)
+
+	if err != nil {
+		return failAll(messages, err)
+	}
+	return nil
+}
+
+// batchFailures returns the messages whose results in output are errors. If
+// output is not a list with one result per message, every message has failed.
+// The returned error summarizes the failures for the tracing span.
+func batchFailures(messages []*sarama.ConsumerMessage, output interface{}) ([]failure, error) {
+	results, ok := output.([]interface{})
+	if !ok || len(results) != len(messages) {
+		err := fmt.Errorf("expected the fn to return a list of %d results but got %T", len(messages), output)
+		return failAll(messages, err), err
+	}
+
+	var failures []failure
+	for i, result := range results {
+		m, ok := result.(map[string]interface{})
+		if !ok || m["error"] == nil || m["error"] == "" {
+			continue
+		}
+		failures = append(failures, failure{message: messages[i], err: errors.New(fmt.Sprint(m["error"]))})
+	}
+
+	if len(failures) > 0 {
+		return failures, fmt.Errorf("%d of %d messages failed", len(failures), len(messages))
+	}
+	return nil, nil
+}
+
+func failAll(messages []*sarama.ConsumerMessage, err error) []failure {
+	failures := make([]failure, len(messages))
+	for i, message := range messages {
+		failures[i] = failure{message: message, err: err}
+	}
+	return failures
+}
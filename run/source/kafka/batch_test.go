@@ -0,0 +1,227 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/fnrun/fnrun/fn"
+	"github.com/fnrun/fnrun/run/config"
+)
+
+func sendMessages(client *testConsumerGroupHandler, count int) {
+	for offset := 0; offset < count; offset++ {
+		message := newConsumerMessage("my-topic", []byte("some key"), []byte("some value"))
+		message.Offset = int64(offset)
+		client.InputCh <- message
+	}
+}
+
+// batchOffsets returns the offsets of the inputs in a batch.
+func batchOffsets(input interface{}) []int64 {
+	var offsets []int64
+	for _, item := range input.([]interface{}) {
+		offsets = append(offsets, item.(map[string]interface{})["offset"].(int64))
+	}
+	return offsets
+}
+
+func TestServe_batchBySize(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	client := newTestConsumerGroupHandler()
+	k := &kafkaSource{
+		MaxBatchSize: 3,
+		MaxBatchWait: time.Hour,
+		client:       client,
+	}
+
+	var batches [][]int64
+	f := fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		batches = append(batches, batchOffsets(input))
+		cancel()
+		return nil, nil
+	})
+
+	sendMessages(client, 3)
+	if err := k.Serve(ctx, f); err != nil {
+		t.Fatalf("Serve returned error: %+v", err)
+	}
+
+	deepEquals(t, batches, [][]int64{{0, 1, 2}})
+	deepEquals(t, client.markedOffsets(), []int64{2})
+}
+
+func TestServe_batchByWait(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	client := newTestConsumerGroupHandler()
+	k := &kafkaSource{
+		MaxBatchSize: 10,
+		MaxBatchWait: 10 * time.Millisecond,
+		client:       client,
+	}
+
+	var batches [][]int64
+	f := fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		batches = append(batches, batchOffsets(input))
+		cancel()
+		return nil, nil
+	})
+
+	sendMessages(client, 2)
+	if err := k.Serve(ctx, f); err != nil {
+		t.Fatalf("Serve returned error: %+v", err)
+	}
+
+	deepEquals(t, batches, [][]int64{{0, 1}})
+	deepEquals(t, client.markedOffsets(), []int64{1})
+}
+
+func TestServe_batchError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	expectedErr := errors.New("expected error")
+
+	client := newTestConsumerGroupHandler()
+	k := &kafkaSource{
+		MaxBatchSize: 2,
+		MaxBatchWait: time.Hour,
+		client:       client,
+	}
+
+	f := fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		return nil, expectedErr
+	})
+
+	sendMessages(client, 2)
+	if err := k.Serve(ctx, f); err != expectedErr {
+		t.Fatalf("Serve did not return expected error: want %+v, got %+v", expectedErr, err)
+	}
+
+	deepEquals(t, client.markedOffsets(), []int64(nil))
+}
+
+func TestServe_batchResultsRetryFailedItems(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	client := newTestConsumerGroupHandler()
+	k := &kafkaSource{
+		MaxBatchSize: 3,
+		MaxBatchWait: time.Hour,
+		BatchResults: true,
+		OnError:      errorPolicy{Action: actionFail, Retries: 1, Backoff: time.Millisecond},
+		client:       client,
+	}
+
+	var batches [][]int64
+	f := fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		batches = append(batches, batchOffsets(input))
+		if len(batches) == 1 {
+			return []interface{}{
+				map[string]interface{}{"id": 0},
+				map[string]interface{}{"error": "invalid row"},
+				nil,
+			}, nil
+		}
+		cancel()
+		return []interface{}{"ok"}, nil
+	})
+
+	sendMessages(client, 3)
+	if err := k.Serve(ctx, f); err != nil {
+		t.Fatalf("Serve returned error: %+v", err)
+	}
+
+	deepEquals(t, batches, [][]int64{{0, 1, 2}, {1}})
+	deepEquals(t, client.markedOffsets(), []int64{2})
+}
+
+func TestServe_batchResultsDeadLetter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var once sync.Once
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(message *sarama.ProducerMessage) error {
+		defer once.Do(cancel)
+
+		for _, header := range message.Headers {
+			if string(header.Key) == headerOffset && string(header.Value) != "1" {
+				return errors.New("unexpected offset " + string(header.Value))
+			}
+			if string(header.Key) == headerError && string(header.Value) != "invalid row" {
+				return errors.New("unexpected error " + string(header.Value))
+			}
+		}
+		return nil
+	})
+
+	client := newTestConsumerGroupHandler()
+	k := &kafkaSource{
+		MaxBatchSize: 3,
+		MaxBatchWait: time.Hour,
+		BatchResults: true,
+		OnError:      errorPolicy{Action: actionDeadLetter, Topic: "my-topic.dlq"},
+		client:       client,
+		producer:     producer,
+	}
+
+	f := fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		return []interface{}{nil, map[string]interface{}{"error": "invalid row"}, nil}, nil
+	})
+
+	sendMessages(client, 3)
+	if err := k.Serve(ctx, f); err != nil {
+		t.Fatalf("Serve returned error: %+v", err)
+	}
+
+	deepEquals(t, client.markedOffsets(), []int64{2})
+}
+
+func TestBatchFailures_unexpectedOutput(t *testing.T) {
+	messages := []*sarama.ConsumerMessage{{Offset: 0}, {Offset: 1}}
+
+	failures, err := batchFailures(messages, []interface{}{nil})
+	if err == nil {
+		t.Fatal("expected batchFailures to return an error but it did not")
+	}
+	equals(t, len(failures), 2)
+}
+
+func TestConfigureMap_batch(t *testing.T) {
+	tests := []struct {
+		options map[string]interface{}
+		want    string
+	}{
+		{options: map[string]interface{}{"maxBatchSize": 100, "maxBatchWait": "250ms", "batchResults": true}},
+		{options: map[string]interface{}{"maxBatchSize": 100, "workers": 4}, want: "workers: workers cannot be combined with maxBatchSize"},
+		{options: map[string]interface{}{"maxBatchSize": 100, "maxBatchWait": "0s"}, want: "maxBatchWait: maxBatchWait must be positive"},
+		{options: map[string]interface{}{"maxBatchSize": -1}, want: "maxBatchSize: maxBatchSize must not be negative"},
+	}
+
+	for _, test := range tests {
+		configMap := map[string]interface{}{
+			"group":   "myGroupName",
+			"brokers": "1.2.3.4",
+			"topics":  "topicA",
+		}
+		for key, value := range test.options {
+			configMap[key] = value
+		}
+
+		err := config.Configure(New(), configMap)
+
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != test.want {
+			t.Errorf("unexpected error for %v: want %q, got %q", test.options, test.want, got)
+		}
+	}
+}
@@ -2,37 +2,258 @@ package kafka
 
 import (
 	"context"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/fnrun/fnrun/fn"
+	"github.com/fnrun/fnrun/run/metrics"
+	"github.com/fnrun/fnrun/run/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var consumerLag = metrics.MustRegister(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: metrics.Namespace,
+	Subsystem: "kafka",
+	Name:      "consumer_lag",
+	Help:      "The number of messages in a partition after the last message processed by the consumer group.",
+}, []string{"group", "topic", "partition"}))
+
 type consumer struct {
-	ctx          context.Context
-	f            fn.Fn
-	ignoreErrors bool
+	ctx      context.Context
+	f        fn.Fn
+	group    string
+	workers  int
+	ordering string
+	policy   errorPolicy
+	producer sarama.SyncProducer
+	pauser   *partitionPauser
+
+	maxBatchSize int
+	maxBatchWait time.Duration
+	batchResults bool
+
+	transactional bool
+	newProducer   func(topic string, partition int32) (sarama.SyncProducer, error)
 }
 
 func (consumer *consumer) Setup(sarama.ConsumerGroupSession) error {
 	return nil
 }
 
-func (consumer *consumer) Cleanup(sarama.ConsumerGroupSession) error {
+// Cleanup removes the lag of the partitions of the session, which the consumer
+// no longer reports once they are revoked.
+func (consumer *consumer) Cleanup(session sarama.ConsumerGroupSession) error {
+	for topic, partitions := range session.Claims() {
+		for _, partition := range partitions {
+			consumerLag.DeleteLabelValues(consumer.group, topic, strconv.Itoa(int(partition)))
+		}
+	}
 	return nil
 }
 
 func (consumer *consumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
-	for message := range claim.Messages() {
-		input := createInput(message)
+	var err error
+	switch {
+	case consumer.transactional:
+		err = consumer.consumeTransactionally(session, claim)
+	case consumer.maxBatchSize > 0:
+		err = consumer.consumeBatches(session, claim)
+	case consumer.workers > 1:
+		err = consumer.consumeConcurrently(session, claim)
+	default:
+		err = consumer.consumeSequentially(session, claim, consumer.processEach, func(message *sarama.ConsumerMessage) error {
+			consumer.mark(session, claim, message)
+			return nil
+		})
+	}
+
+	if err == errSessionEnded {
+		return nil
+	}
+	return err
+}
+
+// consumeSequentially processes the messages of a claim one at a time with
+// process, calling done with each message once it has been handled.
+func (consumer *consumer) consumeSequentially(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim, process processFunc, done func(*sarama.ConsumerMessage) error) error {
+	for {
+		// Stop taking new messages once the session is ending so that only the
+		// in-flight message needs to drain.
+		if session.Context().Err() != nil {
+			return nil
+		}
+
+		select {
+		case message, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
 
-		_, err := consumer.f.Invoke(consumer.ctx, input)
-		if err != nil && !consumer.ignoreErrors {
-			return err
+			if err := consumer.handleAll(session, []*sarama.ConsumerMessage{message}, process); err != nil {
+				return err
+			}
+			if err := done(message); err != nil {
+				return err
+			}
+
+		case <-session.Context().Done():
+			return nil
 		}
-		session.MarkMessage(message, "")
 	}
+}
 
-	return nil
+// consumeConcurrently processes the messages of a claim with a pool of
+// workers. With key ordering, messages with the same key are always handed to
+// the same worker so that they are processed in the order they were received.
+// Offsets are marked through an offsetTracker so that the committed offset
+// never passes a message that has not completed.
+func (consumer *consumer) consumeConcurrently(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	tracker := newOffsetTracker(func(message *sarama.ConsumerMessage) {
+		consumer.mark(session, claim, message)
+	})
+
+	var (
+		wg       sync.WaitGroup
+		failOnce sync.Once
+		failErr  error
+	)
+	failed := make(chan struct{})
+	fail := func(err error) {
+		failOnce.Do(func() {
+			failErr = err
+			close(failed)
+		})
+	}
+
+	queues := make([]chan *pendingMessage, 1)
+	if consumer.ordering == orderingKey {
+		queues = make([]chan *pendingMessage, consumer.workers)
+	}
+	for i := range queues {
+		queues[i] = make(chan *pendingMessage)
+	}
+
+	for i := 0; i < consumer.workers; i++ {
+		queue := queues[i%len(queues)]
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for pending := range queue {
+				select {
+				case <-failed:
+					continue
+				default:
+				}
+
+				if err := consumer.handle(session, pending.message); err != nil {
+					fail(err)
+					continue
+				}
+				tracker.complete(pending)
+			}
+		}()
+	}
+
+	consumer.dispatch(session, claim, tracker, queues, failed)
+
+	for _, queue := range queues {
+		close(queue)
+	}
+	wg.Wait()
+
+	return failErr
+}
+
+// dispatch hands the messages of a claim to the worker queues until the claim
+// ends, the session ends, or a worker fails.
+func (consumer *consumer) dispatch(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim, tracker *offsetTracker, queues []chan *pendingMessage, failed <-chan struct{}) {
+	var next uint32
+
+	for {
+		if session.Context().Err() != nil {
+			return
+		}
+
+		select {
+		case message, ok := <-claim.Messages():
+			if !ok {
+				return
+			}
+
+			// Messages without a key have no ordering to preserve, so they are
+			// spread across the workers.
+			queue := queues[0]
+			if len(queues) > 1 {
+				if len(message.Key) > 0 {
+					hash := fnv.New32a()
+					hash.Write(message.Key)
+					queue = queues[hash.Sum32()%uint32(len(queues))]
+				} else {
+					queue = queues[next%uint32(len(queues))]
+					next++
+				}
+			}
+
+			pending := tracker.add(message)
+			select {
+			case queue <- pending:
+			case <-failed:
+				return
+			case <-session.Context().Done():
+				return
+			}
+
+		case <-failed:
+			return
+		case <-session.Context().Done():
+			return
+		}
+	}
+}
+
+// process invokes the fn with a message in a tracing span.
+func (consumer *consumer) process(ctx context.Context, message *sarama.ConsumerMessage) error {
+	input := createInput(message)
+
+	ctx, span := tracing.StartInput(ctx, message.Topic+" process", trace.SpanKindConsumer, headerCarrier(message.Headers),
+		semconv.MessagingSystemKafka,
+		semconv.MessagingDestinationName(message.Topic),
+		semconv.MessagingDestinationPartitionID(strconv.Itoa(int(message.Partition))),
+		semconv.MessagingKafkaMessageOffset(int(message.Offset)),
+		semconv.MessagingKafkaConsumerGroup(consumer.group),
+	)
+	_, err := consumer.f.Invoke(ctx, input)
+	tracing.End(span, err)
+
+	return err
+}
+
+// processEach processes messages one at a time.
+func (consumer *consumer) processEach(messages []*sarama.ConsumerMessage) []failure {
+	var failures []failure
+	for _, message := range messages {
+		if err := consumer.process(consumer.ctx, message); err != nil {
+			failures = append(failures, failure{message: message, err: err})
+		}
+	}
+	return failures
+}
+
+func (consumer *consumer) mark(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim, message *sarama.ConsumerMessage) {
+	session.MarkMessage(message, "")
+	consumer.recordLag(claim, message)
+}
+
+func (consumer *consumer) recordLag(claim sarama.ConsumerGroupClaim, message *sarama.ConsumerMessage) {
+	lag := claim.HighWaterMarkOffset() - message.Offset - 1
+	consumerLag.WithLabelValues(consumer.group, message.Topic, strconv.Itoa(int(message.Partition))).Set(float64(lag))
 }
 
 func createInput(message *sarama.ConsumerMessage) map[string]interface{} {
@@ -45,5 +266,39 @@ func createInput(message *sarama.ConsumerMessage) map[string]interface{} {
 	input["topic"] = message.Topic
 	input["timestamp"] = message.Timestamp
 
+	headers := make(map[string]interface{}, len(message.Headers))
+	for _, header := range message.Headers {
+		if header != nil {
+			headers[string(header.Key)] = string(header.Value)
+		}
+	}
+	input["headers"] = headers
+
 	return input
 }
+
+// headerCarrier adapts the headers of a Kafka message to a
+// propagation.TextMapCarrier.
+type headerCarrier []*sarama.RecordHeader
+
+func (c headerCarrier) Get(key string) string {
+	for _, header := range c {
+		if header != nil && string(header.Key) == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+// Set is not supported because the source only extracts trace context.
+func (c headerCarrier) Set(key, value string) {}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for _, header := range c {
+		if header != nil {
+			keys = append(keys, string(header.Key))
+		}
+	}
+	return keys
+}
@@ -0,0 +1,268 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/fnrun/fnrun/run/config"
+)
+
+// The actions an errorPolicy may take once a message has failed every attempt.
+const (
+	actionFail       = "fail"
+	actionSkip       = "skip"
+	actionDeadLetter = "deadLetter"
+	actionPause      = "pause"
+)
+
+// The headers added to a message published to the dead-letter topic.
+const (
+	headerError     = "fnrun-error"
+	headerTopic     = "fnrun-original-topic"
+	headerPartition = "fnrun-original-partition"
+	headerOffset    = "fnrun-original-offset"
+	headerAttempts  = "fnrun-attempts"
+)
+
+// errSessionEnded is returned by consumer.handle when the session ended before
+// a failed message could be handled. The message is left unmarked so that it
+// is delivered again in the next session.
+var errSessionEnded = errors.New("session ended")
+
+// errorPolicy describes what the source does when the fn returns an error for
+// a message. The message is retried in place up to Retries times, waiting
+// Backoff between attempts, before Action is taken.
+type errorPolicy struct {
+	Action  string
+	Retries int
+	Backoff time.Duration
+	Topic   string
+}
+
+func (p *errorPolicy) Validate() error {
+	switch p.Action {
+	case actionFail, actionSkip, actionPause:
+	case actionDeadLetter:
+		if p.Topic == "" {
+			return config.WithPath("topic", errors.New("topic is required when action is deadLetter"))
+		}
+	default:
+		return config.WithPath("action", fmt.Errorf("unknown action %q", p.Action))
+	}
+
+	if p.Retries < 0 {
+		return config.WithPath("retries", errors.New("retries must not be negative"))
+	}
+	if p.Backoff < 0 {
+		return config.WithPath("backoff", errors.New("backoff must not be negative"))
+	}
+	return nil
+}
+
+// Describe describes the configuration of an errorPolicy.
+func (*errorPolicy) Describe() *config.Schema {
+	return &config.Schema{
+		Description: "What to do with a message when the fn returns an error for it.",
+		Type:        "object",
+		Properties: map[string]*config.Schema{
+			"action": {
+				Type: "string",
+				Description: "The action taken once every retry has failed. With fail, the consumer group session ends and the message is processed again when it restarts. " +
+					"With skip, the message is marked. With deadLetter, the message is published to topic with its original headers and headers describing the error, then marked. " +
+					"With pause, only the partition of the message is paused and the message is retried every backoff until it succeeds.",
+				Enum:    []interface{}{actionFail, actionSkip, actionDeadLetter, actionPause},
+				Default: actionFail,
+			},
+			"retries": {
+				Type:        "integer",
+				Description: "The number of times a failed message is retried in place before the action is taken.",
+				Minimum:     config.Minimum(0),
+				Default:     0,
+			},
+			"backoff": {
+				Type:        "string",
+				Description: "How long to wait between attempts, as a duration such as 500ms.",
+				Default:     "1s",
+			},
+			"topic": {
+				Type:        "string",
+				Description: "The dead-letter topic. It is required when action is deadLetter and uses the brokers and authentication of the source.",
+			},
+		},
+		AdditionalProperties: config.NoAdditionalProperties(),
+	}
+}
+
+func newErrorPolicy() errorPolicy {
+	return errorPolicy{
+		Action:  actionFail,
+		Backoff: time.Second,
+	}
+}
+
+// failure is a message that the fn failed to process.
+type failure struct {
+	message *sarama.ConsumerMessage
+	err     error
+}
+
+// processFunc processes messages and returns those that failed.
+type processFunc func([]*sarama.ConsumerMessage) []failure
+
+// handle processes a message and applies the error policy of the consumer if
+// the fn fails. A nil return means that the message may be marked. Otherwise,
+// the message must not be marked and the claim should stop.
+func (consumer *consumer) handle(session sarama.ConsumerGroupSession, message *sarama.ConsumerMessage) error {
+	return consumer.handleAll(session, []*sarama.ConsumerMessage{message}, consumer.processEach)
+}
+
+// handleAll processes messages with process and applies the error policy of
+// the consumer to the messages that fail. Only failed messages are retried. A
+// nil return means that every message may be marked.
+func (consumer *consumer) handleAll(session sarama.ConsumerGroupSession, messages []*sarama.ConsumerMessage, process processFunc) error {
+	failures := process(messages)
+	attempts := 1
+	for ; len(failures) > 0 && attempts <= consumer.policy.Retries; attempts++ {
+		if !sleep(session.Context(), consumer.policy.Backoff) {
+			return errSessionEnded
+		}
+		failures = process(failedMessages(failures))
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+
+	switch consumer.policy.Action {
+	case actionSkip:
+		return nil
+	case actionDeadLetter:
+		for _, f := range failures {
+			if err := consumer.deadLetter(f.message, f.err, attempts); err != nil {
+				return err
+			}
+		}
+		return nil
+	case actionPause:
+		return consumer.pauseUntilProcessed(session, failures, process)
+	default:
+		return failures[0].err
+	}
+}
+
+func failedMessages(failures []failure) []*sarama.ConsumerMessage {
+	messages := make([]*sarama.ConsumerMessage, len(failures))
+	for i, f := range failures {
+		messages[i] = f.message
+	}
+	return messages
+}
+
+// deadLetter publishes a failed message to the dead-letter topic. The message
+// may only be marked if publishing succeeds, so an error publishing is
+// returned together with the error from the fn.
+func (consumer *consumer) deadLetter(message *sarama.ConsumerMessage, err error, attempts int) error {
+	headers := make([]sarama.RecordHeader, 0, len(message.Headers)+5)
+	for _, header := range message.Headers {
+		if header != nil {
+			headers = append(headers, *header)
+		}
+	}
+	headers = append(headers,
+		sarama.RecordHeader{Key: []byte(headerError), Value: []byte(err.Error())},
+		sarama.RecordHeader{Key: []byte(headerTopic), Value: []byte(message.Topic)},
+		sarama.RecordHeader{Key: []byte(headerPartition), Value: []byte(strconv.Itoa(int(message.Partition)))},
+		sarama.RecordHeader{Key: []byte(headerOffset), Value: []byte(strconv.FormatInt(message.Offset, 10))},
+		sarama.RecordHeader{Key: []byte(headerAttempts), Value: []byte(strconv.Itoa(attempts))},
+	)
+
+	producerMessage := &sarama.ProducerMessage{
+		Topic:   consumer.policy.Topic,
+		Value:   sarama.ByteEncoder(message.Value),
+		Headers: headers,
+	}
+	if message.Key != nil {
+		producerMessage.Key = sarama.ByteEncoder(message.Key)
+	}
+
+	if _, _, sendErr := consumer.producer.SendMessage(producerMessage); sendErr != nil {
+		return errors.Join(err, fmt.Errorf("error publishing to dead-letter topic %s: %w", consumer.policy.Topic, sendErr))
+	}
+	return nil
+}
+
+// pauseUntilProcessed pauses the partition of failed messages and retries them
+// every backoff until they succeed or the session ends. Other partitions
+// continue to be consumed in the meantime.
+func (consumer *consumer) pauseUntilProcessed(session sarama.ConsumerGroupSession, failures []failure, process processFunc) error {
+	topic, partition := failures[0].message.Topic, failures[0].message.Partition
+	consumer.pauser.pause(topic, partition)
+	defer consumer.pauser.resume(topic, partition)
+
+	for len(failures) > 0 {
+		log.Printf("Pausing partition %d of topic %s at offset %d: %+v\n", partition, topic, failures[0].message.Offset, failures[0].err)
+
+		if !sleep(session.Context(), consumer.policy.Backoff) {
+			return errSessionEnded
+		}
+		failures = process(failedMessages(failures))
+	}
+	return nil
+}
+
+// partitionPauser pauses and resumes the partitions of a consumer group. A
+// partition stays paused until every pause of it has been matched by a resume,
+// since several workers may be waiting on failed messages of one partition.
+type partitionPauser struct {
+	client sarama.ConsumerGroup
+	mutex  sync.Mutex
+	paused map[string]map[int32]int
+}
+
+func newPartitionPauser(client sarama.ConsumerGroup) *partitionPauser {
+	return &partitionPauser{
+		client: client,
+		paused: make(map[string]map[int32]int),
+	}
+}
+
+func (p *partitionPauser) pause(topic string, partition int32) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.paused[topic] == nil {
+		p.paused[topic] = make(map[int32]int)
+	}
+	p.paused[topic][partition]++
+	if p.paused[topic][partition] == 1 {
+		p.client.Pause(map[string][]int32{topic: {partition}})
+	}
+}
+
+func (p *partitionPauser) resume(topic string, partition int32) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.paused[topic][partition]--
+	if p.paused[topic][partition] == 0 {
+		delete(p.paused[topic], partition)
+		p.client.Resume(map[string][]int32{topic: {partition}})
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,227 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/fnrun/fnrun/fn"
+	"github.com/fnrun/fnrun/run/config"
+)
+
+// failingFn returns an error from its first failures invocations, and cancels
+// the context of Serve once it has succeeded.
+func failingFn(failures int32, cancel context.CancelFunc) (fn.Fn, *int32) {
+	var calls int32
+	return fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) <= failures {
+			return nil, errors.New("fn failed")
+		}
+		cancel()
+		return nil, nil
+	}), &calls
+}
+
+func TestServe_retriesInPlace(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	client := newTestConsumerGroupHandler()
+	k := &kafkaSource{
+		OnError: errorPolicy{Action: actionFail, Retries: 2, Backoff: time.Millisecond},
+		client:  client,
+	}
+	f, calls := failingFn(2, cancel)
+
+	client.InputCh <- newConsumerMessage("my-topic", []byte("some key"), []byte("some value"))
+	if err := k.Serve(ctx, f); err != nil {
+		t.Fatalf("Serve returned error: %+v", err)
+	}
+
+	equals(t, atomic.LoadInt32(calls), int32(3))
+	deepEquals(t, client.markedOffsets(), []int64{0})
+}
+
+func TestServe_deadLetter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(message *sarama.ProducerMessage) error {
+		defer cancel()
+
+		if message.Topic != "my-topic.dlq" {
+			return fmt.Errorf("unexpected topic %q", message.Topic)
+		}
+
+		got := map[string]string{}
+		for _, header := range message.Headers {
+			got[string(header.Key)] = string(header.Value)
+		}
+		want := map[string]string{
+			"source":        "billing",
+			headerError:     "fn failed",
+			headerTopic:     "my-topic",
+			headerPartition: "3",
+			headerOffset:    "7",
+			headerAttempts:  "2",
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			return fmt.Errorf("unexpected headers: want %v, got %v", want, got)
+		}
+		return nil
+	})
+
+	client := newTestConsumerGroupHandler()
+	k := &kafkaSource{
+		OnError:  errorPolicy{Action: actionDeadLetter, Retries: 1, Backoff: time.Millisecond, Topic: "my-topic.dlq"},
+		client:   client,
+		producer: producer,
+	}
+	f, _ := failingFn(2, cancel)
+
+	message := newConsumerMessage("my-topic", []byte("some key"), []byte("some value"))
+	message.Partition = 3
+	message.Offset = 7
+	message.Headers = append(message.Headers, &sarama.RecordHeader{Key: []byte("source"), Value: []byte("billing")})
+	client.InputCh <- message
+
+	if err := k.Serve(ctx, f); err != nil {
+		t.Fatalf("Serve returned error: %+v", err)
+	}
+
+	deepEquals(t, client.markedOffsets(), []int64{7})
+}
+
+func TestServe_deadLetterFailure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sendErr := errors.New("broker unavailable")
+
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageAndFail(sendErr)
+
+	client := newTestConsumerGroupHandler()
+	k := &kafkaSource{
+		OnError:  errorPolicy{Action: actionDeadLetter, Topic: "my-topic.dlq"},
+		client:   client,
+		producer: producer,
+	}
+	f, _ := failingFn(1, cancel)
+
+	client.InputCh <- newConsumerMessage("my-topic", []byte("some key"), []byte("some value"))
+
+	if err := k.Serve(ctx, f); !errors.Is(err, sendErr) {
+		t.Errorf("expected Serve to return an error wrapping %+v, got %+v", sendErr, err)
+	}
+	deepEquals(t, client.markedOffsets(), []int64(nil))
+}
+
+func TestServe_pausePartition(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	client := newTestConsumerGroupHandler()
+	k := &kafkaSource{
+		OnError: errorPolicy{Action: actionPause, Backoff: time.Millisecond},
+		client:  client,
+	}
+	f, calls := failingFn(3, cancel)
+
+	message := newConsumerMessage("my-topic", []byte("some key"), []byte("some value"))
+	message.Partition = 2
+	client.InputCh <- message
+
+	if err := k.Serve(ctx, f); err != nil {
+		t.Fatalf("Serve returned error: %+v", err)
+	}
+
+	equals(t, atomic.LoadInt32(calls), int32(4))
+	deepEquals(t, client.paused, []string{"pause my-topic/2", "resume my-topic/2"})
+	deepEquals(t, client.markedOffsets(), []int64{0})
+}
+
+func TestServe_pauseEndsWithSession(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	client := newTestConsumerGroupHandler()
+	k := &kafkaSource{
+		OnError: errorPolicy{Action: actionPause, Backoff: time.Hour},
+		client:  client,
+	}
+	f := fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		cancel()
+		return nil, errors.New("fn failed")
+	})
+
+	client.InputCh <- newConsumerMessage("my-topic", []byte("some key"), []byte("some value"))
+
+	if err := k.Serve(ctx, f); err != nil {
+		t.Fatalf("Serve returned error: %+v", err)
+	}
+	deepEquals(t, client.markedOffsets(), []int64(nil))
+}
+
+func TestPartitionPauser(t *testing.T) {
+	client := newTestConsumerGroupHandler()
+	pauser := newPartitionPauser(client)
+
+	pauser.pause("my-topic", 1)
+	pauser.pause("my-topic", 1)
+	pauser.resume("my-topic", 1)
+	pauser.resume("my-topic", 1)
+
+	deepEquals(t, client.paused, []string{"pause my-topic/1", "resume my-topic/1"})
+}
+
+func TestConfigureMap_onError(t *testing.T) {
+	tests := []struct {
+		onError      map[string]interface{}
+		ignoreErrors bool
+		want         string
+	}{
+		{onError: map[string]interface{}{"action": "pause", "retries": 3, "backoff": "250ms"}},
+		{onError: map[string]interface{}{"action": "deadLetter", "topic": "dlq"}},
+		{onError: map[string]interface{}{"action": "deadLetter"}, want: "onError.topic: topic is required when action is deadLetter"},
+		{onError: map[string]interface{}{"action": "drop"}, want: `onError.action: unknown action "drop"`},
+		{onError: map[string]interface{}{"retries": -1}, want: "onError.retries: retries must not be negative"},
+		{onError: map[string]interface{}{"action": "pause"}, ignoreErrors: true, want: "ignoreErrors: ignoreErrors cannot be combined with onError action pause"},
+	}
+
+	for _, test := range tests {
+		k := New().(*kafkaSource)
+		err := config.Configure(k, map[string]interface{}{
+			"group":        "myGroupName",
+			"brokers":      "1.2.3.4",
+			"topics":       "topicA",
+			"ignoreErrors": test.ignoreErrors,
+			"onError":      test.onError,
+		})
+
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != test.want {
+			t.Errorf("unexpected error for %v: want %q, got %q", test.onError, test.want, got)
+		}
+	}
+}
+
+func TestConfigureMap_onErrorDefaults(t *testing.T) {
+	k := New().(*kafkaSource)
+	err := config.Configure(k, map[string]interface{}{
+		"group":   "myGroupName",
+		"brokers": "1.2.3.4",
+		"topics":  "topicA",
+		"onError": map[string]interface{}{"retries": 2},
+	})
+	if err != nil {
+		t.Fatalf("config.Configure returned an error: %+v", err)
+	}
+
+	equals(t, k.OnError, errorPolicy{Action: actionFail, Retries: 2, Backoff: time.Second})
+}
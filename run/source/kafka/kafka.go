@@ -1,18 +1,68 @@
 // Package kafka provides an fnrun source that receives messages from Kafka.
 // The kafka source will invoke a function with a message and will mark the
-// message as received unless the function returns an error.
+// message as received once the function succeeds or the error policy has
+// handled its failure.
+//
+// After marking a message, the source records the number of messages remaining
+// in its partition in the fnrun_kafka_consumer_lag metric, labeled by group,
+// topic, and partition.
+//
+// When the fn returns an error, the message may be retried in place and then
+// either fail the consumer group session, be skipped, be published to a
+// dead-letter topic, or pause its partition until a retry succeeds, according
+// to the onError policy.
+//
+// By default, the messages of a partition are processed one at a time. With
+// more than one worker, the messages of a partition are processed
+// concurrently, either in any order or, with key ordering, in order for each
+// key. In either case a message is only marked once every earlier message in
+// its partition has completed, so a restart never skips an unprocessed message.
+//
+// In batch mode, the source invokes the function with a list of inputs of up to
+// maxBatchSize messages of a partition instead of one input at a time. The
+// function may return a result for each message so that only the messages that
+// failed are retried or handled by the error policy.
+//
+// In transactional mode, each message is processed in a Kafka transaction of a
+// producer dedicated to its partition. Transactional kafka middleware and fns
+// produce their messages in that transaction, which commits them atomically
+// with the offset of the message, so read_committed consumers of the output
+// see each message processed exactly once. If the fn fails, the transaction is
+// aborted and the message is delivered again.
+//
+// The source connects with TLS when tls is configured and authenticates with
+// SASL PLAIN or SCRAM when sasl is configured.
+//
+// Each message is invoked in a tracing span that continues the trace in the
+// traceparent header of the message, if it has one. Each batch is invoked in a
+// new trace.
 package kafka
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/fnrun/fnrun/fn"
 	"github.com/fnrun/fnrun/run"
+	"github.com/fnrun/fnrun/run/config"
+	"github.com/fnrun/fnrun/run/kafkaauth"
+	"github.com/fnrun/fnrun/run/kafkaproducer"
 	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
 )
 
+const (
+	orderingKey  = "key"
+	orderingNone = "none"
+)
+
+var isolationLevels = map[string]sarama.IsolationLevel{
+	"read_uncommitted": sarama.ReadUncommitted,
+	"read_committed":   sarama.ReadCommitted,
+}
+
 type kafkaSource struct {
 	Group        string
 	Brokers      []string
@@ -21,15 +71,34 @@ type kafkaSource struct {
 	Assignor     sarama.BalanceStrategy
 	Version      sarama.KafkaVersion `mapstructure:",omitempty"`
 	IgnoreErrors bool
+	OnError      errorPolicy `mapstructure:"onError"`
+	Workers      int
+	Ordering     string
 
-	client sarama.ConsumerGroup
-}
+	MaxBatchSize int
+	MaxBatchWait time.Duration
+	BatchResults bool
 
-func (k *kafkaSource) setUpConsumerGroup() error {
-	if k.client != nil {
-		return nil
-	}
+	Transactional   bool
+	TransactionalID string `mapstructure:"transactionalID"`
+
+	ClientID           string `mapstructure:"clientID"`
+	SessionTimeout     time.Duration
+	FetchMinBytes      int32
+	FetchDefaultBytes  int32
+	FetchMaxBytes      int32
+	IsolationLevel     string
+	AutoCommitInterval time.Duration
+
+	TLS  *kafkaauth.TLS
+	SASL *kafkaauth.SASL
+
+	client      sarama.ConsumerGroup
+	producer    sarama.SyncProducer
+	newProducer func(topic string, partition int32) (sarama.SyncProducer, error)
+}
 
+func (k *kafkaSource) newConfig() (*sarama.Config, error) {
 	config := sarama.NewConfig()
 	config.Version = k.Version
 	config.Consumer.Group.Rebalance.Strategy = k.Assignor
@@ -38,6 +107,46 @@ func (k *kafkaSource) setUpConsumerGroup() error {
 		config.Consumer.Offsets.Initial = sarama.OffsetOldest
 	}
 
+	// Options left unset keep the sarama defaults.
+	if k.ClientID != "" {
+		config.ClientID = k.ClientID
+	}
+	if k.SessionTimeout != 0 {
+		config.Consumer.Group.Session.Timeout = k.SessionTimeout
+	}
+	if k.FetchMinBytes != 0 {
+		config.Consumer.Fetch.Min = k.FetchMinBytes
+	}
+	if k.FetchDefaultBytes != 0 {
+		config.Consumer.Fetch.Default = k.FetchDefaultBytes
+	}
+	if k.FetchMaxBytes != 0 {
+		config.Consumer.Fetch.Max = k.FetchMaxBytes
+	}
+	if k.IsolationLevel != "" {
+		config.Consumer.IsolationLevel = isolationLevels[k.IsolationLevel]
+	}
+	if k.AutoCommitInterval != 0 {
+		config.Consumer.Offsets.AutoCommit.Interval = k.AutoCommitInterval
+	}
+
+	if err := kafkaauth.Apply(config, k.TLS, k.SASL); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func (k *kafkaSource) setUpConsumerGroup() error {
+	if k.client != nil {
+		return nil
+	}
+
+	config, err := k.newConfig()
+	if err != nil {
+		return errors.Wrap(err, "error creating consumer group client")
+	}
+
 	client, err := sarama.NewConsumerGroup(k.Brokers, k.Group, config)
 	if err != nil {
 		return errors.Wrap(err, "error creating consumer group client")
@@ -47,15 +156,104 @@ func (k *kafkaSource) setUpConsumerGroup() error {
 	return nil
 }
 
+// newTransactionalConfig returns the configuration of the transactional
+// producer of a claim.
+func (k *kafkaSource) newTransactionalConfig(topic string, partition int32) (*sarama.Config, error) {
+	config, err := k.newConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := k.TransactionalID
+	if prefix == "" {
+		prefix = k.Group
+	}
+
+	config.Producer.Transaction.ID = fmt.Sprintf("%s-%s-%d", prefix, topic, partition)
+	config.Producer.Idempotent = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Return.Successes = true
+	config.Net.MaxOpenRequests = 1
+
+	// Middleware and fns that produce in the transaction may choose the
+	// partitions of their messages.
+	config.Producer.Partitioner = kafkaproducer.NewPartitioner
+
+	return config, nil
+}
+
+func (k *kafkaSource) newTransactionalProducer(topic string, partition int32) (sarama.SyncProducer, error) {
+	config, err := k.newTransactionalConfig(topic, partition)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating transactional producer")
+	}
+
+	producer, err := sarama.NewSyncProducer(k.Brokers, config)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating transactional producer")
+	}
+	return producer, nil
+}
+
+// setUpDeadLetterProducer creates the producer used to publish failed messages
+// to the dead-letter topic, if the error policy needs one.
+func (k *kafkaSource) setUpDeadLetterProducer() error {
+	if k.producer != nil || k.OnError.Action != actionDeadLetter {
+		return nil
+	}
+
+	config, err := k.newConfig()
+	if err != nil {
+		return errors.Wrap(err, "error creating dead-letter producer")
+	}
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Retry.Max = 10
+	config.Producer.Return.Successes = true
+
+	producer, err := sarama.NewSyncProducer(k.Brokers, config)
+	if err != nil {
+		return errors.Wrap(err, "error creating dead-letter producer")
+	}
+	k.producer = producer
+
+	return nil
+}
+
 func (k *kafkaSource) Serve(ctx context.Context, f fn.Fn) error {
 	if err := k.setUpConsumerGroup(); err != nil {
 		return err
 	}
+	if err := k.setUpDeadLetterProducer(); err != nil {
+		k.client.Close()
+		return err
+	}
+
+	policy := k.OnError
+	if k.IgnoreErrors {
+		policy.Action = actionSkip
+	}
 
+	// Invocations are detached from ctx so that a message being processed when
+	// shutdown begins completes and is marked before the session closes.
 	consumer := &consumer{
-		ctx:          ctx,
-		f:            f,
-		ignoreErrors: k.IgnoreErrors,
+		ctx:      context.WithoutCancel(ctx),
+		f:        f,
+		group:    k.Group,
+		workers:  k.Workers,
+		ordering: k.Ordering,
+		policy:   policy,
+		producer: k.producer,
+		pauser:   newPartitionPauser(k.client),
+
+		maxBatchSize: k.MaxBatchSize,
+		maxBatchWait: k.MaxBatchWait,
+		batchResults: k.BatchResults,
+
+		transactional: k.Transactional,
+		newProducer:   k.newProducer,
+	}
+	if consumer.newProducer == nil {
+		consumer.newProducer = k.newTransactionalProducer
 	}
 
 	errorCh := make(chan error, 1)
@@ -63,6 +261,12 @@ func (k *kafkaSource) Serve(ctx context.Context, f fn.Fn) error {
 	go func() {
 		defer close(errorCh)
 		defer k.client.Close()
+		defer func() {
+			if k.producer != nil {
+				k.producer.Close()
+				k.producer = nil
+			}
+		}()
 
 		for {
 			if ctx.Err() != nil {
@@ -93,21 +297,213 @@ func (k *kafkaSource) ConfigureMap(configMap map[string]interface{}) error {
 		configMap["assignor"] = "sticky"
 	}
 
-	decoderConfig := &mapstructure.DecoderConfig{
-		Metadata: nil,
-		Result:   k,
-		DecodeHook: mapstructure.ComposeDecodeHookFunc(
-			mapstructure.StringToSliceHookFunc(","),
-			stringToKafkaVersionHookFunc(),
-			stringToBalanceStrategyHookFunc(),
-		),
+	return config.Decode(configMap, k,
+		mapstructure.StringToSliceHookFunc(","),
+		mapstructure.StringToTimeDurationHookFunc(),
+		stringToKafkaVersionHookFunc(),
+		stringToBalanceStrategyHookFunc(),
+	)
+}
+
+// Validate checks the configuration for problems that sarama would otherwise
+// only report when the consumer group is created.
+func (k *kafkaSource) Validate() error {
+	if len(k.Brokers) == 0 {
+		return config.WithPath("brokers", errors.New("brokers must contain at least one broker"))
+	}
+	if len(k.Topics) == 0 {
+		return config.WithPath("topics", errors.New("topics must contain at least one topic"))
+	}
+	if k.Group == "" {
+		return config.WithPath("group", errors.New("group is required"))
+	}
+	if k.Workers < 1 {
+		return config.WithPath("workers", errors.New("workers must be at least 1"))
 	}
-	decoder, err := mapstructure.NewDecoder(decoderConfig)
+	if err := k.OnError.Validate(); err != nil {
+		return config.WithPath("onError", err)
+	}
+	if k.IgnoreErrors && k.OnError.Action != actionFail && k.OnError.Action != actionSkip {
+		return config.WithPath("ignoreErrors", errors.New("ignoreErrors cannot be combined with onError action "+k.OnError.Action))
+	}
+	if k.Ordering != orderingKey && k.Ordering != orderingNone {
+		return config.WithPath("ordering", fmt.Errorf("ordering must be %q or %q", orderingKey, orderingNone))
+	}
+	if k.MaxBatchSize < 0 {
+		return config.WithPath("maxBatchSize", errors.New("maxBatchSize must not be negative"))
+	}
+	if k.MaxBatchSize > 0 && k.MaxBatchWait <= 0 {
+		return config.WithPath("maxBatchWait", errors.New("maxBatchWait must be positive"))
+	}
+	if k.MaxBatchSize > 0 && k.Workers > 1 {
+		return config.WithPath("workers", errors.New("workers cannot be combined with maxBatchSize"))
+	}
+	if k.Transactional && k.Workers > 1 {
+		return config.WithPath("workers", errors.New("workers cannot be combined with transactional"))
+	}
+	if k.Transactional && k.MaxBatchSize > 0 {
+		return config.WithPath("maxBatchSize", errors.New("maxBatchSize cannot be combined with transactional"))
+	}
+	if _, ok := isolationLevels[k.IsolationLevel]; k.IsolationLevel != "" && !ok {
+		return config.WithPath("isolationLevel", fmt.Errorf("isolationLevel must be %q or %q", "read_uncommitted", "read_committed"))
+	}
+	if !k.Version.IsAtLeast(sarama.V0_10_2_0) {
+		return config.WithPath("version", fmt.Errorf("version %s is not supported; consumer groups require at least %s", k.Version, sarama.V0_10_2_0))
+	}
+	if k.Transactional && !k.Version.IsAtLeast(sarama.V0_11_0_0) {
+		return config.WithPath("version", fmt.Errorf("version %s is not supported; transactions require at least %s", k.Version, sarama.V0_11_0_0))
+	}
+	if k.TLS != nil {
+		if err := k.TLS.Validate(); err != nil {
+			return config.WithPath("tls", err)
+		}
+	}
+	if k.SASL != nil {
+		if err := k.SASL.Validate(); err != nil {
+			return config.WithPath("sasl", err)
+		}
+	}
+
+	saramaConfig, err := k.newConfig()
 	if err != nil {
 		return err
 	}
+	if k.Transactional {
+		if saramaConfig, err = k.newTransactionalConfig(k.Topics[0], 0); err != nil {
+			return err
+		}
+	}
+	return saramaConfig.Validate()
+}
+
+// Describe describes the configuration of the kafka source.
+func (*kafkaSource) Describe() *config.Schema {
+	stringList := func(description string) *config.Schema {
+		return &config.Schema{
+			Description: description,
+			OneOf: []*config.Schema{
+				{Type: "array", Items: &config.Schema{Type: "string"}},
+				{Type: "string"},
+			},
+		}
+	}
 
-	return decoder.Decode(configMap)
+	return &config.Schema{
+		Description: "Consumes messages from Kafka topics as part of a consumer group, marking each message after the fn processes it successfully.",
+		Type:        "object",
+		Properties: map[string]*config.Schema{
+			"group": {
+				Type:        "string",
+				Description: "The consumer group ID.",
+			},
+			"brokers": stringList("The addresses of the Kafka brokers, as a list or a comma-separated string."),
+			"topics":  stringList("The topics to consume, as a list or a comma-separated string."),
+			"oldest": {
+				Type:        "boolean",
+				Description: "Whether a group without committed offsets starts from the oldest message instead of the newest.",
+				Default:     false,
+			},
+			"assignor": {
+				Type:        "string",
+				Description: "The strategy used to assign partitions to the members of the group.",
+				Enum:        []interface{}{"sticky", "roundrobin", "range"},
+				Default:     "sticky",
+			},
+			"version": {
+				Type:        "string",
+				Description: "The Kafka protocol version, which must be at least 0.10.2.0.",
+				Default:     "2.1.1",
+			},
+			"ignoreErrors": {
+				Type:        "boolean",
+				Description: "Whether messages are marked even if the fn returns an error. It is equivalent to the skip action of onError.",
+				Default:     false,
+			},
+			"onError": config.Describe(&errorPolicy{}),
+			"workers": {
+				Type:        "integer",
+				Description: "The number of messages of each partition that are processed concurrently.",
+				Minimum:     config.Minimum(1),
+				Default:     1,
+			},
+			"ordering": {
+				Type:        "string",
+				Description: "How messages of a partition are ordered when there is more than one worker. With key, messages with the same key are processed in order. With none, messages are processed in any order.",
+				Enum:        []interface{}{orderingKey, orderingNone},
+				Default:     orderingKey,
+			},
+			"maxBatchSize": {
+				Type:        "integer",
+				Description: "Enables batch mode when greater than zero. The fn is invoked with a list of up to this many messages of a partition, and the messages are marked once the whole batch has been handled.",
+				Minimum:     config.Minimum(0),
+				Default:     0,
+			},
+			"maxBatchWait": {
+				Type:        "string",
+				Description: "How long a batch waits for more messages after its first message before the fn is invoked, as a duration such as 500ms.",
+				Default:     "1s",
+			},
+			"batchResults": {
+				Type: "boolean",
+				Description: "Whether the fn returns a list with a result for each message of a batch. A message whose result is an object with a non-empty error field has failed and is handled by onError, " +
+					"while the other messages of the batch succeed. Use the json middleware to deserialize the output of fns that print JSON.",
+				Default: false,
+			},
+			"transactional": {
+				Type: "boolean",
+				Description: "Whether each message is processed in a Kafka transaction that commits its offset together with the messages that transactional kafka middleware and fns produce for it. " +
+					"The transaction is aborted if the fn fails. It requires version 0.11.0.0 or later and cannot be combined with workers or maxBatchSize.",
+				Default: false,
+			},
+			"transactionalID": {
+				Type:        "string",
+				Description: "The prefix of the transactional ID of the producer of each partition, which is followed by the topic and partition. It defaults to the group.",
+			},
+			"clientID": {
+				Type:        "string",
+				Description: "The client ID sent to the brokers with each request.",
+				Default:     "sarama",
+			},
+			"sessionTimeout": {
+				Type:        "string",
+				Description: "How long the group coordinator waits for a heartbeat before removing the consumer from the group, as a duration such as 30s.",
+				Default:     "10s",
+			},
+			"fetchMinBytes": {
+				Type:        "integer",
+				Description: "The minimum number of bytes the broker returns from a fetch.",
+				Minimum:     config.Minimum(1),
+				Default:     1,
+			},
+			"fetchDefaultBytes": {
+				Type:        "integer",
+				Description: "The number of bytes of each partition requested in a fetch.",
+				Minimum:     config.Minimum(1),
+				Default:     1024 * 1024,
+			},
+			"fetchMaxBytes": {
+				Type:        "integer",
+				Description: "The maximum number of bytes of each partition requested in a fetch. Zero means no limit.",
+				Minimum:     config.Minimum(0),
+				Default:     0,
+			},
+			"isolationLevel": {
+				Type:        "string",
+				Description: "Whether messages of transactions that are not yet committed are consumed. The read_committed level requires version 0.11.0.0 or later.",
+				Enum:        []interface{}{"read_uncommitted", "read_committed"},
+				Default:     "read_uncommitted",
+			},
+			"autoCommitInterval": {
+				Type:        "string",
+				Description: "How often marked offsets are committed, as a duration such as 1s.",
+				Default:     "1s",
+			},
+			"tls":  config.Describe(&kafkaauth.TLS{}),
+			"sasl": config.Describe(&kafkaauth.SASL{}),
+		},
+		Required:             []string{"group", "brokers", "topics"},
+		AdditionalProperties: config.NoAdditionalProperties(),
+	}
 }
 
 // New returns a kafka source with default values. The resulting value must be
@@ -116,7 +512,12 @@ func New() run.Source {
 	version, _ := sarama.ParseKafkaVersion("2.1.1")
 
 	return &kafkaSource{
-		Version: version,
-		Oldest:  false,
+		Version:  version,
+		Oldest:   false,
+		Workers:  1,
+		Ordering: orderingKey,
+		OnError:  newErrorPolicy(),
+
+		MaxBatchWait: time.Second,
 	}
 }
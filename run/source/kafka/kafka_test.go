@@ -3,6 +3,7 @@ package kafka
 import (
 	"context"
 	"errors"
+	"fmt"
 	"reflect"
 	"sync"
 	"testing"
@@ -11,6 +12,7 @@ import (
 	"github.com/Shopify/sarama"
 	"github.com/fnrun/fnrun/fn"
 	"github.com/fnrun/fnrun/run/config"
+	"github.com/fnrun/fnrun/run/tracing"
 )
 
 func equals(t *testing.T, got, want interface{}) {
@@ -61,6 +63,79 @@ func TestConfigureMap(t *testing.T) {
 	equals(t, k.Assignor.Name(), sarama.BalanceStrategyRoundRobin.Name())
 }
 
+func TestConfigureMap_consumerOptions(t *testing.T) {
+	k := New().(*kafkaSource)
+	err := config.Configure(k, map[string]interface{}{
+		"group":              "myGroupName",
+		"brokers":            "1.2.3.4",
+		"topics":             "topicA",
+		"clientID":           "fnrunner",
+		"sessionTimeout":     "30s",
+		"fetchMinBytes":      10,
+		"fetchDefaultBytes":  2048,
+		"fetchMaxBytes":      4096,
+		"isolationLevel":     "read_committed",
+		"autoCommitInterval": "5s",
+		"tls":                map[string]interface{}{"insecureSkipVerify": true},
+		"sasl": map[string]interface{}{
+			"mechanism": "SCRAM-SHA-512",
+			"username":  "user",
+			"password":  "secret",
+		},
+	})
+	if err != nil {
+		t.Fatalf("config.Configure returned an error: %+v", err)
+	}
+
+	c, err := k.newConfig()
+	if err != nil {
+		t.Fatalf("newConfig returned an error: %+v", err)
+	}
+
+	equals(t, c.ClientID, "fnrunner")
+	equals(t, c.Consumer.Group.Session.Timeout, 30*time.Second)
+	equals(t, c.Consumer.Fetch.Min, int32(10))
+	equals(t, c.Consumer.Fetch.Default, int32(2048))
+	equals(t, c.Consumer.Fetch.Max, int32(4096))
+	equals(t, c.Consumer.IsolationLevel, sarama.ReadCommitted)
+	equals(t, c.Consumer.Offsets.AutoCommit.Interval, 5*time.Second)
+	equals(t, c.Net.TLS.Enable, true)
+	equals(t, c.Net.TLS.Config.InsecureSkipVerify, true)
+	equals(t, c.Net.SASL.Enable, true)
+	equals(t, c.Net.SASL.Mechanism, sarama.SASLMechanism(sarama.SASLTypeSCRAMSHA512))
+	equals(t, c.Net.SASL.User, "user")
+}
+
+func TestConfigureMap_invalidSASL(t *testing.T) {
+	k := New().(*kafkaSource)
+	err := config.Configure(k, map[string]interface{}{
+		"group":   "myGroupName",
+		"brokers": "1.2.3.4",
+		"topics":  "topicA",
+		"sasl":    map[string]interface{}{"mechanism": "GSSAPI", "username": "user"},
+	})
+
+	want := `sasl.mechanism: unsupported mechanism "GSSAPI"`
+	if err == nil || err.Error() != want {
+		t.Errorf("unexpected error: want %q, got %+v", want, err)
+	}
+}
+
+func TestCreateInput_headers(t *testing.T) {
+	message := newConsumerMessage("my-topic", []byte("some key"), []byte("some value"))
+	message.Headers = append(message.Headers,
+		&sarama.RecordHeader{Key: []byte("content-type"), Value: []byte("application/json")},
+		&sarama.RecordHeader{Key: []byte("source"), Value: []byte("billing")},
+	)
+
+	input := createInput(message)
+
+	deepEquals(t, input["headers"], map[string]interface{}{
+		"content-type": "application/json",
+		"source":       "billing",
+	})
+}
+
 func TestConfigureMap_invalidMapValue(t *testing.T) {
 	k := New().(*kafkaSource)
 	err := config.Configure(k, map[string]interface{}{
@@ -111,6 +186,37 @@ func TestServe(t *testing.T) {
 	}
 }
 
+func TestServe_continuesTraceFromHeaders(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	client := newTestConsumerGroupHandler()
+	k := &kafkaSource{
+		client: client,
+	}
+
+	traceparentCh := make(chan string, 1)
+
+	f := fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		cancel()
+		traceparentCh <- tracing.Traceparent(ctx)
+		return input, nil
+	})
+
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	message := newConsumerMessage("my-topic", []byte("some key"), []byte("some value"))
+	message.Headers = append(message.Headers, &sarama.RecordHeader{
+		Key:   []byte("traceparent"),
+		Value: []byte(traceparent),
+	})
+
+	client.InputCh <- message
+	if err := k.Serve(ctx, f); err != nil {
+		t.Fatal(err)
+	}
+
+	equals(t, <-traceparentCh, traceparent)
+}
+
 func TestServe_withFnError(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	expectedErr := errors.New("expected error")
@@ -155,6 +261,226 @@ func TestServe_withFnError_ignoreErrors(t *testing.T) {
 	}
 }
 
+func TestServe_drainsInFlightMessage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	client := newTestConsumerGroupHandler()
+	k := &kafkaSource{
+		client: client,
+	}
+
+	f := fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		cancel()
+		return nil, ctx.Err()
+	})
+
+	client.InputCh <- newConsumerMessage("my-topic", []byte("some key"), []byte("some value"))
+	err := k.Serve(ctx, f)
+
+	if err != nil {
+		t.Errorf("Serve returned error: %+v", err)
+	}
+}
+
+func TestServe_workersMarkContiguousOffsets(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	client := newTestConsumerGroupHandler()
+	k := &kafkaSource{
+		Workers:  2,
+		Ordering: orderingNone,
+		client:   client,
+	}
+
+	release := make(chan struct{})
+	completedCh := make(chan int64, 2)
+
+	f := fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		offset := input.(map[string]interface{})["offset"].(int64)
+		if offset == 0 {
+			<-release
+			return nil, nil
+		}
+		completedCh <- offset
+		return nil, nil
+	})
+
+	for offset := int64(0); offset < 3; offset++ {
+		message := newConsumerMessage("my-topic", nil, []byte("some value"))
+		message.Offset = offset
+		client.InputCh <- message
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- k.Serve(ctx, f)
+	}()
+
+	<-completedCh
+	<-completedCh
+	if marked := client.markedOffsets(); len(marked) != 0 {
+		t.Errorf("expected no offsets to be marked before offset 0 completed, got %v", marked)
+	}
+
+	close(release)
+	cancel()
+	if err := <-errCh; err != nil {
+		t.Fatalf("Serve returned error: %+v", err)
+	}
+
+	deepEquals(t, client.markedOffsets(), []int64{0, 1, 2})
+}
+
+func TestServe_keyOrdering(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	client := newTestConsumerGroupHandler()
+	k := &kafkaSource{
+		Workers:  4,
+		Ordering: orderingKey,
+		client:   client,
+	}
+
+	var mutex sync.Mutex
+	processed := map[string][]int64{}
+	doneCh := make(chan struct{}, 6)
+
+	f := fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		m := input.(map[string]interface{})
+
+		mutex.Lock()
+		processed[m["key"].(string)] = append(processed[m["key"].(string)], m["offset"].(int64))
+		mutex.Unlock()
+
+		doneCh <- struct{}{}
+		return nil, nil
+	})
+
+	for offset, key := range []string{"a", "b", "a", "b", "a", "b"} {
+		message := newConsumerMessage("my-topic", []byte(key), []byte("some value"))
+		message.Offset = int64(offset)
+		client.InputCh <- message
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- k.Serve(ctx, f)
+	}()
+
+	for i := 0; i < 6; i++ {
+		<-doneCh
+	}
+	cancel()
+	if err := <-errCh; err != nil {
+		t.Fatalf("Serve returned error: %+v", err)
+	}
+
+	deepEquals(t, processed, map[string][]int64{"a": {0, 2, 4}, "b": {1, 3, 5}})
+	deepEquals(t, client.markedOffsets(), []int64{0, 1, 2, 3, 4, 5})
+}
+
+func TestServe_workersStopAtFailedOffset(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	expectedErr := errors.New("expected error")
+
+	client := newTestConsumerGroupHandler()
+	k := &kafkaSource{
+		Workers:  2,
+		Ordering: orderingNone,
+		client:   client,
+	}
+
+	f := fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		if input.(map[string]interface{})["offset"].(int64) == 1 {
+			return nil, expectedErr
+		}
+		return nil, nil
+	})
+
+	for offset := int64(0); offset < 4; offset++ {
+		message := newConsumerMessage("my-topic", nil, []byte("some value"))
+		message.Offset = offset
+		client.InputCh <- message
+	}
+
+	if err := k.Serve(ctx, f); err != expectedErr {
+		t.Fatalf("Serve did not return expected error: want %+v, got %+v", expectedErr, err)
+	}
+
+	for _, offset := range client.markedOffsets() {
+		if offset >= 1 {
+			t.Errorf("offset %d was marked after the failed offset 1", offset)
+		}
+	}
+}
+
+func TestValidate_workers(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		workers  int
+		ordering string
+		wantErr  bool
+	}{
+		{name: "key", workers: 4, ordering: "key"},
+		{name: "none", workers: 4, ordering: "none"},
+		{name: "no workers", workers: 0, ordering: "key", wantErr: true},
+		{name: "unknown ordering", workers: 4, ordering: "partition", wantErr: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			k := New().(*kafkaSource)
+			err := config.Configure(k, map[string]interface{}{
+				"group":    "myGroupName",
+				"brokers":  "1.2.3.4",
+				"topics":   "topicA",
+				"workers":  test.workers,
+				"ordering": test.ordering,
+			})
+
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Errorf("unexpected error: %+v", err)
+			}
+		})
+	}
+}
+
+func TestValidate_requiredKeys(t *testing.T) {
+	tests := []struct {
+		configMap map[string]interface{}
+		want      string
+	}{
+		{configMap: map[string]interface{}{"topics": "topicA", "group": "myGroupName"}, want: "brokers: brokers must contain at least one broker"},
+		{configMap: map[string]interface{}{"brokers": "1.2.3.4", "group": "myGroupName"}, want: "topics: topics must contain at least one topic"},
+		{configMap: map[string]interface{}{"brokers": "1.2.3.4", "topics": "topicA"}, want: "group: group is required"},
+	}
+
+	for _, test := range tests {
+		err := config.Configure(New(), test.configMap)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("unexpected error for %v: want %q, got %v", test.configMap, test.want, err)
+		}
+	}
+}
+
+func TestCleanup_removesLagOfClaims(t *testing.T) {
+	const group = "TestCleanup_removesLagOfClaims"
+	consumerLag.WithLabelValues(group, "topicA", "1").Set(4)
+	consumerLag.WithLabelValues(group, "topicA", "2").Set(2)
+
+	c := &consumer{group: group}
+	session := &testConsumerGroupSession{claims: map[string][]int32{"topicA": {1}}}
+	if err := c.Cleanup(session); err != nil {
+		t.Fatalf("Cleanup returned error: %+v", err)
+	}
+
+	if consumerLag.DeleteLabelValues(group, "topicA", "1") {
+		t.Error("expected the lag of the revoked partition to be removed")
+	}
+	if !consumerLag.DeleteLabelValues(group, "topicA", "2") {
+		t.Error("expected the lag of the other partition to remain")
+	}
+}
+
 func newConsumerMessage(topic string, key, value []byte) *sarama.ConsumerMessage {
 	return &sarama.ConsumerMessage{
 		Headers:        []*sarama.RecordHeader{},
@@ -173,11 +499,13 @@ type testConsumerGroupHandler struct {
 	InputCh chan *sarama.ConsumerMessage
 	errorCh chan error
 	closed  bool
+	marked  []int64
+	paused  []string
 	mutex   sync.Mutex
 }
 
 func (cg *testConsumerGroupHandler) Consume(ctx context.Context, topics []string, handler sarama.ConsumerGroupHandler) error {
-	session := &testConsumerGroupSession{Ctx: ctx}
+	session := &testConsumerGroupSession{Ctx: ctx, handler: cg}
 	claim := newTestConsumerGroupClaim(session, cg.InputCh)
 
 	go func() {
@@ -188,6 +516,13 @@ func (cg *testConsumerGroupHandler) Consume(ctx context.Context, topics []string
 	return handler.ConsumeClaim(session, claim)
 }
 
+func (cg *testConsumerGroupHandler) markedOffsets() []int64 {
+	cg.mutex.Lock()
+	defer cg.mutex.Unlock()
+
+	return append([]int64(nil), cg.marked...)
+}
+
 func (cg *testConsumerGroupHandler) Errors() <-chan error {
 	return cg.errorCh
 }
@@ -205,11 +540,26 @@ func (cg *testConsumerGroupHandler) Close() error {
 	return nil
 }
 
-func (cg *testConsumerGroupHandler) Pause(partitions map[string][]int32) {}
+func (cg *testConsumerGroupHandler) Pause(partitions map[string][]int32) {
+	cg.recordPause("pause", partitions)
+}
 
 func (cg *testConsumerGroupHandler) PauseAll() {}
 
-func (cg *testConsumerGroupHandler) Resume(partitions map[string][]int32) {}
+func (cg *testConsumerGroupHandler) Resume(partitions map[string][]int32) {
+	cg.recordPause("resume", partitions)
+}
+
+func (cg *testConsumerGroupHandler) recordPause(action string, partitions map[string][]int32) {
+	cg.mutex.Lock()
+	defer cg.mutex.Unlock()
+
+	for topic, ps := range partitions {
+		for _, partition := range ps {
+			cg.paused = append(cg.paused, fmt.Sprintf("%s %s/%d", action, topic, partition))
+		}
+	}
+}
 
 func (cg *testConsumerGroupHandler) ResumeAll() {}
 
@@ -224,13 +574,18 @@ func newTestConsumerGroupHandler() *testConsumerGroupHandler {
 // Mock consumer group session
 
 type testConsumerGroupSession struct {
-	Ctx context.Context
+	Ctx     context.Context
+	handler *testConsumerGroupHandler
+	claims  map[string][]int32
 }
 
 var _ sarama.ConsumerGroupSession = (*testConsumerGroupSession)(nil)
 
 func (sess *testConsumerGroupSession) Claims() map[string][]int32 {
-	return map[string][]int32{}
+	if sess.claims == nil {
+		return map[string][]int32{}
+	}
+	return sess.claims
 }
 
 func (sess *testConsumerGroupSession) MemberID() string {
@@ -251,6 +606,14 @@ func (sess *testConsumerGroupSession) ResetOffset(topic string, partition int32,
 }
 
 func (sess *testConsumerGroupSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	if sess.handler == nil {
+		return
+	}
+
+	sess.handler.mutex.Lock()
+	defer sess.handler.mutex.Unlock()
+
+	sess.handler.marked = append(sess.handler.marked, msg.Offset)
 }
 
 func (sess *testConsumerGroupSession) Context() context.Context {
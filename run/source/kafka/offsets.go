@@ -0,0 +1,52 @@
+package kafka
+
+import (
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// pendingMessage is a message of a claim that has been handed to a worker.
+type pendingMessage struct {
+	message *sarama.ConsumerMessage
+	done    bool
+}
+
+// offsetTracker marks the messages of a claim in the order they were received.
+// A message is marked only once it and every message received before it have
+// completed, so messages may complete out of order without the committed
+// offset skipping a message that is still in flight or that failed.
+type offsetTracker struct {
+	mutex   sync.Mutex
+	pending []*pendingMessage
+	mark    func(*sarama.ConsumerMessage)
+}
+
+func newOffsetTracker(mark func(*sarama.ConsumerMessage)) *offsetTracker {
+	return &offsetTracker{mark: mark}
+}
+
+// add records that message has been received and returns the pendingMessage
+// to complete once it has been processed.
+func (t *offsetTracker) add(message *sarama.ConsumerMessage) *pendingMessage {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	p := &pendingMessage{message: message}
+	t.pending = append(t.pending, p)
+	return p
+}
+
+// complete records that p has been processed and marks every message up to the
+// first one that has not.
+func (t *offsetTracker) complete(p *pendingMessage) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	p.done = true
+	for len(t.pending) > 0 && t.pending[0].done {
+		t.mark(t.pending[0].message)
+		t.pending[0] = nil
+		t.pending = t.pending[1:]
+	}
+}
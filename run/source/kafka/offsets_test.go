@@ -0,0 +1,29 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+)
+
+func TestOffsetTracker(t *testing.T) {
+	var marked []int64
+	tracker := newOffsetTracker(func(message *sarama.ConsumerMessage) {
+		marked = append(marked, message.Offset)
+	})
+
+	pending := make([]*pendingMessage, 4)
+	for i := range pending {
+		pending[i] = tracker.add(&sarama.ConsumerMessage{Offset: int64(i)})
+	}
+
+	tracker.complete(pending[1])
+	tracker.complete(pending[3])
+	deepEquals(t, marked, []int64(nil))
+
+	tracker.complete(pending[0])
+	deepEquals(t, marked, []int64{0, 1})
+
+	tracker.complete(pending[2])
+	deepEquals(t, marked, []int64{0, 1, 2, 3})
+}
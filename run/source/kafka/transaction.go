@@ -0,0 +1,79 @@
+package kafka
+
+import (
+	"errors"
+
+	"github.com/Shopify/sarama"
+	"github.com/fnrun/fnrun/run/kafkaproducer"
+)
+
+// consumeTransactionally processes the messages of a claim one at a time, each
+// in a transaction of a producer dedicated to the claim. Transactional kafka
+// middleware and fns produce their messages in the same transaction, which
+// commits them together with the offset of the message. Offsets are therefore
+// never marked in the session.
+//
+// The producer of each claim has its own transactional ID so that, after a
+// rebalance, the producer of the new owner of a partition fences off any
+// producer of its previous owner that is still running.
+func (consumer *consumer) consumeTransactionally(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	producer, err := consumer.newProducer(claim.Topic(), claim.Partition())
+	if err != nil {
+		return err
+	}
+	defer producer.Close()
+
+	committed := claim.InitialOffset() - 1
+	process := func(messages []*sarama.ConsumerMessage) []failure {
+		var failures []failure
+		for _, message := range messages {
+			err := consumer.inTransaction(producer, message, func() error {
+				return consumer.process(kafkaproducer.WithTransaction(consumer.ctx, producer), message)
+			})
+			if err != nil {
+				failures = append(failures, failure{message: message, err: err})
+				continue
+			}
+			committed = message.Offset
+		}
+		return failures
+	}
+
+	return consumer.consumeSequentially(session, claim, process, func(message *sarama.ConsumerMessage) error {
+		// A message that the error policy skipped or published to the
+		// dead-letter topic was not committed by a transaction of its own.
+		if committed < message.Offset {
+			if err := consumer.inTransaction(producer, message, func() error { return nil }); err != nil {
+				return err
+			}
+			committed = message.Offset
+		}
+
+		consumer.recordLag(claim, message)
+		return nil
+	})
+}
+
+// inTransaction runs f in a transaction of producer that also commits the
+// offset of message. The transaction is aborted if f or the commit fails.
+func (consumer *consumer) inTransaction(producer sarama.SyncProducer, message *sarama.ConsumerMessage, f func() error) error {
+	if err := producer.BeginTxn(); err != nil {
+		return err
+	}
+
+	err := f()
+	if err == nil {
+		err = producer.AddMessageToTxn(message, consumer.group, nil)
+	}
+	if err == nil {
+		err = producer.CommitTxn()
+	}
+	if err != nil {
+		if abortErr := producer.AbortTxn(); abortErr != nil {
+			return errors.Join(err, abortErr)
+		}
+		return err
+	}
+
+	return nil
+}
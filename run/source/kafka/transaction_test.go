@@ -0,0 +1,262 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/fnrun/fnrun/fn"
+	"github.com/fnrun/fnrun/run/config"
+	kafkafn "github.com/fnrun/fnrun/run/fn/kafka"
+	"github.com/fnrun/fnrun/run/kafkaproducer"
+)
+
+// transactionalProducer records the operations of the transactions it takes
+// part in.
+type transactionalProducer struct {
+	sarama.SyncProducer
+
+	mutex      sync.Mutex
+	operations []string
+	closed     bool
+}
+
+func (p *transactionalProducer) record(operation string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.operations = append(p.operations, operation)
+	return nil
+}
+
+func (p *transactionalProducer) recorded() []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return append([]string(nil), p.operations...)
+}
+
+func (p *transactionalProducer) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	return 0, 0, p.record("send " + msg.Topic)
+}
+
+func (p *transactionalProducer) BeginTxn() error { return p.record("begin") }
+
+func (p *transactionalProducer) CommitTxn() error { return p.record("commit") }
+
+func (p *transactionalProducer) AbortTxn() error { return p.record("abort") }
+
+func (p *transactionalProducer) AddMessageToTxn(msg *sarama.ConsumerMessage, groupId string, metadata *string) error {
+	return p.record(fmt.Sprintf("offset %d %s", msg.Offset, groupId))
+}
+
+func (p *transactionalProducer) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.closed = true
+	return nil
+}
+
+func newTransactionalSource(client *testConsumerGroupHandler, producer *transactionalProducer) *kafkaSource {
+	return &kafkaSource{
+		Group:         "my-group",
+		Transactional: true,
+		client:        client,
+		newProducer: func(topic string, partition int32) (sarama.SyncProducer, error) {
+			return producer, nil
+		},
+	}
+}
+
+func TestServe_transactional(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	client := newTestConsumerGroupHandler()
+	producer := &transactionalProducer{}
+	k := newTransactionalSource(client, producer)
+
+	f := fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		defer cancel()
+
+		txn, err := kafkaproducer.Transaction(ctx)
+		if err != nil {
+			return nil, err
+		}
+		_, _, err = txn.SendMessage(&sarama.ProducerMessage{Topic: "output"})
+		return nil, err
+	})
+
+	client.InputCh <- newConsumerMessage("my-topic", []byte("some key"), []byte("some value"))
+	if err := k.Serve(ctx, f); err != nil {
+		t.Fatalf("Serve returned error: %+v", err)
+	}
+
+	deepEquals(t, producer.recorded(), []string{"begin", "send output", "offset 0 my-group", "commit"})
+	deepEquals(t, client.markedOffsets(), []int64(nil))
+	equals(t, producer.closed, true)
+}
+
+func TestServe_transactionalAbortsOnError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	expectedErr := errors.New("expected error")
+
+	client := newTestConsumerGroupHandler()
+	producer := &transactionalProducer{}
+	k := newTransactionalSource(client, producer)
+
+	f := fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		return nil, expectedErr
+	})
+
+	client.InputCh <- newConsumerMessage("my-topic", []byte("some key"), []byte("some value"))
+	if err := k.Serve(ctx, f); err != expectedErr {
+		t.Errorf("Serve did not return expected error: want %+v, got %+v", expectedErr, err)
+	}
+
+	deepEquals(t, producer.recorded(), []string{"begin", "abort"})
+}
+
+func TestServe_transactionalCommitsSkippedOffset(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	client := newTestConsumerGroupHandler()
+	producer := &transactionalProducer{}
+	k := newTransactionalSource(client, producer)
+	k.OnError = errorPolicy{Action: actionSkip}
+
+	f := fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		cancel()
+		return nil, errors.New("fn failed")
+	})
+
+	client.InputCh <- newConsumerMessage("my-topic", []byte("some key"), []byte("some value"))
+	if err := k.Serve(ctx, f); err != nil {
+		t.Fatalf("Serve returned error: %+v", err)
+	}
+
+	deepEquals(t, producer.recorded(), []string{"begin", "abort", "begin", "offset 0 my-group", "commit"})
+}
+
+func TestNewTransactionalConfig(t *testing.T) {
+	k := New().(*kafkaSource)
+	err := config.Configure(k, map[string]interface{}{
+		"group":         "my-group",
+		"brokers":       "1.2.3.4",
+		"topics":        "topicA",
+		"transactional": true,
+	})
+	if err != nil {
+		t.Fatalf("config.Configure returned an error: %+v", err)
+	}
+
+	c, err := k.newTransactionalConfig("topicA", 3)
+	if err != nil {
+		t.Fatalf("newTransactionalConfig returned an error: %+v", err)
+	}
+	equals(t, c.Producer.Transaction.ID, "my-group-topicA-3")
+	equals(t, c.Producer.Idempotent, true)
+
+	k.TransactionalID = "my-app"
+	c, err = k.newTransactionalConfig("topicA", 3)
+	if err != nil {
+		t.Fatalf("newTransactionalConfig returned an error: %+v", err)
+	}
+	equals(t, c.Producer.Transaction.ID, "my-app-topicA-3")
+}
+
+func TestNewTransactionalConfig_chosenPartition(t *testing.T) {
+	k := New().(*kafkaSource)
+	err := config.Configure(k, map[string]interface{}{
+		"group":         "my-group",
+		"brokers":       "1.2.3.4",
+		"topics":        "topicA",
+		"transactional": true,
+	})
+	if err != nil {
+		t.Fatalf("config.Configure returned an error: %+v", err)
+	}
+
+	c, err := k.newTransactionalConfig("topicA", 0)
+	if err != nil {
+		t.Fatalf("newTransactionalConfig returned an error: %+v", err)
+	}
+	shards := []int32{7, 3}
+	producer := mocks.NewSyncProducer(t, c)
+	for _, shard := range shards {
+		shard := shard
+		producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(message *sarama.ProducerMessage) error {
+			if message.Partition != shard {
+				return fmt.Errorf("expected the message to be produced to partition %d, got %d", shard, message.Partition)
+			}
+			return nil
+		})
+	}
+
+	f := kafkafn.New()
+	err = config.Configure(f, map[string]interface{}{
+		"topic":         "orders",
+		"partition":     ".shard",
+		"transactional": true,
+	})
+	if err != nil {
+		t.Fatalf("config.Configure returned an error: %+v", err)
+	}
+
+	if err := producer.BeginTxn(); err != nil {
+		t.Fatalf("BeginTxn returned an error: %+v", err)
+	}
+	ctx := kafkaproducer.WithTransaction(context.Background(), producer)
+	for _, shard := range shards {
+		if _, err := f.Invoke(ctx, map[string]interface{}{"shard": shard}); err != nil {
+			t.Fatalf("Invoke returned an error: %+v", err)
+		}
+	}
+	if err := producer.CommitTxn(); err != nil {
+		t.Fatalf("CommitTxn returned an error: %+v", err)
+	}
+}
+
+func TestValidate_transactional(t *testing.T) {
+	tests := map[string]struct {
+		options map[string]interface{}
+		wantErr string
+	}{
+		"workers": {
+			options: map[string]interface{}{"workers": 2},
+			wantErr: "workers: workers cannot be combined with transactional",
+		},
+		"batch": {
+			options: map[string]interface{}{"maxBatchSize": 10},
+			wantErr: "maxBatchSize: maxBatchSize cannot be combined with transactional",
+		},
+		"version": {
+			options: map[string]interface{}{"version": "0.10.2.0"},
+			wantErr: "version: version 0.10.2.0 is not supported; transactions require at least 0.11.0.0",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := map[string]interface{}{
+				"group":         "my-group",
+				"brokers":       "1.2.3.4",
+				"topics":        "topicA",
+				"transactional": true,
+			}
+			for key, value := range test.options {
+				m[key] = value
+			}
+
+			err := config.Configure(New(), m)
+			if err == nil || err.Error() != test.wantErr {
+				t.Errorf("unexpected error: want %q, got %+v", test.wantErr, err)
+			}
+		})
+	}
+}
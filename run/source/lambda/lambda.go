@@ -9,10 +9,15 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/fnrun/fnrun/fn"
 	"github.com/fnrun/fnrun/run"
-	"github.com/mitchellh/mapstructure"
+	"github.com/fnrun/fnrun/run/config"
+	"github.com/fnrun/fnrun/run/tracing"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func postError(baseURL string, invocationID string, errToSend error) error {
@@ -32,6 +37,46 @@ func postError(baseURL string, invocationID string, errToSend error) error {
 	return err
 }
 
+// traceparent converts an X-Ray trace header, such as the value of
+// Lambda-Runtime-Trace-Id, to a W3C traceparent. It returns an empty string if
+// the header does not contain both a root trace ID and a parent ID.
+func traceparent(header string) string {
+	var root, parent string
+	flags := "00"
+
+	for _, field := range strings.Split(header, ";") {
+		key, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		switch key {
+		case "Root":
+			// A root trace ID has the form 1-{8 hex digits}-{24 hex digits}.
+			parts := strings.Split(value, "-")
+			if len(parts) == 3 && parts[0] == "1" {
+				root = parts[1] + parts[2]
+			}
+		case "Parent":
+			parent = value
+		case "Sampled":
+			if value == "1" {
+				flags = "01"
+			}
+		}
+	}
+
+	if len(root) != 32 || len(parent) != 16 {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-%s", strings.ToLower(root), strings.ToLower(parent), flags)
+}
+
+// spanName returns the name of the span of each invocation, which is the name
+// of the function.
+func spanName() string {
+	if name := os.Getenv("AWS_LAMBDA_FUNCTION_NAME"); name != "" {
+		return name
+	}
+	return "lambda"
+}
+
 type lambdaSource struct {
 	JSONDeserializeEvent bool   `mapstructure:"jsonDeserializeEvent,omitempty"`
 	RuntimeAPI           string `mapstructure:"runtimeAPI,omitempty"`
@@ -58,7 +103,15 @@ func (l *lambdaSource) Serve(ctx context.Context, f fn.Fn) error {
 			return err
 		}
 
-		output, err := f.Invoke(ctx, input)
+		carrier := propagation.MapCarrier{}
+		if tp := traceparent(resp.Header.Get("Lambda-Runtime-Trace-Id")); tp != "" {
+			carrier.Set("traceparent", tp)
+		}
+		invokeCtx, span := tracing.StartInput(ctx, spanName(), trace.SpanKindServer, carrier,
+			semconv.FaaSInvocationID(invocationID),
+		)
+		output, err := f.Invoke(invokeCtx, input)
+		tracing.End(span, err)
 		if err != nil {
 			if err := postError(baseURL, invocationID, err); err != nil {
 				return err
@@ -122,7 +175,27 @@ func (l *lambdaSource) createInput(resp *http.Response) (map[string]interface{},
 }
 
 func (l *lambdaSource) ConfigureMap(configMap map[string]interface{}) error {
-	return mapstructure.Decode(configMap, l)
+	return config.Decode(configMap, l)
+}
+
+// Describe describes the configuration of the lambda source.
+func (*lambdaSource) Describe() *config.Schema {
+	return &config.Schema{
+		Description: "Serves invocations from the AWS Lambda runtime API.",
+		Type:        "object",
+		Properties: map[string]*config.Schema{
+			"jsonDeserializeEvent": {
+				Type:        "boolean",
+				Description: "Whether each event is deserialized from JSON before the fn is invoked.",
+				Default:     true,
+			},
+			"runtimeAPI": {
+				Type:        "string",
+				Description: "The host and port of the runtime API. Defaults to the value of AWS_LAMBDA_RUNTIME_API.",
+			},
+		},
+		AdditionalProperties: config.NoAdditionalProperties(),
+	}
 }
 
 // New returns a source that serves requests from AWS Lambda.
@@ -16,6 +16,7 @@ import (
 	"github.com/fnrun/fnrun/run/config"
 	"github.com/fnrun/fnrun/run/fn/identity"
 	"github.com/fnrun/fnrun/run/source/lambda"
+	"github.com/fnrun/fnrun/run/tracing"
 )
 
 func TestServe_withDoneContext(t *testing.T) {
@@ -297,3 +298,48 @@ func TestServe(t *testing.T) {
 	// make a server that will requests with incrementing ids
 	// it will send success and error posts to a receive channel
 }
+
+func TestServe_continuesXRayTrace(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Add("Lambda-Runtime-Aws-Request-Id", "1")
+		rw.Header().Add("Lambda-Runtime-Trace-Id", "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1")
+		rw.WriteHeader(http.StatusOK)
+		rw.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	src := lambda.New()
+	err := config.Configure(src, map[string]interface{}{
+		"runtimeAPI": strings.Replace(server.URL, "http://", "", 1),
+	})
+	if err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	traceparentCh := make(chan string, 1)
+
+	f := fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		select {
+		case traceparentCh <- tracing.Traceparent(ctx):
+		default:
+		}
+		return input, nil
+	})
+
+	go func() {
+		src.Serve(ctx, f)
+	}()
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("function not called within the timeout period")
+	case got := <-traceparentCh:
+		want := "00-5759e988bd862e3fe1be46a994272793-53995c3f42cd8ad8-01"
+		if got != want {
+			t.Errorf("unexpected traceparent: want %q, got %q", want, got)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/fnrun/fnrun/fn"
 	"github.com/fnrun/fnrun/run"
 	"github.com/fnrun/fnrun/run/config"
+	"github.com/fnrun/fnrun/run/schema"
 )
 
 type wrappedSource struct {
@@ -22,7 +23,7 @@ func (w *wrappedSource) configure(sourceKey string, sourceConfig interface{}) er
 
 	source := sourceFactory()
 	if err := config.Configure(source, sourceConfig); err != nil {
-		return err
+		return config.WithPath(sourceKey, err)
 	}
 
 	w.source = source
@@ -46,10 +47,25 @@ func (w *wrappedSource) RequiresConfig() bool {
 	return true
 }
 
+func (w *wrappedSource) Start(ctx context.Context) error {
+	return run.Start(ctx, w.source)
+}
+
+func (w *wrappedSource) Close() error {
+	return run.Close(w.source)
+}
+
 func (w *wrappedSource) Serve(ctx context.Context, f fn.Fn) error {
 	return w.source.Serve(ctx, f)
 }
 
+// Describe describes the configuration of the source selected by the loader.
+func (w *wrappedSource) Describe() *config.Schema {
+	s := schema.Components(w.registry.SourceKeys())
+	s.Description = "The source that generates inputs."
+	return s
+}
+
 // New returns a source that can instantiate another source based on
 // its configuration data and information held in the registry.
 func New(registry run.Registry) run.Source {
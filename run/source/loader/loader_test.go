@@ -52,7 +52,7 @@ func TestConfigureString_invalidSourceConfig(t *testing.T) {
 	}
 
 	got := err.Error()
-	want := `*loader_test.configurableSource could not be configured with object of type <nil>`
+	want := `configurable: *loader_test.configurableSource could not be configured with object of type <nil>`
 
 	if got != want {
 		t.Errorf("unexpected error message: want %q, got %q", want, got)
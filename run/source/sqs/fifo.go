@@ -0,0 +1,39 @@
+package sqs
+
+import (
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// fifoSuffix is the suffix of the name of every FIFO queue.
+const fifoSuffix = ".fifo"
+
+// fifoAttributes maps the keys of the input of the fn to the system attributes
+// of messages from FIFO queues.
+var fifoAttributes = map[string]types.MessageSystemAttributeName{
+	"messageGroupId":         types.MessageSystemAttributeNameMessageGroupId,
+	"messageDeduplicationId": types.MessageSystemAttributeNameMessageDeduplicationId,
+	"sequenceNumber":         types.MessageSystemAttributeNameSequenceNumber,
+}
+
+// groupMessages splits messages by message group, preserving the order of the
+// messages within each group. SQS does not deliver further messages of a group
+// while any of its messages are in flight, so processing the groups of each
+// receive in order is enough to process every group in order.
+func groupMessages(messages []types.Message) [][]types.Message {
+	var groups [][]types.Message
+	index := make(map[string]int)
+
+	for _, message := range messages {
+		group := message.Attributes[string(types.MessageSystemAttributeNameMessageGroupId)]
+
+		i, ok := index[group]
+		if !ok {
+			i = len(groups)
+			index[group] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], message)
+	}
+
+	return groups
+}
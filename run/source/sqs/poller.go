@@ -0,0 +1,303 @@
+package sqs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fnrun/fnrun/fn"
+	"github.com/fnrun/fnrun/run/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxDeleteBatchSize is the maximum number of entries in a DeleteMessageBatch
+// request.
+const maxDeleteBatchSize = 10
+
+// sqsAPI is the subset of the SQS client used by the source.
+type sqsAPI interface {
+	GetQueueUrl(ctx context.Context, params *sqs.GetQueueUrlInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error)
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessageBatch(ctx context.Context, params *sqs.DeleteMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageBatchOutput, error)
+	ChangeMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error)
+}
+
+// poller receives messages from a queue and hands them to workers, which
+// invoke the fn and pass the receipt handles of the messages they processed
+// successfully to a deleter.
+type poller struct {
+	client   sqsAPI
+	config   *sqsSourceConfig
+	queueURL *string
+	f        fn.Fn
+	fifo     bool
+
+	// ctx is used for invocations and for the requests that acknowledge or
+	// release messages. It is not cancelled when Serve's context is, so that
+	// messages received before shutdown begins are processed and deleted.
+	ctx context.Context
+
+	received prometheus.Counter
+	deleted  prometheus.Counter
+}
+
+// run polls the queue until ctx is cancelled or a request fails, and then
+// waits for the workers to finish the messages already handed to them.
+func (p *poller) run(ctx context.Context) error {
+	pollCtx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	units := make(chan []types.Message)
+	acks := make(chan *string)
+
+	var workers sync.WaitGroup
+	for i := 0; i < p.config.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for unit := range units {
+				p.handleUnit(unit, acks)
+			}
+		}()
+	}
+
+	deleteErr := make(chan error, 1)
+	go func() {
+		deleteErr <- p.deleteAll(acks, stop)
+	}()
+
+	receiveErr := p.receive(pollCtx, units)
+	close(units)
+	workers.Wait()
+	close(acks)
+
+	if err := <-deleteErr; err != nil {
+		return err
+	}
+	return receiveErr
+}
+
+// receive long polls the queue and sends the messages it receives to workers
+// as units until ctx is cancelled. Messages that were received but not handed
+// to a worker when ctx is cancelled are released.
+func (p *poller) receive(ctx context.Context, units chan<- []types.Message) error {
+	for {
+		result, err := p.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			MessageSystemAttributeNames: []types.MessageSystemAttributeName{
+				types.MessageSystemAttributeNameAll,
+			},
+			MessageAttributeNames: []string{
+				string(types.QueueAttributeNameAll),
+			},
+			QueueUrl:            p.queueURL,
+			MaxNumberOfMessages: p.config.BatchSize,
+			VisibilityTimeout:   p.config.Timeout,
+			WaitTimeSeconds:     p.config.WaitTime,
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		p.received.Add(float64(len(result.Messages)))
+
+		batch := p.units(result.Messages)
+		for i, unit := range batch {
+			if !p.dispatch(ctx, units, unit) {
+				for _, unit := range batch[i:] {
+					p.changeVisibility(unit, 0)
+				}
+				return nil
+			}
+		}
+	}
+}
+
+// units splits messages into the units of work handed to workers. Each message
+// is a unit of its own unless the queue is a FIFO queue, in which case the
+// messages of each message group form a unit.
+func (p *poller) units(messages []types.Message) [][]types.Message {
+	if p.fifo {
+		return groupMessages(messages)
+	}
+
+	units := make([][]types.Message, len(messages))
+	for i := range messages {
+		units[i] = messages[i : i+1]
+	}
+	return units
+}
+
+// dispatch sends unit to a worker unless ctx is cancelled first. It reports
+// whether the unit was sent.
+func (p *poller) dispatch(ctx context.Context, units chan<- []types.Message, unit []types.Message) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	select {
+	case units <- unit:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// handleUnit handles the messages of unit in order. Once a message fails, it
+// and the messages after it become visible again after the backoff, so that
+// the messages of a FIFO message group are never processed out of order.
+func (p *poller) handleUnit(unit []types.Message, acks chan<- *string) {
+	for i := range unit {
+		if !p.handle(unit[i:], acks) {
+			p.changeVisibility(unit[i:], p.config.Backoff)
+			return
+		}
+	}
+}
+
+// handle invokes the fn with the first of pending messages and acknowledges it
+// if it was processed successfully. The visibility timeouts of all pending
+// messages are extended while the fn runs. It reports whether the fn
+// succeeded.
+func (p *poller) handle(pending []types.Message, acks chan<- *string) bool {
+	message := pending[0]
+	invokeCtx, span := tracing.StartInput(p.ctx, p.config.QueueName+" process", trace.SpanKindConsumer, attributeCarrier(message.MessageAttributes),
+		semconv.MessagingSystemAWSSqs,
+		semconv.MessagingDestinationName(p.config.QueueName),
+		semconv.MessagingMessageID(aws.ToString(message.MessageId)),
+	)
+	stopHeartbeat := p.heartbeat(pending)
+	_, err := p.f.Invoke(invokeCtx, createInput(&message))
+	stopHeartbeat()
+	tracing.End(span, err)
+	if err != nil {
+		return false
+	}
+
+	acks <- message.ReceiptHandle
+	return true
+}
+
+// heartbeat extends the visibility timeout of messages every heartbeat
+// interval until the returned function is called, so that messages whose
+// processing outlasts their visibility timeout are not delivered again. The
+// returned function waits for any extension in progress to finish.
+func (p *poller) heartbeat(messages []types.Message) func() {
+	if p.config.HeartbeatInterval <= 0 {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(p.ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(p.config.HeartbeatInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				for _, message := range messages {
+					_, err := p.client.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+						QueueUrl:          p.queueURL,
+						ReceiptHandle:     message.ReceiptHandle,
+						VisibilityTimeout: p.config.Timeout,
+					})
+					if err != nil && ctx.Err() == nil {
+						log.Printf("Error extending visibility of message %s: %+v\n", aws.ToString(message.MessageId), err)
+					}
+				}
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// changeVisibility makes messages visible again after timeout seconds. Errors
+// are logged because the messages become visible once their visibility
+// timeout expires regardless.
+func (p *poller) changeVisibility(messages []types.Message, timeout int32) {
+	for _, message := range messages {
+		_, err := p.client.ChangeMessageVisibility(p.ctx, &sqs.ChangeMessageVisibilityInput{
+			QueueUrl:          p.queueURL,
+			ReceiptHandle:     message.ReceiptHandle,
+			VisibilityTimeout: timeout,
+		})
+		if err != nil {
+			log.Printf("Error changing visibility of message %s: %+v\n", aws.ToString(message.MessageId), err)
+		}
+	}
+}
+
+// deleteAll deletes the messages whose receipt handles are sent to acks,
+// batching the handles that are ready at the same time. If a deletion fails,
+// deleteAll calls stop and discards the remaining handles.
+func (p *poller) deleteAll(acks <-chan *string, stop context.CancelFunc) error {
+	var err error
+	for handle := range acks {
+		batch := []*string{handle}
+	collect:
+		for len(batch) < maxDeleteBatchSize {
+			select {
+			case handle, ok := <-acks:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, handle)
+			default:
+				break collect
+			}
+		}
+
+		if err != nil {
+			continue
+		}
+		if err = p.deleteBatch(batch); err != nil {
+			stop()
+		}
+	}
+	return err
+}
+
+func (p *poller) deleteBatch(handles []*string) error {
+	entries := make([]types.DeleteMessageBatchRequestEntry, len(handles))
+	for i, handle := range handles {
+		entries[i] = types.DeleteMessageBatchRequestEntry{
+			Id:            aws.String(strconv.Itoa(i)),
+			ReceiptHandle: handle,
+		}
+	}
+
+	result, err := p.client.DeleteMessageBatch(p.ctx, &sqs.DeleteMessageBatchInput{
+		QueueUrl: p.queueURL,
+		Entries:  entries,
+	})
+	if err != nil {
+		return err
+	}
+
+	p.deleted.Add(float64(len(result.Successful)))
+	if len(result.Failed) > 0 {
+		failed := result.Failed[0]
+		return fmt.Errorf("error deleting %d of %d messages: %s: %s", len(result.Failed), len(handles), aws.ToString(failed.Code), aws.ToString(failed.Message))
+	}
+	return nil
+}
@@ -11,31 +11,91 @@
 // an integer value representing the number of seconds of the message visibility
 // timeout, and a `batchSize` contain an integer describing the maximum number
 // of messages that can be received with each polling request to the queue.
+//
+// The source long polls the queue, waiting up to `waitTime` seconds for
+// messages to arrive, and processes up to `workers` messages concurrently.
+// Processed messages are deleted in batches. A message that the fn fails to
+// process becomes visible again after `backoff` seconds. When the context of
+// Serve is cancelled, the source stops polling, releases the messages it has
+// received but not started processing, and finishes processing the rest.
+//
+// The source counts the messages it receives and deletes in the
+// fnrun_sqs_messages_received_total and fnrun_sqs_messages_deleted_total
+// metrics, labeled by queue.
+//
+// The input of the fn contains the `id`, `body`, `receiptHandle` and
+// `md5OfBody` of each message, its system `attributes` such as SentTimestamp,
+// its `messageAttributes`, and its `approximateReceiveCount`. If
+// `heartbeatInterval` is set, the visibility timeout of a message is extended
+// at that interval until the fn returns, so that slow invocations do not cause
+// the message to be delivered again.
+//
+// A queue whose name ends in .fifo is processed as a FIFO queue. The messages
+// of each message group are processed strictly in order, while different
+// groups are processed concurrently by the workers. When a message fails, it
+// and the messages of its group received with it become visible again after
+// the backoff, which blocks only that group until then. The input of the fn
+// also contains the `messageGroupId`, `messageDeduplicationId` and
+// `sequenceNumber` of messages from FIFO queues.
+//
+// Each message is invoked in a tracing span that continues the trace in the
+// traceparent message attribute, if the message has one.
 package sqs
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
 	"github.com/fnrun/fnrun/fn"
 	"github.com/fnrun/fnrun/run"
+	"github.com/fnrun/fnrun/run/awspublisher"
+	runconfig "github.com/fnrun/fnrun/run/config"
+	"github.com/fnrun/fnrun/run/metrics"
 	"github.com/mitchellh/mapstructure"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
+var (
+	messagesReceived = metrics.MustRegister(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "sqs",
+		Name:      "messages_received_total",
+		Help:      "The number of messages received from an SQS queue.",
+	}, []string{"queue"}))
+	messagesDeleted = metrics.MustRegister(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "sqs",
+		Name:      "messages_deleted_total",
+		Help:      "The number of messages deleted from an SQS queue after being processed.",
+	}, []string{"queue"}))
+)
+
+// maxVisibilityTimeout is the maximum visibility timeout of a message, in
+// seconds.
+const maxVisibilityTimeout = 43200
+
 type sqsSource struct {
 	config *sqsSourceConfig
+	client sqsAPI
 }
 
 type sqsSourceConfig struct {
-	QueueName     string `mapstructure:"queue"`
-	Timeout       int32  `mapstructure:"timeout,omitempty"`
-	BatchSize     int32  `mapstructure:"batchSize,omitempty"`
-	EndpointURL   string `mapstructure:"endpointURL,omitempty"`
-	PartitionID   string `mapstructure:"partitionID,omitempty"`
-	SigningRegion string `mapstructure:"signingRegion,omitempty"`
+	QueueName         string        `mapstructure:"queue"`
+	Timeout           int32         `mapstructure:"timeout,omitempty"`
+	BatchSize         int32         `mapstructure:"batchSize,omitempty"`
+	WaitTime          int32         `mapstructure:"waitTime"`
+	Workers           int           `mapstructure:"workers"`
+	Backoff           int32         `mapstructure:"backoff"`
+	HeartbeatInterval time.Duration `mapstructure:"heartbeatInterval"`
+
+	awspublisher.Endpoint `mapstructure:",squash"`
 }
 
 func (*sqsSource) RequiresConfig() bool {
@@ -48,90 +108,216 @@ func (s *sqsSource) ConfigureString(queueName string) error {
 }
 
 func (s *sqsSource) ConfigureMap(configMap map[string]interface{}) error {
-	return mapstructure.Decode(configMap, s.config)
+	return runconfig.Decode(configMap, s.config, mapstructure.StringToTimeDurationHookFunc())
+}
+
+func (s *sqsSource) Validate() error {
+	if s.config.QueueName == "" {
+		return runconfig.WithPath("queue", errors.New("queue is required"))
+	}
+	if s.config.BatchSize < 1 || s.config.BatchSize > 10 {
+		return runconfig.WithPath("batchSize", errors.New("batchSize must be between 1 and 10"))
+	}
+	if s.config.WaitTime < 0 || s.config.WaitTime > 20 {
+		return runconfig.WithPath("waitTime", errors.New("waitTime must be between 0 and 20"))
+	}
+	if s.config.Workers < 1 {
+		return runconfig.WithPath("workers", errors.New("workers must be at least 1"))
+	}
+	if s.config.Timeout < 0 || s.config.Timeout > maxVisibilityTimeout {
+		return runconfig.WithPath("timeout", fmt.Errorf("timeout must be between 0 and %d", maxVisibilityTimeout))
+	}
+	if s.config.Backoff < 0 || s.config.Backoff > maxVisibilityTimeout {
+		return runconfig.WithPath("backoff", fmt.Errorf("backoff must be between 0 and %d", maxVisibilityTimeout))
+	}
+	if s.config.HeartbeatInterval < 0 {
+		return runconfig.WithPath("heartbeatInterval", errors.New("heartbeatInterval must not be negative"))
+	}
+	if s.config.HeartbeatInterval > 0 && s.config.HeartbeatInterval >= time.Duration(s.config.Timeout)*time.Second {
+		return runconfig.WithPath("heartbeatInterval", errors.New("heartbeatInterval must be less than timeout"))
+	}
+	return nil
+}
+
+// newClient returns the client of the source, which is created from the
+// default AWS configuration unless one was set for testing.
+func (s *sqsSource) newClient(ctx context.Context) (sqsAPI, error) {
+	if s.client != nil {
+		return s.client, nil
+	}
+
+	cfg, err := s.config.LoadConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return sqs.NewFromConfig(cfg), nil
 }
 
 func (s *sqsSource) Serve(ctx context.Context, f fn.Fn) error {
-	cfg, err := config.LoadDefaultConfig(ctx)
+	client, err := s.newClient(ctx)
 	if err != nil {
 		return err
 	}
-	if s.config.EndpointURL != "" {
-		customResolver := aws.EndpointResolverFunc(func(service, region string) (aws.Endpoint, error) {
-			return aws.Endpoint{
-				PartitionID:   s.config.PartitionID,
-				URL:           s.config.EndpointURL,
-				SigningRegion: s.config.SigningRegion,
-			}, nil
-		})
-		cfg.EndpointResolver = customResolver
-	}
-
-	svc := sqs.NewFromConfig(cfg)
 
-	urlResult, err := svc.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{
+	urlResult, err := client.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{
 		QueueName: &s.config.QueueName,
 	})
-
 	if err != nil {
 		return err
 	}
 
-	queueURL := urlResult.QueueUrl
+	p := &poller{
+		client:   client,
+		config:   s.config,
+		queueURL: urlResult.QueueUrl,
+		f:        f,
+		fifo:     strings.HasSuffix(s.config.QueueName, fifoSuffix),
+		ctx:      context.WithoutCancel(ctx),
+		received: messagesReceived.WithLabelValues(s.config.QueueName),
+		deleted:  messagesDeleted.WithLabelValues(s.config.QueueName),
+	}
+	return p.run(ctx)
+}
 
-	for {
-		msgResult, err := svc.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
-			AttributeNames: []types.QueueAttributeName{
-				types.QueueAttributeName(types.MessageSystemAttributeNameSentTimestamp),
-			},
-			MessageAttributeNames: []string{
-				string(types.QueueAttributeNameAll),
-			},
-			QueueUrl:            queueURL,
-			MaxNumberOfMessages: s.config.BatchSize,
-			VisibilityTimeout:   s.config.Timeout,
-		})
+// attributeCarrier adapts the attributes of an SQS message to a
+// propagation.TextMapCarrier.
+type attributeCarrier map[string]types.MessageAttributeValue
 
-		if err != nil {
-			return err
-		}
+func (c attributeCarrier) Get(key string) string {
+	return aws.ToString(c[key].StringValue)
+}
 
-		for _, message := range msgResult.Messages {
-			_, err = f.Invoke(ctx, createInput(&message))
-			if err != nil {
-				continue
-			}
-
-			_, err = svc.DeleteMessage(ctx, &sqs.DeleteMessageInput{
-				QueueUrl:      queueURL,
-				ReceiptHandle: message.ReceiptHandle,
-			})
-			if err != nil {
-				return err
-			}
-		}
+func (c attributeCarrier) Set(key, value string) {
+	c[key] = types.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(value),
 	}
 }
 
+func (c attributeCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
 func createInput(message *types.Message) map[string]interface{} {
 	input := make(map[string]interface{})
 
-	input["id"] = *message.MessageId
-	input["body"] = *message.Body
+	input["id"] = aws.ToString(message.MessageId)
+	input["body"] = aws.ToString(message.Body)
+	input["receiptHandle"] = aws.ToString(message.ReceiptHandle)
+	input["md5OfBody"] = aws.ToString(message.MD5OfBody)
+
+	attributes := make(map[string]interface{}, len(message.Attributes))
+	for name, value := range message.Attributes {
+		attributes[name] = value
+	}
+	input["attributes"] = attributes
+
+	for key, name := range fifoAttributes {
+		if value, ok := message.Attributes[string(name)]; ok {
+			input[key] = value
+		}
+	}
+
+	if count, err := strconv.Atoi(message.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)]); err == nil {
+		input["approximateReceiveCount"] = count
+	}
+
+	// Binary attributes are exposed as bytes and all others, including
+	// numbers, as the strings they were sent as.
+	messageAttributes := make(map[string]interface{}, len(message.MessageAttributes))
+	for name, value := range message.MessageAttributes {
+		if strings.HasPrefix(aws.ToString(value.DataType), "Binary") {
+			messageAttributes[name] = value.BinaryValue
+		} else {
+			messageAttributes[name] = aws.ToString(value.StringValue)
+		}
+	}
+	input["messageAttributes"] = messageAttributes
 
 	return input
 }
 
+// Describe describes the configuration of the sqs source.
+func (s *sqsSource) Describe() *runconfig.Schema {
+	properties := map[string]*runconfig.Schema{
+		"queue": {
+			Type:        "string",
+			Description: "The name of the queue.",
+		},
+		"timeout": {
+			Type:        "integer",
+			Description: "The visibility timeout of received messages, in seconds.",
+			Default:     30,
+			Minimum:     runconfig.Minimum(0),
+		},
+		"batchSize": {
+			Type:        "integer",
+			Description: "The maximum number of messages received by each poll, at most 10.",
+			Default:     1,
+			Minimum:     runconfig.Minimum(1),
+		},
+		"waitTime": {
+			Type:        "integer",
+			Description: "The number of seconds each poll waits for messages to arrive, at most 20. A value of 0 disables long polling.",
+			Default:     20,
+			Minimum:     runconfig.Minimum(0),
+		},
+		"workers": {
+			Type:        "integer",
+			Description: "The number of messages processed concurrently.",
+			Default:     1,
+			Minimum:     runconfig.Minimum(1),
+		},
+		"backoff": {
+			Type:        "integer",
+			Description: "The number of seconds after which a message the fn failed to process becomes visible again.",
+			Default:     10,
+			Minimum:     runconfig.Minimum(0),
+		},
+		"heartbeatInterval": {
+			Type:        "string",
+			Description: "How often the visibility timeout of a message is extended by timeout seconds while the fn processes it, as a Go duration string. It must be less than timeout. Visibility timeouts are not extended if it is 0.",
+			Default:     "0s",
+		},
+	}
+	for key, schema := range s.config.Endpoint.DescribeProperties("SQS") {
+		properties[key] = schema
+	}
+
+	return &runconfig.Schema{
+		Description: "Polls an SQS queue and deletes each message after the fn processes it successfully.",
+		OneOf: []*runconfig.Schema{
+			{
+				Type:        "string",
+				Description: "The name of the queue.",
+			},
+			{
+				Type:                 "object",
+				Properties:           properties,
+				Required:             []string{"queue"},
+				AdditionalProperties: runconfig.NoAdditionalProperties(),
+			},
+		},
+	}
+}
+
 // New creates a new instance of the sqs source with default values. The
 // resulting object must be configured with a queue name. If a queue name is not
 // configured, Serve will return an error.
 func New() run.Source {
 	return &sqsSource{
 		config: &sqsSourceConfig{
-			Timeout:       30,
-			BatchSize:     1,
-			PartitionID:   "aws",
-			SigningRegion: "us-east-1",
+			Timeout:   30,
+			BatchSize: 1,
+			WaitTime:  20,
+			Workers:   1,
+			Backoff:   10,
+			Endpoint:  awspublisher.DefaultEndpoint(),
 		},
 	}
 }
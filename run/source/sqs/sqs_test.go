@@ -0,0 +1,475 @@
+package sqs
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fnrun/fnrun/fn"
+	"github.com/fnrun/fnrun/run/config"
+)
+
+// fakeClient serves the batches of messages sent to its batches channel and
+// records the requests it receives. When no batch is ready, ReceiveMessage
+// blocks until its context is cancelled, like a long poll that never ends.
+type fakeClient struct {
+	batches chan []types.Message
+
+	mutex      sync.Mutex
+	receives   []*sqs.ReceiveMessageInput
+	deleted    []string
+	visibility map[string]int32
+	changes    map[string]int
+	deleteErr  error
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{
+		batches:    make(chan []types.Message, 10),
+		visibility: make(map[string]int32),
+		changes:    make(map[string]int),
+	}
+}
+
+func (c *fakeClient) GetQueueUrl(ctx context.Context, params *sqs.GetQueueUrlInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error) {
+	return &sqs.GetQueueUrlOutput{QueueUrl: aws.String("https://sqs.local/" + aws.ToString(params.QueueName))}, nil
+}
+
+func (c *fakeClient) ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	c.mutex.Lock()
+	c.receives = append(c.receives, params)
+	c.mutex.Unlock()
+
+	select {
+	case messages := <-c.batches:
+		return &sqs.ReceiveMessageOutput{Messages: messages}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *fakeClient) DeleteMessageBatch(ctx context.Context, params *sqs.DeleteMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageBatchOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.deleteErr != nil {
+		return nil, c.deleteErr
+	}
+
+	output := &sqs.DeleteMessageBatchOutput{}
+	for _, entry := range params.Entries {
+		c.deleted = append(c.deleted, aws.ToString(entry.ReceiptHandle))
+		output.Successful = append(output.Successful, types.DeleteMessageBatchResultEntry{Id: entry.Id})
+	}
+	return output, nil
+}
+
+func (c *fakeClient) ChangeMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.visibility[aws.ToString(params.ReceiptHandle)] = params.VisibilityTimeout
+	c.changes[aws.ToString(params.ReceiptHandle)]++
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+func (c *fakeClient) deletedHandles() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	deleted := append([]string(nil), c.deleted...)
+	sort.Strings(deleted)
+	return deleted
+}
+
+func newMessage(id string) types.Message {
+	return types.Message{
+		MessageId:     aws.String(id),
+		ReceiptHandle: aws.String("handle-" + id),
+		Body:          aws.String("body of " + id),
+	}
+}
+
+func newFIFOMessage(id, group string) types.Message {
+	message := newMessage(id)
+	message.Attributes = map[string]string{
+		"MessageGroupId":         group,
+		"MessageDeduplicationId": "dedup-" + id,
+		"SequenceNumber":         "1000" + id,
+	}
+	return message
+}
+
+func newTestSource(t *testing.T, client *fakeClient, configMap map[string]interface{}) *sqsSource {
+	t.Helper()
+
+	s := New().(*sqsSource)
+	if err := config.Configure(s, configMap); err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+	s.client = client
+	return s
+}
+
+func TestServe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	client := newFakeClient()
+	s := newTestSource(t, client, map[string]interface{}{"queue": "orders", "batchSize": 3})
+
+	var mutex sync.Mutex
+	var bodies []string
+	f := fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		bodies = append(bodies, input.(map[string]interface{})["body"].(string))
+		if len(bodies) == 3 {
+			cancel()
+		}
+		return nil, nil
+	})
+
+	client.batches <- []types.Message{newMessage("1"), newMessage("2"), newMessage("3")}
+	if err := s.Serve(ctx, f); err != nil {
+		t.Fatalf("Serve returned error: %+v", err)
+	}
+
+	want := []string{"body of 1", "body of 2", "body of 3"}
+	if !reflect.DeepEqual(bodies, want) {
+		t.Errorf("unexpected bodies: want %v, got %v", want, bodies)
+	}
+
+	wantDeleted := []string{"handle-1", "handle-2", "handle-3"}
+	if got := client.deletedHandles(); !reflect.DeepEqual(got, wantDeleted) {
+		t.Errorf("unexpected deleted messages: want %v, got %v", wantDeleted, got)
+	}
+
+	receive := client.receives[0]
+	if receive.WaitTimeSeconds != 20 || receive.MaxNumberOfMessages != 3 || aws.ToString(receive.QueueUrl) != "https://sqs.local/orders" {
+		t.Errorf("unexpected receive request: %+v", receive)
+	}
+}
+
+func TestServe_workers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := newFakeClient()
+	s := newTestSource(t, client, map[string]interface{}{"queue": "orders", "batchSize": 2, "workers": 2})
+
+	// Both invocations must be in flight at the same time to return.
+	var started sync.WaitGroup
+	started.Add(2)
+	f := fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		started.Done()
+		started.Wait()
+		cancel()
+		return nil, nil
+	})
+
+	client.batches <- []types.Message{newMessage("1"), newMessage("2")}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Serve(ctx, f)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Serve returned error: %+v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("messages were not processed concurrently")
+	}
+
+	want := []string{"handle-1", "handle-2"}
+	if got := client.deletedHandles(); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected deleted messages: want %v, got %v", want, got)
+	}
+}
+
+func TestServe_failureBacksOff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	client := newFakeClient()
+	s := newTestSource(t, client, map[string]interface{}{"queue": "orders", "backoff": 45})
+
+	f := fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		cancel()
+		return nil, errors.New("fn failed")
+	})
+
+	client.batches <- []types.Message{newMessage("1")}
+	if err := s.Serve(ctx, f); err != nil {
+		t.Fatalf("Serve returned error: %+v", err)
+	}
+
+	if got := client.deletedHandles(); len(got) != 0 {
+		t.Errorf("expected no messages to be deleted, got %v", got)
+	}
+	if got := client.visibility["handle-1"]; got != 45 {
+		t.Errorf("unexpected visibility timeout: want 45, got %d", got)
+	}
+}
+
+func TestServe_drainsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	client := newFakeClient()
+	s := newTestSource(t, client, map[string]interface{}{"queue": "orders", "batchSize": 2})
+
+	f := fn.NewFnFromInvokeFunc(func(invokeCtx context.Context, input interface{}) (interface{}, error) {
+		cancel()
+		<-ctx.Done()
+		return nil, invokeCtx.Err()
+	})
+
+	client.batches <- []types.Message{newMessage("1"), newMessage("2")}
+	if err := s.Serve(ctx, f); err != nil {
+		t.Fatalf("Serve returned error: %+v", err)
+	}
+
+	// The message being processed when Serve was cancelled is deleted, and the
+	// one that was not handed to a worker is released.
+	want := []string{"handle-1"}
+	if got := client.deletedHandles(); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected deleted messages: want %v, got %v", want, got)
+	}
+	if got, ok := client.visibility["handle-2"]; !ok || got != 0 {
+		t.Errorf("expected message 2 to be released, got visibility %d", got)
+	}
+}
+
+func TestServe_deleteError(t *testing.T) {
+	client := newFakeClient()
+	client.deleteErr = errors.New("delete failed")
+	s := newTestSource(t, client, map[string]interface{}{"queue": "orders"})
+
+	f := fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		return nil, nil
+	})
+
+	client.batches <- []types.Message{newMessage("1")}
+	if err := s.Serve(context.Background(), f); err != client.deleteErr {
+		t.Errorf("unexpected error: want %v, got %+v", client.deleteErr, err)
+	}
+}
+
+func TestServe_heartbeat(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	client := newFakeClient()
+	s := newTestSource(t, client, map[string]interface{}{"queue": "orders", "timeout": 60, "heartbeatInterval": "5ms"})
+
+	f := fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		defer cancel()
+		time.Sleep(50 * time.Millisecond)
+		return nil, nil
+	})
+
+	client.batches <- []types.Message{newMessage("1")}
+	if err := s.Serve(ctx, f); err != nil {
+		t.Fatalf("Serve returned error: %+v", err)
+	}
+
+	if got := client.changes["handle-1"]; got < 2 {
+		t.Errorf("expected the visibility timeout to be extended repeatedly, got %d extensions", got)
+	}
+	if got := client.visibility["handle-1"]; got != 60 {
+		t.Errorf("unexpected visibility timeout: want 60, got %d", got)
+	}
+
+	// No extensions happen once the message has been processed.
+	changes := client.changes["handle-1"]
+	time.Sleep(20 * time.Millisecond)
+	if got := client.changes["handle-1"]; got != changes {
+		t.Errorf("visibility timeout was extended after the fn returned")
+	}
+}
+
+func TestServe_fifoOrdersEachGroup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := newFakeClient()
+	s := newTestSource(t, client, map[string]interface{}{"queue": "orders.fifo", "batchSize": 4, "workers": 2})
+
+	// The first message of each group returns only once the first message of
+	// the other group has started, which requires the groups to be processed
+	// concurrently.
+	var started sync.WaitGroup
+	started.Add(2)
+
+	var mutex sync.Mutex
+	var processed []string
+	f := fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		id := input.(map[string]interface{})["id"].(string)
+		if id == "a1" || id == "b1" {
+			started.Done()
+			started.Wait()
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		processed = append(processed, id)
+		if len(processed) == 4 {
+			cancel()
+		}
+		return nil, nil
+	})
+
+	client.batches <- []types.Message{
+		newFIFOMessage("a1", "a"),
+		newFIFOMessage("b1", "b"),
+		newFIFOMessage("a2", "a"),
+		newFIFOMessage("b2", "b"),
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Serve(ctx, f)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Serve returned error: %+v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message groups were not processed concurrently")
+	}
+
+	position := make(map[string]int)
+	for i, id := range processed {
+		position[id] = i
+	}
+	if position["a1"] > position["a2"] || position["b1"] > position["b2"] {
+		t.Errorf("messages of a group were processed out of order: %v", processed)
+	}
+}
+
+func TestServe_fifoFailureBlocksGroup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	client := newFakeClient()
+	s := newTestSource(t, client, map[string]interface{}{"queue": "orders.fifo", "batchSize": 3, "backoff": 15})
+
+	var processed []string
+	f := fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		id := input.(map[string]interface{})["id"].(string)
+		processed = append(processed, id)
+		if id == "a1" {
+			return nil, errors.New("fn failed")
+		}
+		cancel()
+		return nil, nil
+	})
+
+	client.batches <- []types.Message{
+		newFIFOMessage("a1", "a"),
+		newFIFOMessage("a2", "a"),
+		newFIFOMessage("b1", "b"),
+	}
+	if err := s.Serve(ctx, f); err != nil {
+		t.Fatalf("Serve returned error: %+v", err)
+	}
+
+	if want := []string{"a1", "b1"}; !reflect.DeepEqual(processed, want) {
+		t.Errorf("unexpected processed messages: want %v, got %v", want, processed)
+	}
+	if want := []string{"handle-b1"}; !reflect.DeepEqual(client.deletedHandles(), want) {
+		t.Errorf("unexpected deleted messages: want %v, got %v", want, client.deletedHandles())
+	}
+	for _, handle := range []string{"handle-a1", "handle-a2"} {
+		if got := client.visibility[handle]; got != 15 {
+			t.Errorf("unexpected visibility timeout of %s: want 15, got %d", handle, got)
+		}
+	}
+}
+
+func TestCreateInput_fifo(t *testing.T) {
+	message := newFIFOMessage("1", "customer-7")
+	input := createInput(&message)
+
+	for key, want := range map[string]string{
+		"messageGroupId":         "customer-7",
+		"messageDeduplicationId": "dedup-1",
+		"sequenceNumber":         "10001",
+	} {
+		if got := input[key]; got != want {
+			t.Errorf("unexpected %s: want %q, got %v", key, want, got)
+		}
+	}
+}
+
+func TestCreateInput(t *testing.T) {
+	message := newMessage("1")
+	message.MD5OfBody = aws.String("b5b8b1d6d1c7e5e3b9d4c1a0f3e2d1c0")
+	message.Attributes = map[string]string{
+		"SentTimestamp":           "1700000000000",
+		"ApproximateReceiveCount": "3",
+	}
+	message.MessageAttributes = map[string]types.MessageAttributeValue{
+		"source":   {DataType: aws.String("String"), StringValue: aws.String("web")},
+		"priority": {DataType: aws.String("Number.int"), StringValue: aws.String("5")},
+		"payload":  {DataType: aws.String("Binary"), BinaryValue: []byte{0x01, 0x02}},
+	}
+
+	want := map[string]interface{}{
+		"id":                      "1",
+		"body":                    "body of 1",
+		"receiptHandle":           "handle-1",
+		"md5OfBody":               "b5b8b1d6d1c7e5e3b9d4c1a0f3e2d1c0",
+		"approximateReceiveCount": 3,
+		"attributes": map[string]interface{}{
+			"SentTimestamp":           "1700000000000",
+			"ApproximateReceiveCount": "3",
+		},
+		"messageAttributes": map[string]interface{}{
+			"source":   "web",
+			"priority": "5",
+			"payload":  []byte{0x01, 0x02},
+		},
+	}
+
+	if got := createInput(&message); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected input: want %#v, got %#v", want, got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		configMap map[string]interface{}
+		want      string
+	}{
+		{configMap: map[string]interface{}{"queue": "orders", "waitTime": 0, "workers": 8, "backoff": 0}},
+		{configMap: map[string]interface{}{"timeout": 30}, want: "queue: queue is required"},
+		{configMap: map[string]interface{}{"queue": "orders", "batchSize": 11}, want: "batchSize: batchSize must be between 1 and 10"},
+		{configMap: map[string]interface{}{"queue": "orders", "waitTime": 21}, want: "waitTime: waitTime must be between 0 and 20"},
+		{configMap: map[string]interface{}{"queue": "orders", "workers": 0}, want: "workers: workers must be at least 1"},
+		{configMap: map[string]interface{}{"queue": "orders", "backoff": -1}, want: "backoff: backoff must be between 0 and 43200"},
+		{configMap: map[string]interface{}{"queue": "orders", "timeout": 30, "heartbeatInterval": "30s"}, want: "heartbeatInterval: heartbeatInterval must be less than timeout"},
+	}
+
+	for _, test := range tests {
+		err := config.Configure(New(), test.configMap)
+
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != test.want {
+			t.Errorf("unexpected error for %v: want %q, got %q", test.configMap, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package supervisor
+
+import (
+	"time"
+)
+
+// Pipeline states reported by Status.
+const (
+	StatePending    = "pending"
+	StateRunning    = "running"
+	StateRestarting = "restarting"
+	StateStopped    = "stopped"
+)
+
+// Components identifies the source, middleware, and fn of a pipeline by the
+// keys they are registered under.
+type Components struct {
+	Source     string   `json:"source"`
+	Middleware []string `json:"middleware"`
+	Fn         string   `json:"fn"`
+}
+
+// PipelineStatus describes the state of a pipeline.
+type PipelineStatus struct {
+	Name       string     `json:"name"`
+	State      string     `json:"state"`
+	Components Components `json:"components"`
+
+	// StartedAt is the time the pipeline last started running. It is nil if
+	// the pipeline has not run.
+	StartedAt *time.Time `json:"startedAt,omitempty"`
+	Restarts  int        `json:"restarts"`
+	Reloads   int        `json:"reloads"`
+
+	LastError   string     `json:"lastError,omitempty"`
+	LastErrorAt *time.Time `json:"lastErrorAt,omitempty"`
+}
+
+// Status returns the status of each pipeline, in the same order as Pipelines.
+func (s *Supervisor) Status() []PipelineStatus {
+	statuses := make([]PipelineStatus, len(s.pipelines))
+	for i, p := range s.pipelines {
+		statuses[i] = p.status()
+	}
+	return statuses
+}
+
+func (p *pipeline) status() PipelineStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	status := PipelineStatus{
+		Name:  p.name,
+		State: p.state,
+		Components: Components{
+			Source: componentKey(p.config["source"]),
+			Fn:     componentKey(p.config["fn"]),
+		},
+		Restarts: p.restarts,
+		Reloads:  p.reloads,
+	}
+
+	if middleware, ok := p.config["middleware"].([]interface{}); ok {
+		for _, m := range middleware {
+			status.Components.Middleware = append(status.Components.Middleware, componentKey(m))
+		}
+	}
+
+	if !p.startedAt.IsZero() {
+		startedAt := p.startedAt
+		status.StartedAt = &startedAt
+	}
+
+	if p.lastErr != nil {
+		lastErrAt := p.lastErrAt
+		status.LastError = p.lastErr.Error()
+		status.LastErrorAt = &lastErrAt
+	}
+
+	return status
+}
+
+// componentKey returns the key of the component selected by a source,
+// middleware, or fn configuration value, which is either a key or a map with a
+// single key.
+func componentKey(cfg interface{}) string {
+	switch v := cfg.(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		for key := range v {
+			return key
+		}
+	}
+	return ""
+}
@@ -0,0 +1,461 @@
+// Package supervisor provides a supervisor that runs one or more named
+// pipelines concurrently. Each pipeline is a runner comprising a source,
+// middleware, and an fn, and each has its own restart policy.
+//
+// The supervisor may be configured with the same source, middleware, and fn
+// keys accepted by a runner, in which case it runs a single pipeline named
+// "default". Alternatively, it may be configured with a `pipelines` map whose
+// keys are pipeline names and whose values are runner configurations. Each
+// pipeline configuration may also contain the following restart options, which
+// default to the policy provided to New:
+//
+// - restart: a bool that describes whether the pipeline restarts after its
+// source returns
+// - restartWait: a string that can be parsed into a time.Duration
+// - maxRestarts: an int limiting the number of times the pipeline restarts,
+// where 0 means unlimited
+//
+// Every pipeline gets its own instances of its source, middleware, and fn. YAML
+// anchors may be used to share a configuration between pipelines. The name of
+// the pipeline is available to its components through run.Pipeline.
+//
+// A running supervisor may be reloaded with a new configuration. Reloading
+// replaces the middleware and fn of each pipeline without stopping its source,
+// so consumers such as Kafka keep their group membership.
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fnrun/fnrun/run"
+	"github.com/fnrun/fnrun/run/config"
+	"github.com/fnrun/fnrun/run/runner"
+	"github.com/mitchellh/mapstructure"
+)
+
+// DefaultPipelineName is the name given to the pipeline when the supervisor is
+// configured with top-level source, middleware, and fn keys.
+const DefaultPipelineName = "default"
+
+// RestartPolicy describes whether and when a pipeline is restarted after its
+// source returns.
+type RestartPolicy struct {
+	Restart     bool          `mapstructure:"restart"`
+	RestartWait time.Duration `mapstructure:"restartWait"`
+	MaxRestarts int           `mapstructure:"maxRestarts"`
+}
+
+func (p RestartPolicy) allowsRestart(restarts int) bool {
+	return p.Restart && (p.MaxRestarts <= 0 || restarts < p.MaxRestarts)
+}
+
+func (p RestartPolicy) describe() map[string]*config.Schema {
+	return map[string]*config.Schema{
+		"restart": {
+			Type:        "boolean",
+			Description: "Whether the pipeline restarts after its source returns.",
+			Default:     p.Restart,
+		},
+		"restartWait": {
+			Type:        "string",
+			Description: "How long to wait before restarting the pipeline, as a Go duration string.",
+			Default:     p.RestartWait.String(),
+		},
+		"maxRestarts": {
+			Type:        "integer",
+			Description: "The maximum number of times the pipeline restarts. 0 means unlimited.",
+			Default:     p.MaxRestarts,
+			Minimum:     config.Minimum(0),
+		},
+	}
+}
+
+// PipelineError is an error returned by a named pipeline.
+type PipelineError struct {
+	Pipeline string
+	Err      error
+}
+
+func (e *PipelineError) Error() string {
+	return fmt.Sprintf("pipeline %q: %v", e.Pipeline, e.Err)
+}
+
+func (e *PipelineError) Unwrap() error {
+	return e.Err
+}
+
+// pipelineConfig is the configuration of a single pipeline: its runner
+// configuration along with an optional restart policy.
+type pipelineConfig struct {
+	RestartPolicy `mapstructure:",squash"`
+
+	Source     interface{} `mapstructure:"source"`
+	Middleware interface{} `mapstructure:"middleware"`
+	Fn         interface{} `mapstructure:"fn"`
+}
+
+type pipeline struct {
+	name string
+
+	// mu guards the fields below, which are replaced when the supervisor is
+	// reloaded. runner is nil while the pipeline is waiting to restart.
+	mu     sync.Mutex
+	config map[string]interface{}
+	policy RestartPolicy
+	runner *runner.Runner
+
+	state     string
+	startedAt time.Time
+	restarts  int
+	reloads   int
+	lastErr   error
+	lastErrAt time.Time
+}
+
+func (p *pipeline) setState(state string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.state = state
+	if state == StateRunning {
+		p.startedAt = time.Now()
+	}
+}
+
+func (p *pipeline) recordError(err error) {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.lastErr = err
+	p.lastErrAt = time.Now()
+}
+
+// reload swaps the middleware and fn of the running runner with those of next
+// and then replaces the configuration of the pipeline with that of next. The
+// runner of next is closed if it is not used. If the pipeline is waiting to
+// restart, the configuration of next is used when it restarts.
+//
+// p.mu is not held while the runner reloads, which waits for in-flight inputs,
+// so that the status of the pipeline stays available.
+func (p *pipeline) reload(ctx context.Context, next *pipeline) error {
+	p.mu.Lock()
+	r := p.runner
+	sourceChanged := !reflect.DeepEqual(p.config["source"], next.config["source"])
+	p.mu.Unlock()
+
+	if r == nil {
+		if err := next.runner.Close(); err != nil {
+			log.Printf("Error closing unused runner of pipeline %q: %+v\n", p.name, err)
+		}
+	} else if err := r.Reload(ctx, next.runner); err != nil && !errors.Is(err, runner.ErrClosed) {
+		return err
+	}
+
+	if sourceChanged {
+		log.Printf("Source configuration of pipeline %q changed; it will be applied when the pipeline restarts\n", p.name)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.config = next.config
+	p.policy = next.policy
+	p.reloads++
+	return nil
+}
+
+// Supervisor runs a set of named pipelines.
+type Supervisor struct {
+	registry      run.Registry
+	defaultPolicy RestartPolicy
+	pipelines     []*pipeline
+}
+
+// Pipelines returns the names of the configured pipelines in sorted order.
+func (s *Supervisor) Pipelines() []string {
+	names := make([]string, len(s.pipelines))
+	for i, p := range s.pipelines {
+		names[i] = p.name
+	}
+	return names
+}
+
+// RequiresConfig always returns true. This method exists to interoperate with
+// the config package.
+func (s *Supervisor) RequiresConfig() bool {
+	return true
+}
+
+// ConfigureMap configures the supervisor with either a single pipeline or a
+// map of named pipelines.
+func (s *Supervisor) ConfigureMap(configMap map[string]interface{}) error {
+	cfg := struct {
+		Pipelines  map[string]interface{} `mapstructure:"pipelines"`
+		Source     interface{}            `mapstructure:"source"`
+		Middleware interface{}            `mapstructure:"middleware"`
+		Fn         interface{}            `mapstructure:"fn"`
+	}{}
+
+	if err := mapstructure.Decode(configMap, &cfg); err != nil {
+		return err
+	}
+
+	if cfg.Pipelines == nil {
+		p, err := s.newPipeline(DefaultPipelineName, configMap)
+		if err != nil {
+			return err
+		}
+		s.pipelines = []*pipeline{p}
+		return nil
+	}
+
+	if cfg.Source != nil || cfg.Middleware != nil || cfg.Fn != nil {
+		return errors.New("source, middleware, and fn must be configured within pipelines when pipelines is set")
+	}
+	if err := config.Decode(configMap, &struct {
+		Pipelines map[string]interface{} `mapstructure:"pipelines"`
+	}{}); err != nil {
+		return err
+	}
+	if len(cfg.Pipelines) == 0 {
+		return errors.New("pipelines must contain at least one pipeline")
+	}
+
+	names := make([]string, 0, len(cfg.Pipelines))
+	for name := range cfg.Pipelines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pipelines := make([]*pipeline, 0, len(names))
+	var errs []error
+	for _, name := range names {
+		pipelineConfig, ok := cfg.Pipelines[name].(map[string]interface{})
+		if !ok {
+			err := fmt.Errorf("expected pipeline configuration to be a map but was %T", cfg.Pipelines[name])
+			errs = append(errs, config.WithPath("pipelines", config.WithPath(name, err)))
+			continue
+		}
+
+		p, err := s.newPipeline(name, pipelineConfig)
+		if err != nil {
+			errs = append(errs, config.WithPath("pipelines", config.WithPath(name, err)))
+			continue
+		}
+		pipelines = append(pipelines, p)
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	s.pipelines = pipelines
+	return nil
+}
+
+// Describe describes the configuration of the supervisor.
+func (s *Supervisor) Describe() *config.Schema {
+	pipeline := runner.New(s.registry).Describe()
+	pipeline.Description = "A pipeline comprising a source, middleware, and an fn, with an optional restart policy."
+	for key, property := range s.defaultPolicy.describe() {
+		pipeline.Properties[key] = property
+	}
+
+	root := runner.New(s.registry).Describe()
+	root.Description = "The configuration of fnrunner: either a single pipeline or a map of named pipelines."
+	root.Required = nil
+	for key, property := range s.defaultPolicy.describe() {
+		root.Properties[key] = property
+	}
+	root.Properties["pipelines"] = &config.Schema{
+		Type:                 "object",
+		Description:          "Named pipelines that run concurrently. Pipelines may not be combined with top-level source, middleware, and fn keys.",
+		AdditionalProperties: pipeline,
+		MinProperties:        1,
+	}
+
+	return root
+}
+
+func (s *Supervisor) newPipeline(name string, configMap map[string]interface{}) (*pipeline, error) {
+	cfg := pipelineConfig{RestartPolicy: s.defaultPolicy}
+	if err := config.Decode(configMap, &cfg, mapstructure.StringToTimeDurationHookFunc()); err != nil {
+		return nil, err
+	}
+
+	p := &pipeline{
+		name: name,
+		config: map[string]interface{}{
+			"source":     cfg.Source,
+			"middleware": cfg.Middleware,
+			"fn":         cfg.Fn,
+		},
+		policy: cfg.RestartPolicy,
+		state:  StatePending,
+	}
+
+	r, err := s.newRunner(p)
+	if err != nil {
+		return nil, err
+	}
+	p.runner = r
+
+	return p, nil
+}
+
+func (s *Supervisor) newRunner(p *pipeline) (*runner.Runner, error) {
+	r := runner.New(s.registry)
+	if err := config.Configure(r, p.config); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Run runs every pipeline concurrently until ctx is cancelled. A pipeline whose
+// restart policy does not allow it to restart after an error causes the other
+// pipelines to stop. Run returns the errors of the pipelines that failed, each
+// wrapped in a PipelineError.
+func (s *Supervisor) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make([]error, len(s.pipelines))
+	var wg sync.WaitGroup
+
+	for i, p := range s.pipelines {
+		wg.Add(1)
+		go func(i int, p *pipeline) {
+			defer wg.Done()
+
+			err := s.supervise(ctx, p)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				errs[i] = &PipelineError{Pipeline: p.name, Err: err}
+				cancel()
+			}
+		}(i, p)
+	}
+
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (s *Supervisor) supervise(ctx context.Context, p *pipeline) error {
+	ctx = run.WithPipeline(ctx, p.name)
+
+	p.mu.Lock()
+	r := p.runner
+	p.mu.Unlock()
+
+	var err error
+	defer p.setState(StateStopped)
+
+	for restarts := 0; ; restarts++ {
+		if r != nil {
+			p.setState(StateRunning)
+			err = r.Run(ctx)
+			p.recordError(err)
+
+			p.mu.Lock()
+			if closeErr := r.Close(); closeErr != nil {
+				log.Printf("Error closing pipeline %q: %+v\n", p.name, closeErr)
+			}
+			p.runner = nil
+			p.mu.Unlock()
+		}
+
+		p.mu.Lock()
+		policy := p.policy
+		p.mu.Unlock()
+
+		if ctx.Err() != nil || !policy.allowsRestart(restarts) {
+			return err
+		}
+
+		p.setState(StateRestarting)
+		log.Printf("Pipeline %q received error: %+v\n", p.name, err)
+		log.Printf("Restarting pipeline %q in %s\n", p.name, policy.RestartWait.String())
+		select {
+		case <-time.After(policy.RestartWait):
+		case <-ctx.Done():
+			return nil
+		}
+		log.Printf("Restarting pipeline %q...\n", p.name)
+
+		p.mu.Lock()
+		r, err = s.newRunner(p)
+		p.runner = r
+		p.restarts++
+		p.mu.Unlock()
+		p.recordError(err)
+	}
+}
+
+// Reload reconfigures the supervisor with configMap while its pipelines run.
+// Each pipeline keeps its source running and swaps in newly configured
+// middleware and fn; changes to a source or restart policy are applied the next
+// time the pipeline restarts.
+//
+// The whole configuration is validated before any pipeline is changed, so the
+// current pipelines stay in place if it contains an error. Pipelines cannot be
+// added or removed by reloading. Each pipeline is then reloaded in turn, and a
+// pipeline whose new middleware or fn fails to start keeps its current ones
+// while the others are still reloaded. A pipeline that cannot start its current
+// middleware and fn again after the new ones fail stops and is restarted with
+// its current configuration according to its restart policy. The returned
+// error names the pipelines that were reloaded and those that were not.
+func (s *Supervisor) Reload(ctx context.Context, configMap map[string]interface{}) error {
+	next := New(s.registry, s.defaultPolicy)
+	if err := config.Configure(next, configMap); err != nil {
+		return err
+	}
+
+	if !reflect.DeepEqual(s.Pipelines(), next.Pipelines()) {
+		next.close()
+		return fmt.Errorf("pipelines cannot be added or removed by reloading (current %v, new %v)", s.Pipelines(), next.Pipelines())
+	}
+
+	var reloaded, failed []string
+	var errs []error
+	for i, p := range s.pipelines {
+		if err := p.reload(ctx, next.pipelines[i]); err != nil {
+			failed = append(failed, p.name)
+			errs = append(errs, &PipelineError{Pipeline: p.name, Err: err})
+			continue
+		}
+		reloaded = append(reloaded, p.name)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("reloaded pipelines %v but not %v: %w", reloaded, failed, errors.Join(errs...))
+	}
+	return nil
+}
+
+// close closes the runners of a supervisor that has not been run.
+func (s *Supervisor) close() {
+	for _, p := range s.pipelines {
+		if err := p.runner.Close(); err != nil {
+			log.Printf("Error closing unused runner of pipeline %q: %+v\n", p.name, err)
+		}
+	}
+}
+
+// New returns a supervisor that must be configured before use. Pipelines that
+// do not specify restart options use defaultPolicy.
+func New(registry run.Registry, defaultPolicy RestartPolicy) *Supervisor {
+	return &Supervisor{
+		registry:      registry,
+		defaultPolicy: defaultPolicy,
+	}
+}
@@ -0,0 +1,415 @@
+package supervisor_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fnrun/fnrun/fn"
+	"github.com/fnrun/fnrun/run"
+	"github.com/fnrun/fnrun/run/config"
+	"github.com/fnrun/fnrun/run/fn/loader"
+	"github.com/fnrun/fnrun/run/middleware/pipeline"
+	sourceloader "github.com/fnrun/fnrun/run/source/loader"
+	"github.com/fnrun/fnrun/run/supervisor"
+)
+
+var (
+	errSource = errors.New("source failed")
+	errStart  = errors.New("start failed")
+)
+
+func newRegistry(failures *int32) run.Registry {
+	reg := run.NewRegistry()
+	reg.RegisterSourceWithRegistry("source", sourceloader.New)
+	reg.RegisterSource("blocking", newBlockingSource)
+	reg.RegisterSource("failing", func() run.Source { return &failingSource{failures: failures} })
+	reg.RegisterFnWithRegistry("fn", loader.New)
+	reg.RegisterFn("echo", newEchoFn)
+	reg.RegisterFn("failingStart", newFailingStartFn)
+	reg.RegisterMiddlewareWithRegistry("middleware", pipeline.NewWithRegistry)
+
+	return reg
+}
+
+func TestConfigureMap_singlePipeline(t *testing.T) {
+	s := supervisor.New(newRegistry(nil), supervisor.RestartPolicy{})
+
+	err := config.Configure(s, map[string]interface{}{
+		"source": "blocking",
+		"fn":     "echo",
+	})
+	if err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+
+	want := []string{supervisor.DefaultPipelineName}
+	got := s.Pipelines()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected pipelines: want %v, got %v", want, got)
+	}
+}
+
+func TestConfigureMap_namedPipelines(t *testing.T) {
+	s := supervisor.New(newRegistry(nil), supervisor.RestartPolicy{})
+
+	err := config.Configure(s, map[string]interface{}{
+		"pipelines": map[string]interface{}{
+			"web":   map[string]interface{}{"source": "blocking", "fn": "echo"},
+			"kafka": map[string]interface{}{"source": "blocking", "fn": "echo"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+
+	want := []string{"kafka", "web"}
+	got := s.Pipelines()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected pipelines: want %v, got %v", want, got)
+	}
+}
+
+func TestConfigureMap_mixedConfiguration(t *testing.T) {
+	s := supervisor.New(newRegistry(nil), supervisor.RestartPolicy{})
+
+	err := config.Configure(s, map[string]interface{}{
+		"source": "blocking",
+		"pipelines": map[string]interface{}{
+			"web": map[string]interface{}{"source": "blocking", "fn": "echo"},
+		},
+	})
+	if err == nil {
+		t.Error("expected config.Configure to return an error but it did not")
+	}
+}
+
+func TestConfigureMap_invalidPipelineReportsName(t *testing.T) {
+	s := supervisor.New(newRegistry(nil), supervisor.RestartPolicy{})
+
+	err := config.Configure(s, map[string]interface{}{
+		"pipelines": map[string]interface{}{
+			"web": map[string]interface{}{"source": "blocking"},
+		},
+	})
+	if err == nil {
+		t.Fatal("expected config.Configure to return an error but it did not")
+	}
+
+	want := `pipelines.web: fn is a required configuration key`
+	got := err.Error()
+	if got != want {
+		t.Errorf("unexpected error message: want %q, got %q", want, got)
+	}
+}
+
+func TestConfigureMap_reportsEveryInvalidPipeline(t *testing.T) {
+	s := supervisor.New(newRegistry(nil), supervisor.RestartPolicy{})
+
+	err := config.Configure(s, map[string]interface{}{
+		"pipelines": map[string]interface{}{
+			"web":   map[string]interface{}{"source": "blocking"},
+			"kafka": map[string]interface{}{"fn": "echo"},
+		},
+	})
+
+	want := []string{
+		"pipelines.kafka: source is a required configuration key",
+		"pipelines.web: fn is a required configuration key",
+	}
+	errs := config.Errors(err)
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors but got %d: %+v", len(want), len(errs), errs)
+	}
+	for i, e := range errs {
+		if e.Error() != want[i] {
+			t.Errorf("unexpected error message: want %q, got %q", want[i], e.Error())
+		}
+	}
+}
+
+func TestConfigureMap_unknownPipelineKey(t *testing.T) {
+	s := supervisor.New(newRegistry(nil), supervisor.RestartPolicy{})
+
+	err := config.Configure(s, map[string]interface{}{
+		"pipelines": map[string]interface{}{
+			"web": map[string]interface{}{"source": "blocking", "fn": "echo", "restat": true},
+		},
+	})
+	if err == nil {
+		t.Fatal("expected config.Configure to return an error but it did not")
+	}
+
+	want := `pipelines.web.restat: unknown configuration key (did you mean "restart"?)`
+	got := err.Error()
+	if got != want {
+		t.Errorf("unexpected error message: want %q, got %q", want, got)
+	}
+}
+
+func TestRun_failingPipelineStopsOthers(t *testing.T) {
+	var failures int32
+	s := supervisor.New(newRegistry(&failures), supervisor.RestartPolicy{})
+
+	err := config.Configure(s, map[string]interface{}{
+		"pipelines": map[string]interface{}{
+			"good": map[string]interface{}{"source": "blocking", "fn": "echo"},
+			"bad":  map[string]interface{}{"source": "failing", "fn": "echo"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	err = s.Run(ctx)
+
+	var pipelineErr *supervisor.PipelineError
+	if !errors.As(err, &pipelineErr) {
+		t.Fatalf("expected Run to return a PipelineError but got %+v", err)
+	}
+	if pipelineErr.Pipeline != "bad" {
+		t.Errorf("unexpected pipeline in error: want %q, got %q", "bad", pipelineErr.Pipeline)
+	}
+	if !errors.Is(err, errSource) {
+		t.Errorf("expected error to wrap %+v but got %+v", errSource, err)
+	}
+	if ctx.Err() != nil {
+		t.Error("expected Run to return before the context deadline")
+	}
+}
+
+func TestRun_restartsPipelineWithItsOwnPolicy(t *testing.T) {
+	var failures int32
+	s := supervisor.New(newRegistry(&failures), supervisor.RestartPolicy{})
+
+	err := config.Configure(s, map[string]interface{}{
+		"pipelines": map[string]interface{}{
+			"bad": map[string]interface{}{
+				"source":      "failing",
+				"fn":          "echo",
+				"restart":     true,
+				"restartWait": "1ms",
+				"maxRestarts": 2,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+
+	err = s.Run(context.Background())
+	if !errors.Is(err, errSource) {
+		t.Errorf("expected error to wrap %+v but got %+v", errSource, err)
+	}
+
+	if got := atomic.LoadInt32(&failures); got != 3 {
+		t.Errorf("unexpected number of runs: want 3, got %d", got)
+	}
+
+	status := s.Status()[0]
+	if status.State != supervisor.StateStopped {
+		t.Errorf("unexpected state: want %q, got %q", supervisor.StateStopped, status.State)
+	}
+	if status.Restarts != 2 {
+		t.Errorf("unexpected number of restarts: want 2, got %d", status.Restarts)
+	}
+	if status.LastError != errSource.Error() || status.LastErrorAt == nil {
+		t.Errorf("unexpected last error: %q at %v", status.LastError, status.LastErrorAt)
+	}
+}
+
+func TestRun_cancelledContext(t *testing.T) {
+	s := supervisor.New(newRegistry(nil), supervisor.RestartPolicy{Restart: true})
+
+	err := config.Configure(s, map[string]interface{}{
+		"pipelines": map[string]interface{}{
+			"a": map[string]interface{}{"source": "blocking", "fn": "echo"},
+			"b": map[string]interface{}{"source": "blocking", "fn": "echo"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-time.After(10 * time.Millisecond)
+		cancel()
+	}()
+
+	if err := s.Run(ctx); err != nil {
+		t.Errorf("Run returned error: %+v", err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	s := supervisor.New(newRegistry(nil), supervisor.RestartPolicy{})
+	pipelines := map[string]interface{}{
+		"web": map[string]interface{}{"source": "blocking", "fn": "echo"},
+	}
+
+	err := config.Configure(s, map[string]interface{}{"pipelines": pipelines})
+	if err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	doneCh := make(chan error, 1)
+	go func() {
+		doneCh <- s.Run(ctx)
+	}()
+
+	err = s.Reload(ctx, map[string]interface{}{
+		"pipelines": map[string]interface{}{
+			"web": map[string]interface{}{"source": "blocking", "fn": "echo", "middleware": []interface{}{}},
+		},
+	})
+	if err != nil {
+		t.Errorf("Reload returned error: %+v", err)
+	}
+
+	cancel()
+	if err := <-doneCh; err != nil {
+		t.Errorf("Run returned error: %+v", err)
+	}
+}
+
+func TestReload_reportsPipelinesNotReloaded(t *testing.T) {
+	s := supervisor.New(newRegistry(nil), supervisor.RestartPolicy{})
+	err := config.Configure(s, map[string]interface{}{
+		"pipelines": map[string]interface{}{
+			"a": map[string]interface{}{"source": "blocking", "fn": "echo"},
+			"b": map[string]interface{}{"source": "blocking", "fn": "echo"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		statuses := s.Status()
+		if statuses[0].State == supervisor.StateRunning && statuses[1].State == supervisor.StateRunning {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	err = s.Reload(ctx, map[string]interface{}{
+		"pipelines": map[string]interface{}{
+			"a": map[string]interface{}{"source": "blocking", "fn": "echo", "middleware": []interface{}{}},
+			"b": map[string]interface{}{"source": "blocking", "fn": "failingStart"},
+		},
+	})
+
+	var pipelineErr *supervisor.PipelineError
+	if !errors.As(err, &pipelineErr) || pipelineErr.Pipeline != "b" || !errors.Is(err, errStart) {
+		t.Fatalf("expected a start error for pipeline b but got %+v", err)
+	}
+	want := "reloaded pipelines [a] but not [b]: pipeline \"b\": start failed"
+	if got := err.Error(); got != want {
+		t.Errorf("unexpected error message: want %q, got %q", want, got)
+	}
+
+	statuses := s.Status()
+	if statuses[0].Reloads != 1 || statuses[1].Reloads != 0 {
+		t.Errorf("expected only pipeline a to be reloaded, got %+v", statuses)
+	}
+	if got := statuses[1].Components.Fn; got != "echo" {
+		t.Errorf("expected pipeline b to keep fn echo, got %q", got)
+	}
+}
+
+func TestReload_invalidConfiguration(t *testing.T) {
+	s := supervisor.New(newRegistry(nil), supervisor.RestartPolicy{})
+
+	err := config.Configure(s, map[string]interface{}{"source": "blocking", "fn": "echo"})
+	if err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+
+	err = s.Reload(context.Background(), map[string]interface{}{"source": "blocking", "fn": "unknown"})
+	if err == nil {
+		t.Fatal("expected Reload to return an error but it did not")
+	}
+
+	want := `fn: a registered fn not found for key "unknown"`
+	if got := err.Error(); got != want {
+		t.Errorf("unexpected error message: want %q, got %q", want, got)
+	}
+}
+
+func TestReload_addedPipeline(t *testing.T) {
+	s := supervisor.New(newRegistry(nil), supervisor.RestartPolicy{})
+
+	err := config.Configure(s, map[string]interface{}{"source": "blocking", "fn": "echo"})
+	if err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+
+	err = s.Reload(context.Background(), map[string]interface{}{
+		"pipelines": map[string]interface{}{
+			"a": map[string]interface{}{"source": "blocking", "fn": "echo"},
+			"b": map[string]interface{}{"source": "blocking", "fn": "echo"},
+		},
+	})
+	if err == nil {
+		t.Error("expected Reload to return an error but it did not")
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Test components
+
+type echoFn struct{}
+
+func (*echoFn) Invoke(ctx context.Context, input interface{}) (interface{}, error) {
+	return fmt.Sprint(input), nil
+}
+
+func newEchoFn() fn.Fn {
+	return &echoFn{}
+}
+
+type failingStartFn struct {
+	echoFn
+}
+
+func (*failingStartFn) Start(context.Context) error {
+	return errStart
+}
+
+func newFailingStartFn() fn.Fn {
+	return &failingStartFn{}
+}
+
+type blockingSource struct{}
+
+func (*blockingSource) Serve(ctx context.Context, f fn.Fn) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func newBlockingSource() run.Source {
+	return &blockingSource{}
+}
+
+type failingSource struct {
+	failures *int32
+}
+
+func (s *failingSource) Serve(ctx context.Context, f fn.Fn) error {
+	atomic.AddInt32(s.failures, 1)
+	return errSource
+}
@@ -0,0 +1,237 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/fnrun/fnrun/run/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// The exporters supported by Provider.
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+// DefaultServiceName is the service name reported with spans when none is
+// configured.
+const DefaultServiceName = "fnrunner"
+
+// shutdownTimeout bounds the time Close waits for buffered spans to be
+// exported.
+const shutdownTimeout = 5 * time.Second
+
+// Provider exports the spans created by fnrun. Starting a Provider installs it
+// as the global OpenTelemetry tracer provider.
+//
+// The provider may be configured with a string containing the name of an
+// exporter or with a map. The otlp exporter sends spans to an OpenTelemetry
+// collector over OTLP/HTTP and honors the standard OTEL_EXPORTER_OTLP_*
+// environment variables. The stdout and file exporters write spans as JSON
+// and are intended for local testing.
+type Provider struct {
+	Exporter    string            `mapstructure:"exporter"`
+	Endpoint    string            `mapstructure:"endpoint"`
+	Insecure    bool              `mapstructure:"insecure"`
+	Headers     map[string]string `mapstructure:"headers"`
+	File        string            `mapstructure:"file"`
+	ServiceName string            `mapstructure:"serviceName"`
+	SampleRatio float64           `mapstructure:"sampleRatio"`
+
+	provider *sdktrace.TracerProvider
+	closer   io.Closer
+}
+
+// RequiresConfig always returns true. The provider must be configured with an
+// exporter.
+func (p *Provider) RequiresConfig() bool {
+	return true
+}
+
+// ConfigureString configures the exporter of the provider.
+func (p *Provider) ConfigureString(exporter string) error {
+	p.Exporter = exporter
+	return nil
+}
+
+// ConfigureMap configures the provider from a map.
+func (p *Provider) ConfigureMap(configMap map[string]interface{}) error {
+	return config.Decode(configMap, p)
+}
+
+// Validate checks that the exporter is supported and has the options it needs.
+func (p *Provider) Validate() error {
+	switch p.Exporter {
+	case ExporterOTLP, ExporterStdout:
+	case ExporterFile:
+		if p.File == "" {
+			return config.WithPath("file", errors.New("file is required by the file exporter"))
+		}
+	default:
+		return config.WithPath("exporter", fmt.Errorf("unsupported exporter %q", p.Exporter))
+	}
+
+	if p.SampleRatio < 0 || p.SampleRatio > 1 {
+		return config.WithPath("sampleRatio", errors.New("sampleRatio must be between 0 and 1"))
+	}
+	return nil
+}
+
+// Describe describes the configuration of the provider.
+func (p *Provider) Describe() *config.Schema {
+	exporter := &config.Schema{
+		Type:        "string",
+		Description: "The exporter that receives spans.",
+		Enum:        []interface{}{ExporterOTLP, ExporterStdout, ExporterFile},
+		Default:     ExporterOTLP,
+	}
+
+	return &config.Schema{
+		Description: "Exports OpenTelemetry spans for every input, middleware, and fn. A string configures the exporter.",
+		OneOf: []*config.Schema{
+			exporter,
+			{
+				Type: "object",
+				Properties: map[string]*config.Schema{
+					"exporter": exporter,
+					"endpoint": {
+						Type:        "string",
+						Description: "The URL of the OTLP/HTTP endpoint. Defaults to the OTEL_EXPORTER_OTLP_ENDPOINT environment variable or http://localhost:4318.",
+						Examples:    []interface{}{"http://localhost:4318"},
+					},
+					"insecure": {
+						Type:        "boolean",
+						Description: "Whether to send spans to the OTLP endpoint without TLS.",
+						Default:     false,
+					},
+					"headers": {
+						Type:                 "object",
+						Description:          "Headers sent with each OTLP export request.",
+						AdditionalProperties: &config.Schema{Type: "string"},
+					},
+					"file": {
+						Type:        "string",
+						Description: "The path of the file the file exporter appends spans to.",
+					},
+					"serviceName": {
+						Type:        "string",
+						Description: "The service name reported with spans.",
+						Default:     DefaultServiceName,
+					},
+					"sampleRatio": {
+						Type:        "number",
+						Description: "The fraction of new traces to sample. Inputs that continue a trace follow the sampling decision of their parent.",
+						Minimum:     config.Minimum(0),
+						Default:     1,
+					},
+				},
+				AdditionalProperties: config.NoAdditionalProperties(),
+			},
+		},
+	}
+}
+
+func (p *Provider) newExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	switch p.Exporter {
+	case ExporterStdout:
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+
+	case ExporterFile:
+		f, err := os.OpenFile(p.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		p.closer = f
+		return exporter, nil
+
+	default:
+		var opts []otlptracehttp.Option
+		if p.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(p.Endpoint))
+		}
+		if p.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		if len(p.Headers) > 0 {
+			opts = append(opts, otlptracehttp.WithHeaders(p.Headers))
+		}
+		return otlptracehttp.New(ctx, opts...)
+	}
+}
+
+// Start creates the exporter and installs the provider as the global tracer
+// provider.
+func (p *Provider) Start(ctx context.Context) error {
+	// The resource is built before the exporter, which may open a file, so
+	// that nothing is left open if it fails.
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		semconv.ServiceName(p.ServiceName),
+	))
+	if err != nil {
+		return err
+	}
+
+	exporter, err := p.newExporter(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Spans are written synchronously to local exporters so that they appear
+	// as soon as they end.
+	export := sdktrace.WithBatcher(exporter)
+	if p.Exporter != ExporterOTLP {
+		export = sdktrace.WithSyncer(exporter)
+	}
+
+	p.provider = sdktrace.NewTracerProvider(
+		export,
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(p.SampleRatio))),
+	)
+	otel.SetTracerProvider(p.provider)
+
+	return nil
+}
+
+// Close exports any buffered spans and shuts down the exporter.
+func (p *Provider) Close() error {
+	if p.provider == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	err := p.provider.Shutdown(ctx)
+	p.provider = nil
+	if p.closer != nil {
+		err = errors.Join(err, p.closer.Close())
+		p.closer = nil
+	}
+	return err
+}
+
+// NewProvider returns a provider that exports spans over OTLP.
+func NewProvider() *Provider {
+	return &Provider{
+		Exporter:    ExporterOTLP,
+		ServiceName: DefaultServiceName,
+		SampleRatio: 1,
+	}
+}
@@ -0,0 +1,72 @@
+package tracing_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fnrun/fnrun/run/config"
+	"github.com/fnrun/fnrun/run/tracing"
+	"go.opentelemetry.io/otel"
+)
+
+func TestProvider_Configure(t *testing.T) {
+	tests := []struct {
+		config  interface{}
+		wantErr string
+	}{
+		{config: "stdout"},
+		{config: map[string]interface{}{"endpoint": "http://localhost:4318", "sampleRatio": 0.5}},
+		{config: "zipkin", wantErr: `exporter: unsupported exporter "zipkin"`},
+		{config: map[string]interface{}{"exporter": "file"}, wantErr: "file: file is required by the file exporter"},
+		{config: map[string]interface{}{"sampleRatio": 2}, wantErr: "sampleRatio: sampleRatio must be between 0 and 1"},
+	}
+
+	for _, tt := range tests {
+		err := config.Configure(tracing.NewProvider(), tt.config)
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("config.Configure(%v) returned error: %+v", tt.config, err)
+		}
+		if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+			t.Errorf("unexpected error for %v: want %q, got %v", tt.config, tt.wantErr, err)
+		}
+	}
+}
+
+func TestProvider_fileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.json")
+
+	p := tracing.NewProvider()
+	err := config.Configure(p, map[string]interface{}{
+		"exporter":    "file",
+		"file":        path,
+		"serviceName": "orders",
+	})
+	if err != nil {
+		t.Fatalf("config.Configure returned error: %+v", err)
+	}
+
+	previous := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(previous)
+
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatalf("Start returned error: %+v", err)
+	}
+	_, span := tracing.Tracer().Start(context.Background(), "test span")
+	span.End()
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close returned error: %+v", err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("os.ReadFile returned error: %+v", err)
+	}
+	for _, want := range []string{`"Name":"test span"`, `"Value":"orders"`} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("expected exported spans to contain %s but got:\n%s", want, b)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Package tracing provides OpenTelemetry tracing for fnrun.
+//
+// Sources extract the trace context of each input they receive with
+// StartInput, the pipeline and fn loaders create a span for every middleware
+// and fn invocation, and fns that call other services inject the current trace
+// context into their requests with Inject or Environ. Trace context is
+// propagated in the W3C Trace Context and Baggage formats.
+//
+// Spans are created with the global OpenTelemetry tracer provider, which
+// discards them until a Provider is started. Trace context is propagated
+// whether or not spans are exported.
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"github.com/fnrun/fnrun/fn"
+	"github.com/fnrun/fnrun/run"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName is the name of the tracer used by fnrun.
+const InstrumentationName = "github.com/fnrun/fnrun"
+
+// ComponentKey is the attribute holding the registry key of the component
+// that created a span.
+const ComponentKey = attribute.Key("fnrun.component")
+
+var propagator = propagation.NewCompositeTextMapPropagator(
+	propagation.TraceContext{},
+	propagation.Baggage{},
+)
+
+// Tracer returns the tracer used by fnrun.
+func Tracer() trace.Tracer {
+	return otel.Tracer(InstrumentationName)
+}
+
+// Extract returns a copy of ctx containing the trace context in carrier.
+func Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	return propagator.Extract(ctx, carrier)
+}
+
+// Inject sets the trace context of ctx in carrier.
+func Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	propagator.Inject(ctx, carrier)
+}
+
+// Environ returns the trace context of ctx as environment variables in
+// KEY=value form, such as TRACEPARENT, for use by a child process.
+func Environ(ctx context.Context) []string {
+	carrier := propagation.MapCarrier{}
+	Inject(ctx, carrier)
+
+	env := make([]string, 0, len(carrier))
+	for _, key := range carrier.Keys() {
+		env = append(env, strings.ToUpper(key)+"="+carrier.Get(key))
+	}
+	return env
+}
+
+// Traceparent returns the W3C traceparent of the span in ctx, or an empty
+// string if ctx does not contain a valid span context.
+func Traceparent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// StartInput starts a span for an input received by a source. The span
+// continues the trace in carrier, if it contains one, and otherwise starts a
+// new trace. carrier may be nil.
+func StartInput(ctx context.Context, name string, kind trace.SpanKind, carrier propagation.TextMapCarrier, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if carrier != nil {
+		ctx = Extract(ctx, carrier)
+	}
+	return Tracer().Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+}
+
+// End records err, if it is not nil, on span and ends span.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Invoke invokes f in a span named key, which should be the registry key of f.
+func Invoke(ctx context.Context, key string, f fn.Fn, input interface{}) (interface{}, error) {
+	ctx, span := Tracer().Start(ctx, key, trace.WithAttributes(ComponentKey.String(key)))
+	output, err := f.Invoke(ctx, input)
+	End(span, err)
+	return output, err
+}
+
+type tracedMiddleware struct {
+	key        string
+	middleware run.Middleware
+}
+
+func (t *tracedMiddleware) Invoke(ctx context.Context, input interface{}, f fn.Fn) (interface{}, error) {
+	ctx, span := Tracer().Start(ctx, t.key, trace.WithAttributes(ComponentKey.String(t.key)))
+	output, err := t.middleware.Invoke(ctx, input, f)
+	End(span, err)
+	return output, err
+}
+
+// Middleware returns a middleware that invokes m in a span named key, which
+// should be the registry key of m. The span of m encloses the spans of the
+// middleware and fn that m invokes. The returned middleware does not start or
+// close m.
+func Middleware(key string, m run.Middleware) run.Middleware {
+	return &tracedMiddleware{key: key, middleware: m}
+}
@@ -0,0 +1,125 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/fnrun/fnrun/fn"
+	"github.com/fnrun/fnrun/run/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func remoteContext() context.Context {
+	return tracing.Extract(context.Background(), propagation.MapCarrier{"traceparent": traceparent})
+}
+
+// recordSpans installs a tracer provider that records spans for the duration
+// of the test.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	return recorder
+}
+
+func TestExtractAndInject(t *testing.T) {
+	carrier := propagation.MapCarrier{}
+	tracing.Inject(remoteContext(), carrier)
+
+	if got := carrier.Get("traceparent"); got != traceparent {
+		t.Errorf("unexpected traceparent: want %q, got %q", traceparent, got)
+	}
+}
+
+func TestEnviron(t *testing.T) {
+	want := []string{"TRACEPARENT=" + traceparent}
+	got := tracing.Environ(remoteContext())
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected environment: want %v, got %v", want, got)
+	}
+
+	if got := tracing.Environ(context.Background()); len(got) != 0 {
+		t.Errorf("expected no environment variables without a trace but got %v", got)
+	}
+}
+
+func TestTraceparent(t *testing.T) {
+	if got := tracing.Traceparent(remoteContext()); got != traceparent {
+		t.Errorf("unexpected traceparent: want %q, got %q", traceparent, got)
+	}
+	if got := tracing.Traceparent(context.Background()); got != "" {
+		t.Errorf("expected an empty traceparent without a trace but got %q", got)
+	}
+}
+
+func TestStartInput_continuesTrace(t *testing.T) {
+	recorder := recordSpans(t)
+
+	_, span := tracing.StartInput(context.Background(), "orders process", trace.SpanKindConsumer,
+		propagation.MapCarrier{"traceparent": traceparent})
+	tracing.End(span, nil)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span but got %d", len(spans))
+	}
+	got := spans[0]
+	if got.Name() != "orders process" || got.SpanKind() != trace.SpanKindConsumer {
+		t.Errorf("unexpected span: %q of kind %v", got.Name(), got.SpanKind())
+	}
+	if got.Parent().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || !got.Parent().IsRemote() {
+		t.Errorf("expected span to continue the remote trace but its parent is %+v", got.Parent())
+	}
+}
+
+func TestMiddleware_nestsSpans(t *testing.T) {
+	recorder := recordSpans(t)
+	errFailed := errors.New("failed")
+
+	m := tracing.Middleware("fnrun.middleware/test", fnMiddleware(func(ctx context.Context, input interface{}, f fn.Fn) (interface{}, error) {
+		return tracing.Invoke(ctx, "fnrun.fn/identity", f, input)
+	}))
+	f := fn.NewFnFromInvokeFunc(func(ctx context.Context, input interface{}) (interface{}, error) {
+		return nil, errFailed
+	})
+
+	if _, err := m.Invoke(context.Background(), "input", f); !errors.Is(err, errFailed) {
+		t.Fatalf("expected Invoke to return %v but got %v", errFailed, err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans but got %d", len(spans))
+	}
+	inner, outer := spans[0], spans[1]
+	if inner.Name() != "fnrun.fn/identity" || outer.Name() != "fnrun.middleware/test" {
+		t.Errorf("unexpected span names: %q, %q", inner.Name(), outer.Name())
+	}
+	if inner.Parent().SpanID() != outer.SpanContext().SpanID() {
+		t.Error("expected the fn span to be a child of the middleware span")
+	}
+	for _, span := range spans {
+		if span.Status().Code != codes.Error {
+			t.Errorf("expected span %q to have an error status but got %v", span.Name(), span.Status())
+		}
+	}
+}
+
+type fnMiddleware func(ctx context.Context, input interface{}, f fn.Fn) (interface{}, error)
+
+func (m fnMiddleware) Invoke(ctx context.Context, input interface{}, f fn.Fn) (interface{}, error) {
+	return m(ctx, input, f)
+}